@@ -0,0 +1,94 @@
+// Command clithings is every tool in the repository in one binary, each
+// as a subcommand that takes the same flags as its standalone build:
+//
+//	clithings publicip -store
+//	clithings dbtool query mydb --query="SELECT 1"
+//	clithings --version
+//
+// The tools log through utility/clog, so CLITHINGS_LOG_LEVEL and
+// CLITHINGS_LOG_FORMAT apply to all of them, and exit with the status their
+// standalone binaries would.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"cli-things/internal/cloudflarebackup"
+	"cli-things/internal/dbtoolcli"
+	"cli-things/internal/envanonymizer"
+	"cli-things/internal/internalip"
+	"cli-things/internal/publicip"
+	"cli-things/internal/xata2pg"
+	"cli-things/utility/buildinfo"
+	"cli-things/utility/cli"
+	"cli-things/utility/clog"
+	"cli-things/utility/exitcode"
+)
+
+var logger = clog.New(os.Stderr, "clithings")
+
+// tool is one subcommand.
+type tool struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// tools are the subcommands, in the order help lists them.
+var tools = []tool{
+	{"cloudflare-backup", "back up Cloudflare accounts, zones and DNS records to Postgres", cloudflarebackup.Run},
+	{"dbtool", "manage Postgres databases: query, dump, load, migrate and more", dbtoolcli.Run},
+	{"env-anonymizer", "generate, check and compare .env.example files", envanonymizer.Run},
+	{"internalip", "print and store the host's internal IP addresses", internalip.Run},
+	{"publicip", "print and store the public IP address; sync Cloudflare A records", publicip.Run},
+	{"xata2pg", "migrate Xata Postgres databases into a local server", xata2pg.Run},
+}
+
+func main() { cli.Main(run) }
+
+// run dispatches args, the command line without the program name, to the
+// tool it names. Flags in front of the tool name are clithings' own.
+func run(args []string) error {
+	fs := flag.NewFlagSet("clithings", flag.ContinueOnError)
+	showVersion := buildinfo.AddFlag(fs)
+	fs.Usage = func() { usage(fs.Output()) }
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if showVersion.Requested() {
+		return buildinfo.Print(os.Stdout, "clithings", showVersion.JSON())
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return cli.Exit(exitcode.ConfigError, nil)
+	}
+	name := args[0]
+	if name == "help" {
+		if len(args) == 1 {
+			usage(os.Stdout)
+			return nil
+		}
+		// "clithings help dbtool" is "clithings dbtool -h".
+		name, args = args[1], []string{name, "-h"}
+	}
+	for _, t := range tools {
+		if t.name == name {
+			return t.run(args[1:])
+		}
+	}
+	return cli.Report(cli.Usagef("unknown tool %q; run 'clithings help' for the list", name), logger.Error)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: clithings [--version] <tool> [flags] [args]")
+	fmt.Fprintln(w, "\nTools:")
+	for _, t := range tools {
+		fmt.Fprintf(w, "  %-18s %s\n", t.name, t.summary)
+	}
+	fmt.Fprintln(w, "\nEach tool takes the flags of its standalone binary; run 'clithings help <tool>' for them.")
+	exitcode.Write(w)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli-things/utility/cli"
+	"cli-things/utility/dbconf"
+	"cli-things/utility/exitcode"
+)
+
+func TestRun(t *testing.T) {
+	for _, c := range []struct {
+		args []string
+		want int
+	}{
+		{nil, exitcode.ConfigError},
+		{[]string{"help"}, exitcode.OK},
+		{[]string{"--version"}, exitcode.OK},
+		{[]string{"nosuch"}, exitcode.ConfigError},
+		{[]string{"help", "nosuch"}, exitcode.ConfigError},
+		// The tool's own flag parsing decides these.
+		{[]string{"help", "publicip"}, exitcode.OK},
+		{[]string{"publicip", "-bogus"}, exitcode.ConfigError},
+		{[]string{"publicip", "-ipv4", "-ipv6"}, exitcode.ConfigError},
+		{[]string{"env-anonymizer", "-sort", "nosuch"}, exitcode.ConfigError},
+		{[]string{"dbtool", "nosuch"}, exitcode.ConfigError},
+		{[]string{"cloudflare-backup", "--interval=-1s"}, exitcode.ConfigError},
+		// The deadline passes before any provider is asked.
+		{[]string{"publicip", "-timeout=1ns"}, exitcode.Timeout},
+	} {
+		if got := cli.Code(run(c.args)); got != c.want {
+			t.Errorf("clithings %q: exit %d, want %d", c.args, got, c.want)
+		}
+	}
+}
+
+func TestCloudflareBackupConfigError(t *testing.T) {
+	// An unreadable config.ini is reported as such, not taken for "no
+	// config" and a missing CLOUDFLARE_API_KEY.
+	t.Setenv("DBTOOL_CONFIG_FILE", filepath.Join(t.TempDir(), "missing.ini"))
+	t.Setenv("CLOUDFLARE_API_KEY", "test-token")
+	dbconf.Reload()
+	t.Cleanup(dbconf.Reload)
+	args := []string{"cloudflare-backup", "--dry-run", "--timeout=1ns"}
+	err := run(args)
+	if got := cli.Code(err); got != exitcode.ConfigError || err == nil || !strings.Contains(err.Error(), "missing.ini") {
+		t.Errorf("clithings %q: exit %d (%v), want %d naming missing.ini", args, got, err, exitcode.ConfigError)
+	}
+}
+
+func TestToolNamesUnique(t *testing.T) {
+	seen := map[string]bool{"help": true}
+	for _, tl := range tools {
+		if seen[tl.name] {
+			t.Errorf("tool %q is listed twice or shadows help", tl.name)
+		}
+		seen[tl.name] = true
+	}
+}
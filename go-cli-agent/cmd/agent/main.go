@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"cli-things/go-cli-agent/internal/agent"
+	"cli-things/go-cli-agent/internal/logging"
+	"cli-things/utility/buildinfo"
+)
+
+func main() {
+	verbose := flag.Bool("verbose", false, "Enable verbose output")
+	logfile := flag.String("logfile", "", "Specify a logfile to write logs")
+	logfileMaxSize := flag.Int64("logfile-max-size", 10, "Rotate --logfile when it reaches this many megabytes (0 never rotates)")
+	logfileKeep := flag.Int("logfile-keep", 3, "Rotated log files to keep")
+	logPrompts := flag.Bool("log-prompts", false, "Log prompts and replies, not only request metadata")
+	auto := flag.Bool("auto", false, "Enable automatic mode")
+	model := flag.String("model", "", "Model to use (overrides OPENROUTER_MODEL)")
+	baseURL := flag.String("base-url", "", "API base URL (overrides OPENROUTER_BASE_URL)")
+	system := flag.String("system", "", "System prompt (overrides AGENT_SYSTEM_PROMPT)")
+	promptFile := flag.String("prompt-file", "", "Read the prompt from this file")
+	noTools := flag.Bool("no-tools", false, "Do not offer tools to the model")
+	allowExec := flag.Bool("allow-exec", false, "Offer the run_command tool, which runs shell commands")
+	maxToolIterations := flag.Int("max-tool-iterations", agent.DefaultMaxToolIterations, "Most requests per prompt while the model calls tools")
+	jsonOut := flag.Bool("json", false, "Print each reply, or the model list, as JSON")
+	listModels := flag.Bool("list-models", false, "List the available models and exit")
+	filter := flag.String("filter", "", "With --list-models, only models whose id or name contains this")
+	noValidate := flag.Bool("no-validate", false, "Do not check the model against the API's model list")
+	useCache := flag.Bool("cache", false, "Answer prompts seen before from the cache in AGENT_CACHE_DIR")
+	noCache := flag.Bool("no-cache", false, "Do not use the cache, even with --cache")
+	cacheTTL := flag.Duration("cache-ttl", 24*time.Hour, "How long cached replies are served (0 keeps them forever)")
+	temperature := flag.Float64("temperature", -1, "Sampling temperature (the model's default when not set)")
+	noStream := flag.Bool("no-stream", false, "Wait for the whole reply instead of streaming it")
+	batch := flag.String("batch", "", "Run each prompt of this file (one per line, or JSONL with id and prompt; - for stdin)")
+	concurrency := flag.Int("concurrency", agent.DefaultConcurrency, "With --batch, prompts sent at once")
+	output := flag.String("output", "", "With --batch, write the JSONL results to this file instead of stdout")
+	showVersion := buildinfo.AddFlag(flag.CommandLine)
+
+	flag.Parse()
+
+	if showVersion.Requested() {
+		buildinfo.Print(os.Stdout, "go-cli-agent", showVersion.JSON() || *jsonOut)
+		return
+	}
+
+	if *verbose {
+		fmt.Fprintln(os.Stderr, "Verbose mode enabled")
+	}
+
+	logs, err := logging.Setup(logging.Options{
+		File:    *logfile,
+		MaxSize: *logfileMaxSize << 20,
+		Keep:    *logfileKeep,
+		Verbose: *verbose,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	defer logs.Close()
+
+	cfg, err := agent.ResolveConfig(agent.Config{Model: *model, BaseURL: *baseURL, SystemPrompt: *system})
+	if errors.Is(err, agent.ErrNoAPIKey) && *listModels {
+		// The model list is public.
+		err = nil
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if *verbose {
+		// Never the key itself, only where it was found.
+		fmt.Fprintf(os.Stderr, "Model: %s (%s)\n", cfg.Model, cfg.Sources["OPENROUTER_MODEL"])
+		fmt.Fprintf(os.Stderr, "Base URL: %s (%s)\n", cfg.BaseURL, cfg.Sources["OPENROUTER_BASE_URL"])
+		fmt.Fprintf(os.Stderr, "API key: set (%s)\n", cfg.Sources["OPENROUTER_API_KEY"])
+		if cfg.SystemPrompt != "" {
+			fmt.Fprintf(os.Stderr, "System prompt: %d characters (%s)\n", len(cfg.SystemPrompt), cfg.Sources["AGENT_SYSTEM_PROMPT"])
+		}
+	}
+
+	// Ctrl-C cancels the request in flight rather than killing the process
+	// mid-write.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *listModels {
+		models, err := agent.New(cfg.BaseURL, cfg.APIKey, cfg.Model).CachedModels(ctx, true)
+		if err == nil {
+			err = agent.PrintModels(os.Stdout, agent.FilterModels(models, *filter), *jsonOut)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if !*noValidate {
+		models, err := agent.New(cfg.BaseURL, cfg.APIKey, cfg.Model).CachedModels(ctx, false)
+		if err != nil {
+			// Not worth refusing to chat over.
+			fmt.Fprintln(os.Stderr, "Warning: could not check the model:", err)
+		} else if err := agent.ValidateModel(cfg.Model, models); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	var cache *agent.Cache
+	if *useCache && !*noCache {
+		cache = &agent.Cache{Dir: cfg.CacheDir, TTL: *cacheTTL}
+	}
+	var temp *float64
+	if *temperature >= 0 {
+		temp = temperature
+	}
+
+	var tools *agent.Registry
+	if !*noTools {
+		tools = agent.NewRegistry(*allowExec)
+	}
+
+	opts := agent.Options{
+		Auto:              *auto,
+		Args:              flag.Args(),
+		PromptFile:        *promptFile,
+		System:            cfg.SystemPrompt,
+		NoStream:          *noStream,
+		JSON:              *jsonOut,
+		LogPrompts:        *logPrompts,
+		Temperature:       temp,
+		Cache:             cache,
+		APIKey:            cfg.APIKey,
+		Model:             cfg.Model,
+		BaseURL:           cfg.BaseURL,
+		Tools:             tools,
+		MaxToolIterations: *maxToolIterations,
+	}
+	if *batch != "" {
+		if code := runBatch(ctx, opts, *batch, *output, *concurrency); code != 0 {
+			os.Exit(code)
+		}
+		return
+	}
+
+	err = agent.Run(ctx, opts)
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		os.Exit(130)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// runBatch runs --batch and returns the exit status: 1 when the batch
+// could not run or any of its prompts failed.
+func runBatch(ctx context.Context, opts agent.Options, path, output string, concurrency int) int {
+	in := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	items, err := agent.ReadBatch(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+		return 1
+	}
+
+	out := os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	summary, err := agent.RunBatch(ctx, opts, items, concurrency, out)
+	fmt.Fprintln(os.Stderr, summary)
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		return 130
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	if summary.Failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -1,8 +0,0 @@
-module go-cli-agent
-
-go 1.18
-
-require (
-    github.com/some/openrouter-sdk v1.0.0
-    // Add other dependencies here as needed
-)
\ No newline at end of file
@@ -0,0 +1,525 @@
+// Package agent implements the chat loop against an OpenRouter compatible
+// API.
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"cli-things/go-cli-agent/internal/openrouter"
+	"cli-things/utility/buildinfo"
+)
+
+const (
+	// DefaultBaseURL is OpenRouter's API root.
+	DefaultBaseURL = "https://openrouter.ai/api/v1"
+	// DefaultModel lets OpenRouter pick a model when OPENROUTER_MODEL is
+	// not set.
+	DefaultModel = "openrouter/auto"
+)
+
+// Options configure Run.
+type Options struct {
+	// Auto keeps a multi-turn conversation going, one user message per
+	// line of In, until EOF.
+	Auto bool
+	// Args are the positional arguments; joined, they are the first prompt.
+	Args []string
+	// PromptFile, when set, holds the prompt instead of Args.
+	PromptFile string
+	// System is sent first as the system message.
+	System string
+	// NoStream waits for the whole reply instead of printing it as it
+	// streams in.
+	NoStream bool
+	// JSON prints each reply as a JSON object with the model, finish
+	// reason, token usage, latency and estimated cost; when streaming, it
+	// is preceded by one {"type":"delta"} line per piece of the reply.
+	JSON bool
+	// APIKey is required; Model and BaseURL default to DefaultModel and
+	// DefaultBaseURL. ResolveConfig finds all three.
+	APIKey, Model, BaseURL string
+	// Tools are offered to the model; nil disables tool calling. Unless
+	// Auto is set, each call is confirmed with Confirm (TerminalConfirm
+	// when nil).
+	Tools   *Registry
+	Confirm func(call openrouter.ToolCall) bool
+	// MaxToolIterations bounds the requests per prompt while the model
+	// calls tools (DefaultMaxToolIterations when 0).
+	MaxToolIterations int
+	// LogPrompts logs prompts and replies along with the request metadata.
+	LogPrompts bool
+	// Temperature is sent with each request when set.
+	Temperature *float64
+	// Cache, when set, answers prompts seen before from disk.
+	Cache *Cache
+	// HistoryFile keeps the lines entered in the interactive mode
+	// (DefaultHistoryFile when empty).
+	HistoryFile string
+	// In, Out and Err default to the process's stdin, stdout and stderr.
+	In       io.Reader
+	Out, Err io.Writer
+}
+
+// Message is one chat message. An assistant message may ask for tool
+// calls instead of answering; each result then goes back as a "tool"
+// message naming the call it answers.
+type Message struct {
+	Role       string                `json:"role"`
+	Content    string                `json:"content"`
+	ToolCalls  []openrouter.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string                `json:"tool_call_id,omitempty"`
+}
+
+type chatRequest struct {
+	Model    string     `json:"model"`
+	Messages []Message  `json:"messages"`
+	Tools    []toolSpec `json:"tools,omitempty"`
+	// Temperature is left to the API's default when nil.
+	Temperature *float64 `json:"temperature,omitempty"`
+	// Usage asks OpenRouter to include the cost in the usage it reports.
+	Usage *usageOption `json:"usage,omitempty"`
+}
+
+type usageOption struct {
+	Include bool `json:"include"`
+}
+
+type chatResponse struct {
+	ID      string            `json:"id"`
+	Model   string            `json:"model"`
+	Choices []chatChoice      `json:"choices"`
+	Usage   *openrouter.Usage `json:"usage"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type chatChoice struct {
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason"`
+}
+
+// DefaultMaxToolIterations bounds the requests one prompt may make while
+// the model keeps calling tools.
+const DefaultMaxToolIterations = 10
+
+// Agent holds a conversation with one model.
+type Agent struct {
+	client   *openrouter.APIClient
+	model    string
+	messages []Message
+
+	// Tools are offered to the model when set.
+	Tools *Registry
+	// MaxToolIterations is the most requests a prompt may take while the
+	// model calls tools (DefaultMaxToolIterations when 0).
+	MaxToolIterations int
+	// Confirm is asked before each tool call; nil runs them unasked.
+	Confirm func(call openrouter.ToolCall) bool
+	// Accounting asks for the cost of each request, for Result.Cost.
+	Accounting bool
+	// LogPrompts adds the prompt and reply to the api_request log event,
+	// which otherwise only has metadata.
+	LogPrompts bool
+	// Temperature is sent with each request when set.
+	Temperature *float64
+	// Cache, when set, answers a prompt seen before without a request.
+	Cache *Cache
+}
+
+// New returns an Agent talking to model at baseURL with apiKey, which may be
+// empty for public endpoints such as /models.
+func New(baseURL, apiKey, model string) *Agent {
+	client := openrouter.NewAPIClient(strings.TrimRight(baseURL, "/"))
+	client.SetHeader("User-Agent", buildinfo.UserAgent("go-cli-agent"))
+	if apiKey != "" {
+		client.SetHeader("Authorization", "Bearer "+apiKey)
+	}
+	return &Agent{client: client, model: model}
+}
+
+// Send adds prompt to the conversation as a user message and returns the
+// assistant's reply, which is added too. Tool calls the model makes on the
+// way are run and answered first.
+func (a *Agent) Send(ctx context.Context, prompt string) (Result, error) {
+	return a.converse(ctx, prompt, nil)
+}
+
+// Stream is Send with the reply passed to onDelta piece by piece as it
+// arrives. Cancelling ctx aborts the request; the conversation is then left
+// as it was.
+func (a *Agent) Stream(ctx context.Context, prompt string, onDelta func(string)) (Result, error) {
+	return a.converse(ctx, prompt, onDelta)
+}
+
+// converse sends prompt and keeps answering the model's tool calls until it
+// replies without any. The conversation only keeps the exchange once it is
+// complete.
+func (a *Agent) converse(ctx context.Context, prompt string, onDelta func(string)) (Result, error) {
+	messages := append(a.messages[:len(a.messages):len(a.messages)], Message{Role: "user", Content: prompt})
+	limit := a.MaxToolIterations
+	if limit <= 0 {
+		limit = DefaultMaxToolIterations
+	}
+	var res Result
+	start := time.Now()
+	var cacheKey string
+	if a.Cache != nil {
+		cacheKey = a.Cache.Key(a.newRequest(messages))
+		if c, created, ok := a.Cache.load(cacheKey); ok {
+			slog.Info("cache_hit", "key", cacheKey, "created", created)
+			if onDelta != nil && c.reply.Content != "" {
+				onDelta(c.reply.Content)
+			}
+			res.add(c)
+			res.Requests = 0
+			res.Cached, res.CachedAt = true, created
+			res.Latency = time.Since(start)
+			if a.Accounting {
+				res.Cost = new(float64)
+			}
+			a.messages = append(messages, c.reply)
+			return res, nil
+		}
+	}
+	for i := 1; ; i++ {
+		c, err := a.complete(ctx, messages, onDelta)
+		res.add(c)
+		res.Latency = time.Since(start)
+		if err != nil {
+			return res, err
+		}
+		messages = append(messages, c.reply)
+		if len(c.reply.ToolCalls) == 0 {
+			a.messages = messages
+			// A reply that needed tools depends on more than the prompt.
+			if a.Cache != nil && i == 1 && c.finishReason != "error" {
+				if err := a.Cache.store(cacheKey, c); err != nil {
+					slog.Warn("cache_store_failed", "key", cacheKey, "error", err)
+				}
+			}
+			if a.Accounting {
+				res.Cost = a.cost(ctx, res.completions)
+			}
+			return res, nil
+		}
+		if i >= limit {
+			return res, fmt.Errorf("model still calling tools after %d requests (raise --max-tool-iterations)", limit)
+		}
+		for _, call := range c.reply.ToolCalls {
+			messages = append(messages, Message{Role: "tool", ToolCallID: call.ID, Content: a.runTool(ctx, call)})
+		}
+	}
+}
+
+// completion is one request's reply and its metadata.
+type completion struct {
+	reply        Message
+	id, model    string
+	finishReason string
+	usage        *openrouter.Usage
+	raw          []byte // the response body, when not streamed
+}
+
+// complete makes one chat completion request, streamed when onDelta is set,
+// and logs it as an api_request event.
+func (a *Agent) complete(ctx context.Context, messages []Message, onDelta func(string)) (completion, error) {
+	start := time.Now()
+	c, status, err := a.request(ctx, messages, onDelta)
+	attrs := []any{
+		"request_id", newRequestID(),
+		"model", a.model,
+		"stream", onDelta != nil,
+		"messages", len(messages),
+		"latency_ms", time.Since(start).Milliseconds(),
+	}
+	if status != 0 {
+		attrs = append(attrs, "status", status)
+	}
+	if c.id != "" {
+		attrs = append(attrs, "generation_id", c.id)
+	}
+	if c.finishReason != "" {
+		attrs = append(attrs, "finish_reason", c.finishReason)
+	}
+	if c.usage != nil {
+		attrs = append(attrs, "prompt_tokens", c.usage.PromptTokens, "completion_tokens", c.usage.CompletionTokens)
+	}
+	if len(c.reply.ToolCalls) > 0 {
+		attrs = append(attrs, "tool_calls", len(c.reply.ToolCalls))
+	}
+	if a.LogPrompts {
+		attrs = append(attrs, "prompt", messages[len(messages)-1].Content, "reply", c.reply.Content)
+	}
+	if err != nil {
+		slog.Error("api_request", append(attrs, "error", err)...)
+	} else {
+		slog.Info("api_request", attrs...)
+	}
+	return c, err
+}
+
+// newRequestID tells the log lines of one request apart; the API's own
+// generation id is only known once it answers.
+func newRequestID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// request makes the request for complete and returns the HTTP status, 0
+// when no response was read.
+func (a *Agent) request(ctx context.Context, messages []Message, onDelta func(string)) (completion, int, error) {
+	req := a.newRequest(messages)
+	if onDelta != nil {
+		var content strings.Builder
+		result, err := a.client.PostStream(ctx, "chat/completions", req, func(delta string) {
+			content.WriteString(delta)
+			onDelta(delta)
+		})
+		c := completion{
+			reply:        Message{Role: "assistant", Content: content.String(), ToolCalls: result.ToolCalls},
+			id:           result.ID,
+			model:        result.Model,
+			finishReason: result.FinishReason,
+			usage:        result.Usage,
+		}
+		if ctx.Err() != nil {
+			return c, result.Status, ctx.Err()
+		}
+		return c, result.Status, err
+	}
+
+	resp, err := a.client.Post(ctx, "chat/completions", req)
+	if err != nil {
+		return completion{}, 0, err
+	}
+	status := resp.StatusCode
+	body, err := openrouter.HandleResponse(resp)
+	if err != nil {
+		return completion{}, status, err
+	}
+	c, err := decodeCompletion(body)
+	return c, status, err
+}
+
+// newRequest is the completion request for messages.
+func (a *Agent) newRequest(messages []Message) chatRequest {
+	req := chatRequest{Model: a.model, Messages: messages, Temperature: a.Temperature}
+	if a.Tools != nil {
+		req.Tools = a.Tools.specs()
+	}
+	if a.Accounting {
+		req.Usage = &usageOption{Include: true}
+	}
+	return req
+}
+
+// decodeCompletion reads a non-streamed completion response.
+func decodeCompletion(body []byte) (completion, error) {
+	var parsed chatResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return completion{}, fmt.Errorf("decoding response: %w", err)
+	}
+	if parsed.Error != nil {
+		return completion{}, fmt.Errorf("API error: %s", parsed.Error.Message)
+	}
+	if len(parsed.Choices) == 0 {
+		return completion{}, errors.New("API returned no choices")
+	}
+	return completion{
+		reply:        parsed.Choices[0].Message,
+		id:           parsed.ID,
+		model:        parsed.Model,
+		finishReason: parsed.Choices[0].FinishReason,
+		usage:        parsed.Usage,
+		raw:          body,
+	}, nil
+}
+
+// Run sends the prompt from opts.Args or PromptFile and prints the reply to
+// Out as it streams in. Unless Auto is set, In is read too when it is not a
+// terminal: with no other prompt it is the prompt, otherwise it is attached
+// to the prompt as input, so that `git diff | agent "write a commit
+// message"` works. With no prompt and In a terminal, Run is an interactive
+// session with slash commands instead. With Auto, Run reads further prompts
+// from In, one per line, until EOF. Cancelling ctx aborts the request in
+// flight.
+func Run(ctx context.Context, opts Options) error {
+	a, err := setup(&opts)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(opts.Out)
+	enc.SetEscapeHTML(false)
+
+	send := func(prompt string) error {
+		if opts.JSON {
+			var res Result
+			var err error
+			if opts.NoStream {
+				res, err = a.Send(ctx, prompt)
+			} else {
+				res, err = a.Stream(ctx, prompt, func(delta string) {
+					enc.Encode(jsonDelta{Type: "delta", Content: delta})
+				})
+			}
+			if err != nil {
+				return err
+			}
+			return enc.Encode(res.json())
+		}
+		if opts.NoStream {
+			res, err := a.Send(ctx, prompt)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(opts.Out, res.Content)
+			return nil
+		}
+		res, err := a.Stream(ctx, prompt, func(delta string) {
+			fmt.Fprint(opts.Out, delta)
+		})
+		if res.Content != "" || err == nil {
+			fmt.Fprintln(opts.Out)
+		}
+		return err
+	}
+
+	prompt := strings.TrimSpace(strings.Join(opts.Args, " "))
+	if opts.PromptFile != "" {
+		if prompt != "" {
+			return errors.New("give the prompt as arguments or with --prompt-file, not both")
+		}
+		b, err := os.ReadFile(opts.PromptFile)
+		if err != nil {
+			return fmt.Errorf("reading prompt file: %w", err)
+		}
+		prompt = strings.TrimSpace(string(b))
+	}
+	if !opts.Auto {
+		if prompt == "" && isTerminal(opts.In) {
+			return repl(ctx, a, opts, send)
+		}
+		if prompt == "" || !isTerminal(opts.In) {
+			b, err := io.ReadAll(opts.In)
+			if err != nil {
+				return fmt.Errorf("reading stdin: %w", err)
+			}
+			prompt = attachInput(prompt, string(b))
+		}
+		if prompt == "" {
+			return errors.New("no prompt given (pass it as arguments, with --prompt-file or on stdin)")
+		}
+		return send(prompt)
+	}
+
+	if prompt != "" {
+		if err := send(prompt); err != nil {
+			return err
+		}
+	}
+	scanner := bufio.NewScanner(opts.In)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for ctx.Err() == nil && scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := send(line); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return scanner.Err()
+}
+
+// attachInput adds input, such as a piped diff, to the instruction between
+// delimiters the model cannot mistake for part of the instruction. Either
+// may be empty.
+func attachInput(instruction, input string) string {
+	input = strings.TrimRight(input, "\n")
+	switch {
+	case strings.TrimSpace(input) == "":
+		return instruction
+	case instruction == "":
+		return strings.TrimSpace(input)
+	}
+	return instruction + "\n\n--- BEGIN INPUT ---\n" + input + "\n--- END INPUT ---"
+}
+
+// isTerminal reports whether r is a terminal, as stdin is when nothing is
+// piped in.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// setup fills in the defaults of opts and returns the Agent it describes.
+func setup(opts *Options) (*Agent, error) {
+	if opts.In == nil {
+		opts.In = os.Stdin
+	}
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+	if opts.Err == nil {
+		opts.Err = os.Stderr
+	}
+	if opts.APIKey == "" {
+		return nil, errors.New("no API key given")
+	}
+	if opts.Model == "" {
+		opts.Model = DefaultModel
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultBaseURL
+	}
+	if opts.HistoryFile == "" {
+		opts.HistoryFile = DefaultHistoryFile()
+	}
+	a := New(opts.BaseURL, opts.APIKey, opts.Model)
+	if opts.System != "" {
+		a.messages = append(a.messages, Message{Role: "system", Content: opts.System})
+	}
+	a.Tools = opts.Tools
+	a.MaxToolIterations = opts.MaxToolIterations
+	a.LogPrompts = opts.LogPrompts
+	a.Temperature = opts.Temperature
+	a.Cache = opts.Cache
+	if !opts.Auto {
+		a.Confirm = opts.Confirm
+		if a.Confirm == nil {
+			a.Confirm = TerminalConfirm
+		}
+	}
+	if opts.JSON {
+		a.Accounting = true
+	}
+	return a, nil
+}
+
+// fork is a copy of a that shares its client, and so its connections, with
+// a conversation of its own starting from a's.
+func (a *Agent) fork() *Agent {
+	b := *a
+	b.messages = a.messages[:len(a.messages):len(a.messages)]
+	return &b
+}
@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Keep the api_request events out of the test output.
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+func chatServer(t *testing.T, handler func(w http.ResponseWriter, req chatRequest)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("path = %q, want /chat/completions", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.Header.Get("User-Agent"); !strings.HasPrefix(got, "go-cli-agent/") {
+			t.Errorf("User-Agent = %q", got)
+		}
+		var req struct {
+			chatRequest
+			Stream bool `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decoding request: %v", err)
+		}
+		if req.Stream {
+			// Answer the non-streaming handlers' replies as a stream.
+			rec := httptest.NewRecorder()
+			handler(rec, req.chatRequest)
+			if rec.Code != http.StatusOK {
+				w.WriteHeader(rec.Code)
+				w.Write(rec.Body.Bytes())
+				return
+			}
+			var resp chatResponse
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			streamReply(w, resp.Choices[0].Message)
+			return
+		}
+		handler(w, req.chatRequest)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func reply(w http.ResponseWriter, content string) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"choices": []interface{}{map[string]interface{}{
+			"message": Message{Role: "assistant", Content: content},
+		}},
+	})
+}
+
+// streamReply sends msg as server-sent events: its content one word per
+// chunk, then each tool call with its arguments split in two.
+func streamReply(w http.ResponseWriter, msg Message) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprint(w, ": OPENROUTER PROCESSING\n\n")
+	send := func(delta interface{}) {
+		chunk, _ := json.Marshal(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"index": 0, "delta": delta}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", chunk)
+	}
+	if msg.Content != "" {
+		for _, word := range strings.SplitAfter(msg.Content, " ") {
+			send(map[string]string{"content": word})
+		}
+	}
+	for i, call := range msg.ToolCalls {
+		args := call.Function.Arguments
+		half := len(args) / 2
+		send(map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+			"index": i, "id": call.ID, "type": "function",
+			"function": map[string]string{"name": call.Function.Name, "arguments": args[:half]},
+		}}})
+		send(map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+			"index": i, "function": map[string]string{"arguments": args[half:]},
+		}}})
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func TestRunPrompt(t *testing.T) {
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		if req.Model != "test/model" || len(req.Messages) != 1 || req.Messages[0].Content != "hello there" {
+			t.Errorf("unexpected request %+v", req)
+		}
+		reply(w, "hi!")
+	})
+	var out bytes.Buffer
+	err := Run(context.Background(), Options{Args: []string{"hello", "there"}, NoStream: true, APIKey: "sk-test", Model: "test/model", BaseURL: srv.URL,
+		In: strings.NewReader(""), Out: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hi!\n" {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestRunAutoKeepsConversation(t *testing.T) {
+	var turns []int
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		turns = append(turns, len(req.Messages))
+		reply(w, "re: "+req.Messages[len(req.Messages)-1].Content)
+	})
+	var out bytes.Buffer
+	err := Run(context.Background(), Options{Auto: true, APIKey: "sk-test", BaseURL: srv.URL,
+		In: strings.NewReader("one\n\ntwo\n"), Out: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "re: one\nre: two\n" {
+		t.Errorf("output = %q", out.String())
+	}
+	if len(turns) != 2 || turns[0] != 1 || turns[1] != 3 {
+		t.Errorf("messages per request = %v, want [1 3]", turns)
+	}
+}
+
+func TestRunSurfacesAPIError(t *testing.T) {
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"message":"No auth credentials found","code":401}}`))
+	})
+	for _, noStream := range []bool{true, false} {
+		err := Run(context.Background(), Options{Args: []string{"hi"}, NoStream: noStream, APIKey: "sk-test", BaseURL: srv.URL, Out: &bytes.Buffer{}})
+		if err == nil || !strings.Contains(err.Error(), "No auth credentials found") || !strings.Contains(err.Error(), "401") {
+			t.Fatalf("noStream=%v: err = %v", noStream, err)
+		}
+		if strings.Contains(err.Error(), "sk-test") {
+			t.Errorf("error leaks the API key: %v", err)
+		}
+	}
+}
+
+func TestStreamDeltas(t *testing.T) {
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		reply(w, "streamed reply here")
+	})
+	a := New(srv.URL, "sk-test", "test/model")
+	var deltas []string
+	res, err := a.Stream(context.Background(), "hi", func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Content != "streamed reply here" || len(deltas) != 3 || deltas[0] != "streamed " {
+		t.Errorf("reply = %q, deltas = %q", res.Content, deltas)
+	}
+	if len(a.messages) != 2 || a.messages[1].Content != res.Content {
+		t.Errorf("conversation = %+v", a.messages)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	started := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"partial\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	a := New(srv.URL, "sk-test", "test/model")
+	_, err := a.Stream(ctx, "hi", func(string) {})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want cancellation", err)
+	}
+	if len(a.messages) != 0 {
+		t.Errorf("cancelled turn kept in conversation: %+v", a.messages)
+	}
+}
+
+func TestRunComposesPrompt(t *testing.T) {
+	promptFile := filepath.Join(t.TempDir(), "prompt.txt")
+	os.WriteFile(promptFile, []byte("summarize\n"), 0o600)
+	for _, c := range []struct {
+		name string
+		opts Options
+		want []Message
+	}{
+		{"stdin attached", Options{Args: []string{"write", "a", "commit", "message"}, System: "be terse", In: strings.NewReader("+added\n-removed\n")},
+			[]Message{{Role: "system", Content: "be terse"}, {Role: "user", Content: "write a commit message\n\n--- BEGIN INPUT ---\n+added\n-removed\n--- END INPUT ---"}}},
+		{"stdin alone", Options{In: strings.NewReader("  what is 2+2?\n")},
+			[]Message{{Role: "user", Content: "what is 2+2?"}}},
+		{"prompt file", Options{PromptFile: promptFile, In: strings.NewReader("")},
+			[]Message{{Role: "user", Content: "summarize"}}},
+	} {
+		var got []Message
+		srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+			got = req.Messages
+			reply(w, "ok")
+		})
+		c.opts.APIKey, c.opts.BaseURL, c.opts.Out, c.opts.NoStream = "sk-test", srv.URL, io.Discard, true
+		if err := Run(context.Background(), c.opts); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: messages = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRunPromptFileAndArgs(t *testing.T) {
+	err := Run(context.Background(), Options{Args: []string{"hi"}, PromptFile: "p.txt", APIKey: "sk-test", In: strings.NewReader("")})
+	if err == nil || !strings.Contains(err.Error(), "not both") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultConcurrency is the number of batch prompts in flight at once.
+const DefaultConcurrency = 4
+
+// BatchItem is one prompt of a batch file.
+type BatchItem struct {
+	ID     string `json:"id"`
+	Prompt string `json:"prompt"`
+}
+
+// BatchResult is one line of the batch output.
+type BatchResult struct {
+	ID           string    `json:"id"`
+	PromptHash   string    `json:"prompt_hash"`
+	Response     string    `json:"response"`
+	Model        string    `json:"model,omitempty"`
+	FinishReason string    `json:"finish_reason,omitempty"`
+	Usage        jsonUsage `json:"usage"`
+	Cached       bool      `json:"cached,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// BatchSummary counts the outcomes of a batch.
+type BatchSummary struct {
+	Succeeded, Failed int
+	Usage             jsonUsage
+}
+
+func (s BatchSummary) String() string {
+	return fmt.Sprintf("%d prompts: %d succeeded, %d failed; tokens: %d prompt, %d completion, %d total",
+		s.Succeeded+s.Failed, s.Succeeded, s.Failed, s.Usage.PromptTokens, s.Usage.CompletionTokens, s.Usage.TotalTokens)
+}
+
+// ReadBatch reads one prompt per line: either plain text, whose id is its
+// line number, or a JSON object with "prompt" and an optional "id". Blank
+// lines are skipped.
+func ReadBatch(r io.Reader) ([]BatchItem, error) {
+	var items []BatchItem
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		item := BatchItem{Prompt: line}
+		if strings.HasPrefix(line, "{") {
+			var obj struct {
+				ID     json.RawMessage `json:"id"`
+				Prompt string          `json:"prompt"`
+			}
+			if err := json.Unmarshal([]byte(line), &obj); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			if strings.TrimSpace(obj.Prompt) == "" {
+				return nil, fmt.Errorf("line %d: no \"prompt\"", n)
+			}
+			item.Prompt = obj.Prompt
+			// Ids may be strings or numbers.
+			var id string
+			if json.Unmarshal(obj.ID, &id) != nil {
+				id = string(obj.ID)
+			}
+			item.ID = id
+		}
+		if item.ID == "" {
+			item.ID = strconv.Itoa(n)
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
+
+// RunBatch sends each item as a conversation of its own, at most
+// concurrency at a time, and writes one BatchResult per item to out as
+// JSONL, in the order of items. A failed prompt is reported in its result
+// and does not stop the others; the retry policy of the client applies to
+// every request. Tools are not offered in a batch.
+func RunBatch(ctx context.Context, opts Options, items []BatchItem, concurrency int, out io.Writer) (BatchSummary, error) {
+	opts.Tools = nil
+	base, err := setup(&opts)
+	if err != nil {
+		return BatchSummary{}, err
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	// Workers hand their result to the collector, which alone owns results.
+	type done struct {
+		i int
+		r *BatchResult
+	}
+	results := make([]*BatchResult, len(items))
+	finished := make(chan done)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	go func() {
+		for i := range items {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				finished <- done{i, runBatchItem(ctx, base.fork(), items[i])}
+			}(i)
+		}
+		wg.Wait()
+		close(finished)
+	}()
+
+	// Write results in input order as soon as all earlier ones are in.
+	var summary BatchSummary
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	next := 0
+	var writeErr error
+	for d := range finished {
+		results[d.i] = d.r
+		for next < len(results) && results[next] != nil {
+			r := results[next]
+			if r.Error != "" {
+				summary.Failed++
+			} else {
+				summary.Succeeded++
+			}
+			summary.Usage.PromptTokens += r.Usage.PromptTokens
+			summary.Usage.CompletionTokens += r.Usage.CompletionTokens
+			summary.Usage.TotalTokens += r.Usage.TotalTokens
+			if writeErr == nil {
+				writeErr = enc.Encode(r)
+			}
+			next++
+		}
+	}
+	if writeErr != nil {
+		return summary, fmt.Errorf("writing results: %w", writeErr)
+	}
+	return summary, ctx.Err()
+}
+
+func runBatchItem(ctx context.Context, a *Agent, item BatchItem) *BatchResult {
+	sum := sha256.Sum256([]byte(item.Prompt))
+	r := &BatchResult{ID: item.ID, PromptHash: hex.EncodeToString(sum[:])}
+	res, err := a.Send(ctx, item.Prompt)
+	r.Response, r.Model, r.FinishReason, r.Cached = res.Content, res.Model, res.FinishReason, res.Cached
+	r.Usage = jsonUsage{res.Usage.PromptTokens, res.Usage.CompletionTokens, res.Usage.TotalTokens}
+	if err != nil {
+		r.Error = err.Error()
+		slog.Warn("batch_item_failed", "id", item.ID, "error", err)
+	}
+	return r
+}
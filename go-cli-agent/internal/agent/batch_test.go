@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadBatch(t *testing.T) {
+	items, err := ReadBatch(strings.NewReader("first prompt\n\n{\"id\":\"b\",\"prompt\":\"second\"}\n{\"id\":7,\"prompt\":\"third\"}\n{\"prompt\":\"fourth\"}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BatchItem{{"1", "first prompt"}, {"b", "second"}, {"7", "third"}, {"5", "fourth"}}
+	if len(items) != len(want) {
+		t.Fatalf("items = %+v", items)
+	}
+	for i := range want {
+		if items[i] != want[i] {
+			t.Errorf("item %d = %+v, want %+v", i, items[i], want[i])
+		}
+	}
+
+	if _, err := ReadBatch(strings.NewReader("ok\n{\"id\":\"x\"}\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("missing prompt: err = %v", err)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, most := 0, 0
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		mu.Lock()
+		inFlight++
+		most = max(most, inFlight)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		if len(req.Tools) != 0 || len(req.Messages) != 1 {
+			t.Errorf("unexpected request %+v", req)
+		}
+		prompt := req.Messages[0].Content
+		if prompt == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"bad prompt"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": Message{Role: "assistant", Content: "re: " + prompt}}},
+			"usage":   map[string]int{"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5},
+		})
+	})
+
+	items := []BatchItem{{"a", "one"}, {"b", "fail"}, {"c", "two"}, {"d", "three"}, {"e", "four"}}
+	var out bytes.Buffer
+	summary, err := RunBatch(context.Background(), Options{APIKey: "sk-test", BaseURL: srv.URL, Tools: NewRegistry(false)}, items, 2, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if most > 2 {
+		t.Errorf("%d requests in flight, want at most 2", most)
+	}
+	if summary.Succeeded != 4 || summary.Failed != 1 || summary.Usage.TotalTokens != 20 {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	var results []BatchResult
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var r BatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("%q: %v", scanner.Text(), err)
+		}
+		results = append(results, r)
+	}
+	if len(results) != len(items) {
+		t.Fatalf("%d results, want %d", len(results), len(items))
+	}
+	for i, r := range results {
+		if r.ID != items[i].ID || len(r.PromptHash) != 64 {
+			t.Errorf("result %d = %+v", i, r)
+		}
+	}
+	if results[0].Response != "re: one" || results[0].Usage.TotalTokens != 5 || results[0].Error != "" {
+		t.Errorf("first result = %+v", results[0])
+	}
+	if results[1].Response != "" || !strings.Contains(results[1].Error, "bad prompt") {
+		t.Errorf("failed result = %+v", results[1])
+	}
+}
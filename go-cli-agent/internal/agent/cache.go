@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cache keeps replies on disk, one JSON file per request, so re-running the
+// same prompt does not cost another request.
+type Cache struct {
+	Dir string
+	// TTL is how long an entry is served; 0 keeps entries forever.
+	TTL time.Duration
+}
+
+// DefaultCacheDir is ~/.cache/go-cli-agent, or its equivalent under
+// XDG_CACHE_HOME or on other systems.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "go-cli-agent-cache")
+	}
+	return filepath.Join(dir, "go-cli-agent")
+}
+
+// cacheEntry is what a cache file holds: the API's response and when it
+// was stored.
+type cacheEntry struct {
+	Created  time.Time       `json:"created"`
+	Response json.RawMessage `json:"response"`
+}
+
+// Key is the hash of what decides a reply: the model, the messages
+// (including the system prompt), the temperature and the tools offered.
+func (c *Cache) Key(req chatRequest) string {
+	b, _ := json.Marshal(struct {
+		Model       string     `json:"model"`
+		Messages    []Message  `json:"messages"`
+		Temperature *float64   `json:"temperature"`
+		Tools       []toolSpec `json:"tools"`
+	}{req.Model, req.Messages, req.Temperature, req.Tools})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+// load returns the cached completion for key unless it is missing, expired
+// or unreadable.
+func (c *Cache) load(key string) (completion, time.Time, bool) {
+	b, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return completion{}, time.Time{}, false
+	}
+	var e cacheEntry
+	if json.Unmarshal(b, &e) != nil {
+		return completion{}, time.Time{}, false
+	}
+	if c.TTL > 0 && time.Since(e.Created) > c.TTL {
+		return completion{}, time.Time{}, false
+	}
+	comp, err := decodeCompletion(e.Response)
+	if err != nil || len(comp.reply.ToolCalls) > 0 {
+		return completion{}, time.Time{}, false
+	}
+	return comp, e.Created, true
+}
+
+// store saves comp under key: the response body as the API sent it, or for
+// a streamed reply the equivalent non-streamed response.
+func (c *Cache) store(key string, comp completion) error {
+	resp := comp.raw
+	if resp == nil {
+		var err error
+		resp, err = json.Marshal(chatResponse{
+			ID:    comp.id,
+			Model: comp.model,
+			Choices: []chatChoice{{
+				Message:      comp.reply,
+				FinishReason: comp.finishReason,
+			}},
+			Usage: comp.usage,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(cacheEntry{Created: time.Now().UTC(), Response: resp})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0o700); err != nil {
+		return err
+	}
+	tmp := c.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path(key))
+}
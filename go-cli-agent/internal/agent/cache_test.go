@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheServesRepeatedPrompt(t *testing.T) {
+	inTempDir(t)
+	quietLog(t)
+	requests := 0
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		requests++
+		reply(w, "cached answer")
+	})
+	cache := &Cache{Dir: t.TempDir(), TTL: time.Hour}
+
+	for i, noStream := range []bool{true, true, false} {
+		var out bytes.Buffer
+		err := Run(context.Background(), Options{Args: []string{"same", "prompt"}, NoStream: noStream, JSON: true,
+			APIKey: "sk-test", BaseURL: srv.URL, Out: &out, Cache: cache})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got jsonResult
+		lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+		if err := json.Unmarshal(lines[len(lines)-1], &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Content != "cached answer" || got.Cached != (i > 0) || (got.CachedAt != nil) != (i > 0) {
+			t.Errorf("run %d: result = %+v", i, got)
+		}
+		if i > 0 && (got.Requests != 0 || got.CostUSD == nil || *got.CostUSD != 0) {
+			t.Errorf("run %d: a cache hit should report no requests and no cost: %+v", i, got)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1", requests)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	c := &Cache{}
+	base := chatRequest{Model: "m", Messages: []Message{{Role: "user", Content: "hi"}}}
+	temp := 0.2
+	for name, other := range map[string]chatRequest{
+		"model":       {Model: "n", Messages: base.Messages},
+		"system":      {Model: "m", Messages: []Message{{Role: "system", Content: "terse"}, {Role: "user", Content: "hi"}}},
+		"temperature": {Model: "m", Messages: base.Messages, Temperature: &temp},
+	} {
+		if c.Key(other) == c.Key(base) {
+			t.Errorf("%s does not change the key", name)
+		}
+	}
+	withUsage := base
+	withUsage.Usage = &usageOption{Include: true}
+	if c.Key(withUsage) != c.Key(base) {
+		t.Error("usage accounting changes the key")
+	}
+}
+
+func TestCacheSkipsToolCallsAndExpired(t *testing.T) {
+	inTempDir(t)
+	quietLog(t)
+	dir := t.TempDir()
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		if req.Messages[len(req.Messages)-1].Role == "user" {
+			toolCallReply(w, "read_file", `{"path":"notes.txt"}`)
+			return
+		}
+		reply(w, "done")
+	})
+	a := New(srv.URL, "sk-test", "m")
+	a.Tools = NewRegistry(false)
+	a.Cache = &Cache{Dir: dir}
+	if _, err := a.Send(context.Background(), "read it"); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 0 {
+		t.Errorf("cached a reply that needed tools: %v", files)
+	}
+
+	c := &Cache{Dir: dir, TTL: time.Minute}
+	comp := completion{reply: Message{Role: "assistant", Content: "old"}}
+	if err := c.store("k", comp); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := c.load("k"); !ok {
+		t.Fatal("fresh entry not loaded")
+	}
+	old := time.Now().Add(-time.Hour)
+	b, _ := json.Marshal(cacheEntry{Created: old, Response: json.RawMessage(`{"choices":[{"message":{"role":"assistant","content":"old"}}]}`)})
+	os.WriteFile(filepath.Join(dir, "k.json"), b, 0o600)
+	if _, _, ok := c.load("k"); ok {
+		t.Error("expired entry loaded")
+	}
+	if _, _, ok := (&Cache{Dir: dir}).load("k"); !ok {
+		t.Error("entry not loaded without a TTL")
+	}
+}
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"errors"
+	"strings"
+
+	"cli-things/utility/dbconf"
+)
+
+// ErrNoAPIKey is ResolveConfig's error when no OPENROUTER_API_KEY is found.
+var ErrNoAPIKey = errors.New("OPENROUTER_API_KEY is not set (environment, .env or config.ini)")
+
+// Config is the resolved API key, model, base URL, system prompt and cache
+// directory, with
+// where each came from: "flag", "env", ".env <path>", "config.ini <path>"
+// or "default".
+type Config struct {
+	APIKey, Model, BaseURL string
+	SystemPrompt           string
+	CacheDir               string
+	Sources                map[string]string
+}
+
+// ResolveConfig looks OPENROUTER_API_KEY, OPENROUTER_MODEL,
+// OPENROUTER_BASE_URL, AGENT_SYSTEM_PROMPT and AGENT_CACHE_DIR up in the
+// process environment, the nearest .env files and
+// ~/.config/<folder>/config.ini, in that order, the way dbconf resolves the
+// other utilities' settings. The non-empty fields of flags (from --model,
+// --base-url and --system) override all of them.
+func ResolveConfig(flags Config) (Config, error) {
+	raw, err := dbconf.GetRawConfigWithSources()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg := Config{Sources: map[string]string{}}
+	lookup := func(key, flagValue, def string) string {
+		if v := strings.TrimSpace(flagValue); v != "" {
+			cfg.Sources[key] = "flag"
+			return v
+		}
+		if rv, ok := raw[key]; ok && strings.TrimSpace(rv.Value) != "" {
+			cfg.Sources[key] = strings.TrimSpace(rv.Source + " " + rv.File)
+			return strings.TrimSpace(rv.Value)
+		}
+		if def != "" {
+			cfg.Sources[key] = "default"
+		}
+		return def
+	}
+	cfg.APIKey = lookup("OPENROUTER_API_KEY", "", "")
+	cfg.Model = lookup("OPENROUTER_MODEL", flags.Model, DefaultModel)
+	cfg.BaseURL = strings.TrimRight(lookup("OPENROUTER_BASE_URL", flags.BaseURL, DefaultBaseURL), "/")
+	cfg.SystemPrompt = lookup("AGENT_SYSTEM_PROMPT", flags.SystemPrompt, "")
+	cfg.CacheDir = lookup("AGENT_CACHE_DIR", flags.CacheDir, DefaultCacheDir())
+	if cfg.APIKey == "" {
+		return cfg, ErrNoAPIKey
+	}
+	return cfg, nil
+}
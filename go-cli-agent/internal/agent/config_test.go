@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli-things/utility/dbconf"
+)
+
+// configDir points dbconf at a config.ini and a .env in a fresh directory
+// and clears the variables ResolveConfig reads.
+func configDir(t *testing.T, ini, dotEnv string) string {
+	t.Helper()
+	dir := t.TempDir()
+	iniPath := filepath.Join(dir, "config.ini")
+	if err := os.WriteFile(iniPath, []byte(ini), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(dotEnv), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	t.Setenv("DBTOOL_CONFIG_FILE", iniPath)
+	t.Setenv("DBCONF_DOTENV_MAX_DEPTH", "0")
+	for _, k := range []string{"OPENROUTER_API_KEY", "OPENROUTER_MODEL", "OPENROUTER_BASE_URL", "AGENT_SYSTEM_PROMPT", "AGENT_CACHE_DIR"} {
+		// Setenv restores the variable afterwards, including one a .env
+		// file set during the test.
+		t.Setenv(k, "")
+		os.Unsetenv(k)
+	}
+	dbconf.Reload()
+	t.Cleanup(dbconf.Reload)
+	return dir
+}
+
+func TestResolveConfigPrecedence(t *testing.T) {
+	configDir(t,
+		"[default]\nOPENROUTER_API_KEY=sk-ini\nOPENROUTER_MODEL=ini/model\nOPENROUTER_BASE_URL=http://ini\nAGENT_SYSTEM_PROMPT=You are terse.\n",
+		"OPENROUTER_MODEL=dotenv/model\nOPENROUTER_BASE_URL=http://dotenv\n")
+	os.Setenv("OPENROUTER_BASE_URL", "http://env/")
+
+	cfg, err := ResolveConfig(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.APIKey != "sk-ini" || cfg.Model != "dotenv/model" || cfg.BaseURL != "http://env" || cfg.SystemPrompt != "You are terse." {
+		t.Errorf("ResolveConfig = key %q model %q base %q system %q, want config.ini's key and system prompt, .env's model, env's base URL",
+			cfg.APIKey, cfg.Model, cfg.BaseURL, cfg.SystemPrompt)
+	}
+	if src := cfg.Sources["OPENROUTER_API_KEY"]; !strings.HasPrefix(src, "config.ini ") {
+		t.Errorf("key source = %q", src)
+	}
+	if src := cfg.Sources["OPENROUTER_BASE_URL"]; src != "env" {
+		t.Errorf("base URL source = %q", src)
+	}
+
+	cfg, err = ResolveConfig(Config{Model: "flag/model", BaseURL: "http://flag", SystemPrompt: "be brief"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Model != "flag/model" || cfg.BaseURL != "http://flag" || cfg.SystemPrompt != "be brief" || cfg.Sources["OPENROUTER_MODEL"] != "flag" {
+		t.Errorf("flags did not override: %+v", cfg.Sources)
+	}
+}
+
+func TestResolveConfigDefaults(t *testing.T) {
+	configDir(t, "[default]\n", "OPENROUTER_API_KEY=sk-dotenv\n")
+	cfg, err := ResolveConfig(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.APIKey != "sk-dotenv" || cfg.Model != DefaultModel || cfg.BaseURL != DefaultBaseURL {
+		t.Errorf("ResolveConfig = %q %q %q", cfg.APIKey, cfg.Model, cfg.BaseURL)
+	}
+	if cfg.Sources["OPENROUTER_MODEL"] != "default" {
+		t.Errorf("model source = %q", cfg.Sources["OPENROUTER_MODEL"])
+	}
+}
+
+func TestResolveConfigNoKey(t *testing.T) {
+	configDir(t, "[default]\n", "")
+	if _, err := ResolveConfig(Config{}); err == nil {
+		t.Fatal("ResolveConfig without a key succeeded")
+	}
+}
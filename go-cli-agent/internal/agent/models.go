@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cli-things/go-cli-agent/internal/openrouter"
+)
+
+// ModelsCacheTTL is how long CachedModels trusts its copy of /models.
+var ModelsCacheTTL = time.Hour
+
+// ModelInfo is one entry of OpenRouter's /models. Prices are USD per token,
+// as strings, the way the API sends them.
+type ModelInfo struct {
+	ID            string `json:"id"`
+	Name          string `json:"name,omitempty"`
+	ContextLength int    `json:"context_length"`
+	Pricing       struct {
+		Prompt     string `json:"prompt"`
+		Completion string `json:"completion"`
+	} `json:"pricing"`
+}
+
+// ListModels fetches the models the API offers, sorted by id.
+func (a *Agent) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	resp, err := a.client.Get(ctx, "models")
+	if err != nil {
+		return nil, err
+	}
+	body, err := openrouter.HandleResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	var parsed struct {
+		Data []ModelInfo `json:"data"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("decoding models: %w", err)
+	}
+	sort.Slice(parsed.Data, func(i, j int) bool { return parsed.Data[i].ID < parsed.Data[j].ID })
+	return parsed.Data, nil
+}
+
+// CachedModels is ListModels through a file in the temporary directory, one
+// per base URL, refreshed after ModelsCacheTTL. With refresh set the file is
+// rewritten without being read. A cache that cannot be written is only
+// slower.
+func (a *Agent) CachedModels(ctx context.Context, refresh bool) ([]ModelInfo, error) {
+	sum := sha256.Sum256([]byte(a.client.BaseURL))
+	path := filepath.Join(os.TempDir(), "go-cli-agent-models-"+hex.EncodeToString(sum[:6])+".json")
+	if !refresh {
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) < ModelsCacheTTL {
+			if b, err := os.ReadFile(path); err == nil {
+				var models []ModelInfo
+				if json.Unmarshal(b, &models) == nil && len(models) > 0 {
+					return models, nil
+				}
+			}
+		}
+	}
+	models, err := a.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if b, err := json.Marshal(models); err == nil {
+		tmp := path + ".tmp"
+		if os.WriteFile(tmp, b, 0o600) == nil {
+			os.Rename(tmp, path)
+		}
+	}
+	return models, nil
+}
+
+// FilterModels keeps the models whose id or name contains filter, ignoring
+// case.
+func FilterModels(models []ModelInfo, filter string) []ModelInfo {
+	filter = strings.ToLower(strings.TrimSpace(filter))
+	if filter == "" {
+		return models
+	}
+	var out []ModelInfo
+	for _, m := range models {
+		if strings.Contains(strings.ToLower(m.ID), filter) || strings.Contains(strings.ToLower(m.Name), filter) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// PrintModels writes models as a table of id, context length and prices
+// per million tokens, or as a JSON array.
+func PrintModels(w io.Writer, models []ModelInfo, asJSON bool) error {
+	if asJSON {
+		if models == nil {
+			models = []ModelInfo{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(models)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCONTEXT\tPROMPT $/M\tCOMPLETION $/M")
+	for _, m := range models {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", m.ID, m.ContextLength, perMillion(m.Pricing.Prompt), perMillion(m.Pricing.Completion))
+	}
+	return tw.Flush()
+}
+
+// perMillion turns a per-token USD price into the per-million-token price
+// people compare.
+func perMillion(perToken string) string {
+	f, err := strconv.ParseFloat(perToken, 64)
+	switch {
+	case err != nil || f < 0:
+		return "-"
+	case f == 0:
+		return "free"
+	}
+	return strconv.FormatFloat(f*1e6, 'f', -1, 64)
+}
+
+// ValidateModel checks model against the list, accepting variant suffixes
+// such as ":free" or ":online" of a listed id, and suggests the closest id
+// on a typo.
+func ValidateModel(model string, models []ModelInfo) error {
+	base := model
+	if i := strings.LastIndex(model, ":"); i > 0 {
+		base = model[:i]
+	}
+	best, bestDist := "", -1
+	for _, m := range models {
+		if m.ID == model || m.ID == base {
+			return nil
+		}
+		if d := editDistance(strings.ToLower(model), strings.ToLower(m.ID)); bestDist < 0 || d < bestDist {
+			best, bestDist = m.ID, d
+		}
+	}
+	if best != "" && bestDist <= len(model)/3+1 {
+		return fmt.Errorf("unknown model %q; did you mean %q? (--no-validate skips this check)", model, best)
+	}
+	return fmt.Errorf("unknown model %q; see --list-models (--no-validate skips this check)", model)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const modelsJSON = `{"data":[
+	{"id":"openai/gpt-4o-mini","name":"OpenAI: GPT-4o-mini","context_length":128000,"pricing":{"prompt":"0.00000015","completion":"0.0000006"}},
+	{"id":"anthropic/claude-3.5-sonnet","name":"Anthropic: Claude 3.5 Sonnet","context_length":200000,"pricing":{"prompt":"0.000003","completion":"0.000015"}},
+	{"id":"meta-llama/llama-3.1-8b-instruct","name":"Meta: Llama 3.1 8B Instruct","context_length":131072,"pricing":{"prompt":"0","completion":"0"}}
+]}`
+
+func modelsServer(t *testing.T) (*httptest.Server, *int) {
+	t.Helper()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		requests++
+		fmt.Fprint(w, modelsJSON)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestCachedModels(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	srv, requests := modelsServer(t)
+	a := New(srv.URL, "", "")
+
+	for i := 0; i < 2; i++ {
+		models, err := a.CachedModels(context.Background(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(models) != 3 || models[0].ID != "anthropic/claude-3.5-sonnet" || models[0].ContextLength != 200000 {
+			t.Fatalf("models = %+v, want the three sorted by id", models)
+		}
+	}
+	if *requests != 1 {
+		t.Errorf("requests = %d, want the second call served from the cache", *requests)
+	}
+	if _, err := a.CachedModels(context.Background(), true); err != nil || *requests != 2 {
+		t.Errorf("refresh: err %v, requests %d", err, *requests)
+	}
+}
+
+func TestPrintModels(t *testing.T) {
+	srv, _ := modelsServer(t)
+	models, err := New(srv.URL, "", "").ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := PrintModels(&out, FilterModels(models, "LLAMA"), false); err != nil {
+		t.Fatal(err)
+	}
+	want := "ID                                CONTEXT  PROMPT $/M  COMPLETION $/M\n" +
+		"meta-llama/llama-3.1-8b-instruct  131072   free        free\n"
+	if out.String() != want {
+		t.Errorf("table =\n%s\nwant\n%s", out.String(), want)
+	}
+	out.Reset()
+	PrintModels(&out, FilterModels(models, "gpt-4o"), false)
+	if !strings.Contains(out.String(), "openai/gpt-4o-mini  128000   0.15        0.6\n") {
+		t.Errorf("table =\n%s", out.String())
+	}
+	out.Reset()
+	PrintModels(&out, FilterModels(models, "no such model"), true)
+	if out.String() != "[]\n" {
+		t.Errorf("empty JSON = %q", out.String())
+	}
+}
+
+func TestValidateModel(t *testing.T) {
+	srv, _ := modelsServer(t)
+	models, err := New(srv.URL, "", "").ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ok := range []string{"openai/gpt-4o-mini", "meta-llama/llama-3.1-8b-instruct:free"} {
+		if err := ValidateModel(ok, models); err != nil {
+			t.Errorf("ValidateModel(%q) = %v", ok, err)
+		}
+	}
+	err = ValidateModel("openai/gpt4o-mini", models)
+	if err == nil || !strings.Contains(err.Error(), `did you mean "openai/gpt-4o-mini"?`) {
+		t.Errorf("typo: err = %v", err)
+	}
+	err = ValidateModel("acme/unheard-of", models)
+	if err == nil || strings.Contains(err.Error(), "did you mean") || !strings.Contains(err.Error(), "--list-models") {
+		t.Errorf("unknown: err = %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// maxHistory is how many lines the history file keeps.
+const maxHistory = 1000
+
+// DefaultHistoryFile is where the REPL keeps the lines entered across runs:
+// $XDG_DATA_HOME/go-cli-agent/history, else
+// ~/.local/share/go-cli-agent/history.
+func DefaultHistoryFile() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "go-cli-agent", "history")
+}
+
+const replHelp = `Commands:
+  /model [name]   show or switch the model
+  /system [text]  set the system prompt, or remove it when empty
+  /save <file>    write the conversation to a Markdown file
+  /clear          forget the conversation, keeping the system prompt
+  /help           show this help
+  /quit           leave (or Ctrl-D)
+`
+
+// repl is the interactive mode: it reads prompts with readline and its
+// history until /quit or EOF, streaming each reply with send. A failed
+// request is reported and the session goes on; cancelling ctx ends it.
+func repl(ctx context.Context, a *Agent, opts Options, send func(prompt string) error) error {
+	if opts.HistoryFile != "" {
+		// readline creates the file but not its directory, and world-readable;
+		// the prompts may well be private.
+		if err := createHistoryFile(opts.HistoryFile); err != nil {
+			slog.Warn("history_file_unusable", "file", opts.HistoryFile, "error", err)
+		}
+	}
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:                 "> ",
+		HistoryFile:            opts.HistoryFile,
+		HistoryLimit:           maxHistory,
+		DisableAutoSaveHistory: true,
+		InterruptPrompt:        "^C",
+		Stdin:                  readline.NewCancelableStdin(opts.In),
+		Stdout:                 opts.Err,
+		Stderr:                 opts.Err,
+		FuncIsTerminal:         func() bool { return isTerminal(opts.In) },
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+
+	fmt.Fprintf(opts.Err, "Chatting with %s. /help lists the commands, /quit or Ctrl-D leaves.\n", a.model)
+	for ctx.Err() == nil {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := rl.SaveHistory(line); err != nil {
+			slog.Warn("history_write_failed", "file", opts.HistoryFile, "error", err)
+		}
+
+		if strings.HasPrefix(line, "/") {
+			quit, err := a.command(line, opts.Err)
+			if err != nil {
+				fmt.Fprintln(opts.Err, "Error:", err)
+			}
+			if quit {
+				return nil
+			}
+			continue
+		}
+		if err := send(line); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			fmt.Fprintln(opts.Err, "Error:", err)
+		}
+	}
+	return ctx.Err()
+}
+
+// createHistoryFile makes the history file and its directory, private to
+// the user, unless it is already there.
+func createHistoryFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// command runs a REPL slash command, reporting to out, and says whether it
+// ends the session.
+func (a *Agent) command(line string, out io.Writer) (quit bool, err error) {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/quit", "/exit":
+		return true, nil
+	case "/help":
+		fmt.Fprint(out, replHelp)
+	case "/model":
+		if arg != "" {
+			a.model = arg
+		}
+		fmt.Fprintln(out, "Model:", a.model)
+	case "/system":
+		a.setSystem(arg)
+		if arg == "" {
+			fmt.Fprintln(out, "System prompt removed")
+		} else {
+			fmt.Fprintf(out, "System prompt set (%d characters)\n", len(arg))
+		}
+	case "/clear":
+		a.messages = a.messages[:a.systemLen():a.systemLen()]
+		fmt.Fprintln(out, "Conversation cleared")
+	case "/save":
+		if arg == "" {
+			return false, errors.New("usage: /save <file>")
+		}
+		if err := os.WriteFile(arg, []byte(a.transcript(time.Now())), 0o644); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(out, "Saved %d messages to %s\n", len(a.messages), arg)
+	default:
+		return false, fmt.Errorf("unknown command %s (/help lists them)", name)
+	}
+	return false, nil
+}
+
+// systemLen is 1 when the conversation starts with a system message.
+func (a *Agent) systemLen() int {
+	if len(a.messages) > 0 && a.messages[0].Role == "system" {
+		return 1
+	}
+	return 0
+}
+
+// setSystem replaces the system message, removing it when text is empty.
+func (a *Agent) setSystem(text string) {
+	rest := a.messages[a.systemLen():]
+	if text == "" {
+		a.messages = append([]Message(nil), rest...)
+		return
+	}
+	a.messages = append([]Message{{Role: "system", Content: text}}, rest...)
+}
+
+// transcript renders the conversation as Markdown, one section per message.
+func (a *Agent) transcript(now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Conversation with %s\n\n_Saved %s_\n", a.model, now.Format("2006-01-02 15:04"))
+	for _, m := range a.messages {
+		switch m.Role {
+		case "system":
+			b.WriteString("\n## System\n\n")
+		case "user":
+			b.WriteString("\n## User\n\n")
+		case "assistant":
+			b.WriteString("\n## Assistant\n\n")
+		case "tool":
+			fence := codeFence(m.Content)
+			fmt.Fprintf(&b, "\n## Tool result\n\n%s\n%s\n%s\n", fence, strings.TrimRight(m.Content, "\n"), fence)
+			continue
+		}
+		if m.Content != "" {
+			b.WriteString(strings.TrimRight(m.Content, "\n") + "\n")
+		}
+		for _, call := range m.ToolCalls {
+			fmt.Fprintf(&b, "\n_Called `%s` with `%s`_\n", call.Function.Name, call.Function.Arguments)
+		}
+	}
+	return b.String()
+}
+
+// codeFence is a run of backticks longer than any in s, so s can be quoted
+// verbatim.
+func codeFence(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplCommands(t *testing.T) {
+	var models []string
+	var sizes []int
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		models = append(models, req.Model)
+		sizes = append(sizes, len(req.Messages))
+		if req.Messages[0].Role == "system" && req.Messages[0].Content != "be brief" {
+			t.Errorf("system message = %q", req.Messages[0].Content)
+		}
+		reply(w, "re: "+req.Messages[len(req.Messages)-1].Content)
+	})
+	dir := t.TempDir()
+	script := strings.Join([]string{
+		"hello",
+		"/model other/model",
+		"again",
+		"/system be brief",
+		"/save " + filepath.Join(dir, "chat.md"),
+		"/clear",
+		"after",
+		"/bogus",
+		"/quit",
+		"never sent",
+	}, "\n")
+	opts := Options{APIKey: "sk-test", Model: "test/model", BaseURL: srv.URL, HistoryFile: filepath.Join(dir, "history"),
+		In: strings.NewReader(script), Out: &bytes.Buffer{}, Err: &bytes.Buffer{}}
+	a, err := setup(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replies []string
+	send := func(prompt string) error {
+		res, err := a.Stream(context.Background(), prompt, func(string) {})
+		replies = append(replies, res.Content)
+		return err
+	}
+	if err := repl(context.Background(), a, opts, send); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(replies, "|") != "re: hello|re: again|re: after" {
+		t.Errorf("replies = %q", replies)
+	}
+	if strings.Join(models, " ") != "test/model other/model other/model" {
+		t.Errorf("models = %v", models)
+	}
+	// /clear keeps only the system prompt set before it.
+	if len(sizes) != 3 || sizes[1] != 3 || sizes[2] != 2 {
+		t.Errorf("messages per request = %v, want [1 3 2]", sizes)
+	}
+	if errOut := opts.Err.(*bytes.Buffer).String(); !strings.Contains(errOut, "unknown command /bogus") {
+		t.Errorf("stderr = %q", errOut)
+	}
+
+	md, err := os.ReadFile(filepath.Join(dir, "chat.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# Conversation with other/model", "## System\n\nbe brief\n", "## User\n\nhello\n", "## Assistant\n\nre: again\n"} {
+		if !strings.Contains(string(md), want) {
+			t.Errorf("transcript lacks %q:\n%s", want, md)
+		}
+	}
+
+	hist, _ := os.ReadFile(filepath.Join(dir, "history"))
+	if lines := strings.Split(strings.TrimSpace(string(hist)), "\n"); len(lines) != 9 || lines[0] != "hello" || lines[8] != "/quit" {
+		t.Errorf("history = %q", hist)
+	}
+}
+
+func TestReplKeepsGoingAfterError(t *testing.T) {
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		if req.Messages[len(req.Messages)-1].Content == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"bad request"}}`))
+			return
+		}
+		reply(w, "ok")
+	})
+	var stderr bytes.Buffer
+	opts := Options{APIKey: "sk-test", BaseURL: srv.URL, HistoryFile: filepath.Join(t.TempDir(), "history"),
+		In: strings.NewReader("fail\nfine\n"), Out: &bytes.Buffer{}, Err: &stderr}
+	a, err := setup(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := 0
+	send := func(prompt string) error {
+		sent++
+		_, err := a.Send(context.Background(), prompt)
+		return err
+	}
+	if err := repl(context.Background(), a, opts, send); err != nil {
+		t.Fatal(err)
+	}
+	if sent != 2 || !strings.Contains(stderr.String(), "Error: API error (HTTP 400): bad request") {
+		t.Errorf("sent %d, stderr = %q", sent, stderr.String())
+	}
+	if len(a.messages) != 2 {
+		t.Errorf("conversation = %+v, want only the exchange that worked", a.messages)
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) { reply(w, "ok") })
+	path := filepath.Join(t.TempDir(), "sub", "history")
+	for _, in := range []string{"one\ntwo\ntwo\n", "three\n"} {
+		opts := Options{APIKey: "sk-test", BaseURL: srv.URL, HistoryFile: path,
+			In: strings.NewReader(in), Out: &bytes.Buffer{}, Err: &bytes.Buffer{}}
+		a, err := setup(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		send := func(prompt string) error {
+			_, err := a.Send(context.Background(), prompt)
+			return err
+		}
+		if err := repl(context.Background(), a, opts, send); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(b)); strings.Join(got, ",") != "one,two,three" {
+		t.Errorf("history file = %q", b)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("history file: %v, %v", fi, err)
+	}
+}
@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"cli-things/go-cli-agent/internal/openrouter"
+)
+
+// Result is the outcome of one prompt: the final reply and what it took,
+// over all the requests a prompt made while the model called tools.
+type Result struct {
+	Content      string
+	Model        string // the model that answered, as the API reports it
+	FinishReason string
+	Usage        openrouter.Usage // token counts summed over the requests
+	Requests     int
+	Latency      time.Duration
+	// Cost is the estimated cost in USD, when Agent.Accounting is set and
+	// the API reported it.
+	Cost *float64
+	// Cached is set when the reply came from Agent.Cache, stored at
+	// CachedAt; Requests is then 0.
+	Cached   bool
+	CachedAt time.Time
+
+	completions []completion
+}
+
+// add folds one request's metadata in.
+func (r *Result) add(c completion) {
+	r.Requests++
+	r.completions = append(r.completions, c)
+	r.Content = c.reply.Content
+	if c.model != "" {
+		r.Model = c.model
+	}
+	if c.finishReason != "" {
+		r.FinishReason = c.finishReason
+	}
+	if u := c.usage; u != nil {
+		r.Usage.PromptTokens += u.PromptTokens
+		r.Usage.CompletionTokens += u.CompletionTokens
+		r.Usage.TotalTokens += u.TotalTokens
+	}
+}
+
+// cost sums the cost of the completions: from their usage when OpenRouter
+// included it, else from its generation stats. It is nil unless every
+// request's cost is known.
+func (a *Agent) cost(ctx context.Context, completions []completion) *float64 {
+	var total float64
+	for _, c := range completions {
+		if c.usage != nil && c.usage.Cost != nil {
+			total += *c.usage.Cost
+			continue
+		}
+		cost, ok := a.generationCost(ctx, c.id)
+		if !ok {
+			return nil
+		}
+		total += cost
+	}
+	return &total
+}
+
+// generationCost asks OpenRouter's /generation endpoint for the total cost
+// of generation id. The stats may lag the completion, so failure just means
+// the cost is unknown.
+func (a *Agent) generationCost(ctx context.Context, id string) (float64, bool) {
+	if id == "" {
+		return 0, false
+	}
+	resp, err := a.client.Get(ctx, "generation?id="+url.QueryEscape(id))
+	if err != nil {
+		return 0, false
+	}
+	body, err := openrouter.HandleResponse(resp)
+	if err != nil {
+		return 0, false
+	}
+	var parsed struct {
+		Data struct {
+			TotalCost *float64 `json:"total_cost"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(body, &parsed) != nil || parsed.Data.TotalCost == nil {
+		return 0, false
+	}
+	return *parsed.Data.TotalCost, true
+}
+
+// jsonUsage is Usage without the per-request cost, which jsonResult
+// reports in total.
+type jsonUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// jsonResult is the --json form of a Result; with streaming it follows
+// the "delta" lines.
+type jsonResult struct {
+	Type         string     `json:"type"`
+	Content      string     `json:"content"`
+	Model        string     `json:"model"`
+	FinishReason string     `json:"finish_reason"`
+	Usage        jsonUsage  `json:"usage"`
+	Requests     int        `json:"requests"`
+	LatencyMS    int64      `json:"latency_ms"`
+	CostUSD      *float64   `json:"cost_usd,omitempty"`
+	Cached       bool       `json:"cached,omitempty"`
+	CachedAt     *time.Time `json:"cached_at,omitempty"`
+}
+
+type jsonDelta struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+func (r Result) json() jsonResult {
+	j := jsonResult{
+		Type:         "result",
+		Content:      r.Content,
+		Model:        r.Model,
+		FinishReason: r.FinishReason,
+		Usage:        jsonUsage{r.Usage.PromptTokens, r.Usage.CompletionTokens, r.Usage.TotalTokens},
+		Requests:     r.Requests,
+		LatencyMS:    r.Latency.Milliseconds(),
+		CostUSD:      r.Cost,
+		Cached:       r.Cached,
+	}
+	if r.Cached {
+		j.CachedAt = &r.CachedAt
+	}
+	return j
+}
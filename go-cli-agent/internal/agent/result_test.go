@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunJSON(t *testing.T) {
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		if req.Usage == nil || !req.Usage.Include {
+			t.Error("usage accounting not requested")
+		}
+		fmt.Fprint(w, `{"id":"gen-1","model":"openai/gpt-4o-mini","choices":[{"message":{"role":"assistant","content":"4"},"finish_reason":"stop"}],
+			"usage":{"prompt_tokens":12,"completion_tokens":1,"total_tokens":13,"cost":0.00025}}`)
+	})
+	var out bytes.Buffer
+	err := Run(context.Background(), Options{Args: []string{"2+2?"}, NoStream: true, JSON: true, APIKey: "sk-test", BaseURL: srv.URL, Out: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got jsonResult
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output %q: %v", out.String(), err)
+	}
+	if got.Type != "result" || got.Content != "4" || got.Model != "openai/gpt-4o-mini" || got.FinishReason != "stop" ||
+		got.Usage != (jsonUsage{12, 1, 13}) || got.Requests != 1 || got.CostUSD == nil || *got.CostUSD != 0.00025 {
+		t.Errorf("result = %+v", got)
+	}
+}
+
+func TestRunJSONStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chat/completions":
+			for _, chunk := range []string{
+				`{"id":"gen-2","model":"m/x","choices":[{"delta":{"content":"Hel"}}]}`,
+				`{"id":"gen-2","model":"m/x","choices":[{"delta":{"content":"lo"},"finish_reason":"stop"}]}`,
+				`{"id":"gen-2","model":"m/x","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`,
+			} {
+				fmt.Fprintf(w, "data: %s\n\n", chunk)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		case "/generation":
+			// The usage above carried no cost, so it is looked up.
+			if r.URL.Query().Get("id") != "gen-2" {
+				t.Errorf("generation id = %q", r.URL.Query().Get("id"))
+			}
+			fmt.Fprint(w, `{"data":{"id":"gen-2","total_cost":0.5}}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	var out bytes.Buffer
+	err := Run(context.Background(), Options{Args: []string{"hi"}, JSON: true, APIKey: "sk-test", BaseURL: srv.URL, Out: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || lines[0] != `{"type":"delta","content":"Hel"}` || lines[1] != `{"type":"delta","content":"lo"}` {
+		t.Fatalf("output = %q", out.String())
+	}
+	var got jsonResult
+	if err := json.Unmarshal([]byte(lines[2]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Content != "Hello" || got.Model != "m/x" || got.FinishReason != "stop" || got.Usage.TotalTokens != 7 || got.CostUSD == nil || *got.CostUSD != 0.5 {
+		t.Errorf("result = %+v", got)
+	}
+}
+
+func TestResultCostUnknown(t *testing.T) {
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		reply(w, "no usage here")
+	})
+	var out bytes.Buffer
+	err := Run(context.Background(), Options{Args: []string{"hi"}, NoStream: true, JSON: true, APIKey: "sk-test", BaseURL: srv.URL, Out: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "cost_usd") {
+		t.Errorf("output %s reports a cost it cannot know", out.String())
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		fmt.Fprint(w, `{"id":"gen-9","choices":[{"message":{"role":"assistant","content":"the answer"},"finish_reason":"stop"}],
+			"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`)
+	})
+	for _, logPrompts := range []bool{false, true} {
+		logged := quietLog(t)
+		err := Run(context.Background(), Options{Args: []string{"secret question"}, NoStream: true, LogPrompts: logPrompts,
+			APIKey: "sk-test", Model: "m/x", BaseURL: srv.URL, Out: &bytes.Buffer{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		line := logged.String()
+		for _, want := range []string{"level=INFO event=api_request request_id=", " model=m/x ", " status=200 ", " generation_id=gen-9 ",
+			" prompt_tokens=3 completion_tokens=2"} {
+			if !strings.Contains(line, want) {
+				t.Errorf("log line %q lacks %q", line, want)
+			}
+		}
+		if strings.Contains(line, "secret question") != logPrompts || strings.Contains(line, "the answer") != logPrompts {
+			t.Errorf("logPrompts=%v: %s", logPrompts, line)
+		}
+		if strings.Contains(line, "sk-test") {
+			t.Errorf("log leaks the API key: %s", line)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cli-things/go-cli-agent/internal/openrouter"
+)
+
+// maxToolOutput caps what a tool hands back to the model.
+const maxToolOutput = 64 << 10
+
+// Tool is a local function the model may call.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments object.
+	Parameters map[string]interface{}
+	// Run executes the call with the decoded arguments; its output, or
+	// error, is what the model sees.
+	Run func(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// Registry is the allowlist of tools offered to the model, in the order
+// they were registered.
+type Registry struct {
+	tools []Tool
+}
+
+// NewRegistry returns the built-in tools: read_file and http_get, and
+// run_command when allowExec is set.
+func NewRegistry(allowExec bool) *Registry {
+	r := &Registry{}
+	r.Register(readFileTool())
+	r.Register(httpGetTool())
+	if allowExec {
+		r.Register(runCommandTool())
+	}
+	return r
+}
+
+// Register adds t, replacing a tool of the same name.
+func (r *Registry) Register(t Tool) {
+	for i := range r.tools {
+		if r.tools[i].Name == t.Name {
+			r.tools[i] = t
+			return
+		}
+	}
+	r.tools = append(r.tools, t)
+}
+
+// Lookup returns the tool called name.
+func (r *Registry) Lookup(name string) (Tool, bool) {
+	for _, t := range r.tools {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Tool{}, false
+}
+
+type toolSpec struct {
+	Type     string       `json:"type"`
+	Function toolFunction `json:"function"`
+}
+
+type toolFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// specs is the "tools" field of a completion request.
+func (r *Registry) specs() []toolSpec {
+	specs := make([]toolSpec, 0, len(r.tools))
+	for _, t := range r.tools {
+		specs = append(specs, toolSpec{Type: "function", Function: toolFunction{t.Name, t.Description, t.Parameters}})
+	}
+	return specs
+}
+
+// runTool executes call after confirmation and returns the text sent back
+// to the model. Failures are reported to the model rather than ending the
+// conversation, so it can try something else.
+func (a *Agent) runTool(ctx context.Context, call openrouter.ToolCall) string {
+	name, args := call.Function.Name, call.Function.Arguments
+	slog.Info("tool_call", "call_id", call.ID, "tool", name, "args", args)
+	t, ok := a.Tools.Lookup(name)
+	if !ok {
+		slog.Warn("tool_call_unknown", "call_id", call.ID, "tool", name)
+		return fmt.Sprintf("error: unknown tool %q", name)
+	}
+	if a.Confirm != nil && !a.Confirm(call) {
+		slog.Info("tool_call_declined", "call_id", call.ID, "tool", name)
+		return "error: the user declined to run this tool call"
+	}
+	if strings.TrimSpace(args) == "" {
+		args = "{}"
+	}
+	out, err := t.Run(ctx, json.RawMessage(args))
+	if len(out) > maxToolOutput {
+		out = out[:maxToolOutput] + "\n[output truncated]"
+	}
+	if err != nil {
+		slog.Warn("tool_call_failed", "call_id", call.ID, "tool", name, "error", err)
+		if out != "" {
+			return out + "\nerror: " + err.Error()
+		}
+		return "error: " + err.Error()
+	}
+	slog.Info("tool_call_done", "call_id", call.ID, "tool", name, "output_bytes", len(out))
+	return out
+}
+
+// TerminalConfirm asks on the controlling terminal, not stdin (which may be
+// the prompt or the conversation), whether to run a tool call. Without a
+// terminal every call is declined.
+func TerminalConfirm(call openrouter.ToolCall) bool {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Declining tool call %s: no terminal to confirm it on (use --auto to run tools unasked)\n", call.Function.Name)
+		return false
+	}
+	defer tty.Close()
+	fmt.Fprintf(tty, "Run tool %s %s? [y/N] ", call.Function.Name, call.Function.Arguments)
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func stringParam(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
+
+func objectSchema(name, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{name: stringParam(description)},
+		"required":   []string{name},
+	}
+}
+
+// readFileTool reads a file under the working directory.
+func readFileTool() Tool {
+	return Tool{
+		Name:        "read_file",
+		Description: "Read a text file under the current working directory.",
+		Parameters:  objectSchema("path", "Path of the file, relative to the working directory"),
+		Run: func(ctx context.Context, raw json.RawMessage) (string, error) {
+			var args struct {
+				Path string `json:"path"`
+			}
+			if err := json.Unmarshal(raw, &args); err != nil || args.Path == "" {
+				return "", errors.New(`want {"path": "..."}`)
+			}
+			path, err := withinWorkingDir(args.Path)
+			if err != nil {
+				return "", err
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return "", err
+			}
+			defer f.Close()
+			if fi, err := f.Stat(); err != nil {
+				return "", err
+			} else if fi.IsDir() {
+				return "", fmt.Errorf("%s is a directory", args.Path)
+			}
+			b, err := io.ReadAll(io.LimitReader(f, maxToolOutput+1))
+			return string(b), err
+		},
+	}
+}
+
+// withinWorkingDir resolves path, following symlinks, and refuses anything
+// outside the working directory.
+func withinWorkingDir(path string) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if wd, err = filepath.EvalSymlinks(wd); err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(wd, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(wd, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the working directory", path)
+	}
+	return resolved, nil
+}
+
+// httpGetTool fetches an http or https URL.
+func httpGetTool() Tool {
+	client := &http.Client{Timeout: 30 * time.Second}
+	return Tool{
+		Name:        "http_get",
+		Description: "Fetch a URL with an HTTP GET request and return the status and body.",
+		Parameters:  objectSchema("url", "The http:// or https:// URL to fetch"),
+		Run: func(ctx context.Context, raw json.RawMessage) (string, error) {
+			var args struct {
+				URL string `json:"url"`
+			}
+			if err := json.Unmarshal(raw, &args); err != nil || args.URL == "" {
+				return "", errors.New(`want {"url": "..."}`)
+			}
+			if !strings.HasPrefix(args.URL, "http://") && !strings.HasPrefix(args.URL, "https://") {
+				return "", errors.New("only http:// and https:// URLs can be fetched")
+			}
+			req, err := http.NewRequestWithContext(ctx, "GET", args.URL, nil)
+			if err != nil {
+				return "", err
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return "", err
+			}
+			defer resp.Body.Close()
+			b, err := io.ReadAll(io.LimitReader(resp.Body, maxToolOutput+1))
+			return fmt.Sprintf("HTTP %s\n\n%s", resp.Status, b), err
+		},
+	}
+}
+
+// runCommandTool runs a shell command; it is only registered with
+// --allow-exec.
+func runCommandTool() Tool {
+	return Tool{
+		Name:        "run_command",
+		Description: "Run a shell command in the current working directory and return its combined output and exit status.",
+		Parameters:  objectSchema("command", "The command line, run with sh -c"),
+		Run: func(ctx context.Context, raw json.RawMessage) (string, error) {
+			var args struct {
+				Command string `json:"command"`
+			}
+			if err := json.Unmarshal(raw, &args); err != nil || strings.TrimSpace(args.Command) == "" {
+				return "", errors.New(`want {"command": "..."}`)
+			}
+			ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+			defer cancel()
+			out, err := exec.CommandContext(ctx, "sh", "-c", args.Command).CombinedOutput()
+			return string(out), err
+		},
+	}
+}
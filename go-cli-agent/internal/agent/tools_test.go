@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli-things/go-cli-agent/internal/logging"
+	"cli-things/go-cli-agent/internal/openrouter"
+)
+
+// inTempDir runs the test in a fresh working directory holding notes.txt.
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("remember the milk"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// quietLog captures the log for the test.
+func quietLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(&buf, slog.LevelInfo)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func toolCallReply(w http.ResponseWriter, name, args string) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"choices": []interface{}{map[string]interface{}{
+			"message": Message{Role: "assistant", ToolCalls: []openrouter.ToolCall{{
+				ID: "call_1", Type: "function", Function: openrouter.FunctionCall{Name: name, Arguments: args},
+			}}},
+			"finish_reason": "tool_calls",
+		}},
+	})
+}
+
+func TestToolCallLoop(t *testing.T) {
+	inTempDir(t)
+	logged := quietLog(t)
+	for _, noStream := range []bool{true, false} {
+		srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+			if len(req.Tools) != 2 || req.Tools[0].Function.Name != "read_file" {
+				t.Errorf("tools = %+v, want read_file and http_get", req.Tools)
+			}
+			last := req.Messages[len(req.Messages)-1]
+			if last.Role == "user" {
+				toolCallReply(w, "read_file", `{"path":"notes.txt"}`)
+				return
+			}
+			if last.Role != "tool" || last.ToolCallID != "call_1" {
+				t.Errorf("last message = %+v, want the tool result", last)
+			}
+			reply(w, "the file says: "+last.Content)
+		})
+		var out bytes.Buffer
+		var asked []string
+		err := Run(context.Background(), Options{
+			Args: []string{"what", "is", "in", "notes.txt?"}, NoStream: noStream,
+			APIKey: "sk-test", BaseURL: srv.URL, Out: &out,
+			Tools: NewRegistry(false),
+			Confirm: func(call openrouter.ToolCall) bool {
+				asked = append(asked, call.Function.Name)
+				return true
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != "the file says: remember the milk\n" {
+			t.Errorf("noStream=%v: output = %q", noStream, out.String())
+		}
+		if len(asked) != 1 || asked[0] != "read_file" {
+			t.Errorf("confirmations = %v", asked)
+		}
+	}
+	if !strings.Contains(logged.String(), `event=tool_call call_id=call_1 tool=read_file args="{\"path\":\"notes.txt\"}"`) {
+		t.Errorf("tool call not logged: %s", logged)
+	}
+}
+
+func TestToolCallDeclined(t *testing.T) {
+	inTempDir(t)
+	quietLog(t)
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		last := req.Messages[len(req.Messages)-1]
+		if last.Role == "user" {
+			toolCallReply(w, "read_file", `{"path":"notes.txt"}`)
+			return
+		}
+		if strings.Contains(last.Content, "milk") || !strings.Contains(last.Content, "declined") {
+			t.Errorf("tool result = %q, want the refusal", last.Content)
+		}
+		reply(w, "ok")
+	})
+	err := Run(context.Background(), Options{
+		Args: []string{"hi"}, NoStream: true, APIKey: "sk-test", BaseURL: srv.URL, Out: io.Discard,
+		Tools: NewRegistry(false), Confirm: func(openrouter.ToolCall) bool { return false },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestToolIterationsLimit(t *testing.T) {
+	inTempDir(t)
+	quietLog(t)
+	requests := 0
+	srv := chatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		requests++
+		toolCallReply(w, "read_file", `{"path":"notes.txt"}`)
+	})
+	a := New(srv.URL, "sk-test", "m")
+	a.Tools = NewRegistry(false)
+	a.MaxToolIterations = 3
+	_, err := a.Send(context.Background(), "loop forever")
+	if err == nil || !strings.Contains(err.Error(), "after 3 requests") {
+		t.Fatalf("err = %v", err)
+	}
+	if requests != 3 || len(a.messages) != 0 {
+		t.Errorf("requests = %d, conversation = %d messages", requests, len(a.messages))
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	if _, ok := NewRegistry(false).Lookup("run_command"); ok {
+		t.Error("run_command registered without allowExec")
+	}
+	r := NewRegistry(true)
+	exec, ok := r.Lookup("run_command")
+	if !ok {
+		t.Fatal("run_command missing with allowExec")
+	}
+	out, err := exec.Run(context.Background(), json.RawMessage(`{"command":"echo hello"}`))
+	if err != nil || out != "hello\n" {
+		t.Errorf("run_command = %q, %v", out, err)
+	}
+}
+
+func TestReadFileStaysInWorkingDir(t *testing.T) {
+	dir := inTempDir(t)
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(outside, []byte("s3cret"), 0o600)
+	os.Symlink(outside, filepath.Join(dir, "link.txt"))
+
+	read, _ := NewRegistry(false).Lookup("read_file")
+	if out, err := read.Run(context.Background(), json.RawMessage(`{"path":"notes.txt"}`)); err != nil || out != "remember the milk" {
+		t.Errorf("read notes.txt = %q, %v", out, err)
+	}
+	for _, p := range []string{outside, "../" + filepath.Base(filepath.Dir(outside)) + "/secret.txt", "link.txt"} {
+		args, _ := json.Marshal(map[string]string{"path": p})
+		if out, err := read.Run(context.Background(), args); err == nil || strings.Contains(out, "s3cret") {
+			t.Errorf("read %s = %q, %v: want it refused", p, out, err)
+		}
+	}
+}
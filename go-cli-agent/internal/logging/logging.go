@@ -0,0 +1,141 @@
+// Package logging sets up the agent's structured log: key=value lines with
+// a timestamp, level and event, written to stderr or to a size-rotated
+// --logfile.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Options configure Setup.
+type Options struct {
+	// File is the log file; empty logs to stderr.
+	File string
+	// MaxSize is the size in bytes at which File is rotated; 0 never
+	// rotates.
+	MaxSize int64
+	// Keep is the number of rotated files kept, File.1 being the newest.
+	Keep int
+	// Verbose logs everything to stderr rather than only warnings and
+	// errors. It has no effect when File is set: everything then goes to
+	// File and nothing to stderr.
+	Verbose bool
+}
+
+// Setup makes a structured logger the default for log/slog, and so for the
+// log package too, and returns what to close on exit.
+func Setup(opts Options) (io.Closer, error) {
+	var w io.Writer = os.Stderr
+	var closer io.Closer = nopCloser{}
+	level := slog.LevelWarn
+	if opts.Verbose {
+		level = slog.LevelInfo
+	}
+	if opts.File != "" {
+		f, err := OpenRotating(opts.File, opts.MaxSize, opts.Keep)
+		if err != nil {
+			return nil, fmt.Errorf("opening logfile: %w", err)
+		}
+		w, closer, level = f, f, slog.LevelInfo
+	}
+	slog.SetDefault(slog.New(NewHandler(w, level)))
+	return closer, nil
+}
+
+// NewHandler writes records at level and above as
+// "time=... level=INFO event=api_request key=value ..." lines: the message
+// of a record is its event name.
+func NewHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	return slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.MessageKey {
+				a.Key = "event"
+			}
+			return a
+		},
+	})
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// RotatingFile is an append-only file that is renamed to path.1 (shifting
+// older copies to path.2 and so on, keeping keep of them) before a write
+// would take it past maxSize.
+type RotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	f       *os.File
+	size    int64
+}
+
+// OpenRotating opens path for appending.
+func OpenRotating(path string, maxSize int64, keep int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxSize: maxSize, keep: keep}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, fi.Size()
+	return nil
+}
+
+// Write appends p, rotating first when p would not fit. A single write
+// larger than maxSize still goes into one file.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	if r.keep <= 0 {
+		os.Remove(r.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, r.keep))
+		for i := r.keep - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	}
+	return r.open()
+}
+
+// Close closes the current file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	r, err := OpenRotating(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Close()
+
+	for name, want := range map[string]string{
+		"agent.log":   "gggg\n",
+		"agent.log.1": "eeee\nffff\n",
+		"agent.log.2": "cccc\ndddd\n",
+	} {
+		b, err := os.ReadFile(filepath.Join(filepath.Dir(path), name))
+		if err != nil || string(b) != want {
+			t.Errorf("%s = %q, %v, want %q", name, b, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 kept beyond keep=2", path)
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	os.WriteFile(path, []byte("12345678\n"), 0o600)
+	r, err := OpenRotating(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("next\n"))
+	r.Close()
+	if b, _ := os.ReadFile(path + ".1"); string(b) != "12345678\n" {
+		t.Errorf("rotated = %q, want the existing content counted against the size", b)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, slog.LevelInfo))
+	logger.Info("api_request", "request_id", "abc", "status", 200)
+	logger.Debug("hidden")
+	line := buf.String()
+	if !strings.Contains(line, " level=INFO event=api_request request_id=abc status=200\n") || !strings.HasPrefix(line, "time=") {
+		t.Errorf("line = %q", line)
+	}
+	if strings.Contains(line, "hidden") {
+		t.Error("debug record logged at info level")
+	}
+}
+
+func TestSetupLogfile(t *testing.T) {
+	prev := slog.Default()
+	defer slog.SetDefault(prev)
+	path := filepath.Join(t.TempDir(), "agent.log")
+	closer, err := Setup(Options{File: path, MaxSize: 1 << 20, Keep: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slog.Info("tool_call", "tool", "read_file")
+	closer.Close()
+	if b, _ := os.ReadFile(path); !strings.Contains(string(b), "event=tool_call tool=read_file") {
+		t.Errorf("logfile = %q", b)
+	}
+}
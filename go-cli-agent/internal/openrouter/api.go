@@ -0,0 +1,460 @@
+// Package openrouter is the HTTP client for OpenRouter compatible APIs:
+// JSON requests, multipart uploads and streamed chat completions, with
+// retries on rate limits and server errors.
+package openrouter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"cli-things/utility/retry"
+)
+
+// APIClient is a struct that holds the base URL and any necessary headers for the API.
+type APIClient struct {
+	BaseURL string
+	Headers map[string]string
+	// HTTPClient sends every request. It has no overall timeout, which
+	// would cut long streamed replies short: connecting and waiting for
+	// the response headers are bounded, the rest is up to the caller's
+	// context.
+	HTTPClient *http.Client
+	// Retry says how requests turned away with 429 or 5xx are retried.
+	Retry retry.Policy
+}
+
+// NewAPIClient initializes a new APIClient with the given base URL.
+func NewAPIClient(baseURL string) *APIClient {
+	return &APIClient{
+		BaseURL:    baseURL,
+		Headers:    make(map[string]string),
+		HTTPClient: newHTTPClient(),
+		Retry:      DefaultRetryPolicy,
+	}
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 2 * time.Minute,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConnsPerHost:   4,
+		},
+	}
+}
+
+// SetHeader allows setting a header for the API client.
+func (client *APIClient) SetHeader(key, value string) {
+	client.Headers[key] = value
+}
+
+// RequestOption adjusts one request after the client's headers are set.
+type RequestOption func(*http.Request)
+
+// WithHeader sets a header on one request, overriding the client's.
+func WithHeader(key, value string) RequestOption {
+	return func(req *http.Request) {
+		req.Header.Set(key, value)
+	}
+}
+
+// send makes one request to endpoint with the client's headers and header,
+// then applies opts.
+func (client *APIClient) send(ctx context.Context, method, endpoint string, body []byte, header map[string]string, opts []RequestOption) (*http.Response, error) {
+	url := fmt.Sprintf("%s/%s", client.BaseURL, endpoint)
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range client.Headers {
+		req.Header.Set(key, value)
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	return client.HTTPClient.Do(req)
+}
+
+// do is send, retried under client.Retry while the API answers 429 or 5xx
+// to a request that may be repeated. Once the attempts are used up, the
+// last failure is returned as an error with the attempt count.
+func (client *APIClient) do(ctx context.Context, method, endpoint string, body []byte, header map[string]string, opts []RequestOption) (*http.Response, error) {
+	policy := client.retryPolicy(method, endpoint)
+	if policy.MaxAttempts <= 1 {
+		return client.send(ctx, method, endpoint, body, header, opts)
+	}
+	var resp *http.Response
+	n := 0
+	err := retry.Do(ctx, policy, func(ctx context.Context) error {
+		n++
+		var err error
+		resp, err = client.send(ctx, method, endpoint, body, header, opts)
+		if err != nil || !retryableStatus(resp.StatusCode) {
+			return err
+		}
+		defer resp.Body.Close()
+		return client.transient(statusError(resp), resp)
+	})
+	if err != nil {
+		return nil, attemptsError(err, n)
+	}
+	return resp, nil
+}
+
+// Post sends a POST request to the specified endpoint with the given payload.
+func (client *APIClient) Post(ctx context.Context, endpoint string, payload interface{}, opts ...RequestOption) (*http.Response, error) {
+	return client.sendJSON(ctx, "POST", endpoint, payload, opts)
+}
+
+// Put sends payload as JSON to endpoint with a PUT request.
+func (client *APIClient) Put(ctx context.Context, endpoint string, payload interface{}, opts ...RequestOption) (*http.Response, error) {
+	return client.sendJSON(ctx, "PUT", endpoint, payload, opts)
+}
+
+// Get sends a GET request to the specified endpoint.
+func (client *APIClient) Get(ctx context.Context, endpoint string, opts ...RequestOption) (*http.Response, error) {
+	return client.do(ctx, "GET", endpoint, nil, nil, opts)
+}
+
+// Delete sends a DELETE request to endpoint.
+func (client *APIClient) Delete(ctx context.Context, endpoint string, opts ...RequestOption) (*http.Response, error) {
+	return client.do(ctx, "DELETE", endpoint, nil, nil, opts)
+}
+
+func (client *APIClient) sendJSON(ctx context.Context, method, endpoint string, payload interface{}, opts []RequestOption) (*http.Response, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return client.do(ctx, method, endpoint, jsonData, map[string]string{"Content-Type": "application/json"}, opts)
+}
+
+// MultipartFile is one file part of PostMultipart.
+type MultipartFile struct {
+	Field    string // form field name
+	Filename string
+	Content  io.Reader
+}
+
+// PostMultipart uploads fields and files to endpoint as a
+// multipart/form-data POST. The form is built in memory first, so its size
+// is known and a retry can send it again; onProgress, when not nil, is
+// called with the bytes sent so far and the total as the body goes out,
+// starting over from zero on a retry.
+func (client *APIClient) PostMultipart(ctx context.Context, endpoint string, fields map[string]string, files []MultipartFile, onProgress func(sent, total int64), opts ...RequestOption) (*http.Response, error) {
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := form.WriteField(k, fields[k]); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range files {
+		part, err := form.CreateFormFile(f.Field, f.Filename)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(part, f.Content); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.Filename, err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	if onProgress != nil {
+		total := int64(buf.Len())
+		opts = append(opts, func(req *http.Request) {
+			req.Body = &progressReader{ReadCloser: req.Body, total: total, onProgress: onProgress}
+		})
+	}
+	return client.do(ctx, "POST", endpoint, buf.Bytes(), map[string]string{"Content-Type": form.FormDataContentType()}, opts)
+}
+
+// progressReader reports the bytes read through it.
+type progressReader struct {
+	io.ReadCloser
+	sent, total int64
+	onProgress  func(sent, total int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.sent += int64(n)
+		r.onProgress(r.sent, r.total)
+	}
+	return n, err
+}
+
+// PostStream sends payload to endpoint with "stream": true and reads the
+// text/event-stream reply, calling onDelta with the content of each chunk
+// as it arrives until the [DONE] event, and returns what else the stream
+// carried, such as tool calls and usage. Cancelling ctx aborts the request.
+// A failure is retried like Post's only while nothing has been passed to
+// onDelta, so the caller never sees a reply start over.
+func (client *APIClient) PostStream(ctx context.Context, endpoint string, payload interface{}, onDelta func(delta string), opts ...RequestOption) (StreamResult, error) {
+	body, err := streamPayload(payload)
+	if err != nil {
+		return StreamResult{}, err
+	}
+	header := map[string]string{"Content-Type": "application/json", "Accept": "text/event-stream"}
+	var result StreamResult
+	n := 0
+	err = retry.Do(ctx, client.retryPolicy("POST", endpoint), func(ctx context.Context) error {
+		n++
+		result = StreamResult{}
+		resp, err := client.send(ctx, "POST", endpoint, body, header, opts)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if !isSuccess(resp.StatusCode) {
+			if !retryableStatus(resp.StatusCode) {
+				return statusError(resp)
+			}
+			return client.transient(statusError(resp), resp)
+		}
+		delivered := false
+		result, err = readEvents(resp.Body, func(delta string) {
+			delivered = true
+			onDelta(delta)
+		})
+		result.Status = resp.StatusCode
+		if err == nil || delivered {
+			return err
+		}
+		return transientError{err}
+	})
+	if err != nil {
+		return result, attemptsError(err, n)
+	}
+	return result, nil
+}
+
+// streamPayload is payload's JSON object with "stream" set to true.
+func streamPayload(payload interface{}) ([]byte, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, fmt.Errorf("streaming payload must be a JSON object: %w", err)
+	}
+	fields["stream"] = json.RawMessage("true")
+	return json.Marshal(fields)
+}
+
+// ToolCall is a function call the model asks for, in the OpenAI chat
+// format OpenRouter uses.
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall names the function of a ToolCall; Arguments is a JSON object
+// encoded as a string.
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Usage is the token accounting of a completion. Cost, in USD, is only
+// reported by OpenRouter when the request asks for usage accounting.
+type Usage struct {
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	TotalTokens      int      `json:"total_tokens"`
+	Cost             *float64 `json:"cost,omitempty"`
+}
+
+// StreamResult is what a stream carried besides its content: the
+// generation's id and model, why it finished, the tool calls assembled from
+// its deltas and, when the API sent it, the usage.
+type StreamResult struct {
+	Status       int // HTTP status of the response that was read
+	ID           string
+	Model        string
+	FinishReason string
+	ToolCalls    []ToolCall
+	Usage        *Usage
+}
+
+type streamChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Usage   *Usage `json:"usage"`
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index int `json:"index"`
+				ToolCall
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// readEvents parses "data: {...}" lines of a chat completion stream.
+// Comment lines (such as OpenRouter's ": OPENROUTER PROCESSING" keep-alives)
+// and other fields are ignored. A tool call arrives in pieces keyed by its
+// index: the id and name once, the arguments split across chunks.
+func readEvents(r io.Reader, onDelta func(delta string)) (StreamResult, error) {
+	var result StreamResult
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return result, nil
+		}
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return result, fmt.Errorf("decoding stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return result, fmt.Errorf("API error: %s", chunk.Error.Message)
+		}
+		if chunk.ID != "" {
+			result.ID = chunk.ID
+		}
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.Usage = chunk.Usage
+		}
+		for _, c := range chunk.Choices {
+			if c.Delta.Content != "" {
+				onDelta(c.Delta.Content)
+			}
+			for _, tc := range c.Delta.ToolCalls {
+				for len(result.ToolCalls) <= tc.Index {
+					result.ToolCalls = append(result.ToolCalls, ToolCall{Type: "function"})
+				}
+				call := &result.ToolCalls[tc.Index]
+				if tc.ID != "" {
+					call.ID = tc.ID
+				}
+				if tc.Type != "" {
+					call.Type = tc.Type
+				}
+				call.Function.Name += tc.Function.Name
+				call.Function.Arguments += tc.Function.Arguments
+			}
+			if c.FinishReason != "" {
+				result.FinishReason = c.FinishReason
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+	return result, errors.New("stream ended before [DONE]")
+}
+
+// APIError is a response with a status other than 2xx. Message is the
+// body's "error.message", else an excerpt of the body; Code and Metadata are
+// the rest of OpenRouter's error object, when the body had one.
+type APIError struct {
+	StatusCode int
+	Message    string
+	Code       string // "error.code", as text: OpenRouter sends numbers, others strings
+	Metadata   map[string]interface{}
+	Body       []byte // the start of the body
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (HTTP %d): %s", e.StatusCode, e.Message)
+}
+
+// apiErrorBody is the error object of OpenRouter and OpenAI error bodies.
+type apiErrorBody struct {
+	Error *struct {
+		Message  string                 `json:"message"`
+		Code     json.RawMessage        `json:"code"`
+		Metadata map[string]interface{} `json:"metadata"`
+	} `json:"error"`
+}
+
+// ErrorMessage is the "error.message" of an API error body, else the body
+// itself, shortened.
+func ErrorMessage(body []byte) string {
+	var parsed apiErrorBody
+	if json.Unmarshal(body, &parsed) == nil && parsed.Error != nil && parsed.Error.Message != "" {
+		return parsed.Error.Message
+	}
+	excerpt := strings.TrimSpace(string(body))
+	if len(excerpt) > 200 {
+		excerpt = excerpt[:200] + "..."
+	}
+	return excerpt
+}
+
+// HandleResponse processes the HTTP response and returns the body as a byte slice.
+// Any 2xx status is a success; otherwise the error is an *APIError.
+func HandleResponse(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	if !isSuccess(resp.StatusCode) {
+		return nil, statusError(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func isSuccess(status int) bool {
+	return status >= 200 && status <= 299
+}
+
+// statusError reads the start of a failed response's body into an
+// *APIError.
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	e := &APIError{StatusCode: resp.StatusCode, Message: ErrorMessage(body), Body: body}
+	var parsed apiErrorBody
+	if json.Unmarshal(body, &parsed) == nil && parsed.Error != nil {
+		e.Metadata = parsed.Error.Metadata
+		var code string
+		if json.Unmarshal(parsed.Error.Code, &code) != nil {
+			code = string(parsed.Error.Code)
+		}
+		e.Code = code
+	}
+	return e
+}
@@ -0,0 +1,290 @@
+package openrouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cli-things/utility/retry"
+)
+
+func TestPostSendsJSONAndHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/chat/completions" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer k" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"echo":%q}`, body["q"])
+	}))
+	defer srv.Close()
+
+	client := NewAPIClient(srv.URL)
+	client.SetHeader("Authorization", "Bearer k")
+	resp, err := client.Post(context.Background(), "chat/completions", map[string]string{"q": "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := HandleResponse(resp)
+	if err != nil {
+		t.Fatalf("HandleResponse on 201: %v", err)
+	}
+	if string(body) != `{"echo":"hi"}` {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestHandleResponseErrors(t *testing.T) {
+	for _, c := range []struct {
+		status int
+		body   string
+		want   string
+	}{
+		{401, `{"error":{"message":"No auth credentials found","code":401}}`, "API error (HTTP 401): No auth credentials found"},
+		{502, "<html>Bad gateway</html>", "API error (HTTP 502): <html>Bad gateway</html>"},
+		{500, strings.Repeat("x", 300), "API error (HTTP 500): " + strings.Repeat("x", 200) + "..."},
+	} {
+		resp := &http.Response{StatusCode: c.status, Body: io.NopCloser(strings.NewReader(c.body))}
+		_, err := HandleResponse(resp)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("HTTP %d: err = %v, want %q", c.status, err, c.want)
+		}
+	}
+	resp := &http.Response{StatusCode: http.StatusNoContent, Body: io.NopCloser(strings.NewReader(""))}
+	if _, err := HandleResponse(resp); err != nil {
+		t.Errorf("HTTP 204: %v", err)
+	}
+}
+
+func TestGetHonorsContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := NewAPIClient(srv.URL).Get(ctx, "models")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the context's deadline", err)
+	}
+}
+
+func TestPostStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["stream"] != true || body["model"] != "m" {
+			t.Errorf("payload = %v, want model kept and stream set", body)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	var got []string
+	_, err := NewAPIClient(srv.URL).PostStream(context.Background(), "chat/completions",
+		map[string]string{"model": "m"}, func(d string) { got = append(got, d) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, "|") != "Hel|lo" {
+		t.Errorf("deltas = %q", got)
+	}
+}
+
+func TestPostStreamErrors(t *testing.T) {
+	for name, c := range map[string]struct {
+		status int
+		body   string
+		want   string
+	}{
+		"status":    {404, `{"error":{"message":"model not found"}}`, "API error (HTTP 404): model not found"},
+		"in stream": {200, "data: {\"error\":{\"message\":\"upstream failed\"}}\n\n", "API error: upstream failed"},
+		"truncated": {200, "data: {\"choices\":[{\"delta\":{\"content\":\"x\"}}]}\n\n", "stream ended before [DONE]"},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+			fmt.Fprint(w, c.body)
+		}))
+		client := NewAPIClient(srv.URL)
+		client.Retry = retry.Policy{}
+		_, err := client.PostStream(context.Background(), "chat/completions", map[string]string{}, func(string) {})
+		srv.Close()
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s: err = %v, want %q", name, err, c.want)
+		}
+	}
+}
+
+func TestPostStreamToolCalls(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, chunk := range []string{
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read_file","arguments":""}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"path\":"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"go.mod\"}"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_2","function":{"name":"http_get","arguments":"{}"}}]}}]}`,
+			`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	result, err := NewAPIClient(srv.URL).PostStream(context.Background(), "chat/completions", map[string]string{}, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FinishReason != "tool_calls" || len(result.ToolCalls) != 2 {
+		t.Fatalf("result = %+v", result)
+	}
+	first := result.ToolCalls[0]
+	if first.ID != "call_1" || first.Type != "function" || first.Function.Name != "read_file" || first.Function.Arguments != `{"path":"go.mod"}` {
+		t.Errorf("first call = %+v", first)
+	}
+	if second := result.ToolCalls[1]; second.ID != "call_2" || second.Type != "function" || second.Function.Name != "http_get" {
+		t.Errorf("second call = %+v", second)
+	}
+}
+
+func TestPutAndDelete(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, fmt.Sprintf("%s /%s %s %s", r.Method, r.URL.Path[1:], r.Header.Get("Content-Type"), body))
+		if r.Method == "DELETE" {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewAPIClient(srv.URL)
+	resp, err := client.Put(context.Background(), "keys/1", map[string]bool{"disabled": true})
+	if err == nil {
+		_, err = HandleResponse(resp)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.Delete(context.Background(), "keys/1")
+	if err == nil {
+		_, err = HandleResponse(resp)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`PUT /keys/1 application/json {"disabled":true}`, "DELETE /keys/1  "}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests =\n%s\nwant\n%s", strings.Join(requests, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRequestHeaderOverride(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s|%s", r.Header.Get("Authorization"), r.Header.Get("Content-Type"), r.Header.Get("X-Title"))
+	}))
+	defer srv.Close()
+
+	client := NewAPIClient(srv.URL)
+	client.SetHeader("Authorization", "Bearer client")
+	resp, err := client.Post(context.Background(), "x", map[string]string{},
+		WithHeader("Authorization", "Bearer provisioning"), WithHeader("Content-Type", "application/vnd.test+json"), WithHeader("X-Title", "cli"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := HandleResponse(resp)
+	if string(body) != "Bearer provisioning|application/vnd.test+json|cli" {
+		t.Errorf("headers seen = %s", body)
+	}
+	if client.Headers["Authorization"] != "Bearer client" {
+		t.Errorf("the override changed the client's headers: %v", client.Headers)
+	}
+}
+
+func TestPostMultipart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatal(err)
+		}
+		f, h, err := r.FormFile("file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(f)
+		fmt.Fprintf(w, "%s %s %s", r.FormValue("purpose"), h.Filename, content)
+	}))
+	defer srv.Close()
+
+	var sent, total int64
+	calls := 0
+	resp, err := NewAPIClient(srv.URL).PostMultipart(context.Background(), "files",
+		map[string]string{"purpose": "batch"},
+		[]MultipartFile{{Field: "file", Filename: "prompts.jsonl", Content: strings.NewReader(strings.Repeat("x", 100000))}},
+		func(s, t int64) { sent, total = s, t; calls++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := HandleResponse(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "batch prompts.jsonl "+strings.Repeat("x", 100000) {
+		t.Errorf("server saw %.60s...", body)
+	}
+	if calls == 0 || sent != total || total <= 100000 {
+		t.Errorf("progress: %d calls, last %d of %d", calls, sent, total)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPaymentRequired)
+		fmt.Fprint(w, `{"error":{"message":"Insufficient credits","code":402,"metadata":{"balance":0}}}`)
+	}))
+	defer srv.Close()
+
+	resp, err := NewAPIClient(srv.URL).Delete(context.Background(), "keys/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = HandleResponse(resp)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %#v, want an *APIError", err)
+	}
+	if apiErr.StatusCode != 402 || apiErr.Message != "Insufficient credits" || apiErr.Code != "402" || apiErr.Metadata["balance"] != 0.0 {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+	if err.Error() != "API error (HTTP 402): Insufficient credits" {
+		t.Errorf("message = %q", err)
+	}
+
+	// Still an *APIError once the retries give up.
+	recordSleeps(t)
+	srv2, _ := flakyServer(t, 10, http.StatusTooManyRequests, "", func(w http.ResponseWriter) {})
+	_, err = NewAPIClient(srv2.URL).Get(context.Background(), "models")
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 429 {
+		t.Errorf("err = %v, want an *APIError with HTTP 429", err)
+	}
+}
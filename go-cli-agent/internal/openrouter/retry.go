@@ -0,0 +1,91 @@
+package openrouter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cli-things/utility/retry"
+)
+
+// DefaultRetryPolicy is the policy NewAPIClient sets: 4 attempts in all,
+// waiting 1s, 2s and 4s plus up to half again as jitter, or what a
+// Retry-After header asks for, up to 5 minutes so a misbehaving server
+// cannot park the agent for hours.
+var DefaultRetryPolicy = retry.Policy{
+	MaxAttempts:   4,
+	Backoff:       time.Second,
+	MaxBackoff:    30 * time.Second,
+	Jitter:        0.5,
+	MaxRetryAfter: 5 * time.Minute,
+}
+
+// retryPolicy is client.Retry for a request to endpoint, retrying only the
+// failures marked transient, and not at all when the request may not be
+// sent twice.
+func (client *APIClient) retryPolicy(method, endpoint string) retry.Policy {
+	p := client.Retry
+	if !retryableRequest(method, endpoint) {
+		p.MaxAttempts = 1
+	}
+	p.IsRetryable = func(err error) bool {
+		var t transientError
+		return errors.As(err, &t)
+	}
+	return p
+}
+
+// transientError marks a failure worth another attempt: a 429 or 5xx
+// answer, or a stream that broke before any of it was delivered.
+type transientError struct{ error }
+
+func (e transientError) Unwrap() error { return e.error }
+
+// transient marks err, the failure of resp, as transient, with the wait the
+// response's Retry-After header asks for.
+func (client *APIClient) transient(err error, resp *http.Response) error {
+	now := time.Now
+	if client.Retry.Clock != nil {
+		now = client.Retry.Clock.Now
+	}
+	err = transientError{err}
+	if d, ok := retry.ParseRetryAfter(resp.Header.Get("Retry-After"), now()); ok {
+		err = retry.WithRetryAfter(err, d)
+	}
+	return err
+}
+
+// attemptsError is the error of a request after n attempts: the transient
+// failure the retries ended on, with the attempt count when there were
+// several, or the other error that ended them.
+func attemptsError(err error, n int) error {
+	var t transientError
+	if !errors.As(err, &t) {
+		return err
+	}
+	if n > 1 {
+		return fmt.Errorf("%w (after %d attempts)", t.error, n)
+	}
+	return t.error
+}
+
+// retryableStatus reports whether status is worth retrying: rate limiting
+// and the server-side failures OpenRouter returns while a provider is
+// overloaded or restarting.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryableRequest reports whether a request may be sent twice: idempotent
+// methods, and POSTs to a completions endpoint, which create nothing.
+func retryableRequest(method, endpoint string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	case "POST":
+		return strings.HasSuffix(strings.TrimRight(endpoint, "/"), "completions")
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package openrouter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cli-things/utility/retry"
+)
+
+// sleepRecorder is a retry.Clock that records the waits it is asked for
+// instead of sleeping.
+type sleepRecorder struct {
+	waits []time.Duration
+}
+
+func (r *sleepRecorder) Now() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+
+func (r *sleepRecorder) Sleep(ctx context.Context, d time.Duration) error {
+	r.waits = append(r.waits, d)
+	return ctx.Err()
+}
+
+// recordSleeps makes the clients created during the test record their
+// retry waits instead of sleeping, and returns the waits.
+func recordSleeps(t *testing.T) *[]time.Duration {
+	t.Helper()
+	rec := &sleepRecorder{}
+	orig := DefaultRetryPolicy
+	DefaultRetryPolicy.Clock = rec
+	t.Cleanup(func() { DefaultRetryPolicy = orig })
+	return &rec.waits
+}
+
+// flakyServer answers the first failures requests with status and a
+// Retry-After of retryAfter (when set), then with ok.
+func flakyServer(t *testing.T, failures int, status int, retryAfter string, ok func(w http.ResponseWriter)) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if int(n) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"error":{"message":"try again %d"}}`, n)
+			return
+		}
+		ok(w)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetry429ThenOK(t *testing.T) {
+	waits := recordSleeps(t)
+	srv, calls := flakyServer(t, 1, http.StatusTooManyRequests, "2", func(w http.ResponseWriter) {
+		fmt.Fprint(w, `{"ok":true}`)
+	})
+	resp, err := NewAPIClient(srv.URL).Post(context.Background(), "chat/completions", map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := HandleResponse(resp)
+	if err != nil || string(body) != `{"ok":true}` {
+		t.Fatalf("body %s, err %v", body, err)
+	}
+	if *calls != 2 || len(*waits) != 1 || (*waits)[0] != 2*time.Second {
+		t.Errorf("calls = %d, waits = %v, want 2 calls and the Retry-After of 2s", *calls, *waits)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	waits := recordSleeps(t)
+	srv, calls := flakyServer(t, 10, http.StatusServiceUnavailable, "", nil)
+	client := NewAPIClient(srv.URL)
+	client.Retry = retry.Policy{MaxAttempts: 3, Backoff: 100 * time.Millisecond, Clock: DefaultRetryPolicy.Clock}
+	_, err := client.Get(context.Background(), "models")
+	if err == nil || err.Error() != "API error (HTTP 503): try again 3 (after 3 attempts)" {
+		t.Fatalf("err = %v", err)
+	}
+	if *calls != 3 || len(*waits) != 2 || (*waits)[0] != 100*time.Millisecond || (*waits)[1] != 200*time.Millisecond {
+		t.Errorf("calls = %d, waits = %v, want 3 calls and a doubling backoff", *calls, *waits)
+	}
+}
+
+func TestRetrySkipsOtherPosts(t *testing.T) {
+	recordSleeps(t)
+	srv, calls := flakyServer(t, 1, http.StatusBadGateway, "", func(w http.ResponseWriter) {})
+	resp, err := NewAPIClient(srv.URL).Post(context.Background(), "keys", map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || *calls != 1 {
+		t.Errorf("status %d after %d calls, want the 502 without a retry", resp.StatusCode, *calls)
+	}
+}
+
+func TestRetryPutAndDelete(t *testing.T) {
+	recordSleeps(t)
+	for _, method := range []string{"PUT", "DELETE"} {
+		srv, calls := flakyServer(t, 1, http.StatusServiceUnavailable, "", func(w http.ResponseWriter) {})
+		client := NewAPIClient(srv.URL)
+		var err error
+		if method == "PUT" {
+			_, err = client.Put(context.Background(), "x", map[string]string{})
+		} else {
+			_, err = client.Delete(context.Background(), "x")
+		}
+		if err != nil || *calls != 2 {
+			t.Errorf("%s: err = %v after %d calls, want a retry", method, err, *calls)
+		}
+	}
+}
+
+func TestRetryNotOn4xx(t *testing.T) {
+	recordSleeps(t)
+	srv, calls := flakyServer(t, 1, http.StatusUnauthorized, "", nil)
+	resp, err := NewAPIClient(srv.URL).Get(context.Background(), "models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if *calls != 1 {
+		t.Errorf("calls = %d, want 1", *calls)
+	}
+}
+
+func TestStreamRetriesBeforeFirstDelta(t *testing.T) {
+	waits := recordSleeps(t)
+	srv, calls := flakyServer(t, 1, http.StatusTooManyRequests, "", func(w http.ResponseWriter) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n")
+	})
+	var got string
+	_, err := NewAPIClient(srv.URL).PostStream(context.Background(), "chat/completions", map[string]string{}, func(d string) { got += d })
+	if err != nil || got != "hi" {
+		t.Fatalf("got %q, err %v", got, err)
+	}
+	if *calls != 2 || len(*waits) != 1 {
+		t.Errorf("calls = %d, waits = %v", *calls, *waits)
+	}
+}
+
+func TestStreamNoRetryAfterDelta(t *testing.T) {
+	recordSleeps(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		// Cut off after the first chunk.
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"par\"}}]}\n\n")
+	}))
+	defer srv.Close()
+	var got []string
+	_, err := NewAPIClient(srv.URL).PostStream(context.Background(), "chat/completions", map[string]string{}, func(d string) { got = append(got, d) })
+	if err == nil || calls != 1 || len(got) != 1 {
+		t.Errorf("err %v, calls %d, deltas %q: want one attempt whose failure is returned", err, calls, got)
+	}
+}
+
+func TestRetryAfterCapped(t *testing.T) {
+	waits := recordSleeps(t)
+	srv, _ := flakyServer(t, 1, http.StatusTooManyRequests, "99999", func(w http.ResponseWriter) {})
+	if _, err := NewAPIClient(srv.URL).Get(context.Background(), "models"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*waits) != 1 || (*waits)[0] != 5*time.Minute {
+		t.Errorf("waits = %v, want the Retry-After capped at 5m", *waits)
+	}
+}
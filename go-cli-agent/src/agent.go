@@ -1,53 +0,0 @@
-package main
-
-import (
-	"flag"
-	"fmt"
-	"log"
-	"os"
-)
-
-func main() {
-	verbose := flag.Bool("verbose", false, "Enable verbose output")
-	logfile := flag.String("logfile", "", "Specify a logfile to write logs")
-	auto := flag.Bool("auto", false, "Enable automatic mode")
-
-	flag.Parse()
-
-	if *verbose {
-		fmt.Println("Verbose mode enabled")
-	}
-
-	if *logfile != "" {
-		file, err := os.OpenFile(*logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-		if err != nil {
-			log.Fatalf("Failed to open logfile: %v", err)
-		}
-		defer file.Close()
-		log.SetOutput(file)
-		log.Println("Logging to file:", *logfile)
-	}
-
-	if *auto {
-		fmt.Println("Automatic mode enabled")
-		// Add logic for automatic mode here
-	}
-
-	// Call the agent's functionality here
-	agent := NewAgent()
-	agent.Execute()
-}
-
-type Agent struct {
-	// Add fields as necessary
-}
-
-func NewAgent() *Agent {
-	return &Agent{}
-}
-
-func (a *Agent) Execute() {
-	// Implement the logic to interact with the OpenRouter API
-	fmt.Println("Executing agent tasks...")
-	// Add further implementation here
-}
\ No newline at end of file
@@ -2,4 +2,11 @@ module cli-things
 
 go 1.21
 
-require github.com/lib/pq v1.10.9
+require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/chzyer/readline v1.5.1
+	github.com/lib/pq v1.10.9
+	golang.org/x/term v0.15.0
+)
+
+require golang.org/x/sys v0.15.0 // indirect
@@ -0,0 +1,241 @@
+package cloudflarebackup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+
+	"cli-things/utility/cfapi"
+	"cli-things/utility/metrics"
+)
+
+// backup holds the state of a single backup run. In dry-run mode every
+// database access is skipped and the collected data is only summarized.
+type backup struct {
+	cf      *cfapi.Client
+	db      *sql.DB // nil in dry-run mode
+	verbose bool
+	dryRun  bool
+	runID   int64
+	// incremental skips upserting records whose modified_on is not newer
+	// than the newest one already stored for the zone.
+	incremental bool
+	exclude     recordExclusions
+	// stats times the accounts step and each zone.
+	stats *metrics.Recorder
+
+	accounts int
+	zones    int
+	records  int
+	excluded int
+	changes  []change
+
+	// Dry-run summary, in API order.
+	accountNames []string
+	zoneSummary  []zoneSummary
+}
+
+type zoneSummary struct {
+	Name        string
+	AccountName string
+	Records     int
+	Excluded    int
+	RecordNames []string
+}
+
+func (b *backup) run(ctx context.Context) error {
+	// 1) accounts
+	stopAccounts := b.stats.Start("accounts")
+	defer stopAccounts()
+	accounts, err := b.cf.ListAccounts(ctx)
+	if err != nil {
+		return fmt.Errorf("accounts list failed: %w", err)
+	}
+	for _, acct := range accounts {
+		if b.dryRun {
+			b.accountNames = append(b.accountNames, acct.Name)
+		} else if err := insertAccount(ctx, b.db, acct); err != nil {
+			return fmt.Errorf("insert account failed: %w", err)
+		}
+		b.accounts++
+	}
+	stopAccounts()
+
+	// 2) zones
+	zones, err := b.cf.ListZones(ctx, cfapi.ZoneFilter{})
+	if err != nil {
+		return fmt.Errorf("zones list failed: %w", err)
+	}
+	for _, zone := range zones {
+		if err := b.backupZone(ctx, zone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *backup) backupZone(ctx context.Context, zone cfapi.Zone) error {
+	defer b.stats.Start("zones")()
+	defer b.stats.Start("zone/" + zone.Name)()
+	if !b.dryRun {
+		if err := insertZone(ctx, b.db, zone); err != nil {
+			return fmt.Errorf("insert zone failed: %w", err)
+		}
+	}
+	b.zones++
+
+	// Delegation snapshot: nameservers + DNSSEC. A failed DNSSEC lookup is
+	// stored with its error rather than failing the run.
+	deleg := collectDelegation(ctx, b.cf, zone)
+	if deleg.DNSSECError != "" {
+		logger.Warnf("dnssec lookup failed for %s: %s", zone.Name, deleg.DNSSECError)
+	}
+	if !b.dryRun {
+		prev, hasPrev, err := previousDelegation(ctx, b.db, b.runID, zone.ID)
+		if err != nil {
+			return fmt.Errorf("load previous delegation failed: %w", err)
+		}
+		if err := insertDelegation(ctx, b.db, b.runID, deleg); err != nil {
+			return fmt.Errorf("insert delegation failed: %w", err)
+		}
+		if hasPrev {
+			for _, c := range diffDelegation(prev, deleg) {
+				// Delegation changes are always worth a notification,
+				// even when --diff is not requested.
+				logger.Info("change detected:", c)
+				b.changes = append(b.changes, c)
+			}
+		}
+	}
+
+	summary := zoneSummary{Name: zone.Name, AccountName: zone.Account.Name}
+
+	// 3) records per zone
+	records, err := b.cf.ListDNSRecords(ctx, zone.ID, cfapi.RecordFilter{})
+	if err != nil {
+		return fmt.Errorf("records list failed: %w", err)
+	}
+	// Excluded records are dropped before anything else looks at them so they
+	// are neither stored nor diffed, and do not skew the incremental count.
+	records, summary.Excluded = b.exclude.filter(records)
+	b.excluded += summary.Excluded
+	if summary.Excluded > 0 {
+		logger.Infof("zone %s: %d record(s) excluded", zone.Name, summary.Excluded)
+	}
+
+	// Incremental mode relies on Cloudflare's modified_on: only records newer
+	// than the stored watermark are written. If the zone's record count
+	// changed, something was added or deleted in a way the watermark may not
+	// reflect, so fall back to a full fetch for this zone.
+	var (
+		watermark time.Time
+		useWM     bool
+		unchanged int
+		stored    map[string]recordHashes
+	)
+	if !b.dryRun {
+		stored, err = storedRecordHashes(ctx, b.db, zone.ID)
+		if err != nil {
+			return fmt.Errorf("load record hashes failed: %w", err)
+		}
+	}
+	if b.incremental {
+		storedCount, wm, ok, err := zoneWatermark(ctx, b.db, zone.ID)
+		if err != nil {
+			return fmt.Errorf("load zone watermark failed: %w", err)
+		}
+		watermark, useWM = wm, ok
+		if useWM && len(records) != storedCount {
+			logger.Debugf("zone %s record count changed (%d -> %d); full fetch", zone.Name, storedCount, len(records))
+			useWM = false
+		}
+	}
+
+	for _, rec := range records {
+		b.records++
+		if useWM && !rec.ModifiedOn.IsZero() && !rec.ModifiedOn.After(watermark) {
+			unchanged++
+			continue
+		}
+		if b.dryRun {
+			if b.verbose {
+				summary.RecordNames = append(summary.RecordNames, rec.Type+" "+rec.Name)
+			}
+		} else {
+			h := recordHashes{Content: contentHash(rec), Raw: rawHash(rec)}
+			b.diffRecord(ctx, zone, rec, stored, h)
+			if err := insertDNSRecord(ctx, b.db, zone.ID, rec, h); err != nil {
+				return fmt.Errorf("insert record failed: %w", err)
+			}
+		}
+		summary.Records++
+	}
+	if useWM {
+		logger.Debugf("zone %s incremental: %d unchanged record(s) skipped", zone.Name, unchanged)
+	}
+	if b.dryRun {
+		b.zoneSummary = append(b.zoneSummary, summary)
+	}
+	return nil
+}
+
+// diffRecord records how rec differs from the stored version. Only content
+// changes (and records new to a zone that already has history) are reported
+// as they happen; metadata-only drift is kept for --diff. When the content
+// hash moved, the stored record is loaded to tell a real change from a
+// formatting one.
+func (b *backup) diffRecord(ctx context.Context, zone cfapi.Zone, rec cfapi.DNSRecord, stored map[string]recordHashes, cur recordHashes) {
+	if len(stored) == 0 {
+		return
+	}
+	prev, ok := stored[rec.ID]
+	if !ok {
+		c := change{Zone: zone.Name, Kind: "record", Detail: fmt.Sprintf("%s %s added", rec.Type, rec.Name)}
+		logger.Info("change detected:", c)
+		b.changes = append(b.changes, c)
+		return
+	}
+	var prevRec *cfapi.DNSRecord
+	if prev.Content != cur.Content {
+		if r, err := storedRecord(ctx, b.db, zone.ID, rec.ID); err == nil {
+			prevRec = &r
+		} else {
+			logger.Debugf("zone %s: load stored record %s: %v", zone.Name, rec.ID, err)
+		}
+	}
+	c, changed := diffRecord(zone.Name, rec, prev, cur, prevRec)
+	if !changed {
+		return
+	}
+	if c.Kind == "record" {
+		logger.Info("change detected:", c)
+	}
+	b.changes = append(b.changes, c)
+}
+
+// printDryRunSummary prints what a real run would have stored, grouped by
+// account. Record names are only collected (and printed) in verbose mode.
+func (b *backup) printDryRunSummary(w io.Writer) {
+	fmt.Fprintf(w, "accounts: %d\n", b.accounts)
+	for _, name := range b.accountNames {
+		zones, records := 0, 0
+		for _, z := range b.zoneSummary {
+			if z.AccountName == name {
+				zones++
+				records += z.Records
+			}
+		}
+		fmt.Fprintf(w, "  account %s: zones=%d records=%d\n", name, zones, records)
+	}
+	fmt.Fprintf(w, "zones: %d\n", b.zones)
+	for _, z := range b.zoneSummary {
+		fmt.Fprintf(w, "  zone %s: records=%d excluded=%d\n", z.Name, z.Records, z.Excluded)
+		for _, rn := range z.RecordNames {
+			fmt.Fprintf(w, "    %s\n", rn)
+		}
+	}
+	fmt.Fprintf(w, "records: %d\n", b.records)
+	fmt.Fprintf(w, "excluded: %d\n", b.excluded)
+}
@@ -0,0 +1,239 @@
+// Package cloudflarebackup is the cloudflare-backup tool: it copies the
+// Cloudflare accounts, zones and DNS records a token can see into Postgres,
+// once or on an interval. utility/cloudflare-backup builds it as a
+// standalone binary; clithings runs it as a subcommand.
+package cloudflarebackup
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"cli-things/utility/buildinfo"
+	"cli-things/utility/cfapi"
+	"cli-things/utility/cli"
+	"cli-things/utility/clog"
+	"cli-things/utility/dbconf"
+	"cli-things/utility/exitcode"
+	"cli-things/utility/metrics"
+)
+
+// logger carries the diagnostics on stderr; -v shows its debug messages,
+// dbconf's included.
+var logger = clog.New(os.Stderr, "cloudflare-backup")
+
+func insertAccount(ctx context.Context, db *sql.DB, acct cfapi.Account) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO public.cloudflare_accounts (id, name, fetched_at, raw)
+		VALUES ($1, $2, now(), $3::jsonb)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, fetched_at = EXCLUDED.fetched_at, raw = EXCLUDED.raw`, acct.ID, acct.Name, string(acct.Raw))
+	return err
+}
+
+func insertZone(ctx context.Context, db *sql.DB, zone cfapi.Zone) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO public.cloudflare_zones (id, account_id, name, status, fetched_at, raw)
+		VALUES ($1, $2, $3, $4, now(), $5::jsonb)
+		ON CONFLICT (id) DO UPDATE SET account_id = EXCLUDED.account_id, name = EXCLUDED.name, status = EXCLUDED.status, fetched_at = EXCLUDED.fetched_at, raw = EXCLUDED.raw`, zone.ID, zone.Account.ID, zone.Name, zone.Status, string(zone.Raw))
+	return err
+}
+
+func insertDNSRecord(ctx context.Context, db *sql.DB, zoneID string, rec cfapi.DNSRecord, h recordHashes) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO public.cloudflare_dns_records (zone_id, id, name, type, content, ttl, proxied, fetched_at, raw, content_hash, raw_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, now(), $8::jsonb, $9, $10)
+		ON CONFLICT (zone_id, id) DO UPDATE SET name = EXCLUDED.name, type = EXCLUDED.type, content = EXCLUDED.content, ttl = EXCLUDED.ttl, proxied = EXCLUDED.proxied, fetched_at = EXCLUDED.fetched_at, raw = EXCLUDED.raw, content_hash = EXCLUDED.content_hash, raw_hash = EXCLUDED.raw_hash`, zoneID, rec.ID, rec.Name, rec.Type, rec.Content, rec.TTL, rec.Proxied, string(rec.Raw), h.Content, h.Raw)
+	return err
+}
+
+// zoneWatermark returns how many records are stored for the zone and the
+// newest modified_on among them. ok is false when nothing usable is stored.
+func zoneWatermark(ctx context.Context, db *sql.DB, zoneID string) (count int, watermark time.Time, ok bool, err error) {
+	var wm sql.NullTime
+	err = db.QueryRowContext(ctx, `SELECT count(*), max((raw->>'modified_on')::timestamptz)
+		FROM public.cloudflare_dns_records WHERE zone_id = $1`, zoneID).Scan(&count, &wm)
+	if err != nil {
+		return 0, time.Time{}, false, err
+	}
+	return count, wm.Time, wm.Valid && count > 0, nil
+}
+
+// startRun inserts the run row up front so per-run snapshots (such as zone
+// delegation) can reference it. The row is marked unsuccessful until
+// finishRun records the outcome.
+func startRun(ctx context.Context, db *sql.DB, incremental bool, tokenStatus string) (int64, error) {
+	var id int64
+	err := db.QueryRowContext(ctx, `INSERT INTO public.cloudflare_backup_runs (run_at, success, incremental, token_status)
+		VALUES (now(), false, $1, NULLIF($2, '')) RETURNING id`, incremental, tokenStatus).Scan(&id)
+	return id, err
+}
+
+func finishRun(ctx context.Context, db *sql.DB, runID int64, accounts, zones, records int, success bool, errMsg string) {
+	_, err := db.ExecContext(ctx, `UPDATE public.cloudflare_backup_runs
+		SET accounts_collected = $2, zones_collected = $3, records_collected = $4, success = $5, error = NULLIF($6, '')
+		WHERE id = $1`, runID, accounts, zones, records, success, errMsg)
+	if err != nil {
+		logger.Error("run record:", err)
+	}
+}
+
+// Run runs cloudflare-backup with args, the command line without the
+// program name. Failures are reported on stderr before they are returned.
+func Run(args []string) error {
+	return cli.Report(run(args), logger.Error)
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("cloudflare-backup", flag.ContinueOnError)
+	var dbname string
+	var timeout time.Duration
+	var verbose bool
+	var showDiff bool
+	var dryRun bool
+	// -metrics-file is the Prometheus textfile unless -metrics-format=json.
+	metricsOut := metrics.Output{Format: formatPrometheus}
+	var incremental bool
+	var excludeTypes stringList
+	var excludeNames stringList
+	var interval time.Duration
+	var jitter time.Duration
+	var replicateTo string
+	var strict bool
+	var profile string
+	fs.StringVar(&dbname, "db", "", "database name (default from dbconf)")
+	fs.StringVar(&profile, "profile", "", "config.ini section to use over [default], e.g. staging (default $DBTOOL_PROFILE)")
+	fs.DurationVar(&timeout, "timeout", 45*time.Second, "overall timeout for Cloudflare backup (per cycle with --interval)")
+	fs.BoolVar(&verbose, "v", false, "enable verbose diagnostics (dbconf, migrations)")
+	fs.BoolVar(&showDiff, "diff", false, "print changes detected since the previous run to stdout (record content changes and metadata-only drift are listed separately)")
+	fs.BoolVar(&dryRun, "dry-run", false, "fetch from Cloudflare and print what would be stored without writing to the database")
+	metricsOut.AddFlags(fs, formatPrometheus)
+	fs.BoolVar(&incremental, "incremental", false, "only upsert records modified since the previous run (full fetch when a zone's record count changed)")
+	fs.Var(&excludeTypes, "exclude-record-type", "skip records of this type, e.g. TXT (repeatable, comma-separated allowed)")
+	fs.Var(&excludeNames, "exclude-name-regex", "skip records whose name matches this regular expression (repeatable)")
+	fs.DurationVar(&interval, "interval", 0, "keep running and start a backup cycle every interval (e.g. 1h); 0 runs once")
+	fs.DurationVar(&jitter, "jitter", 0, "with --interval, add a random delay of up to this much before each cycle")
+	fs.StringVar(&replicateTo, "replicate-to", "", "after each successful run, copy its rows into this database (name resolved via dbconf, or a postgres:// / key=value DSN)")
+	fs.BoolVar(&strict, "strict", false, "refuse to run when the token preflight finds a problem (missing permission, inactive token)")
+	showVersion := buildinfo.AddFlag(fs)
+	logger.AddFlags(fs)
+	exitcode.SetUsage(fs)
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if showVersion.Requested() {
+		return buildinfo.Print(os.Stdout, "cloudflare-backup", showVersion.JSON())
+	}
+	metricsOut.Log = logger.Infof
+
+	exclude, err := newRecordExclusions(excludeTypes, excludeNames)
+	if err != nil {
+		return err
+	}
+	if interval < 0 || jitter < 0 {
+		return cli.Usagef("--interval and --jitter must not be negative")
+	}
+	if dryRun && strings.TrimSpace(replicateTo) != "" {
+		return cli.Usagef("--replicate-to cannot be combined with --dry-run")
+	}
+
+	if profile != "" {
+		dbconf.SetLoadOptions(dbconf.LoadOptions{Profile: profile})
+	}
+	logger.SetVerbose(verbose)
+	if logger.Enabled(clog.LevelDebug) {
+		// Show how the shared dbconf resolves configuration and migrations.
+		dbconf.SetLogger(logger.Debugf)
+		logger.Debug("verbose mode enabled")
+	}
+
+	// Resolve CLOUDFLARE_API_KEY from the environment, .env or config.ini,
+	// in that order (see dbconf.GetRawConfig).
+	cfg, err := dbconf.GetRawConfigWithSources()
+	if err != nil {
+		return exitcode.Wrap(exitcode.ConfigError, err)
+	}
+	tokenVal := cfg["CLOUDFLARE_API_KEY"]
+	token := strings.TrimSpace(tokenVal.Value)
+	if token != "" {
+		logger.Debug(tokenVal)
+	}
+	if token == "" {
+		return cli.Usagef("CLOUDFLARE_API_KEY not set")
+	}
+	if strings.TrimSpace(dbname) == "" && !dryRun {
+		d, err := dbconf.DefaultDBName()
+		if err != nil {
+			return fmt.Errorf("cannot determine default db: %w", err)
+		}
+		dbname = d
+	}
+
+	cf := cfapi.New(token)
+	cf.UserAgent = buildinfo.UserAgent("cloudflare-backup")
+	c := cycleConfig{
+		cf:          cf,
+		timeout:     timeout,
+		verbose:     verbose,
+		dryRun:      dryRun,
+		incremental: incremental && !dryRun,
+		showDiff:    showDiff,
+		metricsOut:  metricsOut,
+		exclude:     exclude,
+		strict:      strict,
+	}
+
+	if dryRun {
+		// Read-only: no migrations, no run record, no upserts. Only the
+		// Cloudflare API result decides the exit code.
+		logger.Info("dry run; nothing will be written to the database")
+	} else {
+		// Try shared migrations directory first (if present). This respects
+		// DB_MIGRATIONS_DIR / MIGRATIONS_DIR when configured, falling back
+		// to ./migrations. If migrations fail, abort early so we don't try
+		// to write into non-existent tables.
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := dbconf.ApplyConfiguredMigrations(ctx, dbname)
+		cancel()
+		if err != nil {
+			c.emitMetrics(runMetrics{Finished: time.Now()})
+			return fmt.Errorf("migrations failed: %w", err)
+		}
+		// One connection pool for the whole process; in --interval mode it
+		// is reused by every cycle.
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		db, err := dbconf.ConnectDBAsContext(ctx, dbname)
+		cancel()
+		if err != nil {
+			c.emitMetrics(runMetrics{Finished: time.Now()})
+			return fmt.Errorf("cannot connect to database: %w", err)
+		}
+		defer db.Close()
+		c.db = db
+
+		if strings.TrimSpace(replicateTo) != "" {
+			// The replica gets the same schema through the same migrations
+			// before the first run is copied into it.
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			replica, err := dbconf.ConnectTargetContext(ctx, replicateTo)
+			if err != nil {
+				cancel()
+				return fmt.Errorf("cannot connect to replica: %w", err)
+			}
+			defer replica.Close()
+			err = dbconf.ApplyConfiguredMigrationsDB(ctx, replica)
+			cancel()
+			if err != nil {
+				return fmt.Errorf("replica migrations failed: %w", err)
+			}
+			c.replica = replica
+		}
+	}
+
+	if interval > 0 {
+		runScheduler(c, interval, jitter)
+		return nil
+	}
+	// runCycle has reported its error already.
+	return cli.Reported(runCycle(context.Background(), c))
+}
@@ -0,0 +1,140 @@
+package cloudflarebackup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cli-things/utility/cfapi"
+
+	"github.com/lib/pq"
+)
+
+// dnssecNotConfigured is the status Cloudflare reports for zones that never
+// had DNSSEC enabled (or had it turned off). It is a valid state, not an error.
+const dnssecNotConfigured = "disabled"
+
+// zoneDelegation captures the nameserver assignment and DNSSEC state of a
+// zone as observed during a single backup run.
+type zoneDelegation struct {
+	ZoneID      string
+	ZoneName    string
+	NameServers []string
+	// DNSSECStatus is empty when the lookup failed; DNSSECError explains why.
+	DNSSECStatus string
+	DNSSECError  string
+	DNSSECRaw    json.RawMessage
+}
+
+// change describes a difference between the previous and current run.
+type change struct {
+	Zone   string
+	Kind   string
+	Detail string
+}
+
+func (c change) String() string {
+	return fmt.Sprintf("~ %s %s: %s", c.Zone, c.Kind, c.Detail)
+}
+
+// collectDelegation snapshots the zone's nameservers and DNSSEC state. API
+// failures are kept in DNSSECError so callers can tell them apart from the
+// "disabled" (not configured) state, which is a successful response.
+func collectDelegation(ctx context.Context, cf *cfapi.Client, zone cfapi.Zone) zoneDelegation {
+	ns := append([]string(nil), zone.NameServers...)
+	sort.Strings(ns)
+	d := zoneDelegation{ZoneID: zone.ID, ZoneName: zone.Name, NameServers: ns}
+	dnssec, err := cf.GetDNSSEC(ctx, zone.ID)
+	if err != nil {
+		d.DNSSECError = err.Error()
+		return d
+	}
+	d.DNSSECStatus = strings.TrimSpace(dnssec.Status)
+	if d.DNSSECStatus == "" {
+		d.DNSSECStatus = dnssecNotConfigured
+	}
+	d.DNSSECRaw = dnssec.Raw
+	return d
+}
+
+func insertDelegation(ctx context.Context, db *sql.DB, runID int64, d zoneDelegation) error {
+	var raw any
+	if len(d.DNSSECRaw) > 0 {
+		raw = string(d.DNSSECRaw)
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO public.cloudflare_zone_delegation (run_id, zone_id, name_servers, dnssec_status, dnssec_error, dnssec_raw, fetched_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6::jsonb, now())
+		ON CONFLICT (run_id, zone_id) DO UPDATE SET name_servers = EXCLUDED.name_servers, dnssec_status = EXCLUDED.dnssec_status, dnssec_error = EXCLUDED.dnssec_error, dnssec_raw = EXCLUDED.dnssec_raw, fetched_at = EXCLUDED.fetched_at`,
+		runID, d.ZoneID, pq.Array(d.NameServers), d.DNSSECStatus, d.DNSSECError, raw)
+	return err
+}
+
+// previousDelegation loads the most recent snapshot for the zone recorded by
+// an earlier run. ok is false when the zone has no history yet.
+func previousDelegation(ctx context.Context, db *sql.DB, runID int64, zoneID string) (zoneDelegation, bool, error) {
+	var (
+		d      = zoneDelegation{ZoneID: zoneID}
+		status sql.NullString
+		errMsg sql.NullString
+	)
+	row := db.QueryRowContext(ctx, `SELECT name_servers, dnssec_status, dnssec_error
+		FROM public.cloudflare_zone_delegation
+		WHERE zone_id = $1 AND run_id < $2
+		ORDER BY run_id DESC LIMIT 1`, zoneID, runID)
+	if err := row.Scan(pq.Array(&d.NameServers), &status, &errMsg); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return zoneDelegation{}, false, nil
+		}
+		return zoneDelegation{}, false, err
+	}
+	d.DNSSECStatus = status.String
+	d.DNSSECError = errMsg.String
+	return d, true, nil
+}
+
+// diffDelegation compares two snapshots of the same zone. Nameservers are
+// compared as a set, since their order means nothing. DNSSEC is only
+// compared when both lookups succeeded so a transient API error is never
+// reported as DNSSEC having been switched off.
+func diffDelegation(prev, cur zoneDelegation) []change {
+	var out []change
+	if sortedJoin(prev.NameServers) != sortedJoin(cur.NameServers) {
+		out = append(out, change{
+			Zone:   cur.ZoneName,
+			Kind:   "nameservers",
+			Detail: fmt.Sprintf("%s -> %s", formatNameServers(prev.NameServers), formatNameServers(cur.NameServers)),
+		})
+	}
+	if prev.DNSSECStatus != "" && cur.DNSSECStatus != "" && prev.DNSSECStatus != cur.DNSSECStatus {
+		out = append(out, change{
+			Zone:   cur.ZoneName,
+			Kind:   "dnssec",
+			Detail: fmt.Sprintf("%s -> %s", describeDNSSEC(prev.DNSSECStatus), describeDNSSEC(cur.DNSSECStatus)),
+		})
+	}
+	return out
+}
+
+func sortedJoin(ns []string) string {
+	s := append([]string(nil), ns...)
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func formatNameServers(ns []string) string {
+	if len(ns) == 0 {
+		return "(none)"
+	}
+	return strings.Join(ns, ",")
+}
+
+func describeDNSSEC(status string) string {
+	if status == dnssecNotConfigured {
+		return status + " (not configured)"
+	}
+	return status
+}
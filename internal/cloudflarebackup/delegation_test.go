@@ -0,0 +1,72 @@
+package cloudflarebackup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffDelegation(t *testing.T) {
+	ns := []string{"ada.ns.cloudflare.com", "bob.ns.cloudflare.com"}
+	snap := func(status, errMsg string, nameServers ...string) zoneDelegation {
+		return zoneDelegation{ZoneID: "z1", ZoneName: "example.com", NameServers: nameServers, DNSSECStatus: status, DNSSECError: errMsg}
+	}
+	cases := []struct {
+		name      string
+		prev, cur zoneDelegation
+		want      []change
+	}{
+		{"unchanged", snap("active", "", ns...), snap("active", "", ns...), nil},
+		{
+			"reordered nameservers",
+			snap("active", "", "bob.ns.cloudflare.com", "ada.ns.cloudflare.com"),
+			snap("active", "", ns...),
+			nil,
+		},
+		{
+			"added nameserver",
+			snap("active", "", ns...),
+			snap("active", "", "ada.ns.cloudflare.com", "bob.ns.cloudflare.com", "cy.ns.cloudflare.com"),
+			[]change{{Zone: "example.com", Kind: "nameservers", Detail: "ada.ns.cloudflare.com,bob.ns.cloudflare.com -> ada.ns.cloudflare.com,bob.ns.cloudflare.com,cy.ns.cloudflare.com"}},
+		},
+		{
+			"replaced nameservers",
+			snap("active", "", ns...),
+			snap("active", "", "ns1.example.net"),
+			[]change{{Zone: "example.com", Kind: "nameservers", Detail: "ada.ns.cloudflare.com,bob.ns.cloudflare.com -> ns1.example.net"}},
+		},
+		{
+			"nameservers removed",
+			snap("active", "", ns...),
+			snap("active", ""),
+			[]change{{Zone: "example.com", Kind: "nameservers", Detail: "ada.ns.cloudflare.com,bob.ns.cloudflare.com -> (none)"}},
+		},
+		{
+			"dnssec enabled",
+			snap(dnssecNotConfigured, "", ns...),
+			snap("pending", "", ns...),
+			[]change{{Zone: "example.com", Kind: "dnssec", Detail: "disabled (not configured) -> pending"}},
+		},
+		{
+			"dnssec disabled",
+			snap("active", "", ns...),
+			snap(dnssecNotConfigured, "", ns...),
+			[]change{{Zone: "example.com", Kind: "dnssec", Detail: "active -> disabled (not configured)"}},
+		},
+		{"dnssec lookup failed now", snap("active", "", ns...), snap("", "403 Forbidden", ns...), nil},
+		{"dnssec lookup failed before", snap("", "timeout", ns...), snap(dnssecNotConfigured, "", ns...), nil},
+		{
+			"both",
+			snap("active", "", ns...),
+			snap(dnssecNotConfigured, "", "ns1.example.net"),
+			[]change{
+				{Zone: "example.com", Kind: "nameservers", Detail: "ada.ns.cloudflare.com,bob.ns.cloudflare.com -> ns1.example.net"},
+				{Zone: "example.com", Kind: "dnssec", Detail: "active -> disabled (not configured)"},
+			},
+		},
+	}
+	for _, c := range cases {
+		if got := diffDelegation(c.prev, c.cur); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: diffDelegation = %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
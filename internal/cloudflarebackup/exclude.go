@@ -0,0 +1,75 @@
+package cloudflarebackup
+
+import (
+	"regexp"
+	"strings"
+
+	"cli-things/utility/cfapi"
+	"cli-things/utility/exitcode"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// recordExclusions drops record classes (for example ACME challenge TXT
+// records) before they are stored or compared, so they never show up in
+// backups or diffs.
+type recordExclusions struct {
+	types map[string]bool
+	names []*regexp.Regexp
+}
+
+// newRecordExclusions builds the exclusions from the --exclude-record-type
+// values (comma-separated types, any case) and the --exclude-name-regex
+// ones. An invalid regular expression is a ConfigError.
+func newRecordExclusions(types, nameRegexps []string) (recordExclusions, error) {
+	e := recordExclusions{types: make(map[string]bool)}
+	for _, t := range types {
+		for _, part := range strings.Split(t, ",") {
+			if part = strings.ToUpper(strings.TrimSpace(part)); part != "" {
+				e.types[part] = true
+			}
+		}
+	}
+	for _, expr := range nameRegexps {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return recordExclusions{}, exitcode.Configf("invalid --exclude-name-regex %q: %w", expr, err)
+		}
+		e.names = append(e.names, re)
+	}
+	return e, nil
+}
+
+func (e recordExclusions) excludes(rec cfapi.DNSRecord) bool {
+	if e.types[strings.ToUpper(rec.Type)] {
+		return true
+	}
+	for _, re := range e.names {
+		if re.MatchString(rec.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the records that are not excluded and how many were dropped.
+func (e recordExclusions) filter(records []cfapi.DNSRecord) ([]cfapi.DNSRecord, int) {
+	if len(e.types) == 0 && len(e.names) == 0 {
+		return records, 0
+	}
+	kept := records[:0:0]
+	for _, rec := range records {
+		if !e.excludes(rec) {
+			kept = append(kept, rec)
+		}
+	}
+	return kept, len(records) - len(kept)
+}
@@ -0,0 +1,85 @@
+package cloudflarebackup
+
+import (
+	"reflect"
+	"testing"
+
+	"cli-things/utility/cfapi"
+	"cli-things/utility/exitcode"
+)
+
+func TestRecordExclusions(t *testing.T) {
+	records := []cfapi.DNSRecord{
+		{Type: "A", Name: "example.com"},
+		{Type: "TXT", Name: "_acme-challenge.example.com"},
+		{Type: "TXT", Name: "example.com"},
+		{Type: "MX", Name: "example.com"},
+		{Type: "CNAME", Name: "www.example.com"},
+		{Type: "AAAA", Name: "tmp-42.example.com"},
+	}
+	cases := []struct {
+		name    string
+		types   []string
+		regexps []string
+		want    []string // Type + " " + Name of the kept records
+		wantErr bool
+	}{
+		{
+			name: "none",
+			want: []string{"A example.com", "TXT _acme-challenge.example.com", "TXT example.com", "MX example.com", "CNAME www.example.com", "AAAA tmp-42.example.com"},
+		},
+		{
+			name:  "type, any case",
+			types: []string{"txt"},
+			want:  []string{"A example.com", "MX example.com", "CNAME www.example.com", "AAAA tmp-42.example.com"},
+		},
+		{
+			name:  "repeated and comma-separated types",
+			types: []string{"TXT, mx", "cname", ""},
+			want:  []string{"A example.com", "AAAA tmp-42.example.com"},
+		},
+		{
+			name:    "name regex",
+			regexps: []string{`^_acme-challenge\.`},
+			want:    []string{"A example.com", "TXT example.com", "MX example.com", "CNAME www.example.com", "AAAA tmp-42.example.com"},
+		},
+		{
+			name:    "type or any regex",
+			types:   []string{"MX"},
+			regexps: []string{`^_acme-challenge\.`, `^tmp-\d+\.`},
+			want:    []string{"A example.com", "TXT example.com", "CNAME www.example.com"},
+		},
+		{
+			name:    "invalid regex",
+			regexps: []string{`^_acme-challenge\.`, `(`},
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		e, err := newRecordExclusions(c.types, c.regexps)
+		if c.wantErr {
+			if code := exitcode.Of(err); code != exitcode.ConfigError {
+				t.Errorf("%s: err = %v (exit %d), want a ConfigError", c.name, err, code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		kept, dropped := e.filter(records)
+		var got []string
+		for _, r := range kept {
+			got = append(got, r.Type+" "+r.Name)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: kept %q, want %q", c.name, got, c.want)
+		}
+		if dropped != len(records)-len(c.want) {
+			t.Errorf("%s: dropped %d, want %d", c.name, dropped, len(records)-len(c.want))
+		}
+	}
+	// filter must not reorder or overwrite the caller's slice.
+	if records[1].Name != "_acme-challenge.example.com" {
+		t.Errorf("filter modified its input: %+v", records)
+	}
+}
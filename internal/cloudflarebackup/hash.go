@@ -0,0 +1,123 @@
+package cloudflarebackup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"cli-things/utility/cfapi"
+)
+
+// recordHashes identifies a stored record version. Content covers only the
+// fields that define what the record resolves to; Raw covers the full API
+// JSON, so Raw moving without Content means Cloudflare only changed metadata.
+type recordHashes struct {
+	Content string
+	Raw     string
+}
+
+// contentHash hashes the normalized record fields: type, name, content, ttl,
+// proxied, priority and data. Fields Cloudflare adds to the JSON later do not
+// affect it.
+func contentHash(rec cfapi.DNSRecord) string {
+	norm := struct {
+		Type     string `json:"type"`
+		Name     string `json:"name"`
+		Content  string `json:"content"`
+		TTL      int    `json:"ttl"`
+		Proxied  *bool  `json:"proxied"`
+		Priority *int   `json:"priority"`
+		Data     any    `json:"data"`
+	}{rec.Type, rec.Name, rec.Content, rec.TTL, rec.Proxied, rec.Priority, canonicalJSON(rec.Data)}
+	b, _ := json.Marshal(norm)
+	return hashBytes(b)
+}
+
+// rawHash hashes the full record JSON with object keys sorted, so key order
+// alone never counts as drift.
+func rawHash(rec cfapi.DNSRecord) string {
+	b, _ := json.Marshal(canonicalJSON(rec.Raw))
+	return hashBytes(b)
+}
+
+// canonicalJSON decodes raw into generic values; re-encoding them sorts
+// object keys. Empty or invalid input yields nil.
+func canonicalJSON(raw json.RawMessage) any {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return string(raw)
+	}
+	return v
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// storedRecordHashes loads the hashes of every record stored for the zone.
+// Rows written before hashes existed are left out so they are not diffed.
+func storedRecordHashes(ctx context.Context, db *sql.DB, zoneID string) (map[string]recordHashes, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, content_hash, raw_hash FROM public.cloudflare_dns_records
+		WHERE zone_id = $1 AND content_hash IS NOT NULL`, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]recordHashes)
+	for rows.Next() {
+		var id string
+		var content, raw sql.NullString
+		if err := rows.Scan(&id, &content, &raw); err != nil {
+			return nil, err
+		}
+		out[id] = recordHashes{Content: content.String, Raw: raw.String}
+	}
+	return out, rows.Err()
+}
+
+// storedRecord loads the record stored under id from its raw JSON.
+func storedRecord(ctx context.Context, db *sql.DB, zoneID, id string) (cfapi.DNSRecord, error) {
+	var raw []byte
+	var rec cfapi.DNSRecord
+	err := db.QueryRowContext(ctx, `SELECT raw FROM public.cloudflare_dns_records WHERE zone_id = $1 AND id = $2`, zoneID, id).Scan(&raw)
+	if err != nil {
+		return rec, err
+	}
+	err = json.Unmarshal(raw, &rec)
+	return rec, err
+}
+
+// diffRecord compares a fetched record with its stored hashes. A content
+// change is a "record" change; a raw-only change is "record-metadata" drift,
+// and so is a content hash change between records that are still
+// cfapi.DNSRecord.Equal, such as a TXT value Cloudflare started quoting.
+// prevRec is the stored record, nil when it was not loaded.
+func diffRecord(zoneName string, rec cfapi.DNSRecord, prev, cur recordHashes, prevRec *cfapi.DNSRecord) (change, bool) {
+	label := rec.Type + " " + rec.Name
+	switch {
+	case prev.Content != cur.Content && prevRec != nil && prevRec.Equal(rec):
+		return change{Zone: zoneName, Kind: "record-metadata", Detail: fmt.Sprintf("%s content %s -> %s (equivalent)", label, shortHash(prev.Content), shortHash(cur.Content))}, true
+	case prev.Content != cur.Content:
+		return change{Zone: zoneName, Kind: "record", Detail: fmt.Sprintf("%s content %s -> %s", label, shortHash(prev.Content), shortHash(cur.Content))}, true
+	case prev.Raw != "" && prev.Raw != cur.Raw:
+		return change{Zone: zoneName, Kind: "record-metadata", Detail: fmt.Sprintf("%s raw %s -> %s (content unchanged)", label, shortHash(prev.Raw), shortHash(cur.Raw))}, true
+	}
+	return change{}, false
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
@@ -0,0 +1,114 @@
+package cloudflarebackup
+
+import (
+	"encoding/json"
+	"testing"
+
+	"cli-things/utility/cfapi"
+)
+
+const mxRecord = `{"id":"r1","zone_id":"z1","type":"MX","name":"example.com","content":"mail.example.com","ttl":300,"proxied":false,"priority":10,"comment":null,"tags":[],"modified_on":"2026-01-02T03:04:05Z"}`
+
+func decodeRecord(t *testing.T, s string) cfapi.DNSRecord {
+	t.Helper()
+	var rec cfapi.DNSRecord
+	if err := json.Unmarshal([]byte(s), &rec); err != nil {
+		t.Fatalf("decode %s: %v", s, err)
+	}
+	return rec
+}
+
+func TestRecordHashes(t *testing.T) {
+	cases := []struct {
+		name          string
+		before, after string
+		// wantKind is the change diffRecord reports, "" for none.
+		wantKind string
+	}{
+		{"unchanged", mxRecord, mxRecord, ""},
+		{
+			"key order",
+			mxRecord,
+			`{"modified_on":"2026-01-02T03:04:05Z","tags":[],"comment":null,"priority":10,"proxied":false,"ttl":300,"content":"mail.example.com","name":"example.com","type":"MX","zone_id":"z1","id":"r1"}`,
+			"",
+		},
+		{
+			"data key order",
+			`{"id":"r2","type":"SRV","name":"_sip._tcp.example.com","ttl":1,"priority":10,"data":{"port":5060,"priority":10,"target":"sip.example.com","weight":5}}`,
+			`{"id":"r2","type":"SRV","name":"_sip._tcp.example.com","ttl":1,"priority":10,"data":{"weight":5,"target":"sip.example.com","priority":10,"port":5060}}`,
+			"",
+		},
+		{
+			"ttl only",
+			mxRecord,
+			`{"id":"r1","zone_id":"z1","type":"MX","name":"example.com","content":"mail.example.com","ttl":3600,"proxied":false,"priority":10,"comment":null,"tags":[],"modified_on":"2026-01-02T03:04:05Z"}`,
+			"record",
+		},
+		{
+			"comment only",
+			mxRecord,
+			`{"id":"r1","zone_id":"z1","type":"MX","name":"example.com","content":"mail.example.com","ttl":300,"proxied":false,"priority":10,"comment":"primary MX","tags":[],"modified_on":"2026-03-04T05:06:07Z"}`,
+			"record-metadata",
+		},
+		{
+			"new API field",
+			mxRecord,
+			`{"id":"r1","zone_id":"z1","type":"MX","name":"example.com","content":"mail.example.com","ttl":300,"proxied":false,"priority":10,"comment":null,"tags":[],"modified_on":"2026-01-02T03:04:05Z","settings":{}}`,
+			"record-metadata",
+		},
+		{
+			"proxied",
+			mxRecord,
+			`{"id":"r1","zone_id":"z1","type":"MX","name":"example.com","content":"mail.example.com","ttl":300,"proxied":true,"priority":10,"comment":null,"tags":[],"modified_on":"2026-01-02T03:04:05Z"}`,
+			"record",
+		},
+		{
+			"priority",
+			mxRecord,
+			`{"id":"r1","zone_id":"z1","type":"MX","name":"example.com","content":"mail.example.com","ttl":300,"proxied":false,"priority":20,"comment":null,"tags":[],"modified_on":"2026-01-02T03:04:05Z"}`,
+			"record",
+		},
+		{
+			"content",
+			mxRecord,
+			`{"id":"r1","zone_id":"z1","type":"MX","name":"example.com","content":"mx2.example.com","ttl":300,"proxied":false,"priority":10,"comment":null,"tags":[],"modified_on":"2026-01-02T03:04:05Z"}`,
+			"record",
+		},
+		{
+			"equivalent TXT quoting",
+			`{"id":"r3","type":"TXT","name":"example.com","content":"v=spf1 -all","ttl":1}`,
+			`{"id":"r3","type":"TXT","name":"example.com","content":"\"v=spf1 -all\"","ttl":1}`,
+			"record-metadata",
+		},
+	}
+	for _, c := range cases {
+		before, after := decodeRecord(t, c.before), decodeRecord(t, c.after)
+		prev := recordHashes{Content: contentHash(before), Raw: rawHash(before)}
+		cur := recordHashes{Content: contentHash(after), Raw: rawHash(after)}
+		got, changed := diffRecord("example.com", after, prev, cur, &before)
+		if !changed {
+			got.Kind = ""
+		}
+		if got.Kind != c.wantKind {
+			t.Errorf("%s: change %q (%s), want %q", c.name, got.Kind, got.Detail, c.wantKind)
+		}
+		if c.wantKind == "" && prev != cur {
+			t.Errorf("%s: hashes moved: %+v -> %+v", c.name, prev, cur)
+		}
+	}
+}
+
+func TestDiffRecordWithoutStoredRecord(t *testing.T) {
+	// When the stored record cannot be loaded, a content hash change is
+	// reported as a change rather than guessed to be equivalent.
+	prev := recordHashes{Content: "a", Raw: "r"}
+	cur := recordHashes{Content: "b", Raw: "s"}
+	got, changed := diffRecord("example.com", decodeRecord(t, mxRecord), prev, cur, nil)
+	if !changed || got.Kind != "record" {
+		t.Errorf("diffRecord = %+v, %v; want a record change", got, changed)
+	}
+	// Rows stored before raw hashes existed have no raw hash to compare.
+	if got, changed := diffRecord("example.com", decodeRecord(t, mxRecord), recordHashes{Content: "a"}, recordHashes{Content: "a", Raw: "s"}, nil); changed {
+		t.Errorf("diffRecord without a stored raw hash = %+v, want no change", got)
+	}
+}
@@ -0,0 +1,81 @@
+package cloudflarebackup
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cli-things/utility/atomicfile"
+)
+
+const metricLastSuccess = "cloudflare_backup_last_success_timestamp"
+
+// formatPrometheus is the --metrics-format of the textfile written here, the
+// default for cloudflare-backup's --metrics-file.
+const formatPrometheus = "prometheus"
+
+// runMetrics is the per-run summary exported for the node_exporter textfile
+// collector.
+type runMetrics struct {
+	Zones    int
+	Records  int
+	Duration time.Duration
+	Success  bool
+	Finished time.Time
+}
+
+// writeMetricsFile renders m in the Prometheus text format and atomically
+// replaces path (see atomicfile) so the collector never reads a partial
+// file. The last-success timestamp only moves forward on successful runs;
+// failed runs carry over the value already in the file.
+func writeMetricsFile(path string, m runMetrics) error {
+	lastSuccess, _ := readMetricValue(path, metricLastSuccess)
+	if m.Success {
+		lastSuccess = float64(m.Finished.Unix())
+	}
+	success := 0
+	if m.Success {
+		success = 1
+	}
+
+	var buf bytes.Buffer
+	writeGauge(&buf, metricLastSuccess, "Unix time of the last fully successful backup run.", lastSuccess)
+	writeGauge(&buf, "cloudflare_backup_zones", "Zones collected by the last run.", float64(m.Zones))
+	writeGauge(&buf, "cloudflare_backup_records", "DNS records collected by the last run.", float64(m.Records))
+	writeGauge(&buf, "cloudflare_backup_duration_seconds", "Duration of the last run in seconds.", m.Duration.Seconds())
+	writeGauge(&buf, "cloudflare_backup_success", "Whether the last run succeeded (1) or failed (0).", float64(success))
+
+	return atomicfile.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+func writeGauge(buf *bytes.Buffer, name, help string, value float64) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s gauge\n", name)
+	fmt.Fprintf(buf, "%s %s\n", name, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// readMetricValue returns the value of an unlabelled metric from an existing
+// textfile. ok is false when the file or metric does not exist.
+func readMetricValue(path, name string) (float64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == name {
+			v, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return 0, false
+			}
+			return v, true
+		}
+	}
+	return 0, false
+}
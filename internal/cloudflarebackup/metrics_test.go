@@ -0,0 +1,81 @@
+package cloudflarebackup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteMetricsFile(t *testing.T) {
+	t1 := time.Unix(1_700_000_000, 0)
+	t2 := t1.Add(time.Hour)
+	// The runs are written to the same file one after another.
+	runs := []struct {
+		name string
+		m    runMetrics
+		want map[string]float64
+	}{
+		{
+			name: "failure before any success",
+			m:    runMetrics{Zones: 1, Records: 2, Duration: 1500 * time.Millisecond, Finished: t1},
+			want: map[string]float64{metricLastSuccess: 0, "cloudflare_backup_success": 0, "cloudflare_backup_zones": 1, "cloudflare_backup_records": 2, "cloudflare_backup_duration_seconds": 1.5},
+		},
+		{
+			name: "success",
+			m:    runMetrics{Zones: 3, Records: 40, Duration: 2 * time.Second, Success: true, Finished: t1},
+			want: map[string]float64{metricLastSuccess: float64(t1.Unix()), "cloudflare_backup_success": 1, "cloudflare_backup_zones": 3, "cloudflare_backup_records": 40, "cloudflare_backup_duration_seconds": 2},
+		},
+		{
+			name: "failure keeps the last success",
+			m:    runMetrics{Duration: time.Second, Finished: t2},
+			want: map[string]float64{metricLastSuccess: float64(t1.Unix()), "cloudflare_backup_success": 0, "cloudflare_backup_zones": 0, "cloudflare_backup_records": 0},
+		},
+		{
+			name: "next success moves it forward",
+			m:    runMetrics{Zones: 3, Records: 41, Success: true, Finished: t2},
+			want: map[string]float64{metricLastSuccess: float64(t2.Unix()), "cloudflare_backup_success": 1, "cloudflare_backup_records": 41},
+		},
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cloudflare_backup.prom")
+	if _, ok := readMetricValue(path, metricLastSuccess); ok {
+		t.Fatal("readMetricValue found a value in a missing file")
+	}
+	for _, r := range runs {
+		if err := writeMetricsFile(path, r.m); err != nil {
+			t.Fatalf("%s: %v", r.name, err)
+		}
+		for name, want := range r.want {
+			got, ok := readMetricValue(path, name)
+			if !ok || got != want {
+				t.Errorf("%s: %s = %v (found %v), want %v", r.name, name, got, ok, want)
+			}
+		}
+		if _, ok := readMetricValue(path, "cloudflare_backup_nope"); ok {
+			t.Errorf("%s: readMetricValue found a metric that is not there", r.name)
+		}
+		// The temp file was renamed over path, not left beside it.
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != filepath.Base(path) {
+			t.Errorf("%s: directory holds %v, want only %s", r.name, entries, filepath.Base(path))
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o644 {
+			t.Errorf("%s: stat = %v, %v; want mode 0644", r.name, info, err)
+		}
+	}
+}
+
+func TestWriteMetricsFileMissingDir(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "cloudflare_backup.prom")
+	if err := writeMetricsFile(path, runMetrics{Success: true, Finished: time.Now()}); err == nil {
+		t.Fatal("writeMetricsFile into a missing directory succeeded")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("stat after failed write: %v, want not exist", err)
+	}
+}
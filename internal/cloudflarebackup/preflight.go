@@ -0,0 +1,87 @@
+package cloudflarebackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"cli-things/utility/cfapi"
+)
+
+// preflightResult is what the token check found before the main loop.
+// TokenStatus is stored on the run record; Problems name the permission
+// that appears to be missing.
+type preflightResult struct {
+	TokenStatus string
+	Problems    []string
+}
+
+func (p *preflightResult) problem(format string, a ...any) {
+	p.Problems = append(p.Problems, fmt.Sprintf(format, a...))
+}
+
+// errUnauthorized is the Cloudflare error code for a token whose permissions
+// do not cover the resource ("Unauthorized to access requested resource").
+const errUnauthorized = 9109
+
+// preflight verifies the token and probes the endpoints a backup depends on
+// with single-item requests. A token without Zone.DNS:Read still lists zones,
+// so the first zone's records are fetched explicitly. A missing permission
+// is only reported when the API refuses the request (403 or error 9109); a
+// zone without records is a valid answer, not a sign of one.
+func preflight(ctx context.Context, cf *cfapi.Client) preflightResult {
+	var p preflightResult
+
+	ts, err := cf.VerifyToken(ctx)
+	switch {
+	case err != nil:
+		p.TokenStatus = "verify failed"
+		p.problem("token verification failed: %v", err)
+	case ts.Status != "active":
+		p.TokenStatus = ts.Status
+		p.problem("token status is %q, expected \"active\"", ts.Status)
+	default:
+		p.TokenStatus = ts.Status
+	}
+
+	one := url.Values{"per_page": {"1"}}
+	var zones []cfapi.Zone
+	if _, err := cf.Do(ctx, http.MethodGet, "/zones", one, nil, &zones); err != nil {
+		if isPermissionError(err) {
+			p.problem("cannot list zones; the token lacks Zone:Read (%v)", err)
+		} else {
+			p.problem("cannot list zones: %v", err)
+		}
+		return p
+	}
+	if len(zones) == 0 {
+		p.problem("the token sees no zones; it appears to lack Zone:Read or its zone resources are empty")
+		return p
+	}
+
+	zone := zones[0]
+	var recs []cfapi.DNSRecord
+	if _, err := cf.Do(ctx, http.MethodGet, "/zones/"+url.PathEscape(zone.ID)+"/dns_records", one, nil, &recs); err != nil {
+		if isPermissionError(err) {
+			p.problem("cannot list DNS records of zone %s; the token lacks Zone.DNS:Read (%v)", zone.Name, err)
+		} else {
+			p.problem("cannot list DNS records of zone %s: %v", zone.Name, err)
+		}
+	}
+	return p
+}
+
+// isPermissionError reports whether the API refused a request because the
+// token is not allowed to make it.
+func isPermissionError(err error) bool {
+	var apiErr *cfapi.APIError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusForbidden || apiErr.HasCode(errUnauthorized))
+}
+
+func (p preflightResult) report() {
+	for _, msg := range p.Problems {
+		logger.Warn("preflight:", msg)
+	}
+}
@@ -0,0 +1,92 @@
+package cloudflarebackup
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cli-things/utility/cfapi"
+)
+
+// fakeCloudflare answers the three preflight requests: an active token, one
+// zone, and the records response given.
+func fakeCloudflare(t *testing.T, recordsStatus int, records string) *cfapi.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/user/tokens/verify":
+			_, _ = w.Write([]byte(`{"success":true,"errors":[],"result":{"id":"t1","status":"active"}}`))
+		case "/zones":
+			_, _ = w.Write([]byte(`{"success":true,"errors":[],"result":[{"id":"z1","name":"example.com"}],"result_info":{"page":1,"per_page":1,"count":1,"total_count":1}}`))
+		case "/zones/z1/dns_records":
+			w.WriteHeader(recordsStatus)
+			_, _ = w.Write([]byte(records))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	cf := cfapi.New("test-token")
+	cf.BaseURL = srv.URL
+	cf.HTTPClient = srv.Client()
+	cf.Attempts, cf.Backoff = 1, time.Millisecond
+	return cf
+}
+
+func TestPreflightRecords(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		body    string
+		problem string // substring of the only problem, "" for none
+	}{
+		{
+			name:   "records",
+			status: http.StatusOK,
+			body:   `{"success":true,"errors":[],"result":[{"id":"r1","type":"A","name":"example.com","content":"192.0.2.1"}],"result_info":{"page":1,"per_page":1,"count":1,"total_count":7}}`,
+		},
+		{
+			name:   "empty zone",
+			status: http.StatusOK,
+			body:   `{"success":true,"errors":[],"result":[],"result_info":{"page":1,"per_page":1,"count":0,"total_count":0}}`,
+		},
+		{
+			name:    "forbidden",
+			status:  http.StatusForbidden,
+			body:    `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}],"result":null}`,
+			problem: "lacks Zone.DNS:Read",
+		},
+		{
+			name:    "unauthorized code",
+			status:  http.StatusBadRequest,
+			body:    `{"success":false,"errors":[{"code":9109,"message":"Unauthorized to access requested resource"}],"result":null}`,
+			problem: "lacks Zone.DNS:Read",
+		},
+		{
+			name:    "other error",
+			status:  http.StatusBadRequest,
+			body:    `{"success":false,"errors":[{"code":7003,"message":"Could not route to /zones/z1/dns_records"}],"result":null}`,
+			problem: "cannot list DNS records of zone example.com: cloudflare api: status 400",
+		},
+	}
+	for _, c := range cases {
+		p := preflight(context.Background(), fakeCloudflare(t, c.status, c.body))
+		if p.TokenStatus != "active" {
+			t.Errorf("%s: TokenStatus = %q, want active", c.name, p.TokenStatus)
+		}
+		switch {
+		case c.problem == "" && len(p.Problems) != 0:
+			t.Errorf("%s: problems %q, want none", c.name, p.Problems)
+		case c.problem != "" && (len(p.Problems) != 1 || !strings.Contains(p.Problems[0], c.problem)):
+			t.Errorf("%s: problems %q, want one containing %q", c.name, p.Problems, c.problem)
+		}
+		if c.problem != "" && !strings.Contains(c.problem, "lacks") && strings.Contains(p.Problems[0], "lacks") {
+			t.Errorf("%s: %q blames a permission for an unrelated error", c.name, p.Problems[0])
+		}
+	}
+}
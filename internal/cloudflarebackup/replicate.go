@@ -0,0 +1,165 @@
+package cloudflarebackup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// replicateRun copies one finished run from src into dst inside a single
+// destination transaction: the run row, its delegation snapshots, and the
+// accounts, zones and records that run fetched. Every row is upserted on its
+// natural key (run id, account id, zone id, (zone_id, record id),
+// (run_id, zone_id)) so replicating the same run twice is harmless.
+//
+// Accounts, zones and records are current-state tables, so "the run's rows"
+// are the accounts and zones fetched at or after the run started and every
+// record of those zones. That also covers records an --incremental run did
+// not rewrite.
+func replicateRun(ctx context.Context, src, dst *sql.DB, runID int64) (rows int, err error) {
+	var (
+		runAt       time.Time
+		accounts    int
+		zones       int
+		records     int
+		success     bool
+		errMsg      sql.NullString
+		incremental bool
+		tokenStatus sql.NullString
+	)
+	err = src.QueryRowContext(ctx, `SELECT run_at, accounts_collected, zones_collected, records_collected, success, error, incremental, token_status
+		FROM public.cloudflare_backup_runs WHERE id = $1`, runID).
+		Scan(&runAt, &accounts, &zones, &records, &success, &errMsg, &incremental, &tokenStatus)
+	if err != nil {
+		return 0, fmt.Errorf("load run %d: %w", runID, err)
+	}
+
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO public.cloudflare_backup_runs (id, run_at, accounts_collected, zones_collected, records_collected, success, error, incremental, token_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET run_at = EXCLUDED.run_at, accounts_collected = EXCLUDED.accounts_collected, zones_collected = EXCLUDED.zones_collected, records_collected = EXCLUDED.records_collected, success = EXCLUDED.success, error = EXCLUDED.error, incremental = EXCLUDED.incremental, token_status = EXCLUDED.token_status`,
+		runID, runAt, accounts, zones, records, success, errMsg, incremental, tokenStatus)
+	if err != nil {
+		return 0, fmt.Errorf("replicate run: %w", err)
+	}
+	rows++
+	// Explicit ids do not advance the destination sequence; keep it ahead so
+	// a backup run directly against the replica cannot collide.
+	_, err = tx.ExecContext(ctx, `SELECT setval(pg_get_serial_sequence('public.cloudflare_backup_runs', 'id'), (SELECT max(id) FROM public.cloudflare_backup_runs))`)
+	if err != nil {
+		return 0, fmt.Errorf("advance run id sequence: %w", err)
+	}
+
+	n, err := copyRows(ctx, src, tx, `SELECT id, name, fetched_at, raw FROM public.cloudflare_accounts WHERE fetched_at >= $1`, []any{runAt},
+		`INSERT INTO public.cloudflare_accounts (id, name, fetched_at, raw) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, fetched_at = EXCLUDED.fetched_at, raw = EXCLUDED.raw`,
+		func(r *sql.Rows) ([]any, error) {
+			var id, name, raw string
+			var fetched time.Time
+			err := r.Scan(&id, &name, &fetched, &raw)
+			return []any{id, name, fetched, raw}, err
+		})
+	if err != nil {
+		return 0, fmt.Errorf("replicate accounts: %w", err)
+	}
+	rows += n
+
+	n, err = copyRows(ctx, src, tx, `SELECT id, account_id, name, status, fetched_at, raw FROM public.cloudflare_zones WHERE fetched_at >= $1`, []any{runAt},
+		`INSERT INTO public.cloudflare_zones (id, account_id, name, status, fetched_at, raw) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET account_id = EXCLUDED.account_id, name = EXCLUDED.name, status = EXCLUDED.status, fetched_at = EXCLUDED.fetched_at, raw = EXCLUDED.raw`,
+		func(r *sql.Rows) ([]any, error) {
+			var id, name, raw string
+			var accountID, status sql.NullString
+			var fetched time.Time
+			err := r.Scan(&id, &accountID, &name, &status, &fetched, &raw)
+			return []any{id, accountID, name, status, fetched, raw}, err
+		})
+	if err != nil {
+		return 0, fmt.Errorf("replicate zones: %w", err)
+	}
+	rows += n
+
+	n, err = copyRows(ctx, src, tx, `SELECT r.zone_id, r.id, r.name, r.type, r.content, r.ttl, r.proxied, r.fetched_at, r.raw, r.content_hash, r.raw_hash
+		FROM public.cloudflare_dns_records r
+		JOIN public.cloudflare_zones z ON z.id = r.zone_id
+		WHERE z.fetched_at >= $1`, []any{runAt},
+		`INSERT INTO public.cloudflare_dns_records (zone_id, id, name, type, content, ttl, proxied, fetched_at, raw, content_hash, raw_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (zone_id, id) DO UPDATE SET name = EXCLUDED.name, type = EXCLUDED.type, content = EXCLUDED.content, ttl = EXCLUDED.ttl, proxied = EXCLUDED.proxied, fetched_at = EXCLUDED.fetched_at, raw = EXCLUDED.raw, content_hash = EXCLUDED.content_hash, raw_hash = EXCLUDED.raw_hash`,
+		func(r *sql.Rows) ([]any, error) {
+			var zoneID, id, name, typ, raw string
+			var content, contentHash, rawHash sql.NullString
+			var ttl sql.NullInt64
+			var proxied sql.NullBool
+			var fetched time.Time
+			err := r.Scan(&zoneID, &id, &name, &typ, &content, &ttl, &proxied, &fetched, &raw, &contentHash, &rawHash)
+			return []any{zoneID, id, name, typ, content, ttl, proxied, fetched, raw, contentHash, rawHash}, err
+		})
+	if err != nil {
+		return 0, fmt.Errorf("replicate records: %w", err)
+	}
+	rows += n
+
+	n, err = copyRows(ctx, src, tx, `SELECT run_id, zone_id, name_servers, dnssec_status, dnssec_error, dnssec_raw, fetched_at
+		FROM public.cloudflare_zone_delegation WHERE run_id = $1`, []any{runID},
+		`INSERT INTO public.cloudflare_zone_delegation (run_id, zone_id, name_servers, dnssec_status, dnssec_error, dnssec_raw, fetched_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (run_id, zone_id) DO UPDATE SET name_servers = EXCLUDED.name_servers, dnssec_status = EXCLUDED.dnssec_status, dnssec_error = EXCLUDED.dnssec_error, dnssec_raw = EXCLUDED.dnssec_raw, fetched_at = EXCLUDED.fetched_at`,
+		func(r *sql.Rows) ([]any, error) {
+			var run int64
+			var zoneID string
+			var ns []string
+			var status, dnssecErr, raw sql.NullString
+			var fetched time.Time
+			err := r.Scan(&run, &zoneID, pq.Array(&ns), &status, &dnssecErr, &raw, &fetched)
+			return []any{run, zoneID, pq.Array(ns), status, dnssecErr, raw, fetched}, err
+		})
+	if err != nil {
+		return 0, fmt.Errorf("replicate delegation: %w", err)
+	}
+	rows += n
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+// copyRows streams the result of query on src into insert on tx. scan turns
+// the current source row into the insert arguments.
+func copyRows(ctx context.Context, src *sql.DB, tx *sql.Tx, query string, args []any, insert string, scan func(*sql.Rows) ([]any, error)) (int, error) {
+	rs, err := src.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rs.Close()
+	stmt, err := tx.PrepareContext(ctx, insert)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	n := 0
+	for rs.Next() {
+		vals, err := scan(rs)
+		if err != nil {
+			return n, err
+		}
+		if _, err := stmt.ExecContext(ctx, vals...); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rs.Err()
+}
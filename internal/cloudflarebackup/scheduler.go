@@ -0,0 +1,190 @@
+package cloudflarebackup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"cli-things/utility/cfapi"
+	"cli-things/utility/exitcode"
+	"cli-things/utility/metrics"
+	"cli-things/utility/secrets"
+)
+
+// cycleConfig is everything a backup cycle needs. The Cloudflare client and
+// database pool are created once and shared by all cycles.
+type cycleConfig struct {
+	cf          *cfapi.Client
+	db          *sql.DB // nil in dry-run mode
+	replica     *sql.DB // --replicate-to destination, nil when unset
+	timeout     time.Duration
+	verbose     bool
+	dryRun      bool
+	incremental bool
+	showDiff    bool
+	metricsOut  metrics.Output
+	exclude     recordExclusions
+	strict      bool
+}
+
+// emitMetrics writes the Prometheus textfile when --metrics-file asks for
+// it; the JSON format is written by the cycle's metrics.Recorder instead.
+func (c cycleConfig) emitMetrics(m runMetrics) {
+	if c.metricsOut.File == "" || c.metricsOut.Format != formatPrometheus {
+		return
+	}
+	if err := writeMetricsFile(c.metricsOut.File, m); err != nil {
+		logger.Error("metrics file:", err)
+	}
+}
+
+// runCycle performs one complete backup: its own run record, metrics file
+// update, step timings and --diff output. Errors are already reported on
+// stderr.
+func runCycle(parent context.Context, c cycleConfig) error {
+	ctx, cancel := context.WithTimeout(parent, c.timeout)
+	defer cancel()
+
+	stats := metrics.New("cloudflare-backup")
+	b := &backup{cf: c.cf, db: c.db, verbose: c.verbose, dryRun: c.dryRun, incremental: c.incremental, exclude: c.exclude, stats: stats}
+	defer func() {
+		stats.Add("records", int64(b.records))
+		stats.Add("records.excluded", int64(b.excluded))
+		stats.Add("changes", int64(len(b.changes)))
+		if err := stats.Flush(context.Background(), c.metricsOut); err != nil {
+			logger.Error(err)
+		}
+	}()
+
+	started := time.Now()
+	stopPreflight := stats.Start("preflight")
+	pf := preflight(ctx, c.cf)
+	stopPreflight()
+	pf.report()
+	if c.strict && len(pf.Problems) > 0 {
+		// A token without the permissions it needs is a configuration
+		// problem.
+		err := exitcode.Configf("preflight found %d problem(s); refusing to run (--strict)", len(pf.Problems))
+		logger.Error(err)
+		c.emitMetrics(runMetrics{Duration: time.Since(started), Finished: time.Now()})
+		return err
+	}
+
+	if c.dryRun {
+		err := b.run(ctx)
+		b.printDryRunSummary(os.Stdout)
+		if err != nil {
+			logger.Error("dry run failed:", err)
+		}
+		return err
+	}
+
+	runID, err := startRun(ctx, c.db, c.incremental, pf.TokenStatus)
+	if err != nil {
+		logger.Error("cannot create run record:", err)
+		c.emitMetrics(runMetrics{Duration: time.Since(started), Finished: time.Now()})
+		return err
+	}
+	b.runID = runID
+
+	runErr := b.run(ctx)
+	errMsg := ""
+	if runErr != nil {
+		// The message is stored on the run record, which outlives logs.
+		errMsg = secrets.Redact(runErr.Error())
+		logger.Error(runErr)
+	}
+	finishRun(context.Background(), c.db, runID, b.accounts, b.zones, b.records, runErr == nil, errMsg)
+	c.emitMetrics(runMetrics{Zones: b.zones, Records: b.records, Duration: time.Since(started), Success: runErr == nil, Finished: time.Now()})
+	if c.showDiff {
+		for _, ch := range b.changes {
+			fmt.Println(ch)
+		}
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if c.replica != nil {
+		rctx, rcancel := context.WithTimeout(parent, c.timeout)
+		n, err := replicateRun(rctx, c.db, c.replica, runID)
+		rcancel()
+		if err != nil {
+			logger.Error("replication failed:", err)
+			return err
+		}
+		logger.Debugf("replicated run %d (%d rows)", runID, n)
+	}
+	logger.Infof("done (accounts=%d zones=%d records=%d excluded=%d)", b.accounts, b.zones, b.records, b.excluded)
+	return nil
+}
+
+// runScheduler starts a cycle immediately and then every interval (plus up
+// to jitter) until SIGTERM or SIGINT. A cycle that is due while the previous
+// one is still running is skipped. On the first signal no new cycles start
+// and the running one is allowed to finish; a second signal cancels it.
+func runScheduler(c cycleConfig, interval, jitter time.Duration) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	busy := make(chan struct{}, 1)
+	start := func() {
+		select {
+		case busy <- struct{}{}:
+		default:
+			logger.Warn("previous cycle still running; skipping this cycle")
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-busy }()
+			_ = runCycle(ctx, c)
+		}()
+	}
+
+	logger.Infof("scheduler started (interval=%s jitter=%s)", interval, jitter)
+	start()
+	timer := time.NewTimer(nextDelay(interval, jitter))
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			start()
+			timer.Reset(nextDelay(interval, jitter))
+		case sig := <-sigs:
+			logger.Infof("received %s; waiting for the running cycle to finish (signal again to abort)", sig)
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-sigs:
+				logger.Warn("aborting running cycle")
+				cancel()
+				<-done
+			}
+			logger.Info("scheduler stopped")
+			return
+		}
+	}
+}
+
+func nextDelay(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(int64(jitter)))
+}
@@ -0,0 +1,1762 @@
+// Package dbtoolcli is the dbtool command line over utility/dbtool: its
+// commands, flags, help and exit codes. The dbtool.go file at the
+// repository root builds it as a standalone binary; clithings runs it as a
+// subcommand.
+package dbtoolcli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"cli-things/utility/buildinfo"
+	"cli-things/utility/cli"
+	db "cli-things/utility/dbtool"
+	"cli-things/utility/dotenv"
+	"cli-things/utility/exitcode"
+	"cli-things/utility/metrics"
+)
+
+// Global flags, set by addGlobalFlags.
+var (
+	verbose bool
+	// dsn is the --dsn connection string for this invocation only.
+	dsn string
+	// profile is the --profile config.ini section for this invocation.
+	profile string
+	// showVersion is --version: "text", "json" (--version=json) or unset.
+	showVersion buildinfo.Flag
+)
+
+// The utility/dbtool settings the query flags write into, as they were at
+// startup, so that run can put them back before each command line.
+var (
+	defaultMaxColWidth = db.MaxColWidth
+	defaultRowLimit    = db.RowLimit
+	defaultUseReplica  = db.UseReplica
+)
+
+// Exit codes for `query` and `seed` besides those of utility/exitcode,
+// above its range so that each code means one thing. 130 follows the shell
+// convention for SIGINT. `query compare` and `schema verify` exit 3 when
+// they find differences, and an expired --timeout exits 4 (Timeout).
+const (
+	exitResultsDiffer = exitcode.Drift
+	exitSQLSyntax     = 5 // SQLSTATE class 42
+	exitSQLConstraint = 6 // SQLSTATE class 23
+	exitConnection    = 7
+	exitQueryCanceled = 130
+)
+
+// sqlExitCode picks the exit code for a failed SQL command: the SQL
+// classes above, otherwise the utility/exitcode class of err. Timeouts
+// are checked first, as a deadline also counts as a network error.
+func sqlExitCode(err error) int {
+	switch {
+	case exitcode.IsTimeout(err):
+		return exitcode.Timeout
+	case db.IsConnectionError(err):
+		return exitConnection
+	case db.IsSyntaxError(err):
+		return exitSQLSyntax
+	case db.IsConstraintViolation(err):
+		return exitSQLConstraint
+	}
+	return exitcode.Of(err)
+}
+
+// runQueryCommand runs query against dbname, reports any error on stderr and
+// returns the exit code. When history is enabled the run is recorded, with
+// the number of parameters but not their values.
+func runQueryCommand(dbname, query string, format db.OutputFormat, timeout time.Duration, params []db.QueryParam) int {
+	// Ctrl-C cancels the statement on the server rather than just
+	// abandoning it.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	stats, err := db.QueryDatabaseStats(ctx, dbname, query, format, timeout, params...)
+	stop()
+	code := 0
+	switch {
+	case err == nil:
+	case errors.Is(err, db.ErrQueryTimeout):
+		fmt.Fprintf(os.Stderr, "query timed out: %v\n", err)
+		code = exitcode.Timeout
+	case errors.Is(err, db.ErrQueryCanceled):
+		fmt.Fprintln(os.Stderr, "query canceled")
+		code = exitQueryCanceled
+	default:
+		fmt.Fprintf(os.Stderr, "query failed: %v\n", err)
+		code = sqlExitCode(err)
+	}
+	if db.HistoryEnabled() {
+		entry := db.NewHistoryEntry(dbname, query, len(params), stats, code, err)
+		if herr := db.AppendHistory(entry); herr != nil {
+			fmt.Fprintf(os.Stderr, "dbtool: could not record history: %v\n", herr)
+		}
+	}
+	return code
+}
+
+// addGlobalFlags registers the global flags on fs. Every command's flag set
+// has them, so they work before the command name or anywhere after it, in any
+// form the flag package accepts (-v, --verbose=true, --dsn URL, --dsn=URL).
+// The current values are the defaults, so parsing a second flag set does not
+// reset flags given earlier on the command line.
+func addGlobalFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&verbose, "verbose", verbose, "Show diagnostics about .env and config.ini resolution")
+	fs.BoolVar(&verbose, "v", verbose, "Same as --verbose")
+	fs.StringVar(&dsn, "dsn", dsn, "Connect with this postgres:// URL or key=value DSN instead of config.ini/.env/DATABASE_URL")
+	fs.StringVar(&profile, "profile", profile, "Use this config.ini section over [default] (default $DBTOOL_PROFILE)")
+	fs.Var(&showVersion, "version", "Show version information (--version=json for JSON)")
+}
+
+// parseGlobalFlags parses the global flags in front of a command or
+// subcommand name and returns the remaining arguments. ok is false when the
+// caller should stop with exit code code (0 after -h/--help, 2 on an unknown
+// flag); help prints the usage for -h.
+func parseGlobalFlags(args []string, help func()) (rest []string, code int, ok bool) {
+	fs := flag.NewFlagSet("dbtool", flag.ContinueOnError)
+	fs.Usage = help
+	addGlobalFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, 0, false
+		}
+		return nil, 2, false
+	}
+	return fs.Args(), 0, true
+}
+
+// newFlagSet returns the flag set for a command: it reports errors instead of
+// exiting, shows help for -h/--help and includes the global flags.
+func newFlagSet(name string, help func()) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = help
+	addGlobalFlags(fs)
+	return fs
+}
+
+// parseCommand parses a command's arguments. Flags and positional arguments
+// may be mixed in any order and "--" ends the flags, so "query --json mydb
+// --query=..." and "query mydb --query=... --json" mean the same. A first
+// positional of "help" shows the command's help. After parsing, the global
+// flags are applied (see setup). ok is false when the command should stop
+// with exit code code: 0 after help or --version, 2 on a usage error.
+func parseCommand(fs *flag.FlagSet, args []string) (pos []string, code int, ok bool) {
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, 0, false
+			}
+			return nil, 2, false
+		}
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			pos = append(pos, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		pos = append(pos, rest[0])
+		args = rest[1:]
+	}
+	if len(pos) > 0 && isHelpToken(pos[0]) {
+		fs.Usage()
+		return nil, 0, false
+	}
+	if code, ok := setup(); !ok {
+		return nil, code, false
+	}
+	return pos, 0, true
+}
+
+// setup applies the global flags once a command has parsed them all:
+// --version, verbose diagnostics, .env loading and the --dsn override.
+func setup() (code int, ok bool) {
+	if showVersion.Requested() {
+		buildinfo.Print(os.Stdout, "dbtool", showVersion.JSON())
+		return 0, false
+	}
+	if verbose {
+		// Export to the dbtool package via env var
+		os.Setenv("DBTOOL_VERBOSE", "1")
+	}
+	if err := loadEnvFromNearestDotEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load .env file: %v\n", err)
+		return 1, false
+	}
+	db.SetProfile(profile)
+	if err := db.SetDSNOverride(dsn); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2, false
+	}
+	if verbose {
+		if v := strings.TrimSpace(os.Getenv("DBTOOL_CONFIG_FILE")); v != "" {
+			fmt.Fprintln(os.Stderr, "dbtool: DBTOOL_CONFIG_FILE after .env:", v)
+		} else {
+			fmt.Fprintln(os.Stderr, "dbtool: DBTOOL_CONFIG_FILE not set; will use default search path in dbtool package")
+		}
+	}
+	return 0, true
+}
+
+// loadEnvFromNearestDotEnv applies the .env files from cwd up to the repo
+// root, noting each key's file so settings can name their .env source.
+func loadEnvFromNearestDotEnv() error {
+	opts := dotenv.Options{
+		MaxDepth:     -1,
+		ResolvePaths: []string{"DBTOOL_CONFIG_FILE"},
+		Set: func(v dotenv.Var) {
+			os.Setenv(v.Key, v.Value)
+			db.NoteEnvFile(v.Key, v.File)
+		},
+	}
+	if verbose {
+		opts.Logf = func(format string, args ...any) { fmt.Fprintf(os.Stderr, format, args...) }
+	}
+	return dotenv.LoadNearest(opts)
+}
+
+// addFormatFlags registers --format plus boolean shorthands (--json, --csv,
+// --tsv) for the given formats. The returned function, called after Parse,
+// resolves them and reports an error if they conflict.
+func addFormatFlags(fs *flag.FlagSet, shorthands ...db.OutputFormat) func() (db.OutputFormat, error) {
+	formatStr := fs.String("format", "", "Output format: text, json, jsonl, csv, tsv, table or markdown")
+	set := make([]*bool, len(shorthands))
+	for i, f := range shorthands {
+		set[i] = fs.Bool(string(f), false, fmt.Sprintf("Same as --format=%s", f))
+	}
+	return func() (db.OutputFormat, error) {
+		var chosen []db.OutputFormat
+		if *formatStr != "" {
+			f, err := db.ParseOutputFormat(*formatStr)
+			if err != nil {
+				return "", err
+			}
+			chosen = append(chosen, f)
+		}
+		for i, f := range shorthands {
+			if *set[i] {
+				chosen = append(chosen, f)
+			}
+		}
+		switch len(chosen) {
+		case 0:
+			return db.FormatText, nil
+		case 1:
+			return chosen[0], nil
+		}
+		return "", errors.New("choose one output format (--format or one of its shorthands)")
+	}
+}
+
+// addSchemaFlags registers the repeatable --schema and --exclude-schema flags
+// shared by database dump and import.
+func addSchemaFlags(fs *flag.FlagSet) (include, exclude *[]string) {
+	include, exclude = new([]string), new([]string)
+	fs.Func("schema", "Only this schema (repeatable; pg_dump/pg_restore -n)", func(v string) error {
+		*include = append(*include, v)
+		return nil
+	})
+	fs.Func("exclude-schema", "Leave out this schema (repeatable; pg_dump/pg_restore -N)", func(v string) error {
+		*exclude = append(*exclude, v)
+		return nil
+	})
+	return include, exclude
+}
+
+// addMetricsFlags adds the metrics.Output flags to a long-running
+// command. The command records its steps in a metrics.Recorder and hands
+// both to flushMetrics before it returns.
+func addMetricsFlags(fs *flag.FlagSet) *metrics.Output {
+	out := new(metrics.Output)
+	out.AddFlags(fs)
+	return out
+}
+
+// flushMetrics prints the one-line summary of what stats recorded on stderr
+// and writes the file and table out names. A failure to write them is
+// reported but does not change the command's exit code.
+func flushMetrics(stats *metrics.Recorder, out *metrics.Output) {
+	if err := stats.Flush(context.Background(), *out); err != nil {
+		fmt.Fprintf(os.Stderr, "dbtool: %v\n", err)
+	}
+}
+
+// wantArgs checks the number of positional arguments (max < 0: no limit),
+// showing the command's help when it is wrong.
+func wantArgs(fs *flag.FlagSet, pos []string, min, max int) bool {
+	if max >= 0 && len(pos) > max {
+		fmt.Fprintf(os.Stderr, "Error: unexpected argument %q\n", pos[max])
+		fs.Usage()
+		return false
+	}
+	if len(pos) < min {
+		fs.Usage()
+		return false
+	}
+	return true
+}
+
+// dbnameArg handles the common optional "[<dbname>]" positional: pos[i] when
+// present, otherwise the configured default. It reports a missing default
+// on stderr.
+func dbnameArg(pos []string, i int) (string, bool) {
+	if i < len(pos) {
+		return pos[i], true
+	}
+	name, err := db.DefaultDBName()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return "", false
+	}
+	return name, true
+}
+
+// confirm asks for "yes" on stdin.
+func confirm(prompt string) bool {
+	fmt.Print(prompt + " Type 'yes' to continue: ")
+	text, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(text) != "yes" {
+		fmt.Println("Aborted")
+		return false
+	}
+	return true
+}
+
+func isHelpToken(s string) bool {
+	switch strings.ToLower(s) {
+	case "-h", "--help", "help", "h":
+		return true
+	default:
+		return false
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  database|db list|ls\n")
+	fmt.Fprintf(os.Stderr, "  database|db dump|export <dbname> <filepath> [--structure-only] [--format=plain|custom|directory] [--compress=N] [--schema=<s>]... [--exclude-schema=<s>]... [--timestamped [--rotate-keep=N] [--rotate-min-ratio=F]]\n")
+	fmt.Fprintf(os.Stderr, "  database|db dump-all <directory> [--exclude-regex=<re>] [--structure-only] [--format=plain|custom|directory] [--compress=N] [--jobs=N]\n")
+	fmt.Fprintf(os.Stderr, "  database|db import|load <dbname> <filepath> [--overwrite] [--single-transaction] [--jobs=N] [--schema=<s>]... [--exclude-schema=<s>]...\n")
+	fmt.Fprintf(os.Stderr, "  database|db reset|wipe <dbname> [--schema=<s>]... [--all-user-schemas] [--exclude-regex=<re>] [--noconfirm]\n")
+	fmt.Fprintf(os.Stderr, "  database|db copy|cp <source-db> <target-db> [--drop-existing] [--jobs=N]\n")
+	fmt.Fprintf(os.Stderr, "  table|tables list|ls [<dbname>] [--schema=<schema>]\n")
+	fmt.Fprintf(os.Stderr, "  table|tables truncate <dbname> <schema.table>... [--cascade] [--restart-identity] [--noconfirm]\n")
+	fmt.Fprintf(os.Stderr, "  table|tables export <dbname> <schema.table> <file.csv> [--where=<condition>]\n")
+	fmt.Fprintf(os.Stderr, "  table|tables import <dbname> <schema.table> <file.csv> [--truncate-first]\n")
+	fmt.Fprintf(os.Stderr, "  table|tables copy|cp <src-db>.<schema.table> <dst-db>[.<schema.table>] [--create] [--truncate] [--source-dsn=<url>]\n")
+	fmt.Fprintf(os.Stderr, "  table|tables describe|desc <dbname> <schema.table> [--format=text|json|jsonl|csv|tsv|table|markdown]\n")
+	fmt.Fprintf(os.Stderr, "  table|tables sizes [<dbname>] [--schema=<schema>] [--sort=size|rows|name] [--exact] [--format=text|json|jsonl|csv|tsv|table|markdown]\n")
+	fmt.Fprintf(os.Stderr, "  index|indexes list|ls [<dbname>] [--table=<schema.table>] [--json]\n")
+	fmt.Fprintf(os.Stderr, "  sequence|sequences|seq list|ls [<dbname>] [--json]\n")
+	fmt.Fprintf(os.Stderr, "  activity list|ls [<dbname>] [--min-duration=<duration>] [--full] [--json]\n")
+	fmt.Fprintf(os.Stderr, "  activity kill <pid> [--terminate]\n")
+	fmt.Fprintf(os.Stderr, "  history list|ls [--db=<name>] [--grep=<pattern>]\n")
+	fmt.Fprintf(os.Stderr, "  history rerun <id> [--format=text|json|jsonl|csv|tsv|table|markdown] [--timeout=<duration>] [--limit=N]\n")
+	fmt.Fprintf(os.Stderr, "  schema verify <dbname> <schema.sql> [--keep-temp]\n")
+	fmt.Fprintf(os.Stderr, "  query|q [<dbname>] --query=\"<sql>\" [--param=[type:]value]... [--timeout=<duration>] [--format=text|json|jsonl|csv|tsv|table|markdown] [--max-col-width=N] [--limit=N] [--replica]\n")
+	fmt.Fprintf(os.Stderr, "  query|q compare <db-a> <db-b> --query=\"<sql>\" [--key=<col>[,<col>...]] [--param=[type:]value]... [--timeout=<duration>] [--json]\n")
+	fmt.Fprintf(os.Stderr, "  maintenance vacuum|analyze|reindex <dbname> [<schema.table>] [--full] [--verbose] [--dry-run]\n")
+	fmt.Fprintf(os.Stderr, "  seed <dbname> <directory> [--only=<glob>] [--no-transaction]\n")
+	fmt.Fprintf(os.Stderr, "  shell [<dbname>]\n")
+	fmt.Fprintf(os.Stderr, "  wait [<dbname>] [--timeout=60s] [--interval=1s] [--create-missing] [--json]\n")
+	fmt.Fprintf(os.Stderr, "  config [--json]\n")
+	fmt.Fprintf(os.Stderr, "  config test [<dbname>] [--json]\n")
+	fmt.Fprintf(os.Stderr, "  migrate [up] [<dbname>]\n")
+	fmt.Fprintf(os.Stderr, "  migrate down [<dbname>] [--steps=N | --to=<id>]\n")
+	fmt.Fprintf(os.Stderr, "  migrate create <name>\n")
+	fmt.Fprintf(os.Stderr, "  migrate status [<dbname>] [--json]\n")
+	fmt.Fprintf(os.Stderr, "  version [--json]\n")
+	fmt.Fprintf(os.Stderr, "  help [command] [subcommand]\n")
+	fmt.Fprintf(os.Stderr, "\nGlobal flags:\n")
+	fmt.Fprintf(os.Stderr, "  -v, --verbose     Show diagnostics about .env and config.ini resolution\n")
+	fmt.Fprintf(os.Stderr, "  --dsn <dsn>       Connect with this postgres:// URL or key=value DSN instead of config.ini/.env/DATABASE_URL\n")
+	fmt.Fprintf(os.Stderr, "  --profile <name>  Use config.ini's [<name>] section over [default] (default $DBTOOL_PROFILE)\n")
+	fmt.Fprintf(os.Stderr, "  --version[=json]  Show version information\n")
+}
+
+func helpSummary() {
+	fmt.Println("Commands:")
+	fmt.Println("  database (db)")
+	fmt.Println("    list (ls)")
+	fmt.Println("    dump (export) <dbname> <filepath> [--structure-only] [--format=plain|custom|directory] [--compress=N] [--schema=<s>]... [--exclude-schema=<s>]...")
+	fmt.Println("    dump-all <directory> [--exclude-regex=<re>] [--structure-only] [--format=plain|custom|directory] [--compress=N] [--jobs=N]")
+	fmt.Println("    import (load) <dbname> <filepath> [--overwrite] [--single-transaction] [--jobs=N] [--schema=<s>]... [--exclude-schema=<s>]...")
+	fmt.Println("    reset (wipe) <dbname> [--schema=<s>]... [--all-user-schemas] [--exclude-regex=<re>] [--noconfirm]")
+	fmt.Println("    copy (cp) <source-db> <target-db> [--drop-existing] [--jobs=N]")
+	fmt.Println("  table (tables)")
+	fmt.Println("    list (ls) [<dbname>] [--schema=<schema>]")
+	fmt.Println("    truncate <dbname> <schema.table>... [--cascade] [--restart-identity] [--noconfirm]")
+	fmt.Println("    export <dbname> <schema.table> <file.csv> [--where=<condition>]")
+	fmt.Println("    import <dbname> <schema.table> <file.csv> [--truncate-first]")
+	fmt.Println("    copy (cp) <src-db>.<schema.table> <dst-db>[.<schema.table>] [--create] [--truncate] [--source-dsn=<url>]")
+	fmt.Println("    describe (desc) <dbname> <schema.table> [--format=text|json|jsonl|csv|tsv|table|markdown]")
+	fmt.Println("    sizes [<dbname>] [--schema=<schema>] [--sort=size|rows|name] [--exact] [--format=text|json|jsonl|csv|tsv|table|markdown]")
+	fmt.Println("  index (indexes)")
+	fmt.Println("    list (ls) [<dbname>] [--table=<schema.table>] [--json]")
+	fmt.Println("  sequence (sequences, seq)")
+	fmt.Println("    list (ls) [<dbname>] [--json]")
+	fmt.Println("  activity")
+	fmt.Println("    list (ls) [<dbname>] [--min-duration=<duration>] [--full] [--json]")
+	fmt.Println("    kill <pid> [--terminate]")
+	fmt.Println("  history")
+	fmt.Println("    list (ls) [--db=<name>] [--grep=<pattern>]")
+	fmt.Println("    rerun <id> [--format=text|json|jsonl|csv|tsv|table|markdown] [--timeout=<duration>] [--limit=N]")
+	fmt.Println("  schema")
+	fmt.Println("    verify <dbname> <schema.sql> [--keep-temp]")
+	fmt.Println("  query (q) [<dbname>] --query=\"<sql>\" [--param=[type:]value]... [--timeout=<duration>] [--format=text|json|jsonl|csv|tsv|table|markdown] [--max-col-width=N] [--limit=N] [--replica]")
+	fmt.Println("    compare <db-a> <db-b> --query=\"<sql>\" [--key=<col>[,<col>...]] [--param=[type:]value]... [--timeout=<duration>] [--json]")
+	fmt.Println("  maintenance")
+	fmt.Println("    vacuum|analyze|reindex <dbname> [<schema.table>] [--full] [--verbose] [--dry-run]")
+	fmt.Println("  seed <dbname> <directory> [--only=<glob>] [--no-transaction]")
+	fmt.Println("  shell [<dbname>]")
+	fmt.Println("  wait [<dbname>] [--timeout=60s] [--interval=1s] [--create-missing] [--json]")
+	fmt.Println("  config [--json]")
+	fmt.Println("    test [<dbname>] [--json]")
+	fmt.Println("  migrate")
+	fmt.Println("    up [<dbname>]")
+	fmt.Println("    create <name>")
+	fmt.Println("    status [<dbname>] [--json]")
+	fmt.Println("  version [--json]")
+	fmt.Println("  help [command] [subcommand]")
+	exitcode.Write(os.Stdout,
+		exitcode.Doc{Code: exitResultsDiffer, Meaning: "query compare or schema verify found differences"},
+		exitcode.Doc{Code: exitcode.Timeout, Meaning: "timed out: wait, or query's --timeout expired"},
+		exitcode.Doc{Code: exitSQLSyntax, Meaning: "query and seed: SQL syntax error, unknown table or column"},
+		exitcode.Doc{Code: exitSQLConstraint, Meaning: "query and seed: constraint violation"},
+		exitcode.Doc{Code: exitConnection, Meaning: "query and seed: connection or authentication failure"},
+		exitcode.Doc{Code: exitQueryCanceled, Meaning: "query: canceled (Ctrl-C)"},
+	)
+}
+
+// metricsHelp is the note on --metrics-file and --metrics-db in the help of
+// the commands that have them.
+const metricsHelp = `  A timing summary goes to stderr at the end; --metrics-file=<f> also writes it as JSON
+  and --metrics-db=<db> stores it in that database's public.tool_metrics table.`
+
+func helpFor(mainCmd, sub string) {
+	mc := normalizeMain(mainCmd)
+	if mc == "query" {
+		if strings.EqualFold(sub, "compare") {
+			fmt.Println("Usage: query|q compare <db-a> <db-b> --query=\"<sql>\" [--key=<col>[,<col>...]] [--param=[type:]value]... [--timeout=<duration>] [--json]")
+			fmt.Println("  Runs the statement against both databases and compares the results by column name,")
+			fmt.Println("  with values compared as text. Rows matching on --key but not on the other columns")
+			fmt.Println("  are reported as differing; without --key whole rows are matched. Exits 0 when the")
+			fmt.Println("  results are identical and 3 when they differ.")
+			return
+		}
+		fmt.Println("Usage: query|q [<dbname>] --query=\"<sql>\" [--param=[type:]value]... [--timeout=<duration>] [--format=text|json|jsonl|csv|tsv|table|markdown] [--max-col-width=N] [--limit=N] [--replica]")
+		fmt.Println("       query|q compare <db-a> <db-b> --query=\"<sql>\" ...  (see 'help query compare')")
+		return
+	}
+	if mc == "seed" {
+		fmt.Println("Usage: seed <dbname> <directory> [--only=<glob>] [--no-transaction]")
+		fmt.Println("  Applies *.sql and *.csv in lexical order, all in one transaction unless --no-transaction.")
+		fmt.Println("  CSV files (with a header row) are loaded into the table named by the file:")
+		fmt.Println("  [NNN_][schema.]table.csv, e.g. 020_public.users.csv; the schema defaults to public.")
+		return
+	}
+	if mc == "wait" {
+		fmt.Println("Usage: wait [<dbname>] [--timeout=60s] [--interval=1s] [--create-missing] [--json]")
+		fmt.Println("  Retries connecting until the database accepts connections; exits 0 when it does and 4")
+		fmt.Println("  on timeout. Reports whether the server is unreachable or up without the database;")
+		fmt.Println("  --create-missing then creates it. --json prints one progress object per attempt.")
+		return
+	}
+	if mc == "version" {
+		fmt.Println("Usage: version [--json]")
+		fmt.Println("  Prints the version, VCS revision, build time, Go version and platform on one line;")
+		fmt.Println("  --json prints them as an object. Same as --version (--version=json).")
+		return
+	}
+	if mc == "shell" {
+		fmt.Println("Usage: shell [<dbname>]  (\\dt, \\d <table>, \\c <dbname>, \\q; statements end with ';')")
+		return
+	}
+	if mc == "index" {
+		fmt.Println("Usage: index|indexes list|ls [<dbname>] [--table=<schema.table>] [--json]")
+		fmt.Println("  scans come from pg_stat_user_indexes; 0 on a long-running server suggests an unused index.")
+		return
+	}
+	if mc == "activity" {
+		switch normalizeSub(sub) {
+		case "list":
+			fmt.Println("Usage: activity list|ls [<dbname>] [--min-duration=<duration>] [--full] [--json]")
+			fmt.Println("  Client connections from pg_stat_activity, longest running first. --min-duration=30s")
+			fmt.Println("  keeps only queries running at least that long; --full shows the whole query text.")
+		case "kill":
+			fmt.Println("Usage: activity kill <pid> [--terminate]")
+			fmt.Println("  Cancels the backend's current query (pg_cancel_backend); --terminate closes the")
+			fmt.Println("  connection instead (pg_terminate_backend).")
+		default:
+			fmt.Println("Usage: activity <list|kill> [args]")
+		}
+		return
+	}
+	if mc == "history" {
+		switch normalizeSub(sub) {
+		case "list":
+			fmt.Println("Usage: history list|ls [--db=<name>] [--grep=<pattern>]")
+			fmt.Println("  --grep is a regular expression matched against the query text.")
+		case "rerun":
+			fmt.Println("Usage: history rerun <id> [--format=text|json|jsonl|csv|tsv|table|markdown] [--timeout=<duration>] [--limit=N]")
+			fmt.Println("  Runs the query again against the same database. Queries that had --param values")
+			fmt.Println("  cannot be rerun: only the parameter count is stored.")
+		default:
+			fmt.Println("Usage: history <list|rerun> [args]")
+			fmt.Println("  Recording is opt-in: set DBTOOL_HISTORY=1 (environment, .env or config.ini).")
+			fmt.Println("  Each `query` run is appended to $XDG_DATA_HOME/dbtool/history.jsonl")
+			fmt.Println("  (default ~/.local/share/dbtool/history.jsonl).")
+		}
+		return
+	}
+	if mc == "schema" {
+		if normalizeSub(sub) == "verify" {
+			fmt.Println("Usage: schema verify <dbname> <schema.sql> [--keep-temp]")
+			fmt.Println("  Loads schema.sql into a temporary database (dbtool_verify_<random>), compares its")
+			fmt.Println("  tables, columns, constraints, indexes, views, sequences, functions, enums and triggers")
+			fmt.Println("  with <dbname>, and exits 3 with a diff (- live, + reference) when they differ.")
+			fmt.Println("  The temporary database is dropped afterwards unless --keep-temp.")
+		} else {
+			fmt.Println("Usage: schema verify <dbname> <schema.sql> [--keep-temp]")
+		}
+		return
+	}
+	if mc == "sequence" {
+		fmt.Println("Usage: sequence|sequences|seq list|ls [<dbname>] [--json]")
+		return
+	}
+	if mc == "maintenance" {
+		fmt.Println("Usage: maintenance vacuum|analyze|reindex <dbname> [<schema.table>] [--full] [--verbose] [--dry-run]")
+		fmt.Println("  Without a table, every user table is processed one at a time. --full is VACUUM FULL;")
+		fmt.Println("  --verbose also turns on dbtool diagnostics and prints the server's progress messages.")
+		return
+	}
+	if mc == "config" {
+		if strings.ToLower(sub) == "test" {
+			fmt.Println("Usage: config test [<dbname>] [--json]")
+		} else {
+			fmt.Println("Usage: config [--json]  (show each setting and where it came from)")
+			fmt.Println("       config test [<dbname>] [--json]  (connect and report server version and latency)")
+		}
+		return
+	}
+	if mc == "migrate" {
+		switch strings.ToLower(sub) {
+		case "create":
+			fmt.Println("Usage: migrate create <name>")
+		case "status":
+			fmt.Println("Usage: migrate status [<dbname>] [--json]")
+		case "up":
+			fmt.Println("Usage: migrate [up] [<dbname>]")
+		case "down":
+			fmt.Println("Usage: migrate down [<dbname>] [--steps=N | --to=<id>]")
+			fmt.Println("  Runs the NNN_name.down.sql files of the last N applied migrations (default 1), or of every")
+			fmt.Println("  migration applied after <id>, newest first, each in its own transaction. If any of them")
+			fmt.Println("  has no down file, nothing is run.")
+		default:
+			fmt.Println("Usage: migrate <up|down|create|status> [args]  (plain 'migrate [<dbname>]' is the same as 'migrate up')")
+		}
+		return
+	}
+	if mc == "table" {
+		if sub == "" {
+			fmt.Println("Usage: table|tables <list|describe|sizes|truncate|export|import|copy> [args]")
+			return
+		}
+		sc := normalizeSub(sub)
+		switch sc {
+		case "list":
+			fmt.Println("Usage: table|tables list|ls [<dbname>] [--schema=<schema>]")
+		case "truncate":
+			fmt.Println("Usage: table|tables truncate <dbname> <schema.table>... [--cascade] [--restart-identity] [--noconfirm]")
+		case "dump":
+			fmt.Println("Usage: table|tables export <dbname> <schema.table> <file.csv> [--where=<condition>]")
+		case "import":
+			fmt.Println("Usage: table|tables import <dbname> <schema.table> <file.csv> [--truncate-first]")
+		case "copy":
+			fmt.Println("Usage: table|tables copy|cp <src-db>.<schema.table> <dst-db>[.<schema.table>] [--create] [--truncate] [--source-dsn=<url>]")
+			fmt.Println("  Streams rows with COPY in one destination transaction, committed only if the row counts match.")
+			fmt.Println("  --create builds a missing destination table from the source columns and primary key.")
+			fmt.Println("  --source-dsn reads the source from another server (the source db name replaces the URL's).")
+		case "describe":
+			fmt.Println("Usage: table|tables describe|desc <dbname> <schema.table> [--format=text|json|jsonl|csv|tsv|table|markdown]")
+		case "sizes":
+			fmt.Println("Usage: table|tables sizes [<dbname>] [--schema=<schema>] [--sort=size|rows|name] [--exact] [--format=text|json|jsonl|csv|tsv|table|markdown]")
+		default:
+			usage()
+		}
+		return
+	}
+	if mc == "database" {
+		if sub == "" {
+			fmt.Println("Usage: database|db <list|dump|dump-all|import|reset|copy> [args]")
+			return
+		}
+		sc := normalizeSub(sub)
+		switch sc {
+		case "list":
+			fmt.Println("Usage: database|db list|ls")
+		case "dump":
+			fmt.Println("Usage: database|db dump|export <dbname> <filepath> [--structure-only] [--format=plain|custom|directory] [--compress=N] [--schema=<s>]... [--exclude-schema=<s>]...")
+			fmt.Println("       database|db dump <dbname> <directory> --timestamped [--rotate-keep=N] [--rotate-min-ratio=F] [...]")
+			fmt.Println("  --timestamped writes <directory>/<dbname>_<timestamp><ext>, the dump-all naming.")
+			fmt.Println("  --rotate-keep then deletes all but the newest N such dumps of <dbname>, unless the new")
+			fmt.Println("  dump is smaller than --rotate-min-ratio (default 0.5) times the previous one.")
+			fmt.Println(metricsHelp)
+		case "dump-all":
+			fmt.Println("Usage: database|db dump-all <directory> [--exclude-regex=<re>] [--structure-only] [--format=plain|custom|directory] [--compress=N] [--jobs=N]")
+			fmt.Println(metricsHelp)
+		case "import":
+			fmt.Println("Usage: database|db import|load <dbname> <filepath> [--overwrite] [--single-transaction] [--jobs=N] [--schema=<s>]... [--exclude-schema=<s>]...")
+			fmt.Println("  Plain SQL dumps (optionally gzip-compressed) are streamed into psql with progress on")
+			fmt.Println("  stderr every few seconds. --single-transaction rolls everything back on the first error.")
+			fmt.Println("  --jobs runs pg_restore in parallel for custom and directory archives.")
+			fmt.Println(metricsHelp)
+		case "reset":
+			fmt.Println("Usage: database|db reset|wipe <dbname> [--schema=<s>]... [--all-user-schemas] [--exclude-regex=<re>] [--noconfirm]")
+			fmt.Println("  Drops and recreates (empty) the public schema, the --schema ones, or with --all-user-schemas")
+			fmt.Println("  every schema but pg_catalog, information_schema and pg_*; --exclude-regex leaves matches out.")
+		case "copy":
+			fmt.Println("Usage: database|db copy|cp <source-db> <target-db> [--drop-existing] [--jobs=N]")
+		default:
+			usage()
+		}
+		return
+	}
+	usage()
+}
+
+func normalizeMain(s string) string {
+	switch strings.ToLower(s) {
+	case "database", "db":
+		return "database"
+	case "table", "tables":
+		return "table"
+	case "query", "q":
+		return "query"
+	case "migrate":
+		return "migrate"
+	case "shell":
+		return "shell"
+	case "wait":
+		return "wait"
+	case "seed":
+		return "seed"
+	case "config":
+		return "config"
+	case "maintenance", "maint":
+		return "maintenance"
+	case "index", "indexes":
+		return "index"
+	case "sequence", "sequences", "seq":
+		return "sequence"
+	case "activity":
+		return "activity"
+	case "history":
+		return "history"
+	case "schema":
+		return "schema"
+	case "version":
+		return "version"
+	case "help", "h", "--help", "-h":
+		return "help"
+	default:
+		return s
+	}
+}
+
+func normalizeSub(s string) string {
+	switch strings.ToLower(s) {
+	case "list", "ls":
+		return "list"
+	case "dump", "export":
+		return "dump"
+	case "import", "load":
+		return "import"
+	case "reset", "wipe":
+		return "reset"
+	case "copy", "cp":
+		return "copy"
+	case "sizes", "size":
+		return "sizes"
+	case "truncate":
+		return "truncate"
+	case "dump-all", "dumpall":
+		return "dump-all"
+	case "describe", "desc":
+		return "describe"
+	default:
+		return s
+	}
+}
+
+// commands maps each normalized command name (see normalizeMain) to its
+// implementation. A command gets the arguments after its name and returns
+// the exit code.
+var commands = map[string]func(args []string) int{
+	"database": func(args []string) int { return runGroup("database", databaseCommands, args) },
+	"table":    func(args []string) int { return runGroup("table", tableCommands, args) },
+	"index": func(args []string) int {
+		return runGroup("index", map[string]func([]string) int{"list": func(a []string) int { return catalogList("index", a) }}, args)
+	},
+	"sequence": func(args []string) int {
+		return runGroup("sequence", map[string]func([]string) int{"list": func(a []string) int { return catalogList("sequence", a) }}, args)
+	},
+	"activity":    func(args []string) int { return runGroup("activity", activityCommands, args) },
+	"history":     func(args []string) int { return runGroup("history", historyCommands, args) },
+	"schema":      func(args []string) int { return runGroup("schema", schemaCommands, args) },
+	"query":       queryCommand,
+	"maintenance": maintenanceCommand,
+	"config":      configCommand,
+	"seed":        seedCommand,
+	"wait":        waitCommand,
+	"shell":       shellCommand,
+	"migrate":     migrateCommand,
+	"version":     versionCommand,
+}
+
+var databaseCommands = map[string]func(args []string) int{
+	"list":     databaseList,
+	"dump":     databaseDump,
+	"dump-all": databaseDumpAll,
+	"import":   databaseImport,
+	"reset":    databaseReset,
+	"copy":     databaseCopy,
+}
+
+var tableCommands = map[string]func(args []string) int{
+	"list":     tableList,
+	"dump":     func(args []string) int { return tableCSV(true, args) },
+	"import":   func(args []string) int { return tableCSV(false, args) },
+	"copy":     tableCopy,
+	"truncate": tableTruncate,
+	"describe": tableDescribe,
+	"sizes":    tableSizes,
+}
+
+var activityCommands = map[string]func(args []string) int{
+	"list": activityList,
+	"kill": activityKill,
+}
+
+var historyCommands = map[string]func(args []string) int{
+	"list":  historyList,
+	"rerun": historyRerun,
+}
+
+var schemaCommands = map[string]func(args []string) int{
+	"verify": schemaVerify,
+}
+
+// Run runs dbtool with args, the command line without the program name.
+// Every command reports its own failures; the returned error carries the
+// exit code.
+func Run(args []string) error {
+	return cli.Exit(run(args), nil)
+}
+
+// run executes a command line (without the program name) and returns the
+// exit code. Global flags in front of the command are parsed here; the ones
+// after it are parsed by the command's own flag set.
+func run(args []string) int {
+	verbose, dsn, profile, showVersion = false, "", "", ""
+	db.MaxColWidth, db.RowLimit, db.UseReplica = defaultMaxColWidth, defaultRowLimit, defaultUseReplica
+	args, code, ok := parseGlobalFlags(args, helpSummary)
+	if !ok {
+		return code
+	}
+	if len(args) == 0 {
+		if showVersion.Requested() {
+			buildinfo.Print(os.Stdout, "dbtool", showVersion.JSON())
+			return 0
+		}
+		fmt.Println("No command provided. Run 'dbtool help' to see available commands.")
+		usage()
+		return 0
+	}
+	name := normalizeMain(args[0])
+	if name == "help" {
+		return helpCommand(args[1:])
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		return 2
+	}
+	return cmd(args[1:])
+}
+
+func helpCommand(args []string) int {
+	switch {
+	case len(args) == 0:
+		helpSummary()
+	case len(args) == 1:
+		topic := normalizeMain(args[0])
+		if _, ok := commands[topic]; ok {
+			helpFor(topic, "")
+		} else {
+			// allow help on subcommands directly, assume database
+			helpFor("database", args[0])
+		}
+	default:
+		switch topic := normalizeMain(args[0]); topic {
+		case "database", "migrate", "table", "config", "activity", "history", "schema", "query":
+			helpFor(topic, args[1])
+		default:
+			helpSummary()
+		}
+	}
+	return 0
+}
+
+// runGroup dispatches "<group> [global flags] <sub> args..." to subs, keyed
+// by normalizeSub names. A missing or help subcommand shows the group's help;
+// an unknown one does too, as a usage error.
+func runGroup(group string, subs map[string]func(args []string) int, args []string) int {
+	args, code, ok := parseGlobalFlags(args, func() { helpFor(group, "") })
+	if !ok {
+		return code
+	}
+	if len(args) == 0 || isHelpToken(args[0]) {
+		helpFor(group, "")
+		return 0
+	}
+	sub := normalizeSub(args[0])
+	cmd, ok := subs[sub]
+	if !ok {
+		helpFor(group, "")
+		return 2
+	}
+	return cmd(args[1:])
+}
+
+func databaseList(args []string) int {
+	fs := newFlagSet("database list", func() { helpFor("database", "list") })
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 0, 0) {
+		return 2
+	}
+	if err := db.ListDatabases(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func databaseDump(args []string) int {
+	fs := newFlagSet("database dump", func() { helpFor("database", "dump") })
+	structureOnly := fs.Bool("structure-only", false, "Dump only schema (no data)")
+	format := fs.String("format", "plain", "Dump format: plain, custom or directory (pg_dump -F)")
+	compress := fs.Int("compress", 0, "Compression level 0-9 (pg_dump -Z); 0 keeps pg_dump's default")
+	schemas, excludeSchemas := addSchemaFlags(fs)
+	timestamped := fs.Bool("timestamped", false, "Treat <filepath> as a directory and write <dbname>_<timestamp><ext> into it")
+	rotate := db.RotateOptions{}
+	fs.IntVar(&rotate.Keep, "rotate-keep", 0, "After a successful --timestamped dump, delete all but the newest N dumps of the database")
+	fs.Float64Var(&rotate.MinRatio, "rotate-min-ratio", 0.5, "Delete nothing if the new dump is smaller than this fraction of the previous one (0 disables)")
+	metricsOut := addMetricsFlags(fs)
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	stats := metrics.New("dbtool")
+	defer flushMetrics(stats, metricsOut)
+	if !wantArgs(fs, pos, 2, 2) {
+		return 2
+	}
+	if rotate.Keep < 0 || rotate.MinRatio < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --rotate-keep and --rotate-min-ratio cannot be negative")
+		return 2
+	}
+	if rotate.Keep > 0 && !*timestamped {
+		fmt.Fprintln(os.Stderr, "Error: --rotate-keep requires --timestamped")
+		return 2
+	}
+	dbname, path := pos[0], pos[1]
+	opts := db.DumpOptions{StructureOnly: *structureOnly, Format: *format, Compress: *compress, Schemas: *schemas, ExcludeSchemas: *excludeSchemas}
+	if *timestamped {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "dump failed: %v\n", err)
+			return exitcode.Of(err)
+		}
+		path = db.TimestampedDumpPath(path, dbname, time.Now(), opts)
+		fmt.Fprintf(os.Stderr, "dbtool: dumping %s -> %s\n", dbname, path)
+	}
+	if err := stats.Time("dump", func() error { return db.RunPgDumpWith(dbname, path, opts) }); err != nil {
+		fmt.Fprintf(os.Stderr, "dump failed: %v\n", err)
+		return exitcode.Of(err)
+	}
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		stats.Add("dump.bytes", info.Size())
+	}
+	if rotate.Keep > 0 {
+		err := stats.Time("rotate", func() error {
+			_, err := db.RotateDumps(dbname, path, rotate)
+			return err
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rotation failed: %v\n", err)
+			return exitcode.Of(err)
+		}
+	}
+	return 0
+}
+
+func databaseDumpAll(args []string) int {
+	fs := newFlagSet("database dump-all", func() { helpFor("database", "dump-all") })
+	exclude := fs.String("exclude-regex", "", "Skip databases whose name matches this regular expression")
+	structureOnly := fs.Bool("structure-only", false, "Dump only schema (no data)")
+	format := fs.String("format", "plain", "Dump format: plain, custom or directory (pg_dump -F)")
+	compress := fs.Int("compress", 0, "Compression level 0-9 (pg_dump -Z); 0 keeps pg_dump's default")
+	jobs := fs.Int("jobs", 1, "Number of databases to dump at the same time")
+	metricsOut := addMetricsFlags(fs)
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	stats := metrics.New("dbtool")
+	defer flushMetrics(stats, metricsOut)
+	if !wantArgs(fs, pos, 1, 1) {
+		return 2
+	}
+	opts := db.DumpAllOptions{
+		DumpOptions: db.DumpOptions{StructureOnly: *structureOnly, Format: *format, Compress: *compress},
+		Jobs:        *jobs,
+		OnResult: func(r db.DumpResult) {
+			stats.AddTime("dump/"+r.Database, r.Duration)
+			if r.Err != nil {
+				stats.Add("databases.failed", 1)
+				return
+			}
+			stats.Add("databases", 1)
+			stats.Add("dump.bytes", r.Bytes)
+		},
+	}
+	if *exclude != "" {
+		re, err := regexp.Compile(*exclude)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --exclude-regex: %v\n", err)
+			return 2
+		}
+		opts.Exclude = re
+	}
+	if err := stats.Time("dump-all", func() error { return db.DumpAllDatabases(pos[0], opts) }); err != nil {
+		fmt.Fprintf(os.Stderr, "dump-all failed: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func databaseImport(args []string) int {
+	fs := newFlagSet("database import", func() { helpFor("database", "import") })
+	overwrite := fs.Bool("overwrite", false, "Reset schema before import")
+	jobs := fs.Int("jobs", 1, "Parallel pg_restore jobs (custom and directory archives)")
+	singleTx := fs.Bool("single-transaction", false, "Restore in one transaction, rolled back on the first error")
+	schemas, excludeSchemas := addSchemaFlags(fs)
+	metricsOut := addMetricsFlags(fs)
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	stats := metrics.New("dbtool")
+	defer flushMetrics(stats, metricsOut)
+	if !wantArgs(fs, pos, 2, 2) {
+		return 2
+	}
+	opts := db.ImportOptions{Overwrite: *overwrite, Jobs: *jobs, SingleTransaction: *singleTx, Schemas: *schemas, ExcludeSchemas: *excludeSchemas}
+	if err := stats.Time("import", func() error { return db.ImportDatabaseWith(pos[0], pos[1], opts) }); err != nil {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func databaseReset(args []string) int {
+	fs := newFlagSet("database reset", func() { helpFor("database", "reset") })
+	noconfirm := fs.Bool("noconfirm", false, "Do not ask for confirmation")
+	var opts db.ResetOptions
+	fs.Func("schema", "Reset this schema (repeatable)", func(v string) error {
+		opts.Schemas = append(opts.Schemas, v)
+		return nil
+	})
+	fs.BoolVar(&opts.AllUserSchemas, "all-user-schemas", false, "Reset every schema except the system ones")
+	exclude := fs.String("exclude-regex", "", "Leave out schemas whose name matches this regular expression")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 1, 1) {
+		return 2
+	}
+	dbname := pos[0]
+	if *exclude != "" {
+		re, err := regexp.Compile(*exclude)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --exclude-regex: %v\n", err)
+			return 2
+		}
+		opts.Exclude = re
+	}
+	schemas, err := db.ResetTargets(dbname, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reset failed: %v\n", err)
+		return exitcode.Of(err)
+	}
+	if len(schemas) == 0 {
+		fmt.Fprintln(os.Stderr, "reset failed: no schemas selected")
+		return 1
+	}
+	if !*noconfirm && !confirm(fmt.Sprintf("Reset database '%s'? This will drop all objects in schema(s): %s.", dbname, strings.Join(schemas, ", "))) {
+		return 0
+	}
+	if err := db.ResetSchemas(dbname, schemas); err != nil {
+		fmt.Fprintf(os.Stderr, "reset failed: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func databaseCopy(args []string) int {
+	fs := newFlagSet("database copy", func() { helpFor("database", "copy") })
+	dropExisting := fs.Bool("drop-existing", false, "Drop the target database first if it exists")
+	jobs := fs.Int("jobs", 1, "Parallel pg_dump/pg_restore jobs for the dump-based copy")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 2, 2) {
+		return 2
+	}
+	if err := db.CopyDatabase(pos[0], pos[1], db.CopyOptions{DropExisting: *dropExisting, Jobs: *jobs}); err != nil {
+		fmt.Fprintf(os.Stderr, "copy failed: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func tableList(args []string) int {
+	fs := newFlagSet("table list", func() { helpFor("table", "list") })
+	schema := fs.String("schema", "", "Schema to filter by (default: all non-system schemas)")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 0, 1) {
+		return 2
+	}
+	dbname, ok := dbnameArg(pos, 0)
+	if !ok {
+		return 2
+	}
+	if err := db.ListTables(dbname, *schema); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// tableCSV is table export (exporting) and table import; normalizeSub maps
+// "export" to "dump".
+func tableCSV(exporting bool, args []string) int {
+	name, sub := "table import", "import"
+	if exporting {
+		name, sub = "table export", "dump"
+	}
+	fs := newFlagSet(name, func() { helpFor("table", sub) })
+	where := fs.String("where", "", "SQL condition to filter exported rows")
+	truncateFirst := fs.Bool("truncate-first", false, "Truncate the table before importing")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 3, 3) {
+		return 2
+	}
+	dbname, table, file := pos[0], pos[1], pos[2]
+	if exporting {
+		if *truncateFirst {
+			fmt.Fprintln(os.Stderr, "Error: --truncate-first only applies to table import")
+			return 2
+		}
+		n, err := db.ExportTableCSV(dbname, table, file, *where)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "export failed: %v\n", err)
+			return exitcode.Of(err)
+		}
+		fmt.Printf("Exported %d row(s) from %s to %s\n", n, table, file)
+		return 0
+	}
+	if *where != "" {
+		fmt.Fprintln(os.Stderr, "Error: --where only applies to table export")
+		return 2
+	}
+	n, err := db.ImportTableCSV(dbname, table, file, *truncateFirst)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		return exitcode.Of(err)
+	}
+	fmt.Printf("Imported %d row(s) from %s into %s\n", n, file, table)
+	return 0
+}
+
+func tableCopy(args []string) int {
+	fs := newFlagSet("table copy", func() { helpFor("table", "copy") })
+	create := fs.Bool("create", false, "Create the destination table if it does not exist")
+	truncate := fs.Bool("truncate", false, "Truncate the destination table first")
+	sourceDSN := fs.String("source-dsn", "", "Read the source from this postgres:// URL instead of the configured server")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 2, 2) {
+		return 2
+	}
+	srcDB, srcTable, err := db.ParseDBTable(pos[0], false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: source %v\n", err)
+		return 2
+	}
+	dstDB, dstTable, err := db.ParseDBTable(pos[1], true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: destination %v\n", err)
+		return 2
+	}
+	opts := db.TableCopyOptions{Create: *create, Truncate: *truncate, SourceDSN: *sourceDSN}
+	if err := db.CopyTable(srcDB, srcTable, dstDB, dstTable, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "table copy failed: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func tableTruncate(args []string) int {
+	fs := newFlagSet("table truncate", func() { helpFor("table", "truncate") })
+	cascade := fs.Bool("cascade", false, "Also truncate tables with foreign keys to these tables")
+	restartIdentity := fs.Bool("restart-identity", false, "Reset sequences owned by the truncated columns")
+	noconfirm := fs.Bool("noconfirm", false, "Do not ask for confirmation")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if len(pos) == 1 {
+		fmt.Fprintln(os.Stderr, "Error: no tables given")
+		return 2
+	}
+	if !wantArgs(fs, pos, 2, -1) {
+		return 2
+	}
+	dbname, tables := pos[0], pos[1:]
+	missing, err := db.MissingTables(dbname, tables)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitcode.Of(err)
+	}
+	if len(missing) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: table(s) not found, nothing truncated:")
+		for _, m := range missing {
+			fmt.Fprintln(os.Stderr, "  "+m)
+		}
+		return 1
+	}
+	if !*noconfirm && !confirm(fmt.Sprintf("Truncate %s in database '%s'? This deletes all rows.", strings.Join(tables, ", "), dbname)) {
+		return 0
+	}
+	if err := db.TruncateTables(dbname, tables, db.TruncateOptions{Cascade: *cascade, RestartIdentity: *restartIdentity}); err != nil {
+		fmt.Fprintf(os.Stderr, "truncate failed: %v\n", err)
+		return exitcode.Of(err)
+	}
+	for _, t := range tables {
+		fmt.Println("Truncated", t)
+	}
+	return 0
+}
+
+func tableDescribe(args []string) int {
+	fs := newFlagSet("table describe", func() { helpFor("table", "describe") })
+	resolveFormat := addFormatFlags(fs, db.FormatJSON)
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 2, 2) {
+		return 2
+	}
+	format, err := resolveFormat()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if err := db.DescribeTable(pos[0], pos[1], format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func tableSizes(args []string) int {
+	fs := newFlagSet("table sizes", func() { helpFor("table", "sizes") })
+	schema := fs.String("schema", "", "Schema to filter by (default: all non-system schemas)")
+	sortBy := fs.String("sort", "size", "Sort by size, rows or name")
+	exact := fs.Bool("exact", false, "Also run an exact count(*) per table")
+	resolveFormat := addFormatFlags(fs, db.FormatJSON)
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 0, 1) {
+		return 2
+	}
+	dbname, ok := dbnameArg(pos, 0)
+	if !ok {
+		return 2
+	}
+	format, err := resolveFormat()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if err := db.TableSizes(dbname, *schema, *sortBy, *exact, format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func queryCommand(args []string) int {
+	if len(args) > 0 && strings.EqualFold(args[0], "compare") {
+		return queryCompare(args[1:])
+	}
+	fs := newFlagSet("query", func() { helpFor("query", "") })
+	q := fs.String("query", "", "SQL statement to execute")
+	resolveFormat := addFormatFlags(fs, db.FormatJSON, db.FormatJSONL, db.FormatCSV, db.FormatTSV)
+	fs.IntVar(&db.MaxColWidth, "max-col-width", db.MaxColWidth, "Truncate --format=table cells beyond this many characters (0 = no limit)")
+	timeout := fs.Duration("timeout", 0, "Cancel the statement after this long, e.g. 30s (also sets statement_timeout)")
+	fs.IntVar(&db.RowLimit, "limit", 1000, "Stop after this many rows (0 = no limit)")
+	fs.BoolVar(&db.UseReplica, "replica", false, "Run on the read replica (DATABASE_READ_URL or DB_READ_HOST), falling back to the primary")
+	var params []db.QueryParam
+	fs.Func("param", "Bind parameter for $1..$n, in order (repeatable); prefix with int:, float:, numeric:, bool:, text:, json:, uuid:, date:, timestamp: or use null:", func(v string) error {
+		p, err := db.ParseParam(v)
+		if err != nil {
+			return err
+		}
+		params = append(params, p)
+		return nil
+	})
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 0, 1) {
+		return 2
+	}
+	dbname, ok := dbnameArg(pos, 0)
+	if !ok {
+		return 2
+	}
+	format, err := resolveFormat()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if db.RowLimit < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --limit must not be negative")
+		return 2
+	}
+	if *timeout < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --timeout must not be negative")
+		return 2
+	}
+	return runQueryCommand(dbname, *q, format, *timeout, params)
+}
+
+// queryCompare is `query compare <db-a> <db-b>`.
+func queryCompare(args []string) int {
+	fs := newFlagSet("query compare", func() { helpFor("query", "compare") })
+	q := fs.String("query", "", "SQL statement to run against both databases")
+	key := fs.String("key", "", "Comma-separated columns that identify a row")
+	asJSON := fs.Bool("json", false, "Output the comparison as JSON")
+	timeout := fs.Duration("timeout", 0, "Cancel the statements after this long, e.g. 30s")
+	var params []db.QueryParam
+	fs.Func("param", "Bind parameter for $1..$n, in order (repeatable), as for query", func(v string) error {
+		p, err := db.ParseParam(v)
+		if err != nil {
+			return err
+		}
+		params = append(params, p)
+		return nil
+	})
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 2, 2) {
+		return 2
+	}
+	if *timeout < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --timeout must not be negative")
+		return 2
+	}
+	opts := db.CompareOptions{Timeout: *timeout, Params: params}
+	for _, k := range strings.Split(*key, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			opts.Key = append(opts.Key, k)
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	c, err := db.CompareQuery(ctx, pos[0], pos[1], *q, opts)
+	switch {
+	case err == nil:
+	case errors.Is(err, db.ErrQueryTimeout):
+		fmt.Fprintf(os.Stderr, "query timed out: %v\n", err)
+		return exitcode.Timeout
+	case errors.Is(err, db.ErrQueryCanceled):
+		fmt.Fprintln(os.Stderr, "query canceled")
+		return exitQueryCanceled
+	default:
+		fmt.Fprintf(os.Stderr, "compare failed: %v\n", err)
+		return sqlExitCode(err)
+	}
+	if *asJSON {
+		out := struct {
+			Identical bool `json:"identical"`
+			*db.QueryComparison
+		}{c.Identical(), c}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitcode.Of(err)
+		}
+	} else {
+		db.WriteQueryComparison(os.Stdout, c)
+	}
+	if !c.Identical() {
+		return exitResultsDiffer
+	}
+	return 0
+}
+
+// catalogList is index list and sequence list.
+func catalogList(mc string, args []string) int {
+	fs := newFlagSet(mc+" list", func() { helpFor(mc, "") })
+	asJSON := fs.Bool("json", false, "Output as JSON")
+	var table *string
+	if mc == "index" {
+		table = fs.String("table", "", "Only indexes on this [schema.]table")
+	}
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 0, 1) {
+		return 2
+	}
+	dbname, ok := dbnameArg(pos, 0)
+	if !ok {
+		return 2
+	}
+	var err error
+	if mc == "index" {
+		err = db.ListIndexes(dbname, *table, *asJSON)
+	} else {
+		err = db.ListSequences(dbname, *asJSON)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func activityList(args []string) int {
+	fs := newFlagSet("activity list", func() { helpFor("activity", "list") })
+	minDuration := fs.Duration("min-duration", 0, "Only show queries running at least this long (e.g. 30s)")
+	full := fs.Bool("full", false, "Show the whole query text")
+	asJSON := fs.Bool("json", false, "Output as JSON")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 0, 1) {
+		return 2
+	}
+	dbname, ok := dbnameArg(pos, 0)
+	if !ok {
+		return 2
+	}
+	if *minDuration < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --min-duration must not be negative")
+		return 2
+	}
+	if err := db.ListActivity(dbname, *minDuration, *full, *asJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func activityKill(args []string) int {
+	fs := newFlagSet("activity kill", func() { helpFor("activity", "kill") })
+	terminate := fs.Bool("terminate", false, "Close the connection instead of canceling the query")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 1, 1) {
+		return 2
+	}
+	pid, err := strconv.Atoi(pos[0])
+	if err != nil || pid <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid pid %q\n", pos[0])
+		return 2
+	}
+	if err := db.KillBackend(pid, *terminate); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func historyList(args []string) int {
+	fs := newFlagSet("history list", func() { helpFor("history", "list") })
+	dbname := fs.String("db", "", "Only queries run against this database")
+	grep := fs.String("grep", "", "Only queries matching this regular expression")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 0, 0) {
+		return 2
+	}
+	if err := db.ListHistory(*dbname, *grep); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func historyRerun(args []string) int {
+	fs := newFlagSet("history rerun", func() { helpFor("history", "rerun") })
+	resolveFormat := addFormatFlags(fs, db.FormatJSON, db.FormatJSONL, db.FormatCSV, db.FormatTSV)
+	timeout := fs.Duration("timeout", 0, "Cancel the statement after this long, e.g. 30s")
+	fs.IntVar(&db.RowLimit, "limit", 1000, "Stop after this many rows (0 = no limit)")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 1, 1) {
+		return 2
+	}
+	id, err := strconv.Atoi(pos[0])
+	if err != nil || id <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid history id %q\n", pos[0])
+		return 2
+	}
+	format, err := resolveFormat()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if db.RowLimit < 0 || *timeout < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --limit and --timeout must not be negative")
+		return 2
+	}
+	entry, err := db.HistoryByID(id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitcode.Of(err)
+	}
+	if entry.Params > 0 {
+		fmt.Fprintf(os.Stderr, "Error: history entry %d used %d parameter(s), whose values are not stored; rerun it with `query --param ...`\n", id, entry.Params)
+		return 2
+	}
+	fmt.Fprintf(os.Stderr, "dbtool: rerunning #%d against %s\n", id, entry.Database)
+	return runQueryCommand(entry.Database, entry.Query, format, *timeout, nil)
+}
+
+func schemaVerify(args []string) int {
+	fs := newFlagSet("schema verify", func() { helpFor("schema", "verify") })
+	keepTemp := fs.Bool("keep-temp", false, "Keep the temporary reference database for inspection")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 2, 2) {
+		return 2
+	}
+	err := db.VerifySchema(pos[0], pos[1], *keepTemp)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, db.ErrSchemaMismatch):
+		fmt.Fprintf(os.Stderr, "dbtool: %q does not match %s\n", pos[0], pos[1])
+		return exitResultsDiffer
+	}
+	fmt.Fprintf(os.Stderr, "schema verify failed: %v\n", err)
+	return sqlExitCode(err)
+}
+
+func maintenanceCommand(args []string) int {
+	fs := newFlagSet("maintenance", func() { helpFor("maintenance", "") })
+	full := fs.Bool("full", false, "Run VACUUM FULL (rewrites tables, takes exclusive locks)")
+	dryRun := fs.Bool("dry-run", false, "Print the statements without running them")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if len(pos) > 1 && isHelpToken(pos[1]) {
+		fs.Usage()
+		return 0
+	}
+	if !wantArgs(fs, pos, 2, 3) {
+		return 2
+	}
+	var table string
+	if len(pos) == 3 {
+		table = pos[2]
+	}
+	// --verbose is a global flag, so it doubles as VACUUM/ANALYZE/REINDEX
+	// VERBOSE here.
+	opts := db.MaintenanceOptions{Full: *full, Verbose: verbose, DryRun: *dryRun}
+	if err := db.RunMaintenance(pos[1], strings.ToLower(pos[0]), table, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "maintenance failed: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+// configCommand is "config [--json]" and "config test [<dbname>] [--json]".
+func configCommand(args []string) int {
+	args, code, ok := parseGlobalFlags(args, func() { helpFor("config", "") })
+	if !ok {
+		return code
+	}
+	if len(args) > 0 && strings.ToLower(args[0]) == "test" {
+		return configTest(args[1:])
+	}
+	fs := newFlagSet("config", func() { helpFor("config", "") })
+	asJSON := fs.Bool("json", false, "Output as JSON")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 0, 0) {
+		return 2
+	}
+	if err := db.PrintConfig(*asJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "config failed: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func configTest(args []string) int {
+	fs := newFlagSet("config test", func() { helpFor("config", "test") })
+	asJSON := fs.Bool("json", false, "Output as JSON")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 0, 1) {
+		return 2
+	}
+	dbname, ok := dbnameArg(pos, 0)
+	if !ok {
+		return 2
+	}
+	if err := db.TestConnection(dbname, *asJSON); err != nil {
+		if !*asJSON {
+			fmt.Fprintf(os.Stderr, "connection test failed: %v\n", err)
+		}
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func seedCommand(args []string) int {
+	fs := newFlagSet("seed", func() { helpFor("seed", "") })
+	only := fs.String("only", "", "Only apply files whose name matches this glob")
+	noTx := fs.Bool("no-transaction", false, "Apply each file in its own transaction")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 2, 2) {
+		return 2
+	}
+	if err := db.Seed(pos[0], pos[1], db.SeedOptions{NoTransaction: *noTx, Only: *only}); err != nil {
+		fmt.Fprintf(os.Stderr, "seed failed: %v\n", err)
+		return sqlExitCode(err)
+	}
+	return 0
+}
+
+func versionCommand(args []string) int {
+	fs := newFlagSet("version", func() { helpFor("version", "") })
+	asJSON := fs.Bool("json", false, "Print the build information as JSON")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 0, 0) {
+		return 2
+	}
+	buildinfo.Print(os.Stdout, "dbtool", *asJSON)
+	return 0
+}
+
+func waitCommand(args []string) int {
+	fs := newFlagSet("wait", func() { helpFor("wait", "") })
+	timeout := fs.Duration("timeout", 60*time.Second, "Give up after this long")
+	interval := fs.Duration("interval", time.Second, "Pause between attempts")
+	create := fs.Bool("create-missing", false, "Create the database if the server is up but it does not exist")
+	asJSON := fs.Bool("json", false, "Print one JSON progress object per attempt")
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 0, 1) {
+		return 2
+	}
+	dbname, ok := dbnameArg(pos, 0)
+	if !ok {
+		return 2
+	}
+	if *timeout <= 0 || *interval <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --timeout and --interval must be positive")
+		return 2
+	}
+	opts := db.WaitOptions{Timeout: *timeout, Interval: *interval, CreateMissing: *create, JSON: *asJSON}
+	if err := db.WaitForDatabase(dbname, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+func shellCommand(args []string) int {
+	fs := newFlagSet("shell", func() { helpFor("shell", "") })
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	if !wantArgs(fs, pos, 0, 1) {
+		return 2
+	}
+	dbname, ok := dbnameArg(pos, 0)
+	if !ok {
+		return 2
+	}
+	if err := db.Shell(dbname); err != nil {
+		fmt.Fprintf(os.Stderr, "shell failed: %v\n", err)
+		return exitcode.Of(err)
+	}
+	return 0
+}
+
+// migrateCommand is "migrate [up|down|create|status] ...". Plain 'migrate
+// [<dbname>]' predates the subcommands and still means 'up'.
+func migrateCommand(args []string) int {
+	args, code, ok := parseGlobalFlags(args, func() { helpFor("migrate", "") })
+	if !ok {
+		return code
+	}
+	if len(args) > 0 && isHelpToken(args[0]) {
+		helpFor("migrate", "")
+		return 0
+	}
+	sub := "up"
+	if len(args) > 0 {
+		switch s := strings.ToLower(args[0]); s {
+		case "up", "down", "create", "status":
+			sub, args = s, args[1:]
+		}
+	}
+	fs := newFlagSet("migrate "+sub, func() { helpFor("migrate", sub) })
+	var asJSON *bool
+	var steps *int
+	var to *string
+	switch sub {
+	case "status":
+		asJSON = fs.Bool("json", false, "Output as JSON")
+	case "down":
+		steps = fs.Int("steps", 0, "Number of applied migrations to roll back (default 1)")
+		to = fs.String("to", "", "Roll back every migration applied after this ID")
+	}
+	pos, code, ok := parseCommand(fs, args)
+	if !ok {
+		return code
+	}
+	switch sub {
+	case "create":
+		if !wantArgs(fs, pos, 1, -1) {
+			return 2
+		}
+		path, err := db.CreateMigration(strings.Join(pos, "_"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate create failed: %v\n", err)
+			return exitcode.Of(err)
+		}
+		fmt.Println(path)
+	case "status":
+		if !wantArgs(fs, pos, 0, 1) {
+			return 2
+		}
+		dbname, ok := dbnameArg(pos, 0)
+		if !ok {
+			return 2
+		}
+		if err := db.PrintMigrationStatus(dbname, *asJSON); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate status failed: %v\n", err)
+			return exitcode.Of(err)
+		}
+	case "down":
+		if !wantArgs(fs, pos, 0, 1) {
+			return 2
+		}
+		if *steps < 0 || (*steps > 0 && *to != "") {
+			fmt.Fprintln(os.Stderr, "Error: use either --steps=N (N >= 1) or --to=<id>")
+			return 2
+		}
+		if *steps == 0 {
+			*steps = 1
+		}
+		dbname, ok := dbnameArg(pos, 0)
+		if !ok {
+			return 2
+		}
+		if err := db.RollbackMigrations(dbname, *steps, *to); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate down failed: %v\n", err)
+			return exitcode.Of(err)
+		}
+	default:
+		if !wantArgs(fs, pos, 0, 1) {
+			return 2
+		}
+		dbname, ok := dbnameArg(pos, 0)
+		if !ok {
+			return 2
+		}
+		if err := db.RunMigrations(dbname); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate failed: %v\n", err)
+			return exitcode.Of(err)
+		}
+		fmt.Printf("Migrations applied to database %q\n", dbname)
+	}
+	return 0
+}
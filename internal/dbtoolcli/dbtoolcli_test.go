@@ -0,0 +1,220 @@
+package dbtoolcli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	db "cli-things/utility/dbtool"
+	"cli-things/utility/exitcode"
+
+	"github.com/lib/pq"
+)
+
+// unreachableDSN refuses connections at once, so commands get through flag
+// parsing and fail with a connection error (exit 7 for query).
+const unreachableDSN = "postgres://u:p@127.0.0.1:1/postgres"
+
+func TestParseCommand(t *testing.T) {
+	t.Setenv("DBTOOL_VERBOSE", "")
+	cases := []struct {
+		args     []string
+		wantPos  []string
+		wantJSON bool
+		wantQ    string
+	}{
+		{[]string{"--json", "mydb", "--query=select 1"}, []string{"mydb"}, true, "select 1"},
+		{[]string{"mydb", "--query", "select 1", "--json"}, []string{"mydb"}, true, "select 1"},
+		{[]string{"--query=select 1"}, nil, false, "select 1"},
+		{[]string{"a", "--json", "b", "--", "--c"}, []string{"a", "b", "--c"}, true, ""},
+	}
+	for _, c := range cases {
+		verbose, dsn, showVersion = false, "", ""
+		fs := newFlagSet("test", func() {})
+		asJSON := fs.Bool("json", false, "")
+		q := fs.String("query", "", "")
+		pos, code, ok := parseCommand(fs, c.args)
+		if !ok {
+			t.Errorf("%q: stopped with exit %d", c.args, code)
+			continue
+		}
+		if !reflect.DeepEqual(pos, c.wantPos) || *asJSON != c.wantJSON || *q != c.wantQ {
+			t.Errorf("%q: pos=%q json=%v query=%q", c.args, pos, *asJSON, *q)
+		}
+	}
+}
+
+func TestParseCommandGlobalFlags(t *testing.T) {
+	t.Setenv("DBTOOL_VERBOSE", "")
+	for _, args := range [][]string{
+		{"--verbose=true", "mydb", "--dsn=" + unreachableDSN},
+		{"mydb", "-v", "--dsn", unreachableDSN},
+	} {
+		verbose, dsn, showVersion = false, "", ""
+		fs := newFlagSet("test", func() {})
+		pos, _, ok := parseCommand(fs, args)
+		if !ok || !reflect.DeepEqual(pos, []string{"mydb"}) || !verbose || dsn != unreachableDSN {
+			t.Errorf("%q: ok=%v pos=%q verbose=%v dsn=%q", args, ok, pos, verbose, dsn)
+		}
+	}
+	fs := newFlagSet("test", func() {})
+	fs.SetOutput(io.Discard)
+	if _, code, ok := parseCommand(fs, []string{"--nope"}); ok || code != 2 {
+		t.Errorf("unknown flag: ok=%v code=%d, want usage error", ok, code)
+	}
+}
+
+// TestRunQueryArgOrder runs the dispatcher with the query in several
+// argument orders and checks, through the query history, which database and
+// statement each one ran.
+func TestRunQueryArgOrder(t *testing.T) {
+	t.Setenv("DBTOOL_VERBOSE", "")
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("DBTOOL_HISTORY", "1")
+	argvs := [][]string{
+		{"--dsn", unreachableDSN, "query", "mydb", "--query=select 1"},
+		{"query", "--json", "mydb", "--query=select 1", "--dsn=" + unreachableDSN},
+		{"q", "--query", "select 1", "mydb", "--jsonl", "-v", "--dsn", unreachableDSN},
+		{"-v=false", "query", "--dsn=" + unreachableDSN, "--limit=5", "mydb", "--query=select 1"},
+	}
+	for _, argv := range argvs {
+		if code := run(argv); code != exitConnection {
+			t.Errorf("%q: exit %d, want %d (connection refused)", argv, code, exitConnection)
+		}
+	}
+	entries, err := db.ReadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(argvs) {
+		t.Fatalf("%d history entries, want %d", len(entries), len(argvs))
+	}
+	for i, e := range entries {
+		if e.Database != "mydb" || e.Query != "select 1" {
+			t.Errorf("%q ran %q against %q", argvs[i], e.Query, e.Database)
+		}
+	}
+}
+
+func TestRunResetsQuerySettings(t *testing.T) {
+	t.Setenv("DBTOOL_VERBOSE", "")
+	t.Setenv("DBTOOL_HISTORY", "")
+	argv := []string{"query", "--dsn=" + unreachableDSN, "--replica", "--max-col-width=5", "--limit=7", "mydb", "--query=select 1"}
+	if code := run(argv); code != exitConnection {
+		t.Fatalf("%q: exit %d, want %d", argv, code, exitConnection)
+	}
+	if !db.UseReplica || db.MaxColWidth != 5 || db.RowLimit != 7 {
+		t.Fatalf("after %q: replica %v, max-col-width %d, limit %d", argv, db.UseReplica, db.MaxColWidth, db.RowLimit)
+	}
+	// A second command line that does not set them gets the defaults back.
+	if code := run([]string{"help", "query"}); code != 0 {
+		t.Fatalf("help query: exit %d", code)
+	}
+	if db.UseReplica != defaultUseReplica || db.MaxColWidth != defaultMaxColWidth || db.RowLimit != defaultRowLimit {
+		t.Errorf("settings carried over: replica %v, max-col-width %d, limit %d", db.UseReplica, db.MaxColWidth, db.RowLimit)
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	t.Setenv("DBTOOL_VERBOSE", "")
+	cases := []struct {
+		args []string
+		want int
+	}{
+		{nil, 0},
+		{[]string{"--version"}, 0},
+		{[]string{"--version=json"}, 0},
+		{[]string{"version"}, 0},
+		{[]string{"version", "--json"}, 0},
+		{[]string{"version", "extra"}, 2},
+		{[]string{"--version=yaml"}, 2},
+		{[]string{"help"}, 0},
+		{[]string{"-h"}, 0},
+		{[]string{"help", "database", "dump"}, 0},
+		{[]string{"db"}, 0},
+		{[]string{"db", "dump", "--help"}, 0},
+		{[]string{"-v", "db", "dump", "help"}, 0},
+		{[]string{"table", "sizes", "-h"}, 0},
+		{[]string{"migrate", "help"}, 0},
+		{[]string{"migrate", "down", "mydb", "--steps=2", "--to=001_a.sql"}, 2},
+		{[]string{"migrate", "down", "a", "b"}, 2},
+		{[]string{"config", "test", "help"}, 0},
+		{[]string{"bogus"}, 2},
+		{[]string{"db", "bogus"}, 2},
+		{[]string{"db", "dump", "mydb"}, 2},
+		{[]string{"db", "dump", "mydb", "out.sql", "extra"}, 2},
+		{[]string{"db", "dump", "mydb", "out.sql", "--rotate-keep=3"}, 2},
+		{[]string{"db", "dump", "mydb", "/backups", "--timestamped", "--rotate-keep=-1"}, 2},
+		{[]string{"query", "mydb", "--nope"}, 2},
+		{[]string{"query", "a", "b", "--query=select 1"}, 2},
+		{[]string{"query", "mydb", "--json", "--csv", "--query=select 1"}, 2},
+		{[]string{"query", "compare", "a", "--query=select 1"}, 2},
+		{[]string{"help", "query", "compare"}, 0},
+		{[]string{"activity", "kill", "abc"}, 2},
+		{[]string{"table", "truncate", "mydb", "--noconfirm"}, 2},
+		{[]string{"db", "reset", "mydb", "--exclude-regex=(", "--noconfirm"}, 2},
+		{[]string{"schema", "verify", "mydb"}, 2},
+		{[]string{"schema", "verify", "mydb", "--keep-temp", "schema.sql", "extra"}, 2},
+		{[]string{"--dsn=mysql://x", "query", "mydb", "--query=select 1"}, 2},
+		{[]string{"--dsn=mysql://x", "table", "sizes", "mydb"}, exitcode.ConfigError},
+		{[]string{"--dsn", unreachableDSN, "wait", "--timeout=300ms", "--interval=50ms"}, exitcode.Timeout},
+	}
+	for _, c := range cases {
+		if got := run(c.args); got != c.want {
+			t.Errorf("run(%q) = %d, want %d", c.args, got, c.want)
+		}
+	}
+}
+
+func TestSQLExitCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("query: %w", &pq.Error{Code: "42P01"}), exitSQLSyntax},
+		{&pq.Error{Code: "23505"}, exitSQLConstraint},
+		{&pq.Error{Code: "28P01"}, exitConnection},
+		{fmt.Errorf("seed: %w", context.DeadlineExceeded), exitcode.Timeout},
+		{exitcode.Configf("no default database"), exitcode.ConfigError},
+		{errors.New("boom"), exitcode.RuntimeError},
+	}
+	codes := map[int]bool{}
+	for _, c := range cases {
+		got := sqlExitCode(c.err)
+		if got != c.want {
+			t.Errorf("sqlExitCode(%v) = %d, want %d", c.err, got, c.want)
+		}
+		codes[got] = true
+	}
+	if len(codes) != len(cases) {
+		t.Errorf("exit codes overlap: %v", codes)
+	}
+}
+
+func TestRunProfile(t *testing.T) {
+	t.Setenv("DBTOOL_VERBOSE", "")
+	t.Setenv("DBTOOL_PROFILE", "")
+	ini := filepath.Join(t.TempDir(), "config.ini")
+	if err := os.WriteFile(ini, []byte("[default]\nDB_HOST=localhost\n[staging]\nDB_HOST=staging.internal\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DBTOOL_CONFIG_FILE", ini)
+	defer db.SetProfile("")
+	for _, tc := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"config", "--profile=staging"}, 0},
+		{[]string{"--profile", "default", "config"}, 0},
+		{[]string{"--profile=nope", "config"}, exitcode.ConfigError},
+	} {
+		if code := run(tc.args); code != tc.want {
+			t.Errorf("%q: exit %d, want %d", tc.args, code, tc.want)
+		}
+	}
+}
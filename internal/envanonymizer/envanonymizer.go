@@ -0,0 +1,1186 @@
+// Package envanonymizer is the env-anonymizer tool: it writes, checks,
+// diffs and validates .env.example files derived from .env files. The
+// env-anonymizer.go file at the repository root builds it as a standalone
+// binary; clithings runs it as a subcommand.
+package envanonymizer
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+
+	"cli-things/utility/buildinfo"
+	"cli-things/utility/cli"
+	"cli-things/utility/exitcode"
+)
+
+const (
+	defaultEnvFile      = ".env"
+	defaultEnvLocalFile = ".env.local"
+	defaultExampleFile  = "_env.example"  // Updated prefix to use underscore
+	anonymizedValueTpl  = "<%s_VALUE>" // Template for anonymized value
+	permissionReadWrite = 0644         // Standard file permissions
+	secretPlaceholder   = "<SECRET_REDACTED>"
+	secretComment       = "# secret — obtain from your vault"
+
+	formatDotenv     = "dotenv"
+	formatCompose    = "compose"
+	formatGHASecrets = "gha-secrets"
+
+	sortSource = "source"
+	sortAlpha  = "alpha"
+	sortPrefix = "prefix"
+)
+
+// Represents a line in the env file (either a variable, comment, or blank)
+type envLine struct {
+	rawLine    string // Original line content for comments/blanks
+	key        string // Parsed key if it's a variable line
+	isVariable bool   // Flag indicating if this line is a key=value pair
+}
+
+// inputList collects the repeatable -input flag.
+type inputList []string
+
+func (l *inputList) String() string { return strings.Join(*l, ",") }
+
+func (l *inputList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// Run runs env-anonymizer with args, the command line without the program
+// name. Failures are reported on stderr before they are returned.
+func Run(args []string) error {
+	return cli.Report(run(args), func(a ...any) { fmt.Fprintln(os.Stderr, "Error:", fmt.Sprint(a...)) })
+}
+
+func run(args []string) error {
+	// --- Command Line Flags ---
+	fs := flag.NewFlagSet("env-anonymizer", flag.ContinueOnError)
+	var inputs inputList
+	fs.Var(&inputs, "input", "Env file or glob (e.g. \".env.*\") to read; repeatable, in order (default: -env then -local)")
+	envFilePath := fs.String("env", defaultEnvFile, "Path to the main .env file (when no -input is given)")
+	localEnvFilePath := fs.String("local", defaultEnvLocalFile, "Path to the local .env override file (when no -input is given)")
+	outputFilePath := fs.String("output", defaultExampleFile, "Path for the generated .env.example file")
+	check := fs.Bool("check", false, "Verify the output file is up to date without writing it (exit 3 and print a diff if not)")
+	keepValues := fs.String("keep-values", "", "Comma-separated keys or regular expressions (e.g. \"PORT|.*_LEVEL\") whose values are copied verbatim")
+	noClassify := fs.Bool("no-classify", false, "Use the ordinary placeholder for every key instead of marking likely secrets")
+	keepExport := fs.Bool("keep-export", false, "Keep the \"export \" prefix of keys that have it in the input")
+	sortMode := fs.String("sort", "", "Key order: source (default), alpha, or prefix (grouped by the part before the first _ under \"# --- DB ---\" headers)")
+	placeholderTemplate := fs.String("placeholder-template", "", "Go template for ordinary placeholders, with {{.Key}} and the lower/upper functions (e.g. \"changeme-{{.Key | lower}}\"); default <KEY_VALUE>")
+	placeholderMap := fs.String("placeholder-map", "", "File of KEY=literal lines giving the example value of specific keys")
+	format := fs.String("format", formatDotenv, "Output format: dotenv, compose (docker-compose environment: mapping) or gha-secrets (GitHub Actions env:/secrets: snippet)")
+	diffMode := fs.Bool("diff", false, "Compare the env files given as arguments (or -input) with the first one instead of generating; exit 3 when key sets differ")
+	showValues := fs.Bool("show-values", false, "With -diff, print differing values instead of redacting them")
+	jsonOut := fs.Bool("json", false, "With -diff or -validate, print the report as JSON")
+	reportOverrides := fs.Bool("report-overrides", false, "Print keys defined in more than one input and list them as comments at the end of the example")
+	validatePath := fs.String("validate", "", "Check this env file against the example (-against) instead of generating; exit 3 on problems")
+	against := fs.String("against", "", "Example file for -validate (default: the example derived from the -validate file's name, next to it)")
+	showVersion := buildinfo.AddFlag(fs)
+	exitcode.SetUsage(fs, exitcode.Doc{Code: exitcode.Drift, Meaning: "-check, -diff or -validate found differences"})
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+
+	if showVersion.Requested() {
+		return buildinfo.Print(os.Stdout, "env-anonymizer", showVersion.JSON() || *jsonOut)
+	}
+
+	if *validatePath != "" {
+		example := *against
+		if example == "" {
+			example = filepath.Join(filepath.Dir(*validatePath), deriveOutputFilename(*validatePath))
+		}
+		return cli.Exit(runValidate(*validatePath, example, *jsonOut, os.Stdout, os.Stderr), nil)
+	}
+
+	if *diffMode {
+		files := fs.Args()
+		if len(files) == 0 {
+			files = inputs
+		}
+		return cli.Exit(runDiff(files, *showValues, *jsonOut, os.Stdout, os.Stderr), nil)
+	}
+
+	keepRe, err := parseKeepValues(*keepValues)
+	if err != nil {
+		return exitcode.Wrap(exitcode.ConfigError, err)
+	}
+	switch *format {
+	case formatDotenv, formatCompose, formatGHASecrets:
+	default:
+		return cli.Usagef("unknown -format %q (want dotenv, compose or gha-secrets)", *format)
+	}
+	switch *sortMode {
+	case "", sortSource, sortAlpha, sortPrefix:
+	default:
+		return cli.Usagef("unknown -sort %q (want source, alpha or prefix)", *sortMode)
+	}
+	tpl, err := parsePlaceholderTemplate(*placeholderTemplate)
+	if err != nil {
+		return exitcode.Wrap(exitcode.ConfigError, err)
+	}
+	placeholders, err := readPlaceholderMap(*placeholderMap)
+	if err != nil {
+		return exitcode.Wrap(exitcode.ConfigError, err)
+	}
+	opts := exampleOptions{sort: *sortMode, keepValues: keepRe, classify: !*noClassify, format: *format, keepExport: *keepExport,
+		placeholderTpl: tpl, placeholders: placeholders, reportOverrides: *reportOverrides}
+
+	if len(inputs) == 0 {
+		inputs = inputList{*envFilePath, *localEnvFilePath}
+	}
+	// The output is derived from the first input before globs expand, so
+	// -input '.env*' still writes _env.example.
+	if !isFlagPassed(fs, "output") {
+		first := inputs[0]
+		if hasGlobMeta(first) {
+			first = defaultEnvFile
+		}
+		*outputFilePath = deriveOutputFilename(first)
+		if *format != formatDotenv {
+			*outputFilePath = strings.TrimSuffix(*outputFilePath, ".example") + "." + *format + ".yml"
+		}
+	}
+	paths, err := expandInputs(inputs, *outputFilePath)
+	if err != nil {
+		return exitcode.Wrap(exitcode.ConfigError, err)
+	}
+
+	if len(paths) == 0 {
+		fmt.Println("Base env file not found, skipping generation.")
+		return nil
+	}
+	if _, err := os.Stat(paths[0]); os.IsNotExist(err) {
+		fmt.Println("Base env file not found, skipping generation.")
+		return nil
+	}
+
+	if *check {
+		upToDate, err := checkExampleFile(paths, *outputFilePath, opts, os.Stdout)
+		if err != nil {
+			return exitcode.Wrap(exitcode.ConfigError, err)
+		}
+		if !upToDate {
+			fmt.Fprintf(os.Stderr, "%s is out of date; run env-anonymizer to regenerate it\n", *outputFilePath)
+			return cli.Exit(exitcode.Drift, nil)
+		}
+		fmt.Printf("%s is up to date\n", *outputFilePath)
+		return nil
+	}
+
+	fmt.Printf("Reading base config from: %s\n", paths[0])
+	for _, path := range paths[1:] {
+		if _, err := os.Stat(path); err == nil {
+			fmt.Printf("Reading additional keys from: %s\n", path)
+		} else if !os.IsNotExist(err) {
+			// Only log error if it's something other than 'file not found'
+			fmt.Fprintf(os.Stderr, "Warning: Could not stat env file %s: %v\n", path, err)
+		}
+	}
+	fmt.Printf("Generating example file: %s\n", *outputFilePath)
+
+	// --- Process Files ---
+	err = generateExampleFile(paths, *outputFilePath, opts)
+	if err != nil {
+		return err
+	}
+
+	if *reportOverrides {
+		overrides, err := findOverrides(paths)
+		if err != nil {
+			return err
+		}
+		if len(overrides) > 0 {
+			fmt.Println("\nKeys defined in more than one input (the example keeps the first; most dotenv loaders use the last):")
+		}
+		for _, o := range overrides {
+			fmt.Printf("  %s: %s (%s)\n", o.Key, strings.Join(o.Files, ", "), o.differ())
+		}
+	}
+
+	fmt.Printf("\nSuccessfully generated %s\n", *outputFilePath)
+	return nil
+}
+
+// envDiff compares the keys of env file B with those of env file A.
+type envDiff struct {
+	A       string        `json:"a"`
+	B       string        `json:"b"`
+	OnlyInA []string      `json:"onlyInA"`
+	OnlyInB []string      `json:"onlyInB"`
+	Changed []valueChange `json:"changed"`
+}
+
+// valueChange is a key set in both files to different values; the values
+// are empty unless -show-values is given.
+type valueChange struct {
+	Key string `json:"key"`
+	A   string `json:"a,omitempty"`
+	B   string `json:"b,omitempty"`
+}
+
+// readEnvValues returns the keys of an env file in order and their parsed
+// values, read the same way as for the example (first occurrence wins).
+func readEnvValues(path string) ([]string, map[string]envValue, error) {
+	var lines []string
+	keepAll := exampleOptions{keepValues: regexp.MustCompile(".*")}
+	if err := processEnvFile(path, map[string]struct{}{}, &lines, false, keepAll); err != nil {
+		return nil, nil, err
+	}
+	var keys []string
+	values := map[string]envValue{}
+	exampleVariables(lines, func(key string, v envValue) {
+		keys = append(keys, key)
+		values[key] = v
+	})
+	return keys, values, nil
+}
+
+// diffEnvFiles compares every file after the first with the first.
+func diffEnvFiles(files []string, showValues bool) ([]envDiff, error) {
+	aKeys, aValues, err := readEnvValues(files[0])
+	if err != nil {
+		return nil, err
+	}
+	var diffs []envDiff
+	for _, b := range files[1:] {
+		bKeys, bValues, err := readEnvValues(b)
+		if err != nil {
+			return nil, err
+		}
+		d := envDiff{A: files[0], B: b, OnlyInA: []string{}, OnlyInB: []string{}, Changed: []valueChange{}}
+		for _, k := range aKeys {
+			bv, ok := bValues[k]
+			switch {
+			case !ok:
+				d.OnlyInA = append(d.OnlyInA, k)
+			case bv.value != aValues[k].value:
+				c := valueChange{Key: k}
+				if showValues {
+					c.A, c.B = aValues[k].value, bv.value
+				}
+				d.Changed = append(d.Changed, c)
+			}
+		}
+		for _, k := range bKeys {
+			if _, ok := aValues[k]; !ok {
+				d.OnlyInB = append(d.OnlyInB, k)
+			}
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+// runDiff is -diff: it prints the reports and returns the exit code, 0 when
+// every file has the same keys as the first, 3 when not, 2 on errors.
+func runDiff(files []string, showValues, asJSON bool, stdout, stderr io.Writer) int {
+	if len(files) < 2 {
+		fmt.Fprintln(stderr, "Error: -diff needs at least two env files")
+		return exitcode.ConfigError
+	}
+	diffs, err := diffEnvFiles(files, showValues)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitcode.ConfigError
+	}
+	code := exitcode.OK
+	for _, d := range diffs {
+		if len(d.OnlyInA) > 0 || len(d.OnlyInB) > 0 {
+			code = exitcode.Drift
+		}
+	}
+	if asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diffs); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return exitcode.ConfigError
+		}
+		return code
+	}
+	for _, d := range diffs {
+		fmt.Fprintf(stdout, "--- %s\n+++ %s\n", d.A, d.B)
+		for _, k := range d.OnlyInA {
+			fmt.Fprintf(stdout, "- %s\n", k)
+		}
+		for _, k := range d.OnlyInB {
+			fmt.Fprintf(stdout, "+ %s\n", k)
+		}
+		for _, c := range d.Changed {
+			if showValues {
+				fmt.Fprintf(stdout, "~ %s: %q -> %q\n", c.Key, c.A, c.B)
+			} else {
+				fmt.Fprintf(stdout, "~ %s (values differ)\n", c.Key)
+			}
+		}
+		if len(d.OnlyInA)+len(d.OnlyInB)+len(d.Changed) == 0 {
+			fmt.Fprintln(stdout, "no differences")
+		}
+	}
+	return code
+}
+
+// placeholderValueRe matches a default placeholder left in a real env file.
+var placeholderValueRe = regexp.MustCompile(`^<.*_VALUE>$`)
+
+// envValidation is the -validate report for one env file.
+type envValidation struct {
+	Env     string `json:"env"`
+	Against string `json:"against"`
+	// Missing keys are in the example but not in the env file.
+	Missing []string `json:"missing"`
+	// Extra keys are in the env file but not in the example.
+	Extra []string `json:"extra"`
+	// EmptySecrets are keys the example marks as secret that are empty.
+	EmptySecrets []string `json:"emptySecrets"`
+	// Placeholders are keys whose value is still an example placeholder.
+	Placeholders []string `json:"placeholders"`
+	OK           bool     `json:"ok"`
+}
+
+// validateEnvFile checks envPath against the example at examplePath.
+func validateEnvFile(envPath, examplePath string) (*envValidation, error) {
+	exKeys, exValues, err := readEnvValues(examplePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read example file %s: %w", examplePath, err)
+	}
+	keys, values, err := readEnvValues(envPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file %s: %w", envPath, err)
+	}
+	r := &envValidation{Env: envPath, Against: examplePath,
+		Missing: []string{}, Extra: []string{}, EmptySecrets: []string{}, Placeholders: []string{}}
+	for _, k := range exKeys {
+		v, ok := values[k]
+		ex := exValues[k]
+		switch {
+		case !ok:
+			r.Missing = append(r.Missing, k)
+		case strings.TrimSpace(v.value) == "" && (ex.value == secretPlaceholder || strings.Contains(ex.comment, secretComment)):
+			r.EmptySecrets = append(r.EmptySecrets, k)
+		}
+	}
+	for _, k := range keys {
+		if _, ok := exValues[k]; !ok {
+			r.Extra = append(r.Extra, k)
+		}
+		if v := strings.TrimSpace(values[k].value); v == secretPlaceholder || placeholderValueRe.MatchString(v) {
+			r.Placeholders = append(r.Placeholders, k)
+		}
+	}
+	r.OK = len(r.Missing)+len(r.Extra)+len(r.EmptySecrets)+len(r.Placeholders) == 0
+	return r, nil
+}
+
+// runValidate is -validate: it prints the report and returns the exit code,
+// 0 when the env file matches the example, 1 when it does not, 2 on errors.
+func runValidate(envPath, examplePath string, asJSON bool, stdout, stderr io.Writer) int {
+	r, err := validateEnvFile(envPath, examplePath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitcode.ConfigError
+	}
+	if asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return exitcode.ConfigError
+		}
+	} else {
+		for _, group := range []struct {
+			label string
+			keys  []string
+		}{
+			{"missing", r.Missing},
+			{"unexpected", r.Extra},
+			{"empty secret", r.EmptySecrets},
+			{"placeholder value", r.Placeholders},
+		} {
+			for _, k := range group.keys {
+				fmt.Fprintf(stdout, "%s: %s\n", group.label, k)
+			}
+		}
+		if r.OK {
+			fmt.Fprintf(stdout, "%s matches %s\n", envPath, examplePath)
+		}
+	}
+	if !r.OK {
+		return exitcode.Drift
+	}
+	return exitcode.OK
+}
+
+// keyOverride is a key defined in more than one input file.
+type keyOverride struct {
+	Key    string
+	Files  []string // in input order, the first being the one the example keeps
+	Differ bool     // whether the files set different values
+}
+
+func (o keyOverride) differ() string {
+	if o.Differ {
+		return "values differ"
+	}
+	return "same value"
+}
+
+// findOverrides lists the keys set in more than one of inputs, in the order
+// they first appear. Missing inputs are skipped.
+func findOverrides(inputs []string) ([]keyOverride, error) {
+	var order []string
+	byKey := map[string]*keyOverride{}
+	first := map[string]string{}
+	for _, path := range inputs {
+		keys, values, err := readEnvValues(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			o, ok := byKey[k]
+			if !ok {
+				o = &keyOverride{Key: k}
+				byKey[k] = o
+				order = append(order, k)
+				first[k] = values[k].value
+			}
+			o.Files = append(o.Files, path)
+			if values[k].value != first[k] {
+				o.Differ = true
+			}
+		}
+	}
+	var overrides []keyOverride
+	for _, k := range order {
+		if o := byKey[k]; len(o.Files) > 1 {
+			overrides = append(overrides, *o)
+		}
+	}
+	return overrides, nil
+}
+
+// overrideComments lists overrides as comments for the end of the example,
+// under one "# overridden in: <file>" header per file that redefines keys.
+func overrideComments(overrides []keyOverride) []string {
+	var files []string
+	byFile := map[string][]string{}
+	for _, o := range overrides {
+		for _, f := range o.Files[1:] {
+			if _, ok := byFile[f]; !ok {
+				files = append(files, f)
+			}
+			byFile[f] = append(byFile[f], fmt.Sprintf("#   %s (%s)", o.Key, o.differ()))
+		}
+	}
+	var lines []string
+	for _, f := range files {
+		lines = append(lines, "", "# overridden in: "+f)
+		lines = append(lines, byFile[f]...)
+	}
+	return lines
+}
+
+// hasGlobMeta reports whether pattern uses filepath.Match syntax.
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// expandInputs resolves -input values into the files to read, in order.
+// Plain paths are kept even when missing; globs expand to their matches in
+// lexical order, skipping outputPath and files already listed.
+func expandInputs(inputs []string, outputPath string) ([]string, error) {
+	var paths []string
+	seen := map[string]bool{}
+	for _, in := range inputs {
+		if !hasGlobMeta(in) {
+			if !seen[filepath.Clean(in)] {
+				seen[filepath.Clean(in)] = true
+				paths = append(paths, in)
+			}
+			continue
+		}
+		matches, err := filepath.Glob(in)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -input pattern %q: %w", in, err)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if seen[filepath.Clean(m)] || filepath.Clean(m) == filepath.Clean(outputPath) {
+				continue
+			}
+			if info, err := os.Stat(m); err == nil && info.IsDir() {
+				continue
+			}
+			seen[filepath.Clean(m)] = true
+			paths = append(paths, m)
+		}
+	}
+	return paths, nil
+}
+
+// exampleOptions controls how values are written to the example file.
+type exampleOptions struct {
+	// keepValues matches the keys whose original values are safe to copy
+	// into the example (e.g. PORT, LOG_LEVEL); nil anonymizes every value.
+	keepValues *regexp.Regexp
+	// classify gives keys that look like secrets (see isSecret) the
+	// secretPlaceholder and secretComment.
+	classify bool
+	// format is formatDotenv, formatCompose or formatGHASecrets; "" is
+	// dotenv.
+	format string
+	// keepExport writes "export " before keys that had it in the input.
+	keepExport bool
+	// sort is sortAlpha or sortPrefix to reorder keys; "" or sortSource
+	// keeps the input order.
+	sort string
+	// placeholderTpl renders ordinary placeholders instead of
+	// anonymizedValueTpl when set.
+	placeholderTpl *template.Template
+	// placeholders are per-key example values from -placeholder-map.
+	placeholders map[string]string
+	// reportOverrides appends overrideComments to the example.
+	reportOverrides bool
+}
+
+var (
+	// secretKeyWords are substrings of key names that hold credentials.
+	secretKeyWords = []string{"KEY", "TOKEN", "SECRET", "PASSWORD", "DSN"}
+	// secretValuePatterns match common credential formats.
+	secretValuePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^(?:AKIA|ASIA)[0-9A-Z]{16}$`),                            // AWS access key ID
+		regexp.MustCompile(`^eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+$`), // JWT
+		regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://[^/@:\s]*:[^/@\s]+@`),         // URL with a password
+	}
+)
+
+// isSecret reports whether key, with its raw (possibly quoted) value, looks
+// like a credential: the key names one (API_KEY, GITHUB_TOKEN, DB_PASSWORD,
+// SENTRY_DSN) or the value is an AWS access key, a JWT or a URL with a
+// password in it.
+func isSecret(key, value string) bool {
+	upper := strings.ToUpper(key)
+	for _, w := range secretKeyWords {
+		if strings.Contains(upper, w) {
+			return true
+		}
+	}
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	for _, re := range secretValuePatterns {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseKeepValues compiles the -keep-values list: comma-separated key names
+// or regular expressions, each matched against the whole key.
+func parseKeepValues(spec string) (*regexp.Regexp, error) {
+	var alts []string
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			alts = append(alts, "(?:"+item+")")
+		}
+	}
+	if len(alts) == 0 {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + strings.Join(alts, "|") + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid -keep-values %q: %w", spec, err)
+	}
+	return re, nil
+}
+
+// envValue is the right-hand side of a KEY=value line.
+type envValue struct {
+	value   string // without quotes; escapes are kept as written
+	quote   string // ", ' or "" for an unquoted value
+	comment string // inline comment including its '#', or ""
+}
+
+// parseEnvValue splits raw, everything after the '=', into the value, its
+// quoting and an inline comment. A '#' inside quotes is part of the value;
+// outside quotes it starts a comment when it opens the value or follows
+// whitespace, so URL fragments like a#b stay in the value. An unterminated
+// quote is kept as part of an unquoted value.
+func parseEnvValue(raw string) envValue {
+	raw = strings.TrimSpace(raw)
+	if raw != "" && (raw[0] == '"' || raw[0] == '\'') {
+		if i := closingQuote(raw[1:], raw[0]); i >= 0 {
+			i++ // index in raw
+			v := envValue{value: raw[1:i], quote: raw[:1]}
+			if rest := strings.TrimSpace(raw[i+1:]); strings.HasPrefix(rest, "#") {
+				v.comment = rest
+			}
+			return v
+		}
+	}
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && (i == 0 || raw[i-1] == ' ' || raw[i-1] == '\t') {
+			return envValue{value: strings.TrimSpace(raw[:i]), comment: raw[i:]}
+		}
+	}
+	return envValue{value: raw}
+}
+
+// closingQuote returns the index in s of the first q that ends a quoted
+// value, or -1. Inside double quotes a backslash escapes the next character.
+func closingQuote(s string, q byte) int {
+	for i := 0; i < len(s); i++ {
+		if q == '"' && s[i] == '\\' {
+			i++ // skip the escaped character
+			continue
+		}
+		if s[i] == q {
+			return i
+		}
+	}
+	return -1
+}
+
+// placeholderData is what a -placeholder-template can refer to.
+type placeholderData struct {
+	Key string
+}
+
+// parsePlaceholderTemplate parses a -placeholder-template and tries it on a
+// sample key, so that mistakes such as {{.Name}} fail before any file is
+// read. An empty text returns nil.
+func parsePlaceholderTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tpl, err := template.New("placeholder").Option("missingkey=error").Funcs(template.FuncMap{
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+	}).Parse(text)
+	if err == nil {
+		err = tpl.Execute(io.Discard, placeholderData{Key: "EXAMPLE_KEY"})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid -placeholder-template %q: %w", text, err)
+	}
+	return tpl, nil
+}
+
+// readPlaceholderMap reads a -placeholder-map file: KEY=literal lines, with
+// blank lines and # comments ignored. The literal is used as written.
+func readPlaceholderMap(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read placeholder map: %w", err)
+	}
+	placeholders := map[string]string{}
+	for n, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: want KEY=literal, got %q", path, n+1, line)
+		}
+		placeholders[key] = strings.TrimSpace(value)
+	}
+	return placeholders, nil
+}
+
+// placeholder is the ordinary placeholder for key: opts.placeholderTpl's
+// output, or <KEY_VALUE>.
+func placeholder(key string, opts exampleOptions) string {
+	if opts.placeholderTpl != nil {
+		var b strings.Builder
+		if err := opts.placeholderTpl.Execute(&b, placeholderData{Key: key}); err == nil {
+			return b.String()
+		}
+	}
+	return fmt.Sprintf(anonymizedValueTpl, strings.ToUpper(key))
+}
+
+// exampleLine is the example file's line for key: the original value when
+// opts keeps it (even for a secret, since keeping is explicit), the
+// -placeholder-map value for key, the secret placeholder and comment when
+// opts classifies it as one, else the ordinary placeholder. The value's
+// quoting and inline comment are kept.
+func exampleLine(key string, v envValue, opts exampleOptions) string {
+	value, comment := v.value, v.comment
+	override, overridden := opts.placeholders[key]
+	switch {
+	case opts.keepValues != nil && opts.keepValues.MatchString(key):
+	case overridden:
+		value = override
+	case opts.classify && isSecret(key, v.value):
+		value = secretPlaceholder
+		comment = strings.TrimSpace(comment + " " + secretComment)
+	default:
+		value = placeholder(key, opts)
+	}
+	line := key + "=" + v.quote + value + v.quote
+	if comment != "" {
+		line += " " + comment
+	}
+	return line
+}
+
+// generateExampleFile orchestrates the reading, processing, and writing.
+func generateExampleFile(inputs []string, outputPath string, opts exampleOptions) error {
+	outputContent, err := renderExample(inputs, opts)
+	if err != nil {
+		return err
+	}
+
+	// Ensure the output directory exists
+	outputDir := filepath.Dir(outputPath)
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create output directory %s: %w", outputDir, err)
+	}
+
+	err = os.WriteFile(outputPath, []byte(outputContent), permissionReadWrite)
+	if err != nil {
+		return fmt.Errorf("failed to write example file %s: %w", outputPath, err)
+	}
+
+	return nil
+}
+
+// renderExample builds the example file's content in memory from inputs, in
+// order: the first supplies the layout (comments and blank lines), later
+// ones only contribute keys not seen before.
+func renderExample(inputs []string, opts exampleOptions) (string, error) {
+	// Keep track of keys we've already added to the example to handle overrides
+	// and ensure uniqueness.
+	seenKeys := make(map[string]struct{}) // Using struct{} as a zero-memory value
+
+	// Store the final lines for the .env.example file, preserving order.
+	var outputLines []string
+
+	for i, path := range inputs {
+		if i == 0 {
+			// --- Process the main .env file ---
+			err := processEnvFile(path, seenKeys, &outputLines, true, opts) // Process comments/blanks
+			if err != nil && !os.IsNotExist(err) {                          // It's okay if .env doesn't exist, but error otherwise
+				return "", fmt.Errorf("failed to process base env file %s: %w", path, err)
+			} else if os.IsNotExist(err) {
+				fmt.Printf("Warning: Base env file %s not found, proceeding without it.\n", path)
+			}
+			continue
+		}
+		// --- Process the later files (optional additions) ---
+		err := processEnvFile(path, seenKeys, &outputLines, false, opts) // Don't process comments/blanks from later files
+		if err != nil && !os.IsNotExist(err) {                           // It's okay if e.g. .env.local doesn't exist
+			// Only warn if we couldn't process it for reasons other than not existing
+			fmt.Fprintf(os.Stderr, "Warning: Failed to process env file %s: %v\n", path, err)
+		}
+	}
+
+	if opts.sort == sortAlpha || opts.sort == sortPrefix {
+		outputLines = sortExample(outputLines, opts.sort)
+	}
+	if opts.reportOverrides {
+		overrides, err := findOverrides(inputs)
+		if err != nil {
+			return "", err
+		}
+		outputLines = append(outputLines, overrideComments(overrides)...)
+	}
+	switch opts.format {
+	case formatCompose:
+		return renderCompose(outputLines), nil
+	case formatGHASecrets:
+		return renderGHASecrets(outputLines), nil
+	}
+	return strings.Join(outputLines, "\n"), nil
+}
+
+// exampleKey is the key of a variable line of the dotenv example, or "" for
+// a comment or blank line.
+func exampleKey(line string) string {
+	t := strings.TrimSpace(line)
+	if t == "" || strings.HasPrefix(t, "#") {
+		return ""
+	}
+	key, _, _ := strings.Cut(strings.TrimPrefix(t, "export "), "=")
+	return key
+}
+
+// sortExample reorders the dotenv example's variables by key, each keeping
+// the comment lines right above it. In prefix mode keys are grouped by the
+// token before their first underscore under "# --- DB ---" headers, with
+// keys that have no underscore last under "# --- OTHER ---". Blank lines
+// are dropped (prefix mode separates groups with one); comments after the
+// last key stay at the end.
+func sortExample(lines []string, mode string) []string {
+	type block struct {
+		key, group string
+		lines      []string
+	}
+	var blocks []block
+	var pending []string
+	for _, line := range lines {
+		key := exampleKey(line)
+		if key == "" {
+			if strings.TrimSpace(line) != "" {
+				pending = append(pending, line)
+			}
+			continue
+		}
+		group := "OTHER"
+		if token, _, ok := strings.Cut(key, "_"); ok && token != "" {
+			group = strings.ToUpper(token)
+		}
+		blocks = append(blocks, block{key, group, append(pending, line)})
+		pending = nil
+	}
+
+	rank := func(b block) string {
+		if b.group == "OTHER" {
+			return "\xff"
+		}
+		return b.group
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		if mode == sortPrefix && blocks[i].group != blocks[j].group {
+			return rank(blocks[i]) < rank(blocks[j])
+		}
+		return blocks[i].key < blocks[j].key
+	})
+
+	var out []string
+	for i, b := range blocks {
+		if mode == sortPrefix && (i == 0 || b.group != blocks[i-1].group) {
+			if i > 0 {
+				out = append(out, "")
+			}
+			out = append(out, "# --- "+b.group+" ---")
+		}
+		out = append(out, b.lines...)
+	}
+	return append(out, pending...)
+}
+
+// exampleVariables yields the key and parsed value of each variable line of
+// the dotenv example, in order, skipping comments and blank lines.
+func exampleVariables(lines []string, fn func(key string, v envValue)) {
+	for _, line := range lines {
+		t := strings.TrimSpace(line)
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		if key, raw, ok := strings.Cut(strings.TrimPrefix(t, "export "), "="); ok {
+			fn(key, parseEnvValue(raw))
+		}
+	}
+}
+
+// renderCompose turns the dotenv example into a docker-compose environment:
+// mapping, with the full-line and inline comments kept as YAML comments.
+func renderCompose(lines []string) string {
+	var b strings.Builder
+	b.WriteString("environment:\n")
+	for _, line := range lines {
+		if t := strings.TrimSpace(line); strings.HasPrefix(t, "#") {
+			b.WriteString("  " + t + "\n")
+			continue
+		}
+		exampleVariables([]string{line}, func(key string, v envValue) {
+			b.WriteString("  " + key + ": " + yamlQuote(v.value))
+			if v.comment != "" {
+				b.WriteString(" " + v.comment)
+			}
+			b.WriteString("\n")
+		})
+	}
+	return b.String()
+}
+
+// renderGHASecrets lists every key of the dotenv example as a GitHub
+// Actions secret reference, once for a job's env: block and once for the
+// secrets: of a reusable workflow call.
+func renderGHASecrets(lines []string) string {
+	var refs []string
+	exampleVariables(lines, func(key string, _ envValue) {
+		refs = append(refs, "  "+key+": ${{ secrets."+strings.ToUpper(key)+" }}\n")
+	})
+	var b strings.Builder
+	b.WriteString("env:\n")
+	for _, r := range refs {
+		b.WriteString(r)
+	}
+	b.WriteString("secrets:\n")
+	for _, r := range refs {
+		b.WriteString(r)
+	}
+	return b.String()
+}
+
+// yamlQuote writes s as a double-quoted YAML scalar.
+func yamlQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(s) + `"`
+}
+
+// checkExampleFile compares the example that would be generated with the
+// existing outputPath, ignoring trailing whitespace and line-ending
+// differences, and writes a unified diff to w when they differ. A missing
+// output file is out of date. Nothing is written to disk.
+func checkExampleFile(inputs []string, outputPath string, opts exampleOptions, w io.Writer) (bool, error) {
+	want, err := renderExample(inputs, opts)
+	if err != nil {
+		return false, err
+	}
+	have, err := os.ReadFile(outputPath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read example file %s: %w", outputPath, err)
+	}
+	haveLines, wantLines := normalizeLines(string(have)), normalizeLines(want)
+	if slices.Equal(haveLines, wantLines) {
+		return true, nil
+	}
+	_, err = io.WriteString(w, unifiedDiff(outputPath, outputPath+" (generated)", haveLines, wantLines))
+	return false, err
+}
+
+// normalizeLines splits content into lines without trailing whitespace or
+// CR, dropping blank lines at the end, so that editors' EOL and final
+// newline choices do not count as changes.
+func normalizeLines(content string) []string {
+	lines := strings.Split(content, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t\r")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// unifiedDiff renders the changes from a to b as a unified diff with three
+// lines of context, like diff -u.
+func unifiedDiff(fromName, toName string, a, b []string) string {
+	const context = 3
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type diffOp struct {
+		kind   byte // ' ', '-' or '+'
+		text   string
+		ai, bi int // position in a and b before this line
+	}
+	var ops []diffOp
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		// A hunk runs from context lines before the first change to context
+		// lines after the last one not separated by more than 2*context
+		// unchanged lines.
+		start, end := max(k-context, 0), k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end = min(end+context, len(ops))
+				break
+			}
+			end = run
+		}
+		hunk := ops[start:end]
+		aLen, bLen := 0, 0
+		for _, o := range hunk {
+			if o.kind != '+' {
+				aLen++
+			}
+			if o.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(hunk[0].ai, aLen), hunkRange(hunk[0].bi, bLen))
+		for _, o := range hunk {
+			out.WriteByte(o.kind)
+			out.WriteString(o.text)
+			out.WriteByte('\n')
+		}
+		k = end
+	}
+	return out.String()
+}
+
+// hunkRange formats one side of a hunk header; start is 0-based.
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// processEnvFile reads a single env file, parses it, and updates the seenKeys and outputLines.
+// If includeNonVariables is true, comments and blank lines are added to outputLines.
+// Values are anonymized unless opts keeps them. A quoted value may span
+// several lines and becomes a single placeholder; `export ` prefixes are
+// dropped unless opts.keepExport is set.
+func processEnvFile(filePath string, seenKeys map[string]struct{}, outputLines *[]string, includeNonVariables bool, opts exampleOptions) error {
+    file, err := os.Open(filePath)
+    if err != nil {
+        return err // Return error to be handled by caller (might be os.ErrNotExist)
+    }
+    defer file.Close()
+
+    scanner := bufio.NewScanner(file)
+    // Increase the scanner buffer to handle long lines (up to ~1MB)
+    buf := make([]byte, 0, 64*1024)
+    scanner.Buffer(buf, 1024*1024)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        originalLine := scanner.Text() // Keep original for comments/blanks
+
+		// Handle Comments and Blank Lines
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			if includeNonVariables {
+				*outputLines = append(*outputLines, originalLine)
+			}
+			continue // Move to the next line
+		}
+
+		// Handle Key-Value Pairs
+        parts := strings.SplitN(line, "=", 2)
+        if len(parts) != 2 {
+			// Line doesn't contain '=', treat as malformed or just a key without value?
+			// For safety/simplicity, we'll skip lines without '='.
+			// If includeNonVariables, maybe add as a comment? For now, skip.
+			if includeNonVariables {
+				fmt.Fprintf(os.Stderr, "Warning: Skipping malformed line in %s: %s\n", filePath, originalLine)
+				*outputLines = append(*outputLines, "# "+originalLine+" # Skipped Malformed Line")
+			}
+			continue
+		}
+
+        key := strings.TrimSpace(parts[0])
+        // Support shell-style `export KEY=val` by stripping the prefix
+        exported := false
+        if strings.HasPrefix(strings.ToLower(key), "export ") {
+            key = strings.TrimSpace(key[len("export "):])
+            exported = true
+        }
+        // Basic validation: Ensure key is not empty and doesn't contain problematic chars (optional)
+        if key == "" {
+			if includeNonVariables {
+				fmt.Fprintf(os.Stderr, "Warning: Skipping line with empty key in %s: %s\n", filePath, originalLine)
+				*outputLines = append(*outputLines, "# "+originalLine+" # Skipped Empty Key")
+			}
+			continue
+		}
+
+		// A quoted value without its closing quote continues on the
+		// following lines, e.g. a PEM private key.
+		raw := parts[1]
+		if v := strings.TrimSpace(raw); v != "" && (v[0] == '"' || v[0] == '\'') && closingQuote(v[1:], v[0]) < 0 {
+			closed := false
+			for !closed && scanner.Scan() {
+				raw += "\n" + scanner.Text()
+				v = strings.TrimSpace(raw)
+				closed = closingQuote(v[1:], v[0]) >= 0
+			}
+			if !closed {
+				fmt.Fprintf(os.Stderr, "Warning: Unterminated quoted value for %s in %s\n", key, filePath)
+			}
+		}
+
+		// If we haven't seen this key before, add it to the output
+		if _, found := seenKeys[key]; !found {
+			seenKeys[key] = struct{}{} // Mark key as seen
+			line := exampleLine(key, parseEnvValue(raw), opts)
+			if exported && opts.keepExport {
+				line = "export " + line
+			}
+			*outputLines = append(*outputLines, line)
+		}
+		// If key was already seen (from .env), we don't add it again when processing .env.local
+	}
+
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		return fmt.Errorf("error reading file %s: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// isFlagPassed checks if a flag was passed in the command line arguments
+func isFlagPassed(fs *flag.FlagSet, name string) bool {
+	found := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// deriveOutputFilename generates the example filename based on the input filename
+func deriveOutputFilename(envPath string) string {
+	baseName := filepath.Base(envPath)
+	if strings.HasPrefix(baseName, ".") {
+		return "_" + baseName[1:] + ".example"
+	}
+	return "_" + baseName + ".example"
+}
@@ -0,0 +1,140 @@
+package internalip
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cli-things/internal/testdb"
+	"cli-things/utility/dbconf"
+)
+
+// The tests in this file run against a real server from internal/testdb
+// and skip when there is none.
+
+func TestMain(m *testing.M) { os.Exit(testdb.Run(m)) }
+
+func TestStoreAndListIntegration(t *testing.T) {
+	name, dsn := testdb.New(t)
+	testdb.Use(t, dsn, dbconf.Reload)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := dbconf.ApplyMigrationsFromDir(ctx, name, "../../migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, info := range []InternalIPInfo{
+		{Hostname: "host-a", Interface: "eth0", IP: "10.0.0.5", MACAddress: "02:00:00:00:00:01"},
+		{Hostname: "host-a", Interface: "eth0", IP: "10.0.0.5", MACAddress: "02:00:00:00:00:01"},
+		{Hostname: "host-a", Interface: "eth0", IP: "10.0.0.6", MACAddress: "02:00:00:00:00:01"},
+		{Hostname: "host-a", Interface: "wlan0", IP: "fd00::2", IsIPv6: true},
+		{Hostname: "host-b", Interface: "eth0", IP: "10.0.0.5"},
+		// Back to an address the interface had before: a new open row.
+		{Hostname: "host-a", Interface: "eth0", IP: "10.0.0.5", MACAddress: "02:00:00:00:00:01"},
+	} {
+		if err := storeInternalIP(ctx, name, info); err != nil {
+			t.Fatalf("store %+v: %v", info, err)
+		}
+	}
+
+	got, err := listStoredIPs(ctx, name, "host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InternalIPInfo{
+		{Hostname: "host-a", Interface: "eth0", IP: "10.0.0.5", MACAddress: "02:00:00:00:00:01"},
+		{Hostname: "host-a", Interface: "wlan0", IP: "fd00::2", IsIPv6: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("listed %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Timestamp.IsZero() {
+			t.Errorf("row %d has no first-use time", i)
+		}
+		got[i].Timestamp = time.Time{}
+		if got[i] != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	all, err := listStoredIPs(ctx, name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[2].Hostname != "host-b" {
+		t.Errorf("listed %+v, want host-a's two open rows then host-b's", all)
+	}
+
+	db, err := dbconf.ConnectDBAsContext(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var rows int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM public.internal_ip_history WHERE hostname = 'host-a' AND interface_name = 'eth0'`).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 3 {
+		t.Errorf("host-a eth0 has %d history row(s), want 3 (10.0.0.5, 10.0.0.6, 10.0.0.5 again)", rows)
+	}
+}
+
+func TestOpenUniqueMigrationIntegration(t *testing.T) {
+	name, dsn := testdb.New(t)
+	testdb.Use(t, dsn, dbconf.Reload)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Apply the table's migration alone, so duplicate open rows can go in
+	// before the unique index exists.
+	dir := t.TempDir()
+	copyMigration := func(file string) {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join("../../migrations", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	copyMigration("20251104_0003_internal_ip_history.sql")
+	if err := dbconf.ApplyMigrationsFromDir(ctx, name, dir); err != nil {
+		t.Fatal(err)
+	}
+	db, err := dbconf.ConnectDBAsContext(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `INSERT INTO public.internal_ip_history
+		(hostname, interface_name, ip, first_use_at, last_use_at) VALUES
+		('host-a', 'eth0', '10.0.0.5', '2026-01-03', NULL),
+		('host-a', 'eth0', '10.0.0.5', '2026-01-01', NULL),
+		('host-a', 'eth0', '10.0.0.5', '2026-01-02', NULL),
+		('host-a', 'eth0', '10.0.0.5', '2025-12-01', '2025-12-31'),
+		('host-a', 'eth1', '10.0.0.5', '2026-01-02', NULL)`); err != nil {
+		t.Fatal(err)
+	}
+
+	copyMigration("20261016_0008_internal_ip_open_unique.sql")
+	if err := dbconf.ApplyMigrationsFromDir(ctx, name, dir); err != nil {
+		t.Fatalf("migration with duplicate open rows: %v", err)
+	}
+	var open, closed int
+	var since time.Time
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FILTER (WHERE last_use_at IS NULL), count(*) FILTER (WHERE last_use_at IS NOT NULL),
+		min(first_use_at) FILTER (WHERE last_use_at IS NULL)
+		FROM public.internal_ip_history WHERE hostname = 'host-a' AND interface_name = 'eth0'`).Scan(&open, &closed, &since); err != nil {
+		t.Fatal(err)
+	}
+	if open != 1 || closed != 1 || !since.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, since.Location())) {
+		t.Errorf("eth0 has %d open row(s) since %v and %d closed, want the one open since 2026-01-01 and the closed one", open, since, closed)
+	}
+	if err := storeInternalIP(ctx, name, InternalIPInfo{Hostname: "host-a", Interface: "eth1", IP: "10.0.0.5"}); err != nil {
+		t.Errorf("store after the migration: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package publicip
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"cli-things/internal/testdb"
+	"cli-things/utility/dbconf"
+)
+
+// The tests in this file run against a real server from internal/testdb
+// and skip when there is none.
+
+func TestMain(m *testing.M) { os.Exit(testdb.Run(m)) }
+
+// migratedDB returns a new database with the repository's migrations
+// applied, with dbconf pointed at it.
+func migratedDB(t *testing.T) string {
+	t.Helper()
+	name, dsn := testdb.New(t)
+	testdb.Use(t, dsn, dbconf.Reload)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := dbconf.ApplyMigrationsFromDir(ctx, name, "../../migrations"); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestStorePublicIPIntegration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	name := migratedDB(t)
+
+	for _, ip := range []string{"192.0.2.1", "192.0.2.1", "192.0.2.2", "192.0.2.1"} {
+		if err := storePublicIP(ctx, name, ip); err != nil {
+			t.Fatalf("store %s: %v", ip, err)
+		}
+		if got, err := getCurrentStoredIP(ctx, name); err != nil || got != ip {
+			t.Fatalf("after storing %s, current = %q, %v", ip, got, err)
+		}
+	}
+
+	db, err := dbconf.ConnectDBAsContext(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var rows, open int
+	if err := db.QueryRowContext(ctx, `SELECT count(*), count(*) FILTER (WHERE last_use_at IS NULL) FROM public.public_ip_history`).Scan(&rows, &open); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 2 || open != 1 {
+		t.Errorf("public_ip_history has %d row(s), %d open; want one per address and only the current one open", rows, open)
+	}
+}
+
+func TestDNSHistoryIntegration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	name := migratedDB(t)
+
+	for i := 0; i < 2; i++ {
+		if err := seedDefaultTargets(ctx, name, "example.com", "home.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	targets, err := listEnabledTargets(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"*.dev.example.com", "*.stage.example.com", "home.example.com"}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("targets = %q, want %q", targets, want)
+	}
+
+	if _, err := currentDNSIP(ctx, name, "home.example.com"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("current DNS IP before any sync: err = %v, want sql.ErrNoRows", err)
+	}
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.2", "192.0.2.1"} {
+		if err := setCurrentDNSIP(ctx, name, "home.example.com", ip); err != nil {
+			t.Fatalf("set %s: %v", ip, err)
+		}
+		if got, err := currentDNSIP(ctx, name, "home.example.com"); err != nil || got != ip {
+			t.Fatalf("after setting %s, current = %q, %v", ip, got, err)
+		}
+	}
+	if err := setCurrentDNSIP(ctx, name, "*.dev.example.com", "198.51.100.7"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := currentDNSIP(ctx, name, "home.example.com"); err != nil || got != "192.0.2.1" {
+		t.Errorf("another name's update changed home.example.com to %q, %v", got, err)
+	}
+}
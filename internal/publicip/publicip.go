@@ -0,0 +1,572 @@
+// Package publicip is the publicip tool: it looks up the host's public
+// address, keeps its history in Postgres and syncs Cloudflare A records to
+// it. utility/publicip builds it as a standalone binary; clithings runs it
+// as a subcommand.
+package publicip
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"cli-things/utility/buildinfo"
+	"cli-things/utility/cfapi"
+	"cli-things/utility/cli"
+	"cli-things/utility/clog"
+	"cli-things/utility/dbconf"
+	"cli-things/utility/exitcode"
+)
+
+// logger carries the diagnostics on stderr; -v shows its debug messages,
+// dbconf's included.
+var logger = clog.New(os.Stderr, "publicip")
+
+// providers are simple plaintext endpoints that return the caller's public IP
+var providers = []string{
+	"https://api.ipify.org",
+	"https://ifconfig.me/ip",
+	"https://checkip.amazonaws.com",
+	"https://icanhazip.com",
+	"https://ip.seeip.org",
+}
+
+func cfGetARecords(ctx context.Context, cf *cfapi.Client, zoneID, fqdn string) ([]cfapi.DNSRecord, error) {
+	return cf.ListDNSRecords(ctx, zoneID, cfapi.RecordFilter{Type: "A", Name: fqdn})
+}
+
+func getCurrentStoredIP(ctx context.Context, dbname string) (string, error) {
+	db, err := dbconf.ConnectDBAsContext(ctx, dbname)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	row := db.QueryRowContext(ctx, `SELECT ip::text FROM public.public_ip_history WHERE last_use_at IS NULL ORDER BY first_use_at DESC LIMIT 1`)
+	var ip string
+	if err := row.Scan(&ip); err != nil {
+		return "", err
+	}
+	if i := strings.Index(ip, "/"); i > 0 {
+		ip = ip[:i]
+	}
+	return ip, nil
+}
+
+func cfFindZoneID(ctx context.Context, cf *cfapi.Client, zoneName string) (string, error) {
+	zones, err := cf.ListZones(ctx, cfapi.ZoneFilter{Name: zoneName})
+	if err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("zone not found")
+	}
+	return zones[0].ID, nil
+}
+
+func cfGetARecord(ctx context.Context, cf *cfapi.Client, zoneID, fqdn string) (*cfapi.DNSRecord, error) {
+	records, err := cfGetARecords(ctx, cf, zoneID, fqdn)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	r := records[0]
+	return &r, nil
+}
+
+// aRecord is the A record publicip keeps for fqdn: unproxied, TTL 300.
+func aRecord(fqdn, ip string) cfapi.DNSRecord {
+	proxied := false
+	return cfapi.DNSRecord{Type: "A", Name: fqdn, Content: ip, TTL: 300, Proxied: &proxied}
+}
+
+// cfUpsertARecord creates the A record when record is nil, otherwise updates it.
+func cfUpsertARecord(ctx context.Context, cf *cfapi.Client, zoneID, fqdn, ip string, record *cfapi.DNSRecord) error {
+	params := aRecord(fqdn, ip).Params()
+	if record == nil {
+		_, err := cf.CreateDNSRecord(ctx, zoneID, params)
+		return err
+	}
+	_, err := cf.UpdateDNSRecord(ctx, zoneID, record.ID, params)
+	return err
+}
+
+func fetchIP(ctx context.Context, client *http.Client, url string) (net.IP, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "cli-things-publicip/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("non-2xx status: %s", resp.Status)
+	}
+	s := bufio.NewScanner(resp.Body)
+	s.Buffer(make([]byte, 0, 64), 256)
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("empty response")
+	}
+	line := strings.TrimSpace(s.Text())
+	// some providers may return extra text; split by space or other tokens
+	if i := strings.IndexFunc(line, func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' || r == '\r' }); i >= 0 {
+		line = line[:i]
+	}
+	ip := net.ParseIP(line)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP in response: %q", line)
+	}
+	return ip, nil
+}
+
+func isFamily(ip net.IP, v4, v6 bool) bool {
+	if v4 && ip.To4() != nil {
+		return true
+	}
+	if v6 && ip.To4() == nil { // IPv6 retained as 16-byte, To4() returns nil
+		return true
+	}
+	// if neither flag set, accept any
+	if !v4 && !v6 {
+		return true
+	}
+	return false
+}
+
+func firstIP(ctx context.Context, v4, v6 bool) (net.IP, string, error) {
+	client := &http.Client{
+		Timeout: 4 * time.Second, // per-request safety; overall is controlled by ctx
+	}
+	type result struct {
+		ip  net.IP
+		src string
+		err error
+	}
+	ch := make(chan result, len(providers))
+
+	for _, url := range providers {
+		url := url // capture
+		go func() {
+			ip, err := fetchIP(ctx, client, url)
+			if err != nil {
+				ch <- result{err: err, src: url}
+				return
+			}
+			if !isFamily(ip, v4, v6) {
+				ch <- result{err: errors.New("ip family mismatch"), src: url}
+				return
+			}
+			ch <- result{ip: ip, src: url}
+		}()
+	}
+
+	var firstErr error
+	for i := 0; i < len(providers); i++ {
+		select {
+		case <-ctx.Done():
+			if firstErr == nil {
+				firstErr = ctx.Err()
+			}
+			return nil, "", firstErr
+		case r := <-ch:
+			if r.err == nil && r.ip != nil {
+				return r.ip, r.src, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+		}
+	}
+	if firstErr == nil {
+		firstErr = errors.New("no providers returned a valid IP")
+	}
+	return nil, "", firstErr
+}
+
+// DB schema helpers
+
+func seedDefaultTargets(ctx context.Context, dbname string, zoneName, host string) error {
+	db, err := dbconf.ConnectDBAsContext(ctx, dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	targets := []string{host, "*.stage." + zoneName, "*.dev." + zoneName}
+	for _, fq := range targets {
+		if _, err := db.ExecContext(ctx, `INSERT INTO public.dns_targets (fqdn, enabled) VALUES ($1, true)
+          ON CONFLICT (fqdn) DO NOTHING`, fq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func currentDNSIP(ctx context.Context, dbname, fqdn string) (string, error) {
+	db, err := dbconf.ConnectDBAsContext(ctx, dbname)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	row := db.QueryRowContext(ctx, `SELECT ip::text FROM public.dns_history WHERE fqdn=$1 AND last_use_at IS NULL ORDER BY first_use_at DESC LIMIT 1`, fqdn)
+	var ip string
+	if err := row.Scan(&ip); err != nil {
+		return "", err
+	}
+	if i := strings.Index(ip, "/"); i > 0 {
+		ip = ip[:i]
+	}
+	return ip, nil
+}
+
+func setCurrentDNSIP(ctx context.Context, dbname, fqdn, ip string) error {
+	db, err := dbconf.ConnectDBAsContext(ctx, dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE public.dns_history SET last_use_at = now() WHERE fqdn=$1 AND last_use_at IS NULL AND ip <> $2::inet`, fqdn, ip); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	ins := `INSERT INTO public.dns_history (fqdn, ip, first_use_at, last_use_at)
+            VALUES ($1, $2::inet, now(), NULL)
+            ON CONFLICT (fqdn, ip) DO UPDATE SET last_use_at = EXCLUDED.last_use_at, first_use_at = LEAST(public.dns_history.first_use_at, EXCLUDED.first_use_at)`
+	if _, err := tx.ExecContext(ctx, ins, fqdn, ip); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// storePublicIP makes ip the current public IP in public_ip_history: the
+// previous current IP, if different, gets its last_use_at, and ip is
+// inserted or reopened with its earliest first_use_at kept.
+func storePublicIP(ctx context.Context, dbname, ip string) error {
+	db, err := dbconf.ConnectDBAsContext(ctx, dbname)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	// Close previous current IP (if any) when it differs
+	if _, err := tx.ExecContext(ctx, "UPDATE public.public_ip_history SET last_use_at = now() WHERE last_use_at IS NULL AND ip <> $1::inet", ip); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("update previous: %w", err)
+	}
+	// Upsert current IP with NULL last_use_at; preserve earliest first_use_at
+	ins := `INSERT INTO public.public_ip_history (ip, first_use_at, last_use_at)
+VALUES ($1::inet, now(), NULL)
+ON CONFLICT (ip) DO UPDATE SET
+  last_use_at = EXCLUDED.last_use_at,
+  first_use_at = LEAST(public.public_ip_history.first_use_at, EXCLUDED.first_use_at)`
+	if _, err := tx.ExecContext(ctx, ins, ip); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("upsert: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func listEnabledTargets(ctx context.Context, dbname string) ([]string, error) {
+	db, err := dbconf.ConnectDBAsContext(ctx, dbname)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, `SELECT fqdn FROM public.dns_targets WHERE enabled = true ORDER BY fqdn`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var f string
+		if err := rows.Scan(&f); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// Run runs publicip with args, the command line without the program name.
+// Failures are reported on stderr before they are returned.
+func Run(args []string) error {
+	return cli.Report(run(args), logger.Error)
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("publicip", flag.ContinueOnError)
+	var (
+		ipv4           bool
+		ipv6           bool
+		timeout        time.Duration
+		showSrc        bool
+		store          bool
+		dbname         string
+		syncCF         bool
+		cfHost         string
+		cfTimeout      time.Duration
+		collectCF      bool
+		initDNSTargets bool
+		forceSync      bool
+		dbTimeout      time.Duration
+		profile        string
+	)
+	fs.BoolVar(&ipv4, "ipv4", false, "prefer IPv4 only")
+	fs.BoolVar(&ipv6, "ipv6", false, "prefer IPv6 only")
+	fs.DurationVar(&timeout, "timeout", 3*time.Second, "overall timeout")
+	fs.BoolVar(&showSrc, "v", false, "print provider source and dbconf diagnostics to stderr")
+	fs.BoolVar(&store, "store", false, "store result in database (uses dbconf)")
+	fs.StringVar(&dbname, "db", "", "override database name (default from config)")
+	fs.StringVar(&profile, "profile", "", "config.ini section to use over [default], e.g. staging (default $DBTOOL_PROFILE)")
+	fs.BoolVar(&syncCF, "sync-cf", false, "sync Cloudflare DNS A records to the current stored IP using DB targets and history")
+	// Backward-compat alias (deprecated): --check-cf
+	var deprecatedCheckCF bool
+	fs.BoolVar(&deprecatedCheckCF, "check-cf", false, "DEPRECATED: use --sync-cf")
+	fs.StringVar(&cfHost, "cf-host", "brain.portnumber53.com", "Cloudflare hostname to check/update")
+	fs.DurationVar(&cfTimeout, "cf-timeout", 20*time.Second, "timeout for Cloudflare API operations")
+	fs.DurationVar(&dbTimeout, "db-timeout", 20*time.Second, "timeout for database operations")
+	fs.BoolVar(&collectCF, "collect-cf", false, "collect current Cloudflare DNS A records for targets and store in DB history")
+	fs.BoolVar(&initDNSTargets, "init-dns-targets", false, "seed default DNS targets into DB")
+	fs.BoolVar(&forceSync, "force", false, "force Cloudflare update even if DB history matches desired IP")
+	showVersion := buildinfo.AddFlag(fs)
+	logger.AddFlags(fs)
+	exitcode.SetUsage(fs)
+	if err := cli.Parse(fs, args); err != nil {
+		return err
+	}
+	if showVersion.Requested() {
+		return buildinfo.Print(os.Stdout, "publicip", showVersion.JSON())
+	}
+	if profile != "" {
+		dbconf.SetLoadOptions(dbconf.LoadOptions{Profile: profile})
+	}
+	logger.SetVerbose(showSrc)
+	if logger.Enabled(clog.LevelDebug) {
+		dbconf.SetLogger(logger.Debugf)
+	}
+
+	// Resolve CLOUDFLARE_API_KEY from the environment, .env or config.ini
+	if raw, err := dbconf.GetRawConfigWithSources(); err == nil {
+		if v := raw["CLOUDFLARE_API_KEY"]; strings.TrimSpace(v.Value) != "" {
+			logger.Debug(v)
+			os.Setenv("CLOUDFLARE_API_KEY", strings.TrimSpace(v.Value))
+		}
+	}
+
+	// Ensure tables if doing DB-related actions
+	if store || syncCF || deprecatedCheckCF || collectCF || initDNSTargets {
+		// Resolve DB name
+		if strings.TrimSpace(dbname) == "" {
+			d, err := dbconf.DefaultDBName()
+			if err != nil {
+				return fmt.Errorf("db: cannot determine default db: %w", err)
+			}
+			dbname = d
+		}
+		dbCtx, cancelDB := context.WithTimeout(context.Background(), dbTimeout)
+		defer cancelDB()
+		// Run shared SQL migrations (if any). This uses the configured
+		// DB_MIGRATIONS_DIR / MIGRATIONS_DIR when set, falling back to
+		// ./migrations by default. If migrations fail, abort early so we
+		// don't continue with missing tables.
+		if err := dbconf.ApplyConfiguredMigrations(dbCtx, dbname); err != nil {
+			return fmt.Errorf("db: migrations failed: %w", err)
+		}
+	}
+
+	if initDNSTargets {
+		dot := strings.Index(cfHost, ".")
+		if dot <= 0 || dot >= len(cfHost)-1 {
+			return cli.Usagef("cf: invalid cf-host")
+		}
+		zoneName := cfHost[dot+1:]
+		dbCtx, cancelDB := context.WithTimeout(context.Background(), dbTimeout)
+		defer cancelDB()
+		if err := seedDefaultTargets(dbCtx, dbname, zoneName, cfHost); err != nil {
+			return fmt.Errorf("db: seed targets: %w", err)
+		}
+	}
+
+	if ipv4 && ipv6 {
+		return cli.Usagef("cannot set both -ipv4 and -ipv6")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ip, src, err := firstIP(ctx, ipv4, ipv6)
+	if err != nil {
+		return err
+	}
+	logger.Debugf("source: %s", src)
+	// Always print to stdout for CLI use
+	fmt.Println(ip.String())
+
+	if store {
+		// Resolve DB name
+		// Connect and write
+		dbCtx, cancelDB := context.WithTimeout(context.Background(), dbTimeout)
+		defer cancelDB()
+		if err := storePublicIP(dbCtx, dbname, ip.String()); err != nil {
+			return fmt.Errorf("store: %w", err)
+		}
+	}
+
+	// Collect current CF DNS and store in DB
+	if collectCF {
+		token := strings.TrimSpace(os.Getenv("CLOUDFLARE_API_KEY"))
+		if token == "" {
+			return cli.Usagef("cf: CLOUDFLARE_API_KEY not set")
+		}
+		cf := cfapi.New(token)
+		cf.UserAgent = buildinfo.UserAgent("publicip")
+		dot := strings.Index(cfHost, ".")
+		if dot <= 0 || dot >= len(cfHost)-1 {
+			return cli.Usagef("cf: invalid cf-host")
+		}
+		zoneName := cfHost[dot+1:]
+		cfCtx, cancelCF := context.WithTimeout(context.Background(), cfTimeout)
+		defer cancelCF()
+		zID, err := cfFindZoneID(cfCtx, cf, zoneName)
+		if err != nil {
+			return fmt.Errorf("cf: zone lookup: %w", err)
+		}
+		dbCtx, cancelDB := context.WithTimeout(context.Background(), dbTimeout)
+		defer cancelDB()
+		targets, err := listEnabledTargets(dbCtx, dbname)
+		if err != nil {
+			return fmt.Errorf("db: list targets: %w", err)
+		}
+		for _, fq := range targets {
+			rec, err := cfGetARecord(cfCtx, cf, zID, fq)
+			if err != nil {
+				return fmt.Errorf("cf: get record: %s %w", fq, err)
+			}
+			if rec != nil {
+				if err := setCurrentDNSIP(dbCtx, dbname, fq, strings.TrimSpace(rec.Content)); err != nil {
+					return fmt.Errorf("db: set dns ip: %s %w", fq, err)
+				}
+			}
+		}
+	}
+
+	if syncCF || deprecatedCheckCF {
+		if strings.TrimSpace(dbname) == "" {
+			d, err := dbconf.DefaultDBName()
+			if err != nil {
+				return fmt.Errorf("cf: cannot determine default db: %w", err)
+			}
+			dbname = d
+		}
+		currentIP, err := getCurrentStoredIP(ctx, dbname)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				logger.Info("cf: no stored IP yet, skipping sync")
+				return nil
+			}
+			return fmt.Errorf("cf: cannot get current stored ip: %w", err)
+		}
+		token := strings.TrimSpace(os.Getenv("CLOUDFLARE_API_KEY"))
+		if token == "" {
+			return cli.Usagef("cf: CLOUDFLARE_API_KEY not set")
+		}
+		cf := cfapi.New(token)
+		cf.UserAgent = buildinfo.UserAgent("publicip")
+		dot := strings.Index(cfHost, ".")
+		if dot <= 0 || dot >= len(cfHost)-1 {
+			return cli.Usagef("cf: invalid cf-host")
+		}
+		zoneName := cfHost[dot+1:]
+		cfCtx, cancelCF := context.WithTimeout(context.Background(), cfTimeout)
+		defer cancelCF()
+		zID, err := cfFindZoneID(cfCtx, cf, zoneName)
+		if err != nil {
+			return fmt.Errorf("cf: zone lookup: %w", err)
+		}
+		// Read desired targets from DB
+		dbCtx, cancelDB := context.WithTimeout(context.Background(), dbTimeout)
+		defer cancelDB()
+		targets, err := listEnabledTargets(dbCtx, dbname)
+		if err != nil {
+			return fmt.Errorf("db: list targets: %w", err)
+		}
+		changed := false
+		for _, fq := range targets {
+			records, err := cfGetARecords(cfCtx, cf, zID, fq)
+			if err != nil {
+				return fmt.Errorf("cf: list records: %s %w", fq, err)
+			}
+			var rec *cfapi.DNSRecord
+			// Determine need from DB unless force is set
+			needUpdate := forceSync
+			if !needUpdate {
+				// Preferred: compare DB-recorded current DNS IP for fqdn
+				if cfip, e := currentDNSIP(dbCtx, dbname, fq); e == nil {
+					needUpdate = strings.TrimSpace(cfip) != currentIP
+				} else {
+					// Fallback to live query if no DB record
+					rec, err = cfGetARecord(cfCtx, cf, zID, fq)
+					if err != nil {
+						return fmt.Errorf("cf: get record: %s %w", fq, err)
+					}
+					needUpdate = rec == nil || !rec.Equal(aRecord(fq, currentIP))
+				}
+			} else {
+				// If forcing and no existing rec loaded, fetch to get ID for PATCH
+				rec, _ = cfGetARecord(cfCtx, cf, zID, fq)
+			}
+			if needUpdate {
+				// The client retries transient failures with exponential backoff.
+				upErr := cfUpsertARecord(cfCtx, cf, zID, fq, currentIP, rec)
+				if upErr != nil {
+					return fmt.Errorf("cf: update record: %s %w", fq, upErr)
+				}
+				// Reflect the change in DB history
+				if err := setCurrentDNSIP(dbCtx, dbname, fq, currentIP); err != nil {
+					return fmt.Errorf("db: set dns ip: %s %w", fq, err)
+				}
+				changed = true
+			}
+			for _, existing := range records {
+				if cfapi.NormalizeContent("A", existing.Content) == currentIP {
+					continue
+				}
+				if err := cf.DeleteDNSRecord(cfCtx, zID, existing.ID); err != nil {
+					return fmt.Errorf("cf: delete stale record: %s %s %w", fq, existing.ID, err)
+				}
+				changed = true
+			}
+		}
+		if changed {
+			logger.Info("cf: records updated")
+		} else {
+			logger.Info("cf: records already current")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+// Package testdb gives integration tests a disposable Postgres server: the
+// one TEST_DATABASE_URL points at when it is set, otherwise a container
+// started with the docker CLI on first use and removed by Run. New creates
+// a database per test and drops it when the test ends.
+//
+// Tests skip, rather than fail, when neither TEST_DATABASE_URL nor a
+// working docker is available, and under go test -short. A package using
+// New calls Run from its TestMain:
+//
+//	func TestMain(m *testing.M) { os.Exit(testdb.Run(m)) }
+package testdb
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	// EnvURL names a server to use instead of a container, as a
+	// postgres:// URL or key=value string for a role that may create
+	// databases on Postgres 13 or later. Its database is only used to
+	// create and drop others.
+	EnvURL = "TEST_DATABASE_URL"
+	// EnvImage overrides Image.
+	EnvImage = "TEST_DATABASE_IMAGE"
+	// Image is the container image started when EnvURL is not set.
+	Image = "postgres:16-alpine"
+)
+
+// StartTimeout bounds how long the server may take to accept connections.
+var StartTimeout = time.Minute
+
+var (
+	mu       sync.Mutex
+	started  bool
+	adminDSN string
+	startErr error
+	stop     func()
+)
+
+// errUnavailable is a start failure that skips the tests instead of
+// failing them.
+type errUnavailable struct{ reason string }
+
+func (e errUnavailable) Error() string { return e.reason }
+
+// Run runs the package's tests, then removes the container if one was
+// started, and returns the exit code for os.Exit.
+func Run(m *testing.M) int {
+	code := m.Run()
+	mu.Lock()
+	defer mu.Unlock()
+	if stop != nil {
+		stop()
+		stop = nil
+	}
+	return code
+}
+
+// Server returns the DSN of the server's maintenance database, starting
+// the container on first use. It skips t when there is no server to use
+// and fails it when the configured server does not come up.
+func Server(t testing.TB) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("testdb: integration test skipped in -short mode")
+	}
+	mu.Lock()
+	if !started {
+		started = true
+		adminDSN, stop, startErr = start()
+	}
+	dsn, err := adminDSN, startErr
+	mu.Unlock()
+	var unavailable errUnavailable
+	if errors.As(err, &unavailable) {
+		t.Skipf("testdb: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("testdb: %v", err)
+	}
+	return dsn
+}
+
+// New creates an empty database for t and returns its name and DSN. The
+// database is dropped, with any connections left open to it, when t ends.
+func New(t testing.TB) (name, dsn string) {
+	t.Helper()
+	admin := Server(t)
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	name = "testdb_" + hex.EncodeToString(b)
+	db, err := sql.Open("postgres", admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, "CREATE DATABASE "+name); err != nil {
+		db.Close()
+		t.Fatalf("testdb: create database: %v", err)
+	}
+	t.Cleanup(func() {
+		defer db.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := db.ExecContext(ctx, "DROP DATABASE IF EXISTS "+name+" WITH (FORCE)"); err != nil {
+			t.Errorf("testdb: drop database %s: %v", name, err)
+		}
+	})
+	dsn, err = dsnFor(admin, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name, dsn
+}
+
+// Use points dbconf at dsn for the rest of t: DATABASE_URL is set, no read
+// replica, profile or migrations overrides apply, and neither .env files
+// nor the user's config.ini are read. reload is dbconf.Reload, which
+// testdb cannot import without a cycle in dbconf's own tests; it runs now
+// and again when t ends.
+func Use(t testing.TB, dsn string, reload func()) {
+	t.Helper()
+	ini := filepath.Join(t.TempDir(), "config.ini")
+	if err := os.WriteFile(ini, []byte("[default]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DATABASE_URL", dsn)
+	t.Setenv("DBTOOL_CONFIG_FILE", ini)
+	t.Setenv("DBCONF_NO_DOTENV", "1")
+	for _, k := range []string{"DATABASE_READ_URL", "DB_READ_HOST", "DBTOOL_PROFILE", "DB_MIGRATIONS_DIR", "DB_MIGRATIONS_TABLE"} {
+		t.Setenv(k, "")
+	}
+	reload()
+	t.Cleanup(reload)
+}
+
+// dsnFor is admin with its database replaced by name.
+func dsnFor(admin, name string) (string, error) {
+	if !strings.Contains(admin, "://") {
+		// In key=value form the last dbname wins.
+		return admin + " dbname=" + name, nil
+	}
+	u, err := url.Parse(admin)
+	if err != nil {
+		return "", fmt.Errorf("testdb: parse %s: %w", EnvURL, err)
+	}
+	u.Path = "/" + name
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// start returns the admin DSN of the server at EnvURL, or of a new
+// container together with the function that removes it.
+func start() (dsn string, stop func(), err error) {
+	if dsn := strings.TrimSpace(os.Getenv(EnvURL)); dsn != "" {
+		if err := waitReady(dsn, StartTimeout); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", EnvURL, err)
+		}
+		return dsn, nil, nil
+	}
+	docker, err := exec.LookPath("docker")
+	if err != nil {
+		return "", nil, errUnavailable{EnvURL + " is not set and docker is not installed"}
+	}
+	if out, err := exec.Command(docker, "info", "--format", "{{.ServerVersion}}").CombinedOutput(); err != nil {
+		return "", nil, errUnavailable{fmt.Sprintf("%s is not set and docker is not usable: %s", EnvURL, firstLine(out, err))}
+	}
+	image := Image
+	if v := strings.TrimSpace(os.Getenv(EnvImage)); v != "" {
+		image = v
+	}
+	const password = "testdb"
+	out, err := exec.Command(docker, "run", "--detach", "--rm",
+		"--label", "cli-things.testdb=1",
+		"--env", "POSTGRES_PASSWORD="+password,
+		"--publish", "127.0.0.1::5432",
+		image).Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("docker run %s: %s", image, firstLine(stderrOf(err), err))
+	}
+	id := strings.TrimSpace(string(out))
+	stop = func() { _ = exec.Command(docker, "rm", "--force", "--volumes", id).Run() }
+	out, err = exec.Command(docker, "port", id, "5432/tcp").Output()
+	if err != nil {
+		stop()
+		return "", nil, fmt.Errorf("docker port: %s", firstLine(stderrOf(err), err))
+	}
+	// One line per published address, such as 127.0.0.1:49153.
+	hostPort := strings.TrimSpace(strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)[0])
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		stop()
+		return "", nil, fmt.Errorf("docker port: unexpected output %q", out)
+	}
+	dsn = fmt.Sprintf("postgres://postgres:%s@%s/postgres?sslmode=disable", password, hostPort)
+	if err := waitReady(dsn, StartTimeout); err != nil {
+		stop()
+		return "", nil, fmt.Errorf("container %.12s: %w", id, err)
+	}
+	return dsn, stop, nil
+}
+
+// waitReady pings dsn until it answers or timeout passes. The postgres
+// image only listens on TCP once initialization is done.
+func waitReady(dsn string, timeout time.Duration) error {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	deadline := time.Now().Add(timeout)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not ready after %s: %w", timeout, err)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+func stderrOf(err error) []byte {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Stderr
+	}
+	return nil
+}
+
+// firstLine is the first line of a command's output, or err when there was
+// none.
+func firstLine(out []byte, err error) string {
+	if s := strings.TrimSpace(string(out)); s != "" {
+		return strings.SplitN(s, "\n", 2)[0]
+	}
+	return err.Error()
+}
@@ -0,0 +1,29 @@
+package testdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDSNFor(t *testing.T) {
+	for _, c := range []struct{ admin, want string }{
+		{"postgres://u:p@localhost:5432/postgres?sslmode=disable", "postgres://u:p@localhost:5432/testdb_x?sslmode=disable"},
+		{"postgresql://u@db", "postgresql://u@db/testdb_x"},
+		{"host=db user=u dbname=postgres", "host=db user=u dbname=postgres dbname=testdb_x"},
+	} {
+		got, err := dsnFor(c.admin, "testdb_x")
+		if err != nil || got != c.want {
+			t.Errorf("dsnFor(%q) = %q, %v; want %q", c.admin, got, err, c.want)
+		}
+	}
+}
+
+func TestStartWithoutServerIsUnavailable(t *testing.T) {
+	t.Setenv(EnvURL, "")
+	t.Setenv("PATH", t.TempDir())
+	_, stop, err := start()
+	var unavailable errUnavailable
+	if !errors.As(err, &unavailable) || stop != nil {
+		t.Errorf("start() = %v, stop set %v; want errUnavailable so tests skip", err, stop != nil)
+	}
+}
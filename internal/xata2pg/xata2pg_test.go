@@ -0,0 +1,34 @@
+package xata2pg
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+const password = "hunter2"
+
+func TestCommandsKeepPasswordOutOfArgs(t *testing.T) {
+	dsn := "postgresql://app:" + password + "@db.example:5432/app?sslmode=require"
+	for name, cmd := range map[string]*exec.Cmd{
+		"pg_dump": pgDumpSectionCommand(dsn, "app.pre.sql", "pre-data"),
+		"psql":    psqlCommand(dsn, "-f", "app.pre.sql"),
+	} {
+		if args := strings.Join(cmd.Args, " "); strings.Contains(args, password) || !strings.Contains(args, "postgresql://app@db.example:5432/app") {
+			t.Errorf("%s args = %q, want the DSN without its password", name, args)
+		}
+		if n := len(cmd.Env); n == 0 || cmd.Env[n-1] != "PGPASSWORD="+password {
+			t.Errorf("%s: PGPASSWORD not set", name)
+		}
+	}
+}
+
+func TestDSNErrorsRedacted(t *testing.T) {
+	bad := "postgres://app:" + password + "@%zz.xata.sh/db"
+	if _, err := parseSourceDSN(bad); err == nil || strings.Contains(err.Error(), password) {
+		t.Errorf("parseSourceDSN error = %v, want one without the password", err)
+	}
+	if _, err := (targetConfig{DatabaseURL: bad}).dsnFor("app"); err == nil || strings.Contains(err.Error(), password) {
+		t.Errorf("dsnFor error = %v, want one without the password", err)
+	}
+}
@@ -0,0 +1,16 @@
+-- cloudflare-backup: per-run DNSSEC and nameserver delegation snapshots
+-- Dependencies: 20251104_0002_cloudflare_backup.sql
+
+CREATE TABLE IF NOT EXISTS public.cloudflare_zone_delegation (
+    run_id bigint NOT NULL REFERENCES public.cloudflare_backup_runs(id) ON DELETE CASCADE,
+    zone_id text NOT NULL,
+    name_servers text[] NOT NULL DEFAULT '{}',
+    -- NULL when the DNSSEC lookup failed; see dnssec_error
+    dnssec_status text,
+    dnssec_error text,
+    dnssec_raw jsonb,
+    fetched_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (run_id, zone_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_cloudflare_zone_delegation_zone ON public.cloudflare_zone_delegation(zone_id, run_id DESC);
@@ -0,0 +1,4 @@
+-- cloudflare-backup: record whether a run used incremental (modified_on) fetching
+-- Dependencies: 20251104_0002_cloudflare_backup.sql
+
+ALTER TABLE public.cloudflare_backup_runs ADD COLUMN IF NOT EXISTS incremental boolean NOT NULL DEFAULT false;
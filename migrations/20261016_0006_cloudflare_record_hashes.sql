@@ -0,0 +1,8 @@
+-- cloudflare-backup: normalized content hash and raw-JSON hash per DNS record
+-- Dependencies: 20251104_0002_cloudflare_backup.sql
+
+-- content_hash covers only the fields that define the record (type, name,
+-- content, ttl, proxied, priority, data); raw_hash covers the full API JSON.
+-- Rows stored before this migration have NULL hashes and are not diffed.
+ALTER TABLE public.cloudflare_dns_records ADD COLUMN IF NOT EXISTS content_hash text;
+ALTER TABLE public.cloudflare_dns_records ADD COLUMN IF NOT EXISTS raw_hash text;
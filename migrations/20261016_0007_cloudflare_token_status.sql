@@ -0,0 +1,6 @@
+-- cloudflare-backup: token status reported by the preflight check
+-- Dependencies: 20251104_0002_cloudflare_backup.sql
+
+-- Status string from /user/tokens/verify (e.g. active, expired), or a short
+-- note when verification failed. The token itself is never stored.
+ALTER TABLE public.cloudflare_backup_runs ADD COLUMN IF NOT EXISTS token_status text;
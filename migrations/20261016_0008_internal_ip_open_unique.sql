@@ -0,0 +1,25 @@
+-- internalip: at most one open row per host, interface and address
+-- Dependencies: 20251104_0003_internal_ip_history.sql
+
+-- storeInternalIP upserts with ON CONFLICT (hostname, interface_name, ip)
+-- WHERE last_use_at IS NULL. unique_active_ip cannot back that: it also
+-- covers last_use_at, so Postgres found no matching constraint and every
+-- -store failed, and open rows (NULL last_use_at) never conflicted anyway.
+
+-- Open rows repeating an address still open on the same interface, written
+-- by hand or by another tool, would make the index below fail. They record
+-- the same ongoing use, so keep the earliest and drop the rest, as the
+-- upsert's LEAST(first_use_at) would have. Closing them instead could
+-- collide on unique_active_ip when two share a closing time.
+DELETE FROM public.internal_ip_history dup
+USING public.internal_ip_history kept
+WHERE dup.last_use_at IS NULL
+  AND kept.last_use_at IS NULL
+  AND kept.hostname = dup.hostname
+  AND kept.interface_name = dup.interface_name
+  AND kept.ip = dup.ip
+  AND (kept.first_use_at, kept.id) < (dup.first_use_at, dup.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_internal_ip_history_open
+    ON public.internal_ip_history (hostname, interface_name, ip)
+    WHERE last_use_at IS NULL;
@@ -0,0 +1,20 @@
+-- utility/metrics: step timings and counters of xata2pg, dbtool and
+-- cloudflare-backup runs, written with --metrics-db
+
+-- One row per timer or counter of a run. A timer's value is its total
+-- seconds and count how often the step ran; a counter's value is its total
+-- and count is NULL. Rows of one run share tool, host and run_started_at.
+CREATE TABLE IF NOT EXISTS public.tool_metrics (
+    id bigserial PRIMARY KEY,
+    tool text NOT NULL,
+    host text NOT NULL,
+    run_started_at timestamptz NOT NULL,
+    run_seconds double precision NOT NULL,
+    kind text NOT NULL CHECK (kind IN ('timer', 'counter')),
+    name text NOT NULL,
+    value double precision NOT NULL,
+    count bigint,
+    recorded_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tool_metrics_tool_run ON public.tool_metrics(tool, run_started_at);
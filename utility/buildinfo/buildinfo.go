@@ -0,0 +1,174 @@
+// Package buildinfo reports the version of the repository's tools: the
+// module version, VCS revision and time that the Go toolchain stamps into
+// the binary, or the values set at link time with
+//
+//	go build -ldflags "-X cli-things/utility/buildinfo.Version=v1.2.3 -X cli-things/utility/buildinfo.BuildTime=2026-10-16T12:00:00Z"
+//
+// Builds of single files (go build ./dbtool.go) carry no VCS stamp, which
+// is what the link-time values are for.
+package buildinfo
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at link time with -X; the build info stamped by the toolchain fills
+// in whatever is left empty.
+var (
+	Version   string
+	Revision  string
+	BuildTime string
+)
+
+// Info is the version of one program.
+type Info struct {
+	Program   string `json:"program"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// readBuildInfo is debug.ReadBuildInfo; tests replace it.
+var readBuildInfo = debug.ReadBuildInfo
+
+// Get returns the version of program, the running binary.
+func Get(program string) Info {
+	info := Info{
+		Program:   program,
+		Version:   Version,
+		Revision:  Revision,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := readBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Revision == "" {
+					info.Revision = s.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+	return info
+}
+
+// String is the one-line form every tool prints for --version, such as
+// "dbtool v1.2.3 (4f1c2d9e0a7b, 2026-10-16T12:00:00Z, modified) go1.21.5 linux/amd64".
+func (i Info) String() string {
+	s := i.Program + " " + i.Version
+	var details []string
+	if i.Revision != "" {
+		details = append(details, shortRevision(i.Revision))
+	}
+	if i.BuildTime != "" {
+		details = append(details, i.BuildTime)
+	}
+	if i.Modified {
+		details = append(details, "modified")
+	}
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	return s + " " + i.GoVersion + " " + i.Platform
+}
+
+func shortRevision(rev string) string {
+	if len(rev) > 12 {
+		return rev[:12]
+	}
+	return rev
+}
+
+// UserAgent is the User-Agent header for program's requests:
+// "program/version", with the revision when the version does not say it.
+func UserAgent(program string) string {
+	i := Get(program)
+	ua := i.Program + "/" + i.Version
+	if rev := shortRevision(i.Revision); rev != "" && !strings.Contains(i.Version, rev[:min(7, len(rev))]) {
+		ua += " (" + rev + ")"
+	}
+	return ua
+}
+
+// Print writes program's version to w: the one-line form, or the Info as
+// JSON.
+func Print(w io.Writer, program string, asJSON bool) error {
+	info := Get(program)
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	_, err := fmt.Fprintln(w, info)
+	return err
+}
+
+// Flag is the value of a --version flag: plain --version asks for the
+// one-line form and --version=json for JSON.
+type Flag string
+
+const (
+	flagText = "text"
+	flagJSON = "json"
+)
+
+// AddFlag registers --version on fs and returns its value.
+func AddFlag(fs *flag.FlagSet) *Flag {
+	f := new(Flag)
+	fs.Var(f, "version", "Print the version and exit (--version=json for JSON)")
+	return f
+}
+
+func (f *Flag) String() string {
+	if f == nil {
+		return ""
+	}
+	return string(*f)
+}
+
+// Set accepts what a boolean flag does, plus "text" and "json".
+func (f *Flag) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "true", "1", "t", flagText:
+		*f = flagText
+	case flagJSON:
+		*f = flagJSON
+	case "false", "0", "f", "":
+		*f = ""
+	default:
+		return fmt.Errorf("want --version or --version=json, not %q", s)
+	}
+	return nil
+}
+
+// IsBoolFlag lets --version stand alone.
+func (f *Flag) IsBoolFlag() bool { return true }
+
+// Requested reports whether --version was given.
+func (f Flag) Requested() bool { return f != "" }
+
+// JSON reports whether --version=json was given.
+func (f Flag) JSON() bool { return f == flagJSON }
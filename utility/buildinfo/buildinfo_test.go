@@ -0,0 +1,119 @@
+package buildinfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+// stamp makes Get see bi as the binary's build info, and clears the
+// link-time values, for the test.
+func stamp(t *testing.T, bi *debug.BuildInfo) {
+	t.Helper()
+	origRead, v, r, b := readBuildInfo, Version, Revision, BuildTime
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return bi, bi != nil }
+	Version, Revision, BuildTime = "", "", ""
+	t.Cleanup(func() { readBuildInfo, Version, Revision, BuildTime = origRead, v, r, b })
+}
+
+func vcsBuild(version string) *debug.BuildInfo {
+	return &debug.BuildInfo{
+		Main: debug.Module{Path: "cli-things", Version: version},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs", Value: "git"},
+			{Key: "vcs.revision", Value: "4f1c2d9e0a7b5c3d2e1f00112233445566778899"},
+			{Key: "vcs.time", Value: "2026-10-16T12:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+}
+
+func TestGetFromBuildInfo(t *testing.T) {
+	stamp(t, vcsBuild("(devel)"))
+	info := Get("dbtool")
+	if info.Version != "devel" || info.Revision != "4f1c2d9e0a7b5c3d2e1f00112233445566778899" || info.BuildTime != "2026-10-16T12:00:00Z" || !info.Modified {
+		t.Errorf("info = %+v", info)
+	}
+	want := "dbtool devel (4f1c2d9e0a7b, 2026-10-16T12:00:00Z, modified) " + runtime.Version() + " " + runtime.GOOS + "/" + runtime.GOARCH
+	if info.String() != want {
+		t.Errorf("String() = %q, want %q", info, want)
+	}
+	if ua := UserAgent("publicip"); ua != "publicip/devel (4f1c2d9e0a7b)" {
+		t.Errorf("UserAgent = %q", ua)
+	}
+}
+
+func TestLinkTimeValuesWin(t *testing.T) {
+	stamp(t, vcsBuild("v0.9.0"))
+	Version, BuildTime = "v1.2.3-4-g4f1c2d9", "2026-10-17T08:00:00Z"
+	info := Get("xata2pg")
+	if info.Version != "v1.2.3-4-g4f1c2d9" || info.BuildTime != "2026-10-17T08:00:00Z" || info.Revision == "" {
+		t.Errorf("info = %+v", info)
+	}
+	// The revision is already in a git describe version.
+	if ua := UserAgent("xata2pg"); ua != "xata2pg/v1.2.3-4-g4f1c2d9" {
+		t.Errorf("UserAgent = %q", ua)
+	}
+}
+
+func TestGetWithoutBuildInfo(t *testing.T) {
+	stamp(t, nil)
+	info := Get("env-anonymizer")
+	if info.Version != "devel" || info.Revision != "" || info.Modified {
+		t.Errorf("info = %+v", info)
+	}
+	if !strings.HasPrefix(info.String(), "env-anonymizer devel go") {
+		t.Errorf("String() = %q", info)
+	}
+	if ua := UserAgent("env-anonymizer"); ua != "env-anonymizer/devel" {
+		t.Errorf("UserAgent = %q", ua)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	stamp(t, vcsBuild("v1.0.0"))
+	var text, js bytes.Buffer
+	if err := Print(&text, "internalip", false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(text.String(), "internalip v1.0.0 (4f1c2d9e0a7b, ") || strings.Count(text.String(), "\n") != 1 {
+		t.Errorf("text = %q", text.String())
+	}
+	if err := Print(&js, "internalip", true); err != nil {
+		t.Fatal(err)
+	}
+	var got Info
+	if err := json.Unmarshal(js.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != Get("internalip") {
+		t.Errorf("JSON = %s", js.String())
+	}
+}
+
+func TestFlag(t *testing.T) {
+	for _, c := range []struct {
+		args            []string
+		requested, json bool
+		err             bool
+	}{
+		{nil, false, false, false},
+		{[]string{"--version"}, true, false, false},
+		{[]string{"-version=json"}, true, true, false},
+		{[]string{"--version=false"}, false, false, false},
+		{[]string{"--version=yaml"}, false, false, true},
+	} {
+		fs := flag.NewFlagSet("tool", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		v := AddFlag(fs)
+		err := fs.Parse(c.args)
+		if (err != nil) != c.err || v.Requested() != c.requested || v.JSON() != c.json {
+			t.Errorf("%v: requested %v, json %v, err %v", c.args, v.Requested(), v.JSON(), err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Package cfapi is a small typed client for the parts of the Cloudflare v4 API
+// used by publicip and cloudflare-backup: accounts, zones, DNSSEC status and
+// DNS records. Every list call follows pagination, failed envelopes are turned
+// into *APIError values, and transient failures are retried with backoff.
+package cfapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cli-things/utility/buildinfo"
+	"cli-things/utility/retry"
+)
+
+// DefaultBaseURL is the Cloudflare v4 API root.
+const DefaultBaseURL = "https://api.cloudflare.com/client/v4"
+
+// Client talks to the Cloudflare API with a bearer token. BaseURL and
+// HTTPClient can be replaced (for example with an httptest server in tests).
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+	// Attempts is the total number of tries for a request (>= 1). Network
+	// errors, 429 and 5xx responses are retried; other failures are not.
+	Attempts int
+	// Backoff is the wait before the first retry; it doubles on each retry.
+	Backoff time.Duration
+	// UserAgent is sent with every request; the tools set their name and
+	// version (see buildinfo.UserAgent).
+	UserAgent string
+}
+
+// New returns a client for the public Cloudflare API with the defaults the
+// tools have been using: 30s request timeout, 3 attempts, 500ms backoff.
+func New(token string) *Client {
+	return &Client{
+		BaseURL:    DefaultBaseURL,
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Attempts:   3,
+		Backoff:    500 * time.Millisecond,
+		UserAgent:  buildinfo.UserAgent("cli-things"),
+	}
+}
+
+// Message is a single entry from the errors/messages array of an API envelope.
+type Message struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// APIError is returned when Cloudflare answers with a non-2xx status or an
+// envelope whose success field is false.
+type APIError struct {
+	StatusCode int
+	Errors     []Message
+}
+
+func (e *APIError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("cloudflare api: status %d", e.StatusCode)
+	}
+	parts := make([]string, 0, len(e.Errors))
+	for _, m := range e.Errors {
+		parts = append(parts, fmt.Sprintf("%s (code %d)", m.Message, m.Code))
+	}
+	return fmt.Sprintf("cloudflare api: status %d: %s", e.StatusCode, strings.Join(parts, "; "))
+}
+
+// HasCode reports whether the API returned the given Cloudflare error code.
+func (e *APIError) HasCode(code int) bool {
+	for _, m := range e.Errors {
+		if m.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ResultInfo is the pagination block of list responses.
+type ResultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+	TotalPages int `json:"total_pages"`
+}
+
+type envelope struct {
+	Success    bool            `json:"success"`
+	Errors     []Message       `json:"errors"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo *ResultInfo     `json:"result_info"`
+}
+
+// Do performs a request against path (relative to BaseURL), decodes the
+// envelope, and unmarshals its result into out when out is non-nil.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body, out any) (*ResultInfo, error) {
+	var payload []byte
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = b
+	}
+	var info *ResultInfo
+	err := retry.Do(ctx, retry.Policy{MaxAttempts: c.Attempts, Backoff: c.Backoff, IsRetryable: retryable}, func(ctx context.Context) error {
+		var err error
+		info, err = c.do(ctx, method, path, query, payload, out)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, payload []byte, out any) (*ResultInfo, error) {
+	u := strings.TrimRight(c.BaseURL, "/") + "/" + strings.TrimLeft(path, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, &APIError{StatusCode: resp.StatusCode}
+		}
+		return nil, fmt.Errorf("cloudflare api: decode response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || !env.Success {
+		return nil, &APIError{StatusCode: resp.StatusCode, Errors: env.Errors}
+	}
+	if out != nil && len(env.Result) > 0 {
+		if err := json.Unmarshal(env.Result, out); err != nil {
+			return nil, fmt.Errorf("cloudflare api: decode result: %w", err)
+		}
+	}
+	return env.ResultInfo, nil
+}
+
+// retryable reports whether a failed request is worth another attempt.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	// Transport-level errors (timeouts, resets, DNS) are transient.
+	return true
+}
+
+// listAll walks every page of a list endpoint, calling fn with each page's
+// decoded results.
+func listAll[T any](ctx context.Context, c *Client, path string, query url.Values, perPage int, fn func([]T) error) error {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("per_page", strconv.Itoa(perPage))
+	for page := 1; ; page++ {
+		q.Set("page", strconv.Itoa(page))
+		var items []T
+		info, err := c.Do(ctx, http.MethodGet, path, q, nil, &items)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		if err := fn(items); err != nil {
+			return err
+		}
+		if info != nil && info.TotalPages > 0 && page >= info.TotalPages {
+			return nil
+		}
+	}
+}
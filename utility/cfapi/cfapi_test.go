@@ -0,0 +1,229 @@
+package cfapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c := New("test-token")
+	c.BaseURL = srv.URL
+	c.HTTPClient = srv.Client()
+	c.Backoff = time.Millisecond
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestListDNSRecordsPaginates(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if r.URL.Path != "/zones/z1/dns_records" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("type"); got != "A" {
+			t.Errorf("type filter = %q", got)
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		result := []map[string]any{
+			{"id": fmt.Sprintf("r%d", page), "type": "A", "name": "a.example.com", "content": "192.0.2.1", "ttl": 300, "extra": page},
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success":     true,
+			"result":      result,
+			"result_info": map[string]any{"page": page, "per_page": 100, "total_pages": 3, "total_count": 3},
+		})
+	})
+
+	recs, err := c.ListDNSRecords(context.Background(), "z1", RecordFilter{Type: "A"})
+	if err != nil {
+		t.Fatalf("ListDNSRecords: %v", err)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("got %d records, want 3", len(recs))
+	}
+	if recs[2].ID != "r3" || recs[2].Content != "192.0.2.1" {
+		t.Errorf("unexpected record: %+v", recs[2])
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(recs[0].Raw, &raw); err != nil || raw["extra"] != float64(1) {
+		t.Errorf("raw JSON not preserved: %s", recs[0].Raw)
+	}
+}
+
+func TestListStopsOnEmptyPage(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		result := []map[string]any{}
+		if n == 1 {
+			result = append(result, map[string]any{"id": "z1", "name": "example.com"})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "result": result})
+	})
+	zones, err := c.ListZones(context.Background(), ZoneFilter{})
+	if err != nil {
+		t.Fatalf("ListZones: %v", err)
+	}
+	if len(zones) != 1 || calls != 2 {
+		t.Fatalf("zones=%d calls=%d, want 1 zone after 2 calls", len(zones), calls)
+	}
+}
+
+func TestAPIErrorIsParsedAndNotRetried(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeJSON(w, http.StatusForbidden, map[string]any{
+			"success": false,
+			"errors":  []map[string]any{{"code": 10000, "message": "Authentication error"}},
+		})
+	})
+	_, err := c.ListAccounts(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusForbidden || !apiErr.HasCode(10000) {
+		t.Errorf("unexpected error: %+v", apiErr)
+	}
+	if calls != 1 {
+		t.Errorf("4xx was retried: %d calls", calls)
+	}
+}
+
+func TestUnsuccessfulEnvelopeWith200IsAnError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"success": false, "errors": []map[string]any{{"code": 1003, "message": "Invalid or missing zone id."}}})
+	})
+	if _, err := c.GetDNSSEC(context.Background(), "nope"); err == nil {
+		t.Fatal("expected error for success=false envelope")
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var got []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("User-Agent"))
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "result": map[string]any{"status": "active"}})
+	})
+	c.GetDNSSEC(context.Background(), "z1")
+	c.UserAgent = "publicip/v1.2.3"
+	c.GetDNSSEC(context.Background(), "z1")
+	if len(got) != 2 || !strings.HasPrefix(got[0], "cli-things/") || got[1] != "publicip/v1.2.3" {
+		t.Errorf("User-Agent headers = %q", got)
+	}
+}
+
+func TestRetriesServerErrors(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			writeJSON(w, http.StatusBadGateway, map[string]any{"success": false})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "result": map[string]any{"status": "active"}})
+	})
+	d, err := c.GetDNSSEC(context.Background(), "z1")
+	if err != nil {
+		t.Fatalf("GetDNSSEC: %v", err)
+	}
+	if d.Status != "active" || calls != 3 {
+		t.Errorf("status=%q calls=%d", d.Status, calls)
+	}
+}
+
+func TestRetriesGiveUpAfterAttempts(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	_, err := c.ListZones(context.Background(), ZoneFilter{Name: "example.com"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 APIError, got %v", err)
+	}
+	if int(calls) != c.Attempts {
+		t.Errorf("calls = %d, want %d", calls, c.Attempts)
+	}
+}
+
+func TestRecordMutations(t *testing.T) {
+	type seen struct {
+		method, path string
+		body         map[string]any
+	}
+	var got []seen
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		b, _ := io.ReadAll(r.Body)
+		if len(b) > 0 {
+			_ = json.Unmarshal(b, &body)
+		}
+		got = append(got, seen{r.Method, r.URL.Path, body})
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "result": map[string]any{"id": "rec1"}})
+	})
+	ctx := context.Background()
+	p := RecordParams{Type: "A", Name: "a.example.com", Content: "192.0.2.7", TTL: 300}
+	if rec, err := c.CreateDNSRecord(ctx, "z1", p); err != nil || rec.ID != "rec1" {
+		t.Fatalf("CreateDNSRecord: %v %+v", err, rec)
+	}
+	if _, err := c.UpdateDNSRecord(ctx, "z1", "rec1", p); err != nil {
+		t.Fatalf("UpdateDNSRecord: %v", err)
+	}
+	if err := c.DeleteDNSRecord(ctx, "z1", "rec1"); err != nil {
+		t.Fatalf("DeleteDNSRecord: %v", err)
+	}
+	want := []struct{ method, path string }{
+		{http.MethodPost, "/zones/z1/dns_records"},
+		{http.MethodPatch, "/zones/z1/dns_records/rec1"},
+		{http.MethodDelete, "/zones/z1/dns_records/rec1"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d requests, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].method != w.method || got[i].path != w.path {
+			t.Errorf("request %d = %s %s, want %s %s", i, got[i].method, got[i].path, w.method, w.path)
+		}
+	}
+	if got[0].body["content"] != "192.0.2.7" || got[0].body["proxied"] != false {
+		t.Errorf("unexpected create body: %v", got[0].body)
+	}
+}
+
+func TestContextCancellationStopsRetries(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	c.Backoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.ListAccounts(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("retry backoff ignored context cancellation")
+	}
+}
@@ -0,0 +1,94 @@
+package cfapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DNSRecord is a DNS record as returned by the API, shared by publicip and
+// cloudflare-backup. Priority is set for MX, SRV and URI records, Data for
+// the types with structured content such as SRV and CAA. Raw holds the
+// original JSON.
+type DNSRecord struct {
+	ID         string          `json:"id"`
+	ZoneID     string          `json:"zone_id"`
+	Type       string          `json:"type"`
+	Name       string          `json:"name"`
+	Content    string          `json:"content"`
+	TTL        int             `json:"ttl"`
+	Proxied    *bool           `json:"proxied"`
+	Priority   *int            `json:"priority"`
+	Data       json.RawMessage `json:"data"`
+	ModifiedOn time.Time       `json:"modified_on"`
+	Raw        json.RawMessage `json:"-"`
+}
+
+func (r *DNSRecord) UnmarshalJSON(b []byte) error {
+	type plain DNSRecord
+	var p plain
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	*r = DNSRecord(p)
+	r.Raw = append(json.RawMessage(nil), b...)
+	return nil
+}
+
+// RecordFilter narrows ListDNSRecords. Empty fields are not sent.
+type RecordFilter struct {
+	Type string
+	Name string
+}
+
+// RecordParams is the body for creating or updating a DNS record. Priority
+// is for MX, SRV and URI records; Data holds the fields of types such as SRV
+// and CAA, which Cloudflare then renders into the content.
+type RecordParams struct {
+	Type     string          `json:"type"`
+	Name     string          `json:"name"`
+	Content  string          `json:"content,omitempty"`
+	TTL      int             `json:"ttl"`
+	Proxied  bool            `json:"proxied"`
+	Priority *int            `json:"priority,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// ListDNSRecords returns every record in the zone matching f.
+func (c *Client) ListDNSRecords(ctx context.Context, zoneID string, f RecordFilter) ([]DNSRecord, error) {
+	q := url.Values{}
+	if f.Type != "" {
+		q.Set("type", f.Type)
+	}
+	if f.Name != "" {
+		q.Set("name", f.Name)
+	}
+	var out []DNSRecord
+	err := listAll(ctx, c, "/zones/"+url.PathEscape(zoneID)+"/dns_records", q, 100, func(page []DNSRecord) error {
+		out = append(out, page...)
+		return nil
+	})
+	return out, err
+}
+
+// CreateDNSRecord creates a record and returns it as stored by Cloudflare.
+func (c *Client) CreateDNSRecord(ctx context.Context, zoneID string, p RecordParams) (DNSRecord, error) {
+	var rec DNSRecord
+	_, err := c.Do(ctx, http.MethodPost, "/zones/"+url.PathEscape(zoneID)+"/dns_records", nil, p, &rec)
+	return rec, err
+}
+
+// UpdateDNSRecord patches an existing record.
+func (c *Client) UpdateDNSRecord(ctx context.Context, zoneID, recordID string, p RecordParams) (DNSRecord, error) {
+	var rec DNSRecord
+	_, err := c.Do(ctx, http.MethodPatch, "/zones/"+url.PathEscape(zoneID)+"/dns_records/"+url.PathEscape(recordID), nil, p, &rec)
+	return rec, err
+}
+
+// DeleteDNSRecord deletes a record.
+func (c *Client) DeleteDNSRecord(ctx context.Context, zoneID, recordID string) error {
+	_, err := c.Do(ctx, http.MethodDelete, "/zones/"+url.PathEscape(zoneID)+"/dns_records/"+url.PathEscape(recordID), nil, nil, nil)
+	return err
+}
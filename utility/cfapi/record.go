@@ -0,0 +1,107 @@
+package cfapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+)
+
+// Params returns the body that creates or updates a record like r.
+func (r DNSRecord) Params() RecordParams {
+	return RecordParams{
+		Type:     r.Type,
+		Name:     r.Name,
+		Content:  r.Content,
+		TTL:      r.TTL,
+		Proxied:  proxied(r.Proxied),
+		Priority: r.Priority,
+		Data:     r.Data,
+	}
+}
+
+// Equal reports whether r and o publish the same thing: type, name,
+// content, TTL, proxying, priority (for the types that have one) and the
+// data object of SRV, CAA and similar types. Names and contents are
+// compared as NormalizeContent leaves them, data with key order ignored,
+// and an unset proxied counts as false. IDs, timestamps and the rest of the
+// raw JSON are not compared.
+func (r DNSRecord) Equal(o DNSRecord) bool {
+	typ := strings.ToUpper(strings.TrimSpace(r.Type))
+	if typ != strings.ToUpper(strings.TrimSpace(o.Type)) ||
+		normalizeName(r.Name) != normalizeName(o.Name) ||
+		NormalizeContent(typ, r.Content) != NormalizeContent(typ, o.Content) ||
+		r.TTL != o.TTL ||
+		proxied(r.Proxied) != proxied(o.Proxied) {
+		return false
+	}
+	if hasPriority(typ) && priority(r.Priority) != priority(o.Priority) {
+		return false
+	}
+	return reflect.DeepEqual(decodeData(r.Data), decodeData(o.Data))
+}
+
+// NormalizeContent returns the form of a typ record's content that Equal
+// compares: addresses as net.IP prints them, host names in lower case
+// without the trailing dot, a TXT value without the one pair of quotes
+// Cloudflare may or may not add, and runs of spaces collapsed.
+func NormalizeContent(typ, content string) string {
+	c := strings.Join(strings.Fields(content), " ")
+	switch strings.ToUpper(typ) {
+	case "A", "AAAA":
+		if ip := net.ParseIP(c); ip != nil {
+			return ip.String()
+		}
+	case "CNAME", "DNAME", "NS", "PTR", "MX":
+		return normalizeName(c)
+	case "SRV":
+		// weight port target, with the priority kept separately.
+		if f := strings.Fields(c); len(f) > 0 {
+			f[len(f)-1] = normalizeName(f[len(f)-1])
+			return strings.Join(f, " ")
+		}
+	case "TXT":
+		if len(c) >= 2 && c[0] == '"' && c[len(c)-1] == '"' && !strings.Contains(c[1:len(c)-1], `"`) {
+			return c[1 : len(c)-1]
+		}
+	}
+	return c
+}
+
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+func proxied(p *bool) bool { return p != nil && *p }
+
+func priority(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+// hasPriority reports whether records of typ carry a meaningful priority;
+// Cloudflare echoes one for other types too.
+func hasPriority(typ string) bool {
+	switch typ {
+	case "MX", "SRV", "URI":
+		return true
+	}
+	return false
+}
+
+// decodeData decodes a data object into generic values, so two objects
+// compare equal whatever their key order. Empty data is nil; invalid data
+// is kept as a string.
+func decodeData(raw json.RawMessage) any {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	return v
+}
@@ -0,0 +1,90 @@
+package cfapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDNSRecordEqual(t *testing.T) {
+	yes, no := true, false
+	one, ten, twenty := 1, 10, 20
+	rec := func(typ, name, content string) DNSRecord {
+		return DNSRecord{Type: typ, Name: name, Content: content, TTL: 300}
+	}
+	with := func(r DNSRecord, f func(*DNSRecord)) DNSRecord {
+		f(&r)
+		return r
+	}
+	a := rec("A", "home.example.com", "192.0.2.1")
+	mx := with(rec("MX", "example.com", "mail.example.com"), func(r *DNSRecord) { r.Priority = &ten })
+	srv := with(rec("SRV", "_sip._tcp.example.com", "5 5060 sip.example.com"), func(r *DNSRecord) {
+		r.Priority = &ten
+		r.Data = json.RawMessage(`{"priority":10,"weight":5,"port":5060,"target":"sip.example.com"}`)
+	})
+	caa := with(rec("CAA", "example.com", `0 issue "letsencrypt.org"`), func(r *DNSRecord) {
+		r.Data = json.RawMessage(`{"flags":0,"tag":"issue","value":"letsencrypt.org"}`)
+	})
+	for _, c := range []struct {
+		name string
+		a, b DNSRecord
+		want bool
+	}{
+		{"A same", a, rec("A", "home.example.com", "192.0.2.1"), true},
+		{"A metadata ignored", a, with(a, func(r *DNSRecord) {
+			r.ID, r.ZoneID, r.Raw = "r1", "z1", json.RawMessage(`{"comment":"x"}`)
+		}), true},
+		{"A name case and trailing dot", a, rec("a", "Home.Example.com.", "192.0.2.1"), true},
+		{"A other address", a, rec("A", "home.example.com", "192.0.2.2"), false},
+		{"A other TTL", a, with(a, func(r *DNSRecord) { r.TTL = 1 }), false},
+		{"A unset proxied is false", a, with(a, func(r *DNSRecord) { r.Proxied = &no }), true},
+		{"A proxied", a, with(a, func(r *DNSRecord) { r.Proxied = &yes }), false},
+		{"A priority ignored", a, with(a, func(r *DNSRecord) { r.Priority = &one }), true},
+		{"AAAA notation", rec("AAAA", "v6.example.com", "2001:db8::1"), rec("AAAA", "v6.example.com", "2001:0db8:0:0:0:0:0:1"), true},
+		{"AAAA other address", rec("AAAA", "v6.example.com", "2001:db8::1"), rec("AAAA", "v6.example.com", "2001:db8::2"), false},
+		{"A and AAAA", a, rec("AAAA", "home.example.com", "::ffff:192.0.2.1"), false},
+		{"CNAME target case", rec("CNAME", "www.example.com", "Example.com."), rec("CNAME", "www.example.com", "example.com"), true},
+		{"CNAME other target", rec("CNAME", "www.example.com", "example.com"), rec("CNAME", "www.example.com", "example.net"), false},
+		{"NS trailing dot", rec("NS", "sub.example.com", "ns1.example.net."), rec("NS", "sub.example.com", "ns1.example.net"), true},
+		{"MX same", mx, with(mx, func(r *DNSRecord) { r.Content = "MAIL.example.com." }), true},
+		{"MX priority", mx, with(mx, func(r *DNSRecord) { r.Priority = &twenty }), false},
+		{"MX unset priority is 0", with(mx, func(r *DNSRecord) { r.Priority = nil }), with(mx, func(r *DNSRecord) { r.Priority = new(int) }), true},
+		{"TXT quoting", rec("TXT", "example.com", `"v=spf1 -all"`), rec("TXT", "example.com", "v=spf1 -all"), true},
+		{"TXT text case", rec("TXT", "example.com", "v=spf1 -all"), rec("TXT", "example.com", "V=SPF1 -all"), false},
+		{"TXT several strings", rec("TXT", "example.com", `"a" "b"`), rec("TXT", "example.com", `a" "b`), false},
+		{"SRV data key order", srv, with(srv, func(r *DNSRecord) {
+			r.Data = json.RawMessage(`{"target":"sip.example.com","port":5060,"weight":5,"priority":10}`)
+		}), true},
+		{"SRV target trailing dot", srv, with(srv, func(r *DNSRecord) { r.Content = "5  5060 sip.example.com." }), true},
+		{"SRV other port", srv, with(srv, func(r *DNSRecord) {
+			r.Content = "5 5061 sip.example.com"
+			r.Data = json.RawMessage(`{"priority":10,"weight":5,"port":5061,"target":"sip.example.com"}`)
+		}), false},
+		{"SRV priority", srv, with(srv, func(r *DNSRecord) { r.Priority = &twenty }), false},
+		{"CAA same", caa, with(caa, func(r *DNSRecord) { r.Data = json.RawMessage(` {"value":"letsencrypt.org","tag":"issue","flags":0}`) }), true},
+		{"CAA other value", caa, with(caa, func(r *DNSRecord) {
+			r.Content = `0 issue "pki.goog"`
+			r.Data = json.RawMessage(`{"flags":0,"tag":"issue","value":"pki.goog"}`)
+		}), false},
+		{"CAA data missing", caa, with(caa, func(r *DNSRecord) { r.Data = nil }), false},
+	} {
+		if got := c.a.Equal(c.b); got != c.want {
+			t.Errorf("%s: Equal = %v, want %v", c.name, got, c.want)
+		}
+		if got := c.b.Equal(c.a); got != c.want {
+			t.Errorf("%s: reversed Equal = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestDNSRecordParams(t *testing.T) {
+	ten := 10
+	r := DNSRecord{ID: "r1", Type: "MX", Name: "example.com", Content: "mail.example.com", TTL: 1, Priority: &ten}
+	b, err := json.Marshal(r.Params())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"MX","name":"example.com","content":"mail.example.com","ttl":1,"proxied":false,"priority":10}`
+	if string(b) != want {
+		t.Errorf("Params = %s, want %s", b, want)
+	}
+}
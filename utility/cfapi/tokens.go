@@ -0,0 +1,23 @@
+package cfapi
+
+import (
+	"context"
+	"net/http"
+)
+
+// TokenStatus is the result of /user/tokens/verify. Status is "active",
+// "disabled" or "expired".
+type TokenStatus struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	ExpiresOn string `json:"expires_on"`
+	NotBefore string `json:"not_before"`
+}
+
+// VerifyToken checks that the client's token is valid. It does not reveal
+// which permissions the token has.
+func (c *Client) VerifyToken(ctx context.Context) (TokenStatus, error) {
+	var ts TokenStatus
+	_, err := c.Do(ctx, http.MethodGet, "/user/tokens/verify", nil, nil, &ts)
+	return ts, err
+}
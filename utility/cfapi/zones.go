@@ -0,0 +1,106 @@
+package cfapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// Account is a Cloudflare account. Raw holds the JSON exactly as returned by
+// the API so callers can archive fields this struct does not model.
+type Account struct {
+	ID   string          `json:"id"`
+	Name string          `json:"name"`
+	Raw  json.RawMessage `json:"-"`
+}
+
+func (a *Account) UnmarshalJSON(b []byte) error {
+	type plain Account
+	var p plain
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	*a = Account(p)
+	a.Raw = append(json.RawMessage(nil), b...)
+	return nil
+}
+
+// Zone is a Cloudflare zone. NameServers are the nameservers Cloudflare
+// assigned to the zone.
+type Zone struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Status      string   `json:"status"`
+	NameServers []string `json:"name_servers"`
+	Account     struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"account"`
+	Raw json.RawMessage `json:"-"`
+}
+
+func (z *Zone) UnmarshalJSON(b []byte) error {
+	type plain Zone
+	var p plain
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	*z = Zone(p)
+	z.Raw = append(json.RawMessage(nil), b...)
+	return nil
+}
+
+// ZoneFilter narrows ListZones. Empty fields are not sent.
+type ZoneFilter struct {
+	Name string
+}
+
+// DNSSEC is the DNSSEC state of a zone. Status is "disabled" for zones where
+// DNSSEC was never configured.
+type DNSSEC struct {
+	Status string          `json:"status"`
+	Raw    json.RawMessage `json:"-"`
+}
+
+func (d *DNSSEC) UnmarshalJSON(b []byte) error {
+	type plain DNSSEC
+	var p plain
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	*d = DNSSEC(p)
+	d.Raw = append(json.RawMessage(nil), b...)
+	return nil
+}
+
+// ListAccounts returns every account the token can see.
+func (c *Client) ListAccounts(ctx context.Context) ([]Account, error) {
+	var out []Account
+	err := listAll(ctx, c, "/accounts", nil, 50, func(page []Account) error {
+		out = append(out, page...)
+		return nil
+	})
+	return out, err
+}
+
+// ListZones returns every zone matching f.
+func (c *Client) ListZones(ctx context.Context, f ZoneFilter) ([]Zone, error) {
+	q := url.Values{}
+	if f.Name != "" {
+		q.Set("name", f.Name)
+	}
+	var out []Zone
+	err := listAll(ctx, c, "/zones", q, 50, func(page []Zone) error {
+		out = append(out, page...)
+		return nil
+	})
+	return out, err
+}
+
+// GetDNSSEC returns the DNSSEC state of a zone.
+func (c *Client) GetDNSSEC(ctx context.Context, zoneID string) (DNSSEC, error) {
+	var d DNSSEC
+	_, err := c.Do(ctx, http.MethodGet, "/zones/"+url.PathEscape(zoneID)+"/dnssec", nil, nil, &d)
+	return d, err
+}
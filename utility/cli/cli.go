@@ -0,0 +1,104 @@
+// Package cli is what the tools' entry points share. Each tool has a Run
+// function that takes its command line (without the program name) and
+// returns an error; Main turns that error into the process's exit status,
+// so a standalone binary and the same tool run as a clithings subcommand
+// end alike.
+//
+// A Run function reports its own failures on stderr, in its own style, and
+// returns them: Report prints an error unless it says it was already
+// printed, and Code picks the exit status by the convention of
+// utility/exitcode unless an *Error in the chain says otherwise.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"cli-things/utility/exitcode"
+)
+
+// Error carries the exit status a failure should end the program with.
+type Error struct {
+	Code int
+	// Err is what went wrong; nil when the tool has already said so in
+	// its own words.
+	Err error
+	// Reported is set when Err has been printed already.
+	Reported bool
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Exit returns an error that ends the program with code. A nil err means
+// the tool has printed what went wrong itself; Exit(0, nil) is nil.
+func Exit(code int, err error) error {
+	if code == 0 && err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err, Reported: err == nil}
+}
+
+// Usagef is a command line that makes no sense: exitcode.ConfigError.
+func Usagef(format string, args ...any) error {
+	return Exit(exitcode.ConfigError, fmt.Errorf(format, args...))
+}
+
+// Reported marks err as printed already, keeping its chain and status.
+func Reported(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: Code(err), Err: err, Reported: true}
+}
+
+// Parse parses args with fs, which should use flag.ContinueOnError. The
+// flag package has printed the usage by the time it fails, so the error
+// only ends Run: status 0 after -h, exitcode.ConfigError after a bad flag.
+func Parse(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, flag.ErrHelp):
+		return &Error{Code: 0, Err: err, Reported: true}
+	default:
+		return &Error{Code: exitcode.ConfigError, Err: err, Reported: true}
+	}
+}
+
+// Report prints err with log unless it is nil or already printed, and
+// returns it, so Run can end with
+//
+//	return cli.Report(run(args), logger.Error)
+func Report(err error, log func(args ...any)) error {
+	var e *Error
+	if err != nil && !(errors.As(err, &e) && e.Reported) {
+		log(err)
+	}
+	return err
+}
+
+// Code is the exit status for err: the Code of the first *Error in its
+// chain, otherwise exitcode.Of(err).
+func Code(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return exitcode.Of(err)
+}
+
+// Main runs a tool with the program's arguments and exits with the status
+// its error asks for.
+func Main(run func(args []string) error) {
+	os.Exit(Code(run(os.Args[1:])))
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestCode(t *testing.T) {
+	boom := errors.New("boom")
+	for _, c := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, 0},
+		{"plain", boom, 1},
+		{"exit", Exit(3, boom), 3},
+		{"exit zero without error", Exit(0, nil), 0},
+		{"usage", Usagef("bad %s", "flag"), 2},
+		{"wrapped", fmt.Errorf("context: %w", Exit(4, boom)), 4},
+		{"reported", Reported(boom), 1},
+	} {
+		if got := Code(c.err); got != c.want {
+			t.Errorf("%s: Code = %d, want %d", c.name, got, c.want)
+		}
+	}
+	if Exit(0, nil) != nil || Reported(nil) != nil {
+		t.Error("Exit(0, nil) and Reported(nil) must be nil")
+	}
+	if !errors.Is(Exit(2, boom), boom) {
+		t.Error("Exit does not wrap its error")
+	}
+}
+
+func TestReport(t *testing.T) {
+	boom := errors.New("boom")
+	for _, c := range []struct {
+		name  string
+		err   error
+		print bool
+	}{
+		{"nil", nil, false},
+		{"plain", boom, true},
+		{"exit", Exit(2, boom), true},
+		{"exit without error", Exit(2, nil), false},
+		{"reported", fmt.Errorf("again: %w", Reported(boom)), false},
+	} {
+		var printed []any
+		got := Report(c.err, func(args ...any) { printed = args })
+		if got != c.err {
+			t.Errorf("%s: Report returned %v, want its argument", c.name, got)
+		}
+		if (printed != nil) != c.print {
+			t.Errorf("%s: printed %v, want printed = %v", c.name, printed, c.print)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct {
+		args []string
+		code int
+		ok   bool
+	}{
+		{[]string{"-n", "1", "rest"}, 0, true},
+		{[]string{"-h"}, 0, false},
+		{[]string{"-bogus"}, 2, false},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.Int("n", 0, "a number")
+		err := Parse(fs, c.args)
+		if (err == nil) != c.ok || Code(err) != c.code {
+			t.Errorf("Parse(%q) = %v (code %d), want ok=%v code %d", c.args, err, Code(err), c.ok, c.code)
+		}
+		var printed bool
+		Report(err, func(...any) { printed = true })
+		if printed {
+			t.Errorf("Parse(%q): Report printed the flag package's error again", c.args)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package clog is the small leveled logger the tools use for their stderr
+// diagnostics, so they all look alike: "<tool>: message", with "warning: "
+// or "error: " in front of the message at those levels, or with JSON on,
+// one object per line:
+//
+//	{"time":"2026-10-16T12:00:00Z","level":"info","tool":"publicip","msg":"cf: records updated"}
+//
+// The level defaults to info and the format to text. CLITHINGS_LOG_LEVEL
+// (debug, info, warn or error) and CLITHINGS_LOG_FORMAT=json change the
+// defaults; a tool's -v and the -log-level and -log-json flags registered
+// by AddFlags override them. Debugf has the signature of dbconf.SetLogger,
+// so a tool hands it to dbconf and -v shows dbconf's diagnostics too.
+//
+// Messages pass through secrets.Redact on the way out, so a DSN or API key
+// that ends up in an error is not written to the log.
+package clog
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cli-things/utility/secrets"
+)
+
+// The environment variables New reads its defaults from.
+const (
+	EnvLevel  = "CLITHINGS_LOG_LEVEL"
+	EnvFormat = "CLITHINGS_LOG_FORMAT"
+)
+
+// Level is the severity of a message; a Logger drops messages below its own.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel parses debug, info, warn (or warning) and error, in any case.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q (want debug, info, warn or error)", s)
+}
+
+// Logger writes one line per message to its writer. It is safe for
+// concurrent use.
+type Logger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	tool  string
+	level Level
+	json  bool
+	now   func() time.Time
+}
+
+// New returns a Logger writing to w with the tool name as prefix, at the
+// level and in the format the environment asks for; unparsable values are
+// ignored.
+func New(w io.Writer, tool string) *Logger {
+	l := &Logger{w: w, tool: tool, level: LevelInfo, now: time.Now}
+	if level, err := ParseLevel(os.Getenv(EnvLevel)); err == nil {
+		l.level = level
+	}
+	l.json = strings.EqualFold(strings.TrimSpace(os.Getenv(EnvFormat)), "json")
+	return l
+}
+
+// SetLevel makes l drop messages below level.
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// SetVerbose lowers the level to debug when verbose is set, for a tool's
+// -v flag; it never raises it.
+func (l *Logger) SetVerbose(verbose bool) {
+	if verbose {
+		l.SetLevel(LevelDebug)
+	}
+}
+
+// SetJSON switches between text lines and JSON objects.
+func (l *Logger) SetJSON(on bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.json = on
+}
+
+// Enabled reports whether messages at level are written, so callers can
+// skip work that only feeds them.
+func (l *Logger) Enabled(level Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level >= l.level
+}
+
+// AddFlags registers -log-level and -log-json on fs. They set l directly,
+// so flags parsed after the environment was read win over it.
+func (l *Logger) AddFlags(fs *flag.FlagSet) {
+	fs.Var(levelFlag{l}, "log-level", "Log level: debug, info, warn or error (default $"+EnvLevel+" or info)")
+	fs.Var(jsonFlag{l}, "log-json", "Write log lines as JSON objects (default $"+EnvFormat+"=json)")
+}
+
+func (l *Logger) Debugf(format string, args ...any) { l.logf(LevelDebug, format, args...) }
+func (l *Logger) Infof(format string, args ...any)  { l.logf(LevelInfo, format, args...) }
+func (l *Logger) Warnf(format string, args ...any)  { l.logf(LevelWarn, format, args...) }
+func (l *Logger) Errorf(format string, args ...any) { l.logf(LevelError, format, args...) }
+
+// Debug, Info, Warn and Error join their arguments like fmt.Println.
+func (l *Logger) Debug(args ...any) { l.log(LevelDebug, args...) }
+func (l *Logger) Info(args ...any)  { l.log(LevelInfo, args...) }
+func (l *Logger) Warn(args ...any)  { l.log(LevelWarn, args...) }
+func (l *Logger) Error(args ...any) { l.log(LevelError, args...) }
+
+func (l *Logger) log(level Level, args ...any) {
+	if l.Enabled(level) {
+		l.write(level, fmt.Sprintln(args...))
+	}
+}
+
+func (l *Logger) logf(level Level, format string, args ...any) {
+	if l.Enabled(level) {
+		l.write(level, fmt.Sprintf(format, args...))
+	}
+}
+
+// line is one message in JSON mode.
+type line struct {
+	Time  string `json:"time"`
+	Level string `json:"level"`
+	Tool  string `json:"tool"`
+	Msg   string `json:"msg"`
+}
+
+// write prints msg, redacted, without its trailing newline, which dbconf's
+// messages and the Println forms carry.
+func (l *Logger) write(level Level, msg string) {
+	msg = secrets.Redact(strings.TrimRight(msg, "\n"))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.json {
+		b, _ := json.Marshal(line{
+			Time:  l.now().UTC().Format(time.RFC3339),
+			Level: level.String(),
+			Tool:  l.tool,
+			Msg:   msg,
+		})
+		l.w.Write(append(b, '\n'))
+		return
+	}
+	var label string
+	switch level {
+	case LevelWarn:
+		label = "warning: "
+	case LevelError:
+		label = "error: "
+	}
+	fmt.Fprintf(l.w, "%s: %s%s\n", l.tool, label, msg)
+}
+
+// levelFlag and jsonFlag are the flag.Values of AddFlags. The flag package
+// calls String on their zero values, hence the nil checks.
+type levelFlag struct{ l *Logger }
+
+func (f levelFlag) String() string {
+	if f.l == nil {
+		return ""
+	}
+	f.l.mu.Lock()
+	defer f.l.mu.Unlock()
+	return f.l.level.String()
+}
+
+func (f levelFlag) Set(s string) error {
+	level, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	f.l.SetLevel(level)
+	return nil
+}
+
+type jsonFlag struct{ l *Logger }
+
+func (f jsonFlag) String() string {
+	if f.l == nil {
+		return ""
+	}
+	f.l.mu.Lock()
+	defer f.l.mu.Unlock()
+	if f.l.json {
+		return "true"
+	}
+	return "false"
+}
+
+func (f jsonFlag) Set(s string) error {
+	on, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", s)
+	}
+	f.l.SetJSON(on)
+	return nil
+}
+
+func (f jsonFlag) IsBoolFlag() bool { return true }
@@ -0,0 +1,133 @@
+package clog
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func newTest(t *testing.T) (*Logger, *bytes.Buffer) {
+	t.Helper()
+	t.Setenv(EnvLevel, "")
+	t.Setenv(EnvFormat, "")
+	var buf bytes.Buffer
+	l := New(&buf, "tool")
+	l.now = func() time.Time { return time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC) }
+	return l, &buf
+}
+
+func TestText(t *testing.T) {
+	l, buf := newTest(t)
+	l.Debugf("hidden %d", 1)
+	l.Infof("copied %d table(s)", 3)
+	l.Warn("previous cycle", "still running")
+	l.Errorf("connect: %v\n", io.EOF)
+	want := "tool: copied 3 table(s)\n" +
+		"tool: warning: previous cycle still running\n" +
+		"tool: error: connect: EOF\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf, want)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	l, buf := newTest(t)
+	l.Errorf("connect %s: %v", "postgres://app:hunter2@db/app", fmt.Errorf("CLOUDFLARE_API_KEY=cf-secret rejected"))
+	want := "tool: error: connect postgres://app:xxxxx@db/app: CLOUDFLARE_API_KEY=xxxxx rejected\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf, want)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	l, buf := newTest(t)
+	l.SetLevel(LevelWarn)
+	l.Info("dropped")
+	l.Warn("kept")
+	if got := buf.String(); got != "tool: warning: kept\n" {
+		t.Errorf("got %q", got)
+	}
+	if l.Enabled(LevelDebug) {
+		t.Error("debug enabled at warn")
+	}
+	l.SetVerbose(false)
+	if l.Enabled(LevelInfo) {
+		t.Error("SetVerbose(false) changed the level")
+	}
+	l.SetVerbose(true)
+	if !l.Enabled(LevelDebug) {
+		t.Error("debug disabled after SetVerbose(true)")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	l, buf := newTest(t)
+	l.SetJSON(true)
+	l.Warnf("zone %s: %d record(s) excluded", "example.com", 2)
+	var got line
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %q", err, buf)
+	}
+	want := line{Time: "2026-10-16T12:00:00Z", Level: "warn", Tool: "tool", Msg: "zone example.com: 2 record(s) excluded"}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv(EnvLevel, "DEBUG")
+	t.Setenv(EnvFormat, "json")
+	var buf bytes.Buffer
+	l := New(&buf, "tool")
+	l.Debug("shown")
+	if !bytes.HasPrefix(buf.Bytes(), []byte(`{"time":`)) {
+		t.Errorf("got %q", buf)
+	}
+
+	t.Setenv(EnvLevel, "loud")
+	t.Setenv(EnvFormat, "")
+	l = New(io.Discard, "tool")
+	if l.Enabled(LevelDebug) || !l.Enabled(LevelInfo) {
+		t.Error("an invalid level should leave the default")
+	}
+}
+
+func TestAddFlags(t *testing.T) {
+	l, buf := newTest(t)
+	fs := flag.NewFlagSet("tool", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	l.AddFlags(fs)
+	if err := fs.Parse([]string{"-log-level=error", "-log-json"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Warn("dropped")
+	l.Error("kept")
+	if got := buf.String(); !bytes.Contains(buf.Bytes(), []byte(`"level":"error"`)) || bytes.Contains(buf.Bytes(), []byte("dropped")) {
+		t.Errorf("got %q", got)
+	}
+	if err := fs.Parse([]string{"-log-level=loud"}); err == nil {
+		t.Error("-log-level=loud accepted")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, level := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		got, err := ParseLevel(level.String())
+		if err != nil || got != level {
+			t.Errorf("ParseLevel(%q) = %v, %v", level, got, err)
+		}
+	}
+	if got, err := ParseLevel(" Warning "); err != nil || got != LevelWarn {
+		t.Errorf("ParseLevel(Warning) = %v, %v", got, err)
+	}
+	if _, err := ParseLevel(""); err == nil {
+		t.Error("ParseLevel accepted an empty string")
+	}
+	if s := fmt.Sprint(Level(7)); s != "level(7)" {
+		t.Errorf("Level(7) = %q", s)
+	}
+}
@@ -0,0 +1,78 @@
+package dbconf
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// MaintenanceDB is the database ConnectAdmin connects to. Every PostgreSQL
+// server has it, and statements such as CREATE DATABASE and DROP DATABASE
+// cannot run in the database they affect.
+const MaintenanceDB = "postgres"
+
+// ConnectAdmin connects to MaintenanceDB on the configured server, whatever
+// database the configuration names.
+func ConnectAdmin() (*sql.DB, error) {
+	return ConnectAdminContext(context.Background())
+}
+
+// ConnectAdminContext is ConnectAdmin with the connection attempt bounded by
+// ctx as well as DefaultConnectTimeout.
+func ConnectAdminContext(ctx context.Context) (*sql.DB, error) {
+	return ConnectDBAsContext(ctx, MaintenanceDB)
+}
+
+// EnsureOptions tunes EnsureDatabase.
+type EnsureOptions struct {
+	// Drop drops an existing database first, terminating its other
+	// connections, so that it is recreated empty.
+	Drop bool
+	// Admin is the maintenance database connection to use; nil connects
+	// with ConnectAdminContext for the call.
+	Admin *sql.DB
+}
+
+// EnsureDatabase creates the database name unless it exists, or recreates it
+// with opts.Drop, and reports whether it existed before the call.
+func EnsureDatabase(ctx context.Context, name string, opts EnsureOptions) (existed bool, err error) {
+	if name == "" {
+		return false, fmt.Errorf("ensure database: empty name")
+	}
+	admin := opts.Admin
+	if admin == nil {
+		if admin, err = ConnectAdminContext(ctx); err != nil {
+			return false, err
+		}
+		defer admin.Close()
+	}
+	if err := admin.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)`, name,
+	).Scan(&existed); err != nil {
+		return false, fmt.Errorf("check database %q: %w", name, err)
+	}
+
+	if existed && opts.Drop {
+		vprintf("dbconf: dropping database %s\n", name)
+		// DROP DATABASE fails while anyone is connected.
+		if _, err := admin.ExecContext(ctx,
+			`SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()`, name,
+		); err != nil {
+			return existed, fmt.Errorf("terminate connections to %q: %w", name, err)
+		}
+		if _, err := admin.ExecContext(ctx, "DROP DATABASE IF EXISTS "+pq.QuoteIdentifier(name)); err != nil {
+			return existed, fmt.Errorf("drop database %q: %w", name, err)
+		}
+	} else if existed {
+		vprintf("dbconf: database %s exists\n", name)
+		return existed, nil
+	}
+
+	vprintf("dbconf: creating database %s\n", name)
+	if _, err := admin.ExecContext(ctx, "CREATE DATABASE "+pq.QuoteIdentifier(name)); err != nil {
+		return existed, fmt.Errorf("create database %q: %w", name, err)
+	}
+	return existed, nil
+}
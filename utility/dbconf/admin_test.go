@@ -0,0 +1,104 @@
+package dbconf
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestEnsureDatabase(t *testing.T) {
+	const name = `my "odd" db`
+	const quoted = `"my ""odd"" db"`
+	exists := regexp.QuoteMeta(`SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)`)
+	ctx := context.Background()
+	for _, c := range []struct {
+		desc          string
+		existed, drop bool
+		stmts         []string
+	}{
+		{"missing", false, false, []string{"CREATE DATABASE " + quoted}},
+		{"exists", true, false, nil},
+		{"missing with drop", false, true, []string{"CREATE DATABASE " + quoted}},
+		{"exists with drop", true, true, []string{"pg_terminate_backend", "DROP DATABASE IF EXISTS " + quoted, "CREATE DATABASE " + quoted}},
+	} {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery(exists).WithArgs(name).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(c.existed))
+		for _, stmt := range c.stmts {
+			e := mock.ExpectExec(regexp.QuoteMeta(stmt))
+			if stmt == "pg_terminate_backend" {
+				e.WithArgs(name)
+			}
+			e.WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		existed, err := EnsureDatabase(ctx, name, EnsureOptions{Drop: c.drop, Admin: db})
+		if err != nil || existed != c.existed {
+			t.Errorf("%s: EnsureDatabase = %v, %v; want %v", c.desc, existed, err, c.existed)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", c.desc, err)
+		}
+		db.Close()
+	}
+
+	if _, err := EnsureDatabase(ctx, "", EnsureOptions{}); err == nil {
+		t.Error("EnsureDatabase accepted an empty name")
+	}
+}
+
+// TestEnsureDatabaseServer runs against the server in DBCONF_TEST_DATABASE_URL,
+// a role allowed to create databases, e.g.
+// postgres://postgres@localhost/postgres?sslmode=disable.
+func TestEnsureDatabaseServer(t *testing.T) {
+	dsn := os.Getenv("DBCONF_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DBCONF_TEST_DATABASE_URL not set")
+	}
+	useDatabaseURL(t, dsn)
+	ctx := context.Background()
+	const name = `dbconf test "ensure"`
+	admin, err := ConnectAdmin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	var current string
+	if err := admin.QueryRow("SELECT current_database()").Scan(&current); err != nil || current != MaintenanceDB {
+		t.Fatalf("ConnectAdmin reached %q (%v), want %q", current, err, MaintenanceDB)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP DATABASE IF EXISTS "dbconf test ""ensure"""`) })
+
+	if existed, err := EnsureDatabase(ctx, name, EnsureOptions{Drop: true}); err != nil || existed {
+		t.Fatalf("first EnsureDatabase = %v, %v", existed, err)
+	}
+	if existed, err := EnsureDatabase(ctx, name, EnsureOptions{Admin: admin}); err != nil || !existed {
+		t.Fatalf("second EnsureDatabase = %v, %v", existed, err)
+	}
+
+	// A connection to the database must not stop Drop.
+	db, err := ConnectDBAs(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE leftover (id int)"); err != nil {
+		t.Fatal(err)
+	}
+	if existed, err := EnsureDatabase(ctx, name, EnsureOptions{Drop: true, Admin: admin}); err != nil || !existed {
+		t.Fatalf("EnsureDatabase with Drop = %v, %v", existed, err)
+	}
+	fresh, err := ConnectDBAs(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Close()
+	var n int
+	if err := fresh.QueryRow(`SELECT count(*) FROM pg_tables WHERE tablename = 'leftover'`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("recreated database still has table leftover (%d, %v)", n, err)
+	}
+}
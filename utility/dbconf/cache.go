@@ -0,0 +1,167 @@
+package dbconf
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// loadState is what dbconf reads from outside the process, once until the
+// next Reload: the .env files, config.ini with its <KEY>_FILE secrets, and
+// the DBConfig resolved from them and the environment.
+type loadState struct {
+	envOnce sync.Once
+	// dotEnv holds the .env values of the keys dbconf reads itself; they
+	// are not copied into the process environment.
+	dotEnv map[string]dotEnvValue
+
+	iniOnce     sync.Once
+	config      map[string]string
+	configPath  string
+	fromProfile map[string]bool
+	secretFiles map[string]string
+	iniErr      error
+
+	cfgOnce sync.Once
+	cfg     *DBConfig
+	cfgErr  error
+}
+
+// dotEnvValue is a value from a .env file and the file it came from.
+type dotEnvValue struct {
+	value, file string
+}
+
+var (
+	stateMu sync.Mutex
+	state   = &loadState{}
+)
+
+func currentState() *loadState {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return state
+}
+
+// Reload drops the cached configuration, so the next call re-reads the .env
+// files, config.ini and the environment. Configuration is otherwise read
+// once per process; tests and tools that change the environment or
+// config.ini while running call Reload afterwards. SetDSNOverride reloads
+// by itself.
+func Reload() {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	state = &loadState{}
+}
+
+// getenv looks key up in the process environment, then in the .env files
+// found from the working directory up. A variable set in the environment,
+// even to "", wins over .env, as it did when .env files were applied to the
+// environment.
+func getenv(key string) string {
+	v, _ := envSource(key)
+	return v
+}
+
+// envSource is getenv that also returns the .env file the value came from,
+// or "" when it was set in the environment proper.
+func envSource(key string) (value, file string) {
+	if v, ok := os.LookupEnv(key); ok {
+		return v, envOrigin(key)
+	}
+	s := currentState()
+	s.loadDotEnv()
+	d := s.dotEnv[key]
+	return d.value, d.file
+}
+
+func (s *loadState) loadDotEnv() {
+	s.envOnce.Do(func() {
+		s.dotEnv = map[string]dotEnvValue{}
+		if why := dotEnvDisabled(); why != "" {
+			vprintf("dbconf: not loading .env files (%s)\n", why)
+			return
+		}
+		_ = loadEnvFromNearestDotEnv(s.dotEnv, dotEnvMaxDepth())
+	})
+}
+
+// dotEnvDisabled says why .env loading is switched off, or "" when it is
+// not. Only the real environment can switch it off: a .env file cannot.
+func dotEnvDisabled() string {
+	if currentLoadOptions().DisableDotEnv {
+		return "LoadOptions.DisableDotEnv is set"
+	}
+	if v := strings.TrimSpace(os.Getenv("DBCONF_NO_DOTENV")); v != "" && v != "0" && !strings.EqualFold(v, "false") {
+		return "DBCONF_NO_DOTENV=" + v
+	}
+	return ""
+}
+
+// dotEnvMaxDepth is DBCONF_DOTENV_MAX_DEPTH, the number of parent
+// directories the .env search may climb (0 looks in the working directory
+// only), or -1 for no limit besides the repository root.
+func dotEnvMaxDepth() int {
+	v := strings.TrimSpace(os.Getenv("DBCONF_DOTENV_MAX_DEPTH"))
+	if v == "" {
+		return -1
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		vprintf("dbconf: ignoring DBCONF_DOTENV_MAX_DEPTH=%q: want a whole number >= 0\n", v)
+		return -1
+	}
+	return n
+}
+
+// ownEnvKey reports whether key is a setting dbconf reads itself (including
+// its <KEY>_FILE form), whose .env value is kept out of the process
+// environment. Other .env keys, such as CLOUDFLARE_API_KEY, are still
+// exported for the utilities that read them with os.Getenv.
+func ownEnvKey(key string) bool {
+	if key == "DBTOOL_CONFIG_FILE" || key == "DBTOOL_PROFILE" {
+		return true
+	}
+	key = strings.TrimSuffix(key, "_FILE")
+	for _, spec := range settingSpecs {
+		for _, k := range spec.env {
+			if k == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ini returns a copy of config.ini's [default] keys, overlaid by the
+// selected profile's section, with <KEY>_FILE secrets resolved, the path
+// read ("" when none was) and where each secret came from.
+func (s *loadState) ini() (config map[string]string, path string, secretFiles map[string]string, err error) {
+	s.loadDotEnv()
+	s.iniOnce.Do(func() {
+		s.config, s.configPath, s.fromProfile, s.iniErr = loadConfigFile(profileName())
+		if s.iniErr == nil {
+			s.secretFiles, s.iniErr = applySecretFiles(s.config)
+		}
+	})
+	if s.iniErr != nil {
+		return nil, "", nil, s.iniErr
+	}
+	config = make(map[string]string, len(s.config))
+	for k, v := range s.config {
+		config[k] = v
+	}
+	return config, s.configPath, s.secretFiles, nil
+}
+
+// load returns a copy of the cached DBConfig, resolving it on first use.
+func load() (*DBConfig, error) {
+	s := currentState()
+	s.cfgOnce.Do(func() { s.cfg, s.cfgErr = s.resolve() })
+	if s.cfgErr != nil {
+		return nil, s.cfgErr
+	}
+	cfg := *s.cfg
+	return &cfg, nil
+}
@@ -0,0 +1,176 @@
+package dbconf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoadCachedUntilReload(t *testing.T) {
+	clearDBEnv(t)
+	ini := filepath.Join(t.TempDir(), "config.ini")
+	writeFile(t, ini, "[default]\nDB_HOST=first\n")
+	t.Setenv("DBTOOL_CONFIG_FILE", ini)
+
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Host = "changed by the caller"
+	writeFile(t, ini, "[default]\nDB_HOST=second\n")
+	if cfg, _ = load(); cfg.Host != "first" {
+		t.Errorf("host = %q before Reload, want the cached first", cfg.Host)
+	}
+	Reload()
+	if cfg, _ = load(); cfg.Host != "second" {
+		t.Errorf("host = %q after Reload, want second", cfg.Host)
+	}
+}
+
+func TestDotEnvKeptOutOfEnvironment(t *testing.T) {
+	clearDBEnv(t)
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, ".env"), "DB_HOST=envhost\nexport DBCONF_TEST_EXPORTED=yes\n")
+	writeFile(t, filepath.Join(dir, "config.ini"), "[default]\n")
+	t.Setenv("DBTOOL_CONFIG_FILE", filepath.Join(dir, "config.ini"))
+	for _, k := range []string{"DB_HOST", "DBCONF_TEST_EXPORTED"} {
+		t.Setenv(k, "")
+		os.Unsetenv(k)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "envhost" {
+		t.Errorf("host = %q, want envhost from .env", cfg.Host)
+	}
+	if v, ok := os.LookupEnv("DB_HOST"); ok {
+		t.Errorf("DB_HOST=%q leaked into the environment", v)
+	}
+	if v := os.Getenv("DBCONF_TEST_EXPORTED"); v != "yes" {
+		t.Errorf("DBCONF_TEST_EXPORTED = %q, want other .env keys still exported", v)
+	}
+	settings, err := ResolveSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range settings {
+		if s.Name == "host" && (s.Source != ".env" || s.Value != "envhost") {
+			t.Errorf("host setting = %+v, want envhost from .env", s)
+		}
+	}
+}
+
+func TestConnectDBAsConcurrent(t *testing.T) {
+	useDatabaseURL(t, "postgres://u:p@127.0.0.1:1/app?sslmode=disable")
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%8 == 0 {
+				Reload()
+			}
+			db, err := ConnectDBAs("app")
+			if err == nil {
+				db.Close()
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		// Nothing listens on port 1: every call should get as far as the
+		// ping, with the same configuration.
+		if err == nil || !strings.Contains(err.Error(), "failed to ping database") {
+			t.Errorf("err = %v, want a ping failure", err)
+		}
+	}
+}
+
+// dotEnvTree makes repo/.env (DB_HOST=roothost) and repo/a/b/.env
+// (DB_PORT=6000) and changes into repo/a/b/c until the test ends.
+func dotEnvTree(t *testing.T) {
+	t.Helper()
+	clearDBEnv(t)
+	repo := t.TempDir()
+	deep := filepath.Join(repo, "a", "b", "c")
+	for _, d := range []string{filepath.Join(repo, ".git"), deep} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(repo, ".env"), "DB_HOST=roothost\n")
+	writeFile(t, filepath.Join(repo, "a", "b", ".env"), "DB_PORT=6000\n")
+	writeFile(t, filepath.Join(repo, "config.ini"), "[default]\n")
+	t.Setenv("DBTOOL_CONFIG_FILE", filepath.Join(repo, "config.ini"))
+	t.Setenv("DBCONF_NO_DOTENV", "")
+	t.Setenv("DBCONF_DOTENV_MAX_DEPTH", "")
+	for _, k := range []string{"DB_HOST", "DB_PORT"} {
+		os.Unsetenv(k)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(deep); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	t.Cleanup(func() { SetLoadOptions(LoadOptions{}) })
+}
+
+func TestDotEnvScope(t *testing.T) {
+	for _, c := range []struct {
+		desc       string
+		noDotEnv   string
+		maxDepth   string
+		opts       LoadOptions
+		host, port string
+	}{
+		{"default walks to the repository root", "", "", LoadOptions{}, "roothost", "6000"},
+		{"max depth 1 stops below the root", "", "1", LoadOptions{}, "", "6000"},
+		{"max depth 0 looks in the working directory only", "", "0", LoadOptions{}, "", ""},
+		{"invalid max depth is ignored", "", "-2", LoadOptions{}, "roothost", "6000"},
+		{"DBCONF_NO_DOTENV", "1", "", LoadOptions{}, "", ""},
+		{"DBCONF_NO_DOTENV=0 keeps loading", "0", "", LoadOptions{}, "roothost", "6000"},
+		{"LoadOptions.DisableDotEnv", "", "", LoadOptions{DisableDotEnv: true}, "", ""},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			dotEnvTree(t)
+			t.Setenv("DBCONF_NO_DOTENV", c.noDotEnv)
+			t.Setenv("DBCONF_DOTENV_MAX_DEPTH", c.maxDepth)
+			SetLoadOptions(c.opts)
+			var logged strings.Builder
+			SetLogger(func(format string, args ...any) { fmt.Fprintf(&logged, format, args...) })
+			t.Cleanup(func() { SetLogger(nil) })
+
+			if host := getenv("DB_HOST"); host != c.host {
+				t.Errorf("DB_HOST = %q, want %q", host, c.host)
+			}
+			if port := getenv("DB_PORT"); port != c.port {
+				t.Errorf("DB_PORT = %q, want %q", port, c.port)
+			}
+			if skipped := strings.Contains(logged.String(), "not loading .env files"); skipped != (c.noDotEnv == "1" || c.opts.DisableDotEnv) {
+				t.Errorf("log does not say why .env loading was skipped:\n%s", logged.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package dbconf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blackhole accepts TCP connections and never answers, like a server behind
+// a firewall that drops replies, and returns a DSN pointing at it.
+func blackhole(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, c)
+			mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	})
+	return "postgres://u:p@" + ln.Addr().String() + "/app?sslmode=disable"
+}
+
+func useDatabaseURL(t *testing.T, dsn string) {
+	t.Helper()
+	clearDBEnv(t)
+	ini := filepath.Join(t.TempDir(), "config.ini")
+	if err := os.WriteFile(ini, []byte("[default]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DBTOOL_CONFIG_FILE", ini)
+	t.Setenv("DATABASE_URL", dsn)
+}
+
+func TestConnectContextBlackhole(t *testing.T) {
+	dsn := blackhole(t)
+	useDatabaseURL(t, dsn)
+	connects := map[string]func(context.Context) error{
+		"ConnectDBAsContext": func(ctx context.Context) error { _, err := ConnectDBAsContext(ctx, "app"); return err },
+		"ConnectDSNContext":  func(ctx context.Context) error { _, err := ConnectDSNContext(ctx, dsn); return err },
+	}
+	for name, connect := range connects {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		start := time.Now()
+		err := connect(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: err = %v, want a deadline error", name, err)
+		}
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("%s: took %s to give up", name, d)
+		}
+	}
+}
+
+func TestConnectDefaultTimeout(t *testing.T) {
+	useDatabaseURL(t, blackhole(t))
+	old := DefaultConnectTimeout
+	DefaultConnectTimeout = 200 * time.Millisecond
+	defer func() { DefaultConnectTimeout = old }()
+
+	start := time.Now()
+	_, err := ConnectDBAs("app")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want a deadline error", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("took %s to give up", d)
+	}
+}
@@ -1,32 +1,23 @@
 package dbconf
 
 import (
-	"bufio"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
-	_ "github.com/lib/pq"
-)
-
-func isVerbose() bool { return strings.TrimSpace(os.Getenv("DBTOOL_VERBOSE")) == "1" }
-
-func vprintln(a ...any) {
-	if isVerbose() {
-		fmt.Fprintln(os.Stderr, a...)
-	}
-}
+	"cli-things/utility/dotenv"
+	"cli-things/utility/exitcode"
 
-func vprintf(format string, a ...any) {
-	if isVerbose() {
-		fmt.Fprintf(os.Stderr, format, a...)
-	}
-}
+	"github.com/lib/pq"
+)
 
 // DBConfig holds database configuration
 type DBConfig struct {
@@ -36,8 +27,29 @@ type DBConfig struct {
 	User          string
 	Password      string
 	SSLMode       string
+	SSLRootCert   string // file paths for libpq's sslrootcert, sslcert and sslkey
+	SSLCert       string
+	SSLKey        string
 	MigrationsDir string
 	URL           string // full DSN, takes precedence when set
+	Pool          PoolConfig
+	// MigrationsLockTimeout bounds the wait for another process applying
+	// migrations (DB_MIGRATIONS_LOCK_TIMEOUT).
+	MigrationsLockTimeout time.Duration
+	// ReadURL (DATABASE_READ_URL) or ReadHost (DB_READ_HOST) point
+	// ConnectReadDB at a read replica; see readConfig.
+	ReadURL  string
+	ReadHost string
+	// MigrationsTable is the ledger of applied migrations, schema.table
+	// (DB_MIGRATIONS_TABLE, default public._migrations).
+	MigrationsTable string
+	// Retry controls retrying transient connection failures
+	// (DB_CONNECT_RETRIES, DB_CONNECT_BACKOFF).
+	Retry ConnectRetry
+
+	// passwordSource is one of the PasswordFrom* constants, or empty while
+	// no password is known.
+	passwordSource string
 }
 
 func firstNonEmpty(vals ...string) string {
@@ -74,7 +86,9 @@ func overrideDBNameInPostgresURL(original, newDBName string) (string, bool) {
 	if err != nil {
 		return "", false
 	}
-	if u.Path == "" {
+	// postgres://?host=/var/run/postgresql has no path to replace; the
+	// socket directory is in the query.
+	if u.Path == "" && (u.Host != "" || !isSocketHost(u.Query().Get("host"))) {
 		return "", false
 	}
 	u.Path = "/" + newDBName
@@ -89,21 +103,20 @@ func getCurrentFolderName() (string, error) {
 	return filepath.Base(cwd), nil
 }
 
-// readConfigFile supports INI-like format with optional [default] section
-func readConfigFile(configPath string) (map[string]string, error) {
-	file, err := os.Open(configPath)
+// readConfigFile supports INI-like format with optional [default] section.
+// Keys before any section belong to [default]. With a profile, the keys of
+// its [profile] section override [default] ones; fromProfile lists them. A
+// profile without a section is an error, so a typo does not silently fall
+// back to the default database.
+func readConfigFile(configPath, profile string) (config map[string]string, fromProfile map[string]bool, err error) {
+	f, err := os.ReadFile(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open config file %s: %w", configPath, err)
+		return nil, nil, exitcode.Configf("failed to open config file %s: %w", configPath, err)
 	}
-	defer file.Close()
 
-	config := make(map[string]string)
+	config = make(map[string]string)
+	sections := map[string]map[string]string{}
 	var currentSection string
-	hasAnySection := false
-	f, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, err
-	}
 	lines := strings.Split(string(f), "\n")
 	for _, raw := range lines {
 		line := strings.TrimSpace(raw)
@@ -111,199 +124,247 @@ func readConfigFile(configPath string) (map[string]string, error) {
 			continue
 		}
 		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			currentSection = strings.Trim(line, "[]")
-			hasAnySection = true
+			currentSection = strings.TrimSpace(strings.Trim(line, "[]"))
+			if sections[currentSection] == nil {
+				sections[currentSection] = map[string]string{}
+			}
 			continue
 		}
 		if strings.Contains(line, "=") {
 			parts := strings.SplitN(line, "=", 2)
 			key := strings.TrimSpace(parts[0])
 			value := strings.TrimSpace(parts[1])
-			if currentSection == "default" || !hasAnySection || currentSection == "" {
+			if currentSection == "default" || currentSection == "" {
 				config[key] = value
+			} else {
+				sections[currentSection][key] = value
 			}
 		}
 	}
-	return config, nil
-}
 
-// applyEnvFile reads key=value lines from a .env and sets os.Environ accordingly.
-func applyEnvFile(path string) error {
-	file, err := os.Open(path)
-	if err != nil {
-		return err
+	fromProfile = map[string]bool{}
+	if profile == "" || profile == "default" {
+		return config, fromProfile, nil
 	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		if strings.HasPrefix(line, "export ") {
-			line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
-		}
-		sepIndex := strings.Index(line, "=")
-		if sepIndex <= 0 {
-			continue
-		}
-		key := strings.TrimSpace(line[:sepIndex])
-		value := strings.TrimSpace(line[sepIndex+1:])
-		if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") && len(value) >= 2 {
-			value = value[1 : len(value)-1]
-		} else if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) >= 2 {
-			value = value[1 : len(value)-1]
-		}
-		if key == "DBTOOL_CONFIG_FILE" && value != "" && !filepath.IsAbs(value) {
-			resolved := filepath.Join(filepath.Dir(path), value)
-			vprintf("dbconf: resolving DBTOOL_CONFIG_FILE relative to %s -> %s\n", path, resolved)
-			value = resolved
-		}
-		// Only set the environment variable if it doesn't already exist
-		// This allows command-line environment variables to override .env file values
-		if _, exists := os.LookupEnv(key); !exists {
-			os.Setenv(key, value)
-		} else {
-			vprintf("dbconf: skipping %s from .env (already set in environment)\n", key)
-		}
+	section, ok := sections[profile]
+	if !ok {
+		return nil, nil, exitcode.Configf("profile %q: no [%s] section in %s", profile, profile, configPath)
 	}
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("failed to read %s: %w", path, err)
+	vprintf("dbconf: profile %s: %d key(s) from [%s] override [default]\n", profile, len(section), profile)
+	for k, v := range section {
+		config[k] = v
+		fromProfile[k] = true
+		// A profile's KEY_FILE replaces a [default] KEY rather than
+		// losing to it.
+		if key, ok := strings.CutSuffix(k, "_FILE"); ok && key != "" {
+			if _, set := section[key]; !set {
+				delete(config, key)
+			}
+		}
 	}
-	return nil
+	return config, fromProfile, nil
 }
 
-// loadEnvFromNearestDotEnv walks up from cwd to repo root and applies all .env files found.
-func loadEnvFromNearestDotEnv() error {
-	currentDir, err := os.Getwd()
-	if err != nil {
-		return err
-	}
-	var envPaths []string
-	vprintf("dbconf: searching for .env files from %s\n", currentDir)
-	for {
-		envPath := filepath.Join(currentDir, ".env")
-		if info, err := os.Stat(envPath); err == nil && !info.IsDir() {
-			envPaths = append(envPaths, envPath)
-			vprintf("dbconf: found .env: %s\n", envPath)
-		}
-		gitPath := filepath.Join(currentDir, ".git")
-		if info, err := os.Stat(gitPath); err == nil && info.IsDir() {
-			break
-		}
-		parent := filepath.Dir(currentDir)
-		if parent == currentDir {
-			break
-		}
-		currentDir = parent
-	}
-	for i := len(envPaths) - 1; i >= 0; i-- {
-		vprintf("dbconf: applying .env: %s\n", envPaths[i])
-		if err := applyEnvFile(envPaths[i]); err != nil {
-			return err
-		}
-	}
-	return nil
+// loadEnvFromNearestDotEnv applies the .env files from cwd up to the repo
+// root, climbing at most maxDepth directories unless it is negative. Keys
+// dbconf reads itself go into dotEnv; the rest are set in os.Environ for
+// the utilities.
+func loadEnvFromNearestDotEnv(dotEnv map[string]dotEnvValue, maxDepth int) error {
+	return dotenv.LoadNearest(dotenv.Options{
+		MaxDepth:     maxDepth,
+		ResolvePaths: []string{"DBTOOL_CONFIG_FILE"},
+		Logf:         vprintf,
+		Set: func(v dotenv.Var) {
+			if ownEnvKey(v.Key) {
+				dotEnv[v.Key] = dotEnvValue{v.Value, v.File}
+				return
+			}
+			os.Setenv(v.Key, v.Value)
+			NoteEnvFile(v.Key, v.File)
+		},
+	})
 }
 
-// load loads DB configuration, preferring DBTOOL_CONFIG_FILE, else ~/.config/<cwd>/config.ini
-func load() (*DBConfig, error) {
-	// Ensure .env variables are loaded to mirror dbtool behavior
-	_ = loadEnvFromNearestDotEnv()
-	configPath := strings.TrimSpace(os.Getenv("DBTOOL_CONFIG_FILE"))
-	var config map[string]string
+// loadConfigFile reads DBTOOL_CONFIG_FILE, else ~/.config/<cwd>/config.ini if
+// it exists, with profile's section over [default] (see readConfigFile).
+// path is the file that was read, or "" when none was; a profile then has
+// nothing to select and is an error.
+func loadConfigFile(profile string) (config map[string]string, path string, fromProfile map[string]bool, err error) {
+	none := func() (map[string]string, string, map[string]bool, error) {
+		if profile != "" && profile != "default" {
+			return nil, "", nil, exitcode.Configf("profile %q selected but no config.ini was found (set DBTOOL_CONFIG_FILE)", profile)
+		}
+		return map[string]string{}, "", map[string]bool{}, nil
+	}
+	configPath := strings.TrimSpace(getenv("DBTOOL_CONFIG_FILE"))
 	if configPath == "" {
 		folderName, err := getCurrentFolderName()
 		if err != nil {
 			// Non-fatal; continue with empty config
 			vprintln("dbconf: could not determine current folder; skipping config.ini")
-			config = make(map[string]string)
-		} else {
-			homeDir, herr := os.UserHomeDir()
-			if herr != nil {
-				// When running under systemd without HOME, skip config.ini gracefully
-				vprintln("dbconf: HOME not set; skipping config.ini and relying on environment variables only")
-				config = make(map[string]string)
-			} else {
-				configPath = filepath.Join(homeDir, ".config", folderName, "config.ini")
-				vprintln("dbconf: using default config.ini:", configPath)
-				// Check if file exists before trying to read it
-				if _, statErr := os.Stat(configPath); os.IsNotExist(statErr) {
-					vprintln("dbconf: config.ini not found; relying on environment variables only")
-					config = make(map[string]string)
-				} else {
-					vprintln("dbconf: reading config.ini:", configPath)
-					var rerr error
-					config, rerr = readConfigFile(configPath)
-					if rerr != nil {
-						return nil, rerr
-					}
-				}
-			}
+			return none()
+		}
+		homeDir, herr := os.UserHomeDir()
+		if herr != nil {
+			// When running under systemd without HOME, skip config.ini gracefully
+			vprintln("dbconf: HOME not set; skipping config.ini and relying on environment variables only")
+			return none()
+		}
+		configPath = filepath.Join(homeDir, ".config", folderName, "config.ini")
+		vprintln("dbconf: using default config.ini:", configPath)
+		// Check if file exists before trying to read it
+		if _, statErr := os.Stat(configPath); os.IsNotExist(statErr) {
+			vprintln("dbconf: config.ini not found; relying on environment variables only")
+			return none()
 		}
 	} else {
 		// DBTOOL_CONFIG_FILE is explicitly set, so it must exist
 		vprintln("dbconf: using DBTOOL_CONFIG_FILE:", configPath)
-		vprintln("dbconf: reading config.ini:", configPath)
-		var rerr error
-		config, rerr = readConfigFile(configPath)
-		if rerr != nil {
-			return nil, rerr
+	}
+	vprintln("dbconf: reading config.ini:", configPath)
+	config, fromProfile, err = readConfigFile(configPath, profile)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return config, configPath, fromProfile, nil
+}
+
+var (
+	dsnOverrideMu sync.Mutex
+	dsnOverride   string
+)
+
+// SetDSNOverride makes every later configuration load use dsn as the
+// connection string, ahead of DATABASE_URL, the DB_* settings, .env files
+// and config.ini. It is meant for a per-invocation flag such as dbtool's
+// --dsn; an empty dsn removes the override. dsn is a postgres:// URL or a
+// keyword/value string such as "host=db user=app dbname=app"; commands that
+// target another database swap the name into the URL path or dbname=.
+func SetDSNOverride(dsn string) error {
+	dsn = strings.TrimSpace(dsn)
+	if dsn != "" {
+		lower := strings.ToLower(dsn)
+		switch {
+		case strings.HasPrefix(lower, "postgres://") || strings.HasPrefix(lower, "postgresql://"):
+			if _, err := url.Parse(dsn); err != nil {
+				return exitcode.Configf("invalid DSN %s: %w", RedactDSN(dsn), err)
+			}
+		case !isKeywordDSN(dsn):
+			return exitcode.Configf("invalid DSN %s: want a postgres:// or postgresql:// URL or key=value pairs", RedactDSN(dsn))
 		}
 	}
+	dsnOverrideMu.Lock()
+	dsnOverride = dsn
+	dsnOverrideMu.Unlock()
+	Reload()
+	return nil
+}
+
+func getDSNOverride() string {
+	dsnOverrideMu.Lock()
+	defer dsnOverrideMu.Unlock()
+	return dsnOverride
+}
+
+// resolve loads DB configuration, preferring DBTOOL_CONFIG_FILE, else ~/.config/<cwd>/config.ini
+func (s *loadState) resolve() (*DBConfig, error) {
+	config, _, secretFiles, err := s.ini()
+	if err != nil {
+		return nil, err
+	}
 
 	dbConfig := &DBConfig{
 		Host: firstNonEmpty(
-			os.Getenv("DB_HOST"),
+			getenv("DB_HOST"),
 			config["DB_HOST"],
 			config["HOST"],
 		),
 		Port: firstNonEmpty(
-			os.Getenv("DB_PORT"),
+			getenv("DB_PORT"),
 			config["DB_PORT"],
 			config["PORT"],
 		),
 		// Support both DB_NAME and DB_DATABASE for compatibility with existing app envs
 		Name: firstNonEmpty(
-			os.Getenv("DB_NAME"),
-			os.Getenv("DB_DATABASE"),
+			getenv("DB_NAME"),
+			getenv("DB_DATABASE"),
 			config["DB_NAME"],
 			config["DB_DATABASE"],
 			config["NAME"],
 		),
 		// Support both DB_USER and DB_USERNAME
 		User: firstNonEmpty(
-			os.Getenv("DB_USER"),
-			os.Getenv("DB_USERNAME"),
+			getenv("DB_USER"),
+			getenv("DB_USERNAME"),
 			config["DB_USER"],
 			config["DB_USERNAME"],
 			config["USER"],
 		),
 		Password: firstNonEmpty(
-			os.Getenv("DB_PASSWORD"),
+			getenv("DB_PASSWORD"),
 			config["DB_PASSWORD"],
 			config["PASSWORD"],
 		),
 		// Support both DB_SSLMODE and DB_SSL_MODE
 		SSLMode: firstNonEmpty(
-			os.Getenv("DB_SSLMODE"),
-			os.Getenv("DB_SSL_MODE"),
+			getenv("DB_SSLMODE"),
+			getenv("DB_SSL_MODE"),
 			config["DB_SSLMODE"],
 			config["DB_SSL_MODE"],
 			config["SSL_MODE"],
 		),
+		SSLRootCert: firstNonEmpty(getenv("DB_SSLROOTCERT"), config["DB_SSLROOTCERT"]),
+		SSLCert:     firstNonEmpty(getenv("DB_SSLCERT"), config["DB_SSLCERT"]),
+		SSLKey:      firstNonEmpty(getenv("DB_SSLKEY"), config["DB_SSLKEY"]),
 		MigrationsDir: firstNonEmpty(
-			os.Getenv("DB_MIGRATIONS_DIR"),
+			getenv("DB_MIGRATIONS_DIR"),
 			config["DB_MIGRATIONS_DIR"],
 			config["MIGRATIONS_DIR"],
 		),
 		URL: firstNonEmpty(
-			os.Getenv("DATABASE_URL"),
+			getenv("DATABASE_URL"),
 			config["DATABASE_URL"],
 		),
+		ReadURL:  strings.TrimSpace(firstNonEmpty(getenv("DATABASE_READ_URL"), config["DATABASE_READ_URL"])),
+		ReadHost: strings.TrimSpace(firstNonEmpty(getenv("DB_READ_HOST"), config["DB_READ_HOST"])),
+	}
+	if dbConfig.Pool, err = loadPoolConfig(config); err != nil {
+		return nil, err
+	}
+	if dbConfig.MigrationsLockTimeout, err = loadMigrationsLockTimeout(config); err != nil {
+		return nil, err
+	}
+	if dbConfig.Retry, err = loadConnectRetry(config); err != nil {
+		return nil, err
+	}
+	ledger, err := parseMigrationsTable(poolSetting(config, "DB_MIGRATIONS_TABLE"))
+	if err != nil {
+		return nil, err
+	}
+	dbConfig.MigrationsTable = ledger.String()
+	if override := getDSNOverride(); override != "" {
+		vprintln("dbconf: using DSN override:", RedactDSN(override))
+		dbConfig.URL = override
+		if dbConfig.ReadURL != "" || dbConfig.ReadHost != "" {
+			// The replica belongs to the configured server, not the override.
+			vprintln("dbconf: ignoring DATABASE_READ_URL/DB_READ_HOST: DSN override in use")
+			dbConfig.ReadURL, dbConfig.ReadHost = "", ""
+		}
 	}
 
+	switch {
+	case getenv("DB_PASSWORD") != "":
+		dbConfig.passwordSource = PasswordFromEnv
+	case secretFiles["DB_PASSWORD"] != "" || (config["DB_PASSWORD"] == "" && secretFiles["PASSWORD"] != ""):
+		dbConfig.passwordSource = PasswordFromFile
+	case dbConfig.Password != "":
+		dbConfig.passwordSource = PasswordFromConfig
+	}
 	if dbConfig.URL != "" {
+		dbConfig.passwordSource = ""
+		if dbConfig.hasPassword() {
+			dbConfig.passwordSource = PasswordFromURL
+		}
 		// Clear discrete fields to avoid ambiguity
 		dbConfig.Host = ""
 		dbConfig.Port = ""
@@ -311,6 +372,7 @@ func load() (*DBConfig, error) {
 		dbConfig.User = ""
 		dbConfig.Password = ""
 		dbConfig.SSLMode = ""
+		dbConfig.URL = dbConfig.mergeSSLParams(dbConfig.URL)
 	}
 
 	if isVerbose() {
@@ -319,34 +381,28 @@ func load() (*DBConfig, error) {
 
 		// Detailed resolution traces so callers can see where values came from.
 		vprintf("dbconf: resolution DB_HOST: env[DB_HOST]=%q config[DB_HOST]=%q config[HOST]=%q -> %q\n",
-			os.Getenv("DB_HOST"), config["DB_HOST"], config["HOST"], dbConfig.Host)
+			getenv("DB_HOST"), config["DB_HOST"], config["HOST"], dbConfig.Host)
 		vprintf("dbconf: resolution DB_PORT: env[DB_PORT]=%q config[DB_PORT]=%q config[PORT]=%q -> %q\n",
-			os.Getenv("DB_PORT"), config["DB_PORT"], config["PORT"], dbConfig.Port)
+			getenv("DB_PORT"), config["DB_PORT"], config["PORT"], dbConfig.Port)
 		vprintf("dbconf: resolution DB_NAME: env[DB_NAME]=%q env[DB_DATABASE]=%q config[DB_NAME]=%q config[DB_DATABASE]=%q config[NAME]=%q -> %q\n",
-			os.Getenv("DB_NAME"), os.Getenv("DB_DATABASE"), config["DB_NAME"], config["DB_DATABASE"], config["NAME"], dbConfig.Name)
+			getenv("DB_NAME"), getenv("DB_DATABASE"), config["DB_NAME"], config["DB_DATABASE"], config["NAME"], dbConfig.Name)
 		vprintf("dbconf: resolution DB_USER: env[DB_USER]=%q env[DB_USERNAME]=%q config[DB_USER]=%q config[DB_USERNAME]=%q config[USER]=%q -> %q\n",
-			os.Getenv("DB_USER"), os.Getenv("DB_USERNAME"), config["DB_USER"], config["DB_USERNAME"], config["USER"], dbConfig.User)
+			getenv("DB_USER"), getenv("DB_USERNAME"), config["DB_USER"], config["DB_USERNAME"], config["USER"], dbConfig.User)
 		vprintf("dbconf: resolution DB_SSLMODE: env[DB_SSLMODE]=%q env[DB_SSL_MODE]=%q config[DB_SSLMODE]=%q config[DB_SSL_MODE]=%q config[SSL_MODE]=%q -> %q\n",
-			os.Getenv("DB_SSLMODE"), os.Getenv("DB_SSL_MODE"), config["DB_SSLMODE"], config["DB_SSL_MODE"], config["SSL_MODE"], dbConfig.SSLMode)
+			getenv("DB_SSLMODE"), getenv("DB_SSL_MODE"), config["DB_SSLMODE"], config["DB_SSL_MODE"], config["SSL_MODE"], dbConfig.SSLMode)
 		vprintf("dbconf: resolution DB_MIGRATIONS_DIR: env[DB_MIGRATIONS_DIR]=%q config[DB_MIGRATIONS_DIR]=%q config[MIGRATIONS_DIR]=%q -> %q\n",
-			os.Getenv("DB_MIGRATIONS_DIR"), config["DB_MIGRATIONS_DIR"], config["MIGRATIONS_DIR"], dbConfig.MigrationsDir)
+			getenv("DB_MIGRATIONS_DIR"), config["DB_MIGRATIONS_DIR"], config["MIGRATIONS_DIR"], dbConfig.MigrationsDir)
+		vprintf("dbconf: resolution SSL files: DB_SSLROOTCERT=%q DB_SSLCERT=%q DB_SSLKEY=%q\n",
+			dbConfig.SSLRootCert, dbConfig.SSLCert, dbConfig.SSLKey)
 		vprintf("dbconf: resolution DATABASE_URL: env[DATABASE_URL]=%q config[DATABASE_URL]=%q -> present=%v\n",
-			os.Getenv("DATABASE_URL"), config["DATABASE_URL"], strings.TrimSpace(dbConfig.URL) != "")
+			getenv("DATABASE_URL"), config["DATABASE_URL"], strings.TrimSpace(dbConfig.URL) != "")
 
 		if u := strings.TrimSpace(dbConfig.URL); u != "" {
-			if pu, err := url.Parse(u); err == nil {
-				if pu.User != nil {
-					if _, has := pu.User.Password(); has {
-						pu.User = url.User(pu.User.Username())
-					}
-				}
-				vprintln("dbconf: effective DATABASE_URL:", pu.String())
-			} else {
-				vprintln("dbconf: effective DATABASE_URL (unparsed):", "<invalid>")
-			}
+			vprintln("dbconf: effective DATABASE_URL:", RedactDSN(u))
 		} else {
 			vprintln("dbconf: effective DATABASE_URL: <empty>")
 		}
+		vprintln("dbconf: connecting to", Describe(dbConfig))
 	}
 
 	if dbConfig.SSLMode == "" {
@@ -358,55 +414,19 @@ func load() (*DBConfig, error) {
 	return dbConfig, nil
 }
 
-// GetRawConfig returns the raw key/value configuration map loaded from
-// config.ini (respecting DBTOOL_CONFIG_FILE and the default path). Only
-// the [default] section and top-level keys are considered, matching the
-// behavior used for DB settings.
+// GetRawConfig returns every configuration key utilities may read, such as
+// CLOUDFLARE_API_KEY: config.ini's [default] section (overlaid by the
+// selected profile, <KEY>_FILE secrets resolved), overridden by non-blank
+// variables of the process environment and the .env files, as for the DB
+// settings. GetRawConfigWithSources also says where each value came from.
 func GetRawConfig() (map[string]string, error) {
-	// Reuse the same resolution logic as load(), but expose the config map
-	// so callers (like utilities) can read additional keys such as
-	// CLOUDFLARE_API_KEY.
-	_ = loadEnvFromNearestDotEnv()
-
-	configPath := strings.TrimSpace(os.Getenv("DBTOOL_CONFIG_FILE"))
-	var config map[string]string
-	if configPath == "" {
-		folderName, err := getCurrentFolderName()
-		if err != nil {
-			vprintln("dbconf: could not determine current folder; skipping config.ini in GetRawConfig")
-			config = make(map[string]string)
-		} else {
-			homeDir, herr := os.UserHomeDir()
-			if herr != nil {
-				vprintln("dbconf: HOME not set; skipping config.ini in GetRawConfig")
-				config = make(map[string]string)
-			} else {
-				configPath = filepath.Join(homeDir, ".config", folderName, "config.ini")
-				vprintln("dbconf: using default config.ini in GetRawConfig:", configPath)
-				if _, statErr := os.Stat(configPath); os.IsNotExist(statErr) {
-					vprintln("dbconf: config.ini not found in GetRawConfig; returning empty config")
-					config = make(map[string]string)
-				} else {
-					vprintln("dbconf: reading config.ini in GetRawConfig:", configPath)
-					var rerr error
-					config, rerr = readConfigFile(configPath)
-					if rerr != nil {
-						return nil, rerr
-					}
-				}
-			}
-		}
-	} else {
-		vprintln("dbconf: using DBTOOL_CONFIG_FILE in GetRawConfig:", configPath)
-		vprintln("dbconf: reading config.ini in GetRawConfig:", configPath)
-		var rerr error
-		config, rerr = readConfigFile(configPath)
-		if rerr != nil {
-			return nil, rerr
-		}
+	vals, err := GetRawConfigWithSources()
+	if err != nil {
+		return nil, err
 	}
-	if config == nil {
-		config = make(map[string]string)
+	config := make(map[string]string, len(vals))
+	for k, v := range vals {
+		config[k] = v.Value
 	}
 	return config, nil
 }
@@ -414,7 +434,9 @@ func GetRawConfig() (map[string]string, error) {
 // GetDBConfig returns loaded configuration
 func GetDBConfig() (*DBConfig, error) { return load() }
 
-// DefaultDBName returns DB name from config or DSN
+// DefaultDBName returns DB name from config or DSN. Like the other
+// configuration problems dbconf reports, a missing name is marked
+// exitcode.ConfigError.
 func DefaultDBName() (string, error) {
 	cfg, err := load()
 	if err != nil {
@@ -434,26 +456,29 @@ func DefaultDBName() (string, error) {
 		if p != "" {
 			return p, nil
 		}
+	} else if isKeywordDSN(u) {
+		if f, _ := dsnFields(u); f["dbname"] != "" {
+			return f["dbname"], nil
+		}
 	}
-	return "", fmt.Errorf("no default database name found; set DB_NAME or DATABASE_URL in config")
+	return "", exitcode.Configf("no default database name found; set DB_NAME or DATABASE_URL in config")
 }
 
 func (c *DBConfig) createConnectionString() string {
-	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(c.URL)), "postgres://") ||
-		strings.HasPrefix(strings.ToLower(strings.TrimSpace(c.URL)), "postgresql://") {
-		return strings.TrimSpace(c.URL)
-	}
-	if isXataHTTPSURL(c.URL) {
-		return ""
-	}
-	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		c.Host, c.Port, c.User, c.Password, c.Name, c.SSLMode)
+	return c.createConnectionStringFor("")
 }
 
+// createConnectionStringFor is the connection string for dbname, or for the
+// configured database when dbname is "". A postgres:// URL gets dbname in
+// its path; a keyword/value DSN, the usual form for a Unix socket, gets it
+// as dbname= instead.
 func (c *DBConfig) createConnectionStringFor(dbname string) string {
 	if u := strings.TrimSpace(c.URL); u != "" {
 		lower := strings.ToLower(u)
 		if strings.HasPrefix(lower, "postgres://") || strings.HasPrefix(lower, "postgresql://") {
+			if dbname == "" {
+				return u
+			}
 			if newURL, ok := overrideDBNameInPostgresURL(u, dbname); ok {
 				return newURL
 			}
@@ -462,48 +487,211 @@ func (c *DBConfig) createConnectionStringFor(dbname string) string {
 		if isXataHTTPSURL(u) {
 			return ""
 		}
+		if isKeywordDSN(u) {
+			if dbname == "" {
+				return u
+			}
+			return setKeywordParam(u, "dbname", dbname)
+		}
+	}
+	if dbname == "" {
+		dbname = c.Name
+	}
+	// Values are quoted, since a socket directory may contain spaces, and
+	// empty ones left out for libpq's defaults: "host= port=5432" would
+	// read as host "port=5432".
+	var b strings.Builder
+	for _, kv := range [][2]string{
+		{"host", c.Host}, {"port", c.Port}, {"user", c.User}, {"password", c.Password},
+		{"dbname", dbname}, {"sslmode", c.SSLMode},
+	} {
+		if kv[1] != "" {
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(kv[0] + "=" + quoteConnValue(kv[1]))
+		}
 	}
-	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		c.Host, c.Port, c.User, c.Password, dbname, c.SSLMode)
+	return b.String() + c.sslConnParams()
+}
+
+// quoteConnValue quotes a key=value connection string value, so passwords
+// with spaces or quotes (e.g. typed at the prompt) survive.
+func quoteConnValue(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
 }
 
+// DefaultConnectTimeout bounds each connection attempt (dial, handshake and
+// ping) made by the Connect functions, also when the caller's context has no
+// deadline, so a firewalled host fails in seconds instead of after the OS
+// TCP timeout.
+var DefaultConnectTimeout = 10 * time.Second
+
 func ConnectDB() (*sql.DB, error) {
+	return ConnectDBContext(context.Background())
+}
+
+func ConnectDBAs(dbname string) (*sql.DB, error) {
+	return ConnectDBAsContext(context.Background(), dbname)
+}
+
+// ConnectDBContext is ConnectDB with the connection attempt bounded by ctx
+// as well as DefaultConnectTimeout.
+func ConnectDBContext(ctx context.Context) (*sql.DB, error) {
+	return openDB(ctx, "", openPostgres)
+}
+
+// ConnectDBAsContext is ConnectDBAs with the connection attempt bounded by
+// ctx as well as DefaultConnectTimeout.
+func ConnectDBAsContext(ctx context.Context, dbname string) (*sql.DB, error) {
+	return openDB(ctx, dbname, openPostgres)
+}
+
+func openPostgres(connStr string) (*sql.DB, error) { return sql.Open("postgres", connStr) }
+
+// ConnectDBAsWithNotices is ConnectDBAs with server notices (NOTICE, INFO,
+// WARNING, e.g. from VACUUM VERBOSE) passed to onNotice as they arrive.
+func ConnectDBAsWithNotices(dbname string, onNotice func(*pq.Error)) (*sql.DB, error) {
+	return openDB(context.Background(), dbname, func(connStr string) (*sql.DB, error) {
+		connector, err := pq.NewConnector(connStr)
+		if err != nil {
+			return nil, err
+		}
+		return sql.OpenDB(pq.ConnectorWithNoticeHandler(connector, onNotice)), nil
+	})
+}
+
+// openDB opens and pings dbname ("" for the configured database). A
+// password missing from the configuration comes from the pgpass file; if the
+// server still rejects the login and stdin is a terminal, the user is asked
+// for it once, as psql does. Time spent at the prompt does not count against
+// DefaultConnectTimeout. Transient failures are retried as configured in
+// DBConfig.Retry, each attempt with its own DefaultConnectTimeout.
+func openDB(ctx context.Context, dbname string, open func(connStr string) (*sql.DB, error)) (*sql.DB, error) {
+	config, err := loadForConnect()
+	if err != nil {
+		return nil, err
+	}
+	return openConfigDB(ctx, config, dbname, open)
+}
+
+func loadForConnect() (*DBConfig, error) {
 	config, err := load()
 	if err != nil {
 		return nil, fmt.Errorf("failed to load database config: %w", err)
 	}
+	return config, nil
+}
+
+// openConfigDB is openDB with config instead of the loaded configuration.
+func openConfigDB(ctx context.Context, config *DBConfig, dbname string, open func(connStr string) (*sql.DB, error)) (*sql.DB, error) {
 	if isXataHTTPSURL(config.URL) {
-		return nil, fmt.Errorf("detected Xata HTTPS DATABASE_URL, which is not PostgreSQL DSN. Please use a PostgreSQL connection URL (postgres://...)")
+		return nil, exitcode.Configf("detected Xata HTTPS DATABASE_URL, which is not PostgreSQL DSN. Please use a PostgreSQL connection URL (postgres://...)")
 	}
-	connStr := config.createConnectionString()
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database connection: %w", err)
+	if u := strings.TrimSpace(config.URL); u != "" && !isURLDSN(u) && !isKeywordDSN(u) {
+		// Falling back to the DB_* fields, which a DATABASE_URL clears, would
+		// connect to libpq's defaults instead.
+		return nil, exitcode.Configf("DATABASE_URL %s is neither a postgres:// URL nor key=value pairs such as host=db dbname=app", RedactDSN(u))
 	}
-	if !(isXataPostgresURL(strings.TrimSpace(config.URL))) {
-		if err := db.Ping(); err != nil {
-			db.Close()
+	if err := config.CheckSSLFiles(); err != nil {
+		return nil, err
+	}
+	config.fillPassword(dbname)
+	for attempt := 1; ; attempt++ {
+		connStr := config.createConnectionString()
+		if dbname != "" {
+			connStr = config.createConnectionStringFor(dbname)
+		}
+		db, err := open(connStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database connection: %w", err)
+		}
+		config.Pool.apply(db)
+		if isXataPostgresURL(strings.TrimSpace(config.URL)) {
+			return db, nil
+		}
+		err = pingContext(ctx, db)
+		if err == nil {
+			return db, nil
+		}
+		db.Close()
+		if attempt <= config.Retry.Retries && ctx.Err() == nil && isTransientConnError(err) {
+			wait := config.Retry.wait(attempt)
+			vprintf("dbconf: connection attempt %d of %d failed: %v; retrying in %s\n",
+				attempt, config.Retry.Retries+1, err, wait.Round(time.Millisecond))
+			if err := connectSleep(ctx, wait); err != nil {
+				return nil, fmt.Errorf("failed to ping database: %w", err)
+			}
+			continue
+		}
+		if !config.shouldPrompt(err) {
+			if attempt > 1 {
+				return nil, fmt.Errorf("failed to ping database after %d attempts: %w", attempt, err)
+			}
 			return nil, fmt.Errorf("failed to ping database: %w", err)
 		}
+		if err := config.promptPassword(dbname); err != nil {
+			return nil, err
+		}
 	}
-	return db, nil
 }
 
-func ConnectDBAs(dbname string) (*sql.DB, error) {
-	config, err := load()
+// pingContext pings db within ctx and DefaultConnectTimeout. It returns when
+// the time is up even if the driver has not: lib/pq honors the context while
+// dialing but not during the startup handshake, which hangs on a server that
+// accepts the connection and never answers.
+func pingContext(ctx context.Context, db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(ctx, DefaultConnectTimeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- db.PingContext(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("connection timed out: %w", ctx.Err())
+		}
+		return ctx.Err()
+	}
+}
+
+// IsDSN reports whether target is a PostgreSQL connection string (URL or
+// key=value form) rather than a bare database name.
+func IsDSN(target string) bool {
+	t := strings.ToLower(strings.TrimSpace(target))
+	return strings.HasPrefix(t, "postgres://") || strings.HasPrefix(t, "postgresql://") || strings.Contains(t, "=")
+}
+
+// ConnectDSN opens and pings a database from an explicit connection string,
+// bypassing DATABASE_URL and the config.ini connection settings (the pool
+// settings still apply).
+func ConnectDSN(dsn string) (*sql.DB, error) {
+	return ConnectDSNContext(context.Background(), dsn)
+}
+
+// ConnectDSNContext is ConnectDSN with the ping bounded by ctx as well as
+// DefaultConnectTimeout.
+func ConnectDSNContext(ctx context.Context, dsn string) (*sql.DB, error) {
+	dsn = strings.TrimSpace(dsn)
+	if isXataHTTPSURL(dsn) {
+		return nil, exitcode.Configf("detected Xata HTTPS URL, which is not PostgreSQL DSN. Please use a PostgreSQL connection URL (postgres://...)")
+	}
+	config, _, _, err := currentState().ini()
 	if err != nil {
-		return nil, fmt.Errorf("failed to load database config: %w", err)
+		config = nil
 	}
-	if isXataHTTPSURL(config.URL) {
-		return nil, fmt.Errorf("detected Xata HTTPS DATABASE_URL, which is not PostgreSQL DSN. Please use a PostgreSQL connection URL (postgres://...)")
+	pool, err := loadPoolConfig(config)
+	if err != nil {
+		return nil, err
 	}
-	connStr := config.createConnectionStringFor(dbname)
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
-	if !(isXataPostgresURL(strings.TrimSpace(config.URL))) {
-		if err := db.Ping(); err != nil {
+	pool.apply(db)
+	if !isXataPostgresURL(dsn) {
+		if err := pingContext(ctx, db); err != nil {
 			db.Close()
 			return nil, fmt.Errorf("failed to ping database: %w", err)
 		}
@@ -511,77 +699,158 @@ func ConnectDBAs(dbname string) (*sql.DB, error) {
 	return db, nil
 }
 
+// ConnectTarget connects to target, which is either a DSN (see IsDSN) or a
+// database name resolved through the usual configuration like ConnectDBAs.
+func ConnectTarget(target string) (*sql.DB, error) {
+	return ConnectTargetContext(context.Background(), target)
+}
+
+// ConnectTargetContext is ConnectTarget with the connection attempt bounded
+// by ctx as well as DefaultConnectTimeout.
+func ConnectTargetContext(ctx context.Context, target string) (*sql.DB, error) {
+	if IsDSN(target) {
+		return ConnectDSNContext(ctx, target)
+	}
+	return ConnectDBAsContext(ctx, strings.TrimSpace(target))
+}
+
+// Migration is one migration file. Its ID, recorded in the migrations table
+// (DB_MIGRATIONS_TABLE, default public._migrations),
+// is the file name, with ".up" dropped for NNN_name.up.sql so that adding a
+// down file to an existing NNN_name.sql does not change its ID.
 type Migration struct {
 	ID  string
 	SQL string
+	// Down is the NNN_name.down.sql that undoes SQL, when HasDown is set.
+	Down    string
+	HasDown bool
 }
 
-func ensureMigrationsTable(ctx context.Context, db *sql.DB) error {
-	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS public._migrations (
-		id text PRIMARY KEY,
-		applied_at timestamptz NOT NULL DEFAULT now()
-	)`)
-	return err
+// AppliedMigrations returns the IDs recorded in the migrations table with
+// the time each was applied. The table is created if it does not exist yet.
+func AppliedMigrations(ctx context.Context, db *sql.DB) (map[string]time.Time, error) {
+	l, err := migrationsLedger()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(ctx, db, l); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id, applied_at FROM `+l.ident())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		out[id] = at
+	}
+	return out, rows.Err()
 }
 
 func ApplyMigrations(ctx context.Context, dbname string, migrations []Migration) error {
-	db, err := ConnectDBAs(dbname)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-	if err := ensureMigrationsTable(ctx, db); err != nil {
-		return err
+	_, err := ApplyMigrationsReport(ctx, dbname, migrations)
+	return err
+}
+
+// ApplyMigrationsDB applies pending migrations on an already open connection.
+// The run holds the migrations advisory lock, so concurrent callers against
+// the same database apply each migration once; a caller that cannot get the
+// lock within DB_MIGRATIONS_LOCK_TIMEOUT fails with ErrMigrationsLocked.
+func ApplyMigrationsDB(ctx context.Context, db *sql.DB, migrations []Migration) error {
+	_, err := ApplyMigrationsDBReport(ctx, db, migrations)
+	return err
+}
+
+// applyMigrations applies the pending migrations in ID order, each in its
+// own transaction with its row in ledger l, and stops at the first
+// failure. The results cover the migrations up to and including that one.
+func applyMigrations(ctx context.Context, db migrationsDB, l ledger, migrations []Migration) ([]MigrationResult, error) {
+	if err := ensureMigrationsTable(ctx, db, l); err != nil {
+		return nil, err
 	}
-	rows, err := db.QueryContext(ctx, `SELECT id FROM public._migrations`)
+	rows, err := db.QueryContext(ctx, `SELECT id FROM `+l.ident())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer rows.Close()
 	done := make(map[string]struct{})
 	for rows.Next() {
 		var id string
 		if err := rows.Scan(&id); err != nil {
-			return err
+			return nil, err
 		}
 		done[id] = struct{}{}
 	}
 	if err := rows.Err(); err != nil {
-		return err
+		return nil, err
 	}
 	sort.Slice(migrations, func(i, j int) bool { return migrations[i].ID < migrations[j].ID })
+	results := make([]MigrationResult, 0, len(migrations))
 	for _, m := range migrations {
 		if _, exists := done[m.ID]; exists {
+			results = append(results, MigrationResult{ID: m.ID})
 			continue
 		}
-		tx, err := db.BeginTx(ctx, nil)
+		start := time.Now()
+		err := applyMigration(ctx, db, l, m)
+		res := MigrationResult{ID: m.ID, Applied: err == nil, Duration: time.Since(start), Err: err}
+		results = append(results, res)
 		if err != nil {
-			return err
-		}
-		if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
-			_ = tx.Rollback()
-			return err
-		}
-		if _, err := tx.ExecContext(ctx, `INSERT INTO public._migrations (id, applied_at) VALUES ($1, now())`, m.ID); err != nil {
-			_ = tx.Rollback()
-			return err
-		}
-		if err := tx.Commit(); err != nil {
-			return err
+			vprintf("dbconf: migration %s failed after %s\n", m.ID, res.Duration.Round(time.Millisecond))
+			return results, err
 		}
+		vprintf("dbconf: applied migration %s in %s\n", m.ID, res.Duration.Round(time.Millisecond))
+	}
+	return results, nil
+}
+
+func applyMigration(ctx context.Context, db migrationsDB, l ledger, m Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("migration %s: %w", m.ID, err)
+	}
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("migration %s failed near %q: %w", m.ID, statementExcerpt(m.SQL, err), err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO `+l.ident()+` (id, applied_at) VALUES ($1, now())`, m.ID); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("record migration %s: %w", m.ID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration %s: %w", m.ID, err)
 	}
 	return nil
 }
 
 func ApplyMigrationsFromDir(ctx context.Context, dbname, dir string) error {
+	migs, err := ReadMigrationsDir(dir)
+	if err != nil || migs == nil {
+		return err
+	}
+	return ApplyMigrations(ctx, dbname, migs)
+}
+
+// ReadMigrationsDir loads *.sql files from dir sorted by ID. A
+// NNN_name.down.sql file is attached as the Down of NNN_name.up.sql (or
+// NNN_name.sql) rather than being a migration itself. A missing directory
+// yields nil; an existing one a non-nil (possibly empty) slice.
+func ReadMigrationsDir(dir string) ([]Migration, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil
+			return nil, nil
 		}
-		return err
+		return nil, err
 	}
-	var migs []Migration
+	byID := map[string]*Migration{}
+	downs := map[string]string{}
 	for _, ent := range entries {
 		if ent.IsDir() {
 			continue
@@ -593,12 +862,34 @@ func ApplyMigrationsFromDir(ctx context.Context, dbname, dir string) error {
 		path := filepath.Join(dir, name)
 		b, err := os.ReadFile(path)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if base, ok := strings.CutSuffix(name, ".down.sql"); ok {
+			downs[base+".sql"] = string(b)
+			continue
+		}
+		id := name
+		if base, ok := strings.CutSuffix(name, ".up.sql"); ok {
+			id = base + ".sql"
 		}
-		migs = append(migs, Migration{ID: name, SQL: string(b)})
+		if _, dup := byID[id]; dup {
+			return nil, fmt.Errorf("migrations %s and %s both have ID %s", id, strings.TrimSuffix(id, ".sql")+".up.sql", id)
+		}
+		byID[id] = &Migration{ID: id, SQL: string(b)}
+	}
+	for id, down := range downs {
+		m, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%s has no matching up migration", strings.TrimSuffix(id, ".sql")+".down.sql")
+		}
+		m.Down, m.HasDown = down, true
+	}
+	migs := make([]Migration, 0, len(byID))
+	for _, m := range byID {
+		migs = append(migs, *m)
 	}
 	sort.Slice(migs, func(i, j int) bool { return migs[i].ID < migs[j].ID })
-	return ApplyMigrations(ctx, dbname, migs)
+	return migs, nil
 }
 
 // ApplyConfiguredMigrations applies SQL migrations using the configured
@@ -606,16 +897,37 @@ func ApplyMigrationsFromDir(ctx context.Context, dbname, dir string) error {
 // falling back to ./migrations. This mirrors dbtool's configuration
 // resolution while keeping callers simple.
 func ApplyConfiguredMigrations(ctx context.Context, dbname string) error {
-	cfg, err := GetDBConfig()
+	_, err := ApplyConfiguredMigrationsReport(ctx, dbname)
+	return err
+}
+
+// ApplyConfiguredMigrationsDB is ApplyConfiguredMigrations for an already
+// open connection, e.g. one obtained with ConnectDSN.
+func ApplyConfiguredMigrationsDB(ctx context.Context, db *sql.DB) error {
+	dir, err := ConfiguredMigrationsDir()
 	if err != nil {
 		return err
 	}
+	if isVerbose() {
+		vprintf("dbconf: ApplyConfiguredMigrationsDB dir=%q\n", dir)
+	}
+	migs, err := ReadMigrationsDir(dir)
+	if err != nil || migs == nil {
+		return err
+	}
+	return ApplyMigrationsDB(ctx, db, migs)
+}
+
+// ConfiguredMigrationsDir returns DB_MIGRATIONS_DIR / MIGRATIONS_DIR from the
+// configuration, or ./migrations when neither is set.
+func ConfiguredMigrationsDir() (string, error) {
+	cfg, err := GetDBConfig()
+	if err != nil {
+		return "", err
+	}
 	dir := strings.TrimSpace(cfg.MigrationsDir)
 	if dir == "" {
 		dir = "./migrations"
 	}
-	if isVerbose() {
-		vprintf("dbconf: ApplyConfiguredMigrations db=%q dir=%q\n", dbname, dir)
-	}
-	return ApplyMigrationsFromDir(ctx, dbname, dir)
+	return dir, nil
 }
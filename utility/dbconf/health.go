@@ -0,0 +1,68 @@
+package dbconf
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Health is what HealthCheck found out about a server.
+type Health struct {
+	Reachable bool `json:"reachable"`
+	// ConnectLatency covers opening and pinging the connection; Latency a
+	// single query round trip once connected.
+	ConnectLatency  time.Duration `json:"connectLatency"`
+	Latency         time.Duration `json:"latency"`
+	ServerVersion   string        `json:"serverVersion,omitempty"`
+	CurrentUser     string        `json:"currentUser,omitempty"`
+	CurrentDatabase string        `json:"currentDatabase,omitempty"`
+	// InRecovery is true on a standby (pg_is_in_recovery). ReadOnly is true
+	// there and when default_transaction_read_only is on, i.e. whenever
+	// writes fail without an explicit read-write transaction.
+	InRecovery bool `json:"inRecovery"`
+	ReadOnly   bool `json:"readOnly"`
+}
+
+// HealthCheck connects to the configured database and reports latency and
+// server metadata. The Health is returned with Reachable false together with
+// the error when the server cannot be reached or queried.
+func HealthCheck(ctx context.Context) (*Health, error) {
+	return HealthCheckAs(ctx, "")
+}
+
+// HealthCheckAs is HealthCheck for dbname on the configured server.
+func HealthCheckAs(ctx context.Context, dbname string) (*Health, error) {
+	h := &Health{}
+	start := time.Now()
+	db, err := ConnectDBAsContext(ctx, dbname)
+	h.ConnectLatency = time.Since(start)
+	if err != nil {
+		return h, err
+	}
+	defer db.Close()
+	return h, h.query(ctx, db)
+}
+
+// HealthCheckDB is HealthCheck on an open connection; ConnectLatency is
+// left zero.
+func HealthCheckDB(ctx context.Context, db *sql.DB) (*Health, error) {
+	h := &Health{}
+	return h, h.query(ctx, db)
+}
+
+func (h *Health) query(ctx context.Context, db *sql.DB) error {
+	start := time.Now()
+	err := db.QueryRowContext(ctx, `SELECT current_setting('server_version'), current_user, current_database(),
+		pg_is_in_recovery(), current_setting('default_transaction_read_only') = 'on'`,
+	).Scan(&h.ServerVersion, &h.CurrentUser, &h.CurrentDatabase, &h.InRecovery, &h.ReadOnly)
+	h.Latency = time.Since(start)
+	if err != nil {
+		return fmt.Errorf("health check query: %w", err)
+	}
+	h.ReadOnly = h.ReadOnly || h.InRecovery
+	h.Reachable = true
+	vprintf("dbconf: health: PostgreSQL %s, %s@%s, read-only=%t, latency %s\n",
+		h.ServerVersion, h.CurrentUser, h.CurrentDatabase, h.ReadOnly, h.Latency.Round(time.Microsecond))
+	return nil
+}
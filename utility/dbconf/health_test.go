@@ -0,0 +1,52 @@
+package dbconf
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestHealthCheckDB(t *testing.T) {
+	for _, c := range []struct {
+		desc                 string
+		recovery, txReadOnly bool
+		wantReadOnly         bool
+	}{
+		{"primary", false, false, false},
+		{"standby", true, false, true},
+		{"read-only default", false, true, true},
+	} {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery(`SELECT current_setting\('server_version'\)`).WillReturnRows(
+			sqlmock.NewRows([]string{"version", "user", "db", "recovery", "ro"}).
+				AddRow("16.2", "app", "appdb", c.recovery, c.txReadOnly))
+		h, err := HealthCheckDB(context.Background(), db)
+		if err != nil {
+			t.Fatalf("%s: %v", c.desc, err)
+		}
+		want := Health{Reachable: true, Latency: h.Latency, ServerVersion: "16.2", CurrentUser: "app",
+			CurrentDatabase: "appdb", InRecovery: c.recovery, ReadOnly: c.wantReadOnly}
+		if *h != want {
+			t.Errorf("%s: HealthCheckDB = %+v, want %+v", c.desc, *h, want)
+		}
+		db.Close()
+	}
+}
+
+func TestHealthCheckUnreachable(t *testing.T) {
+	useDatabaseURL(t, blackhole(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	h, err := HealthCheck(ctx)
+	if err == nil || h == nil || h.Reachable {
+		t.Fatalf("HealthCheck = %+v, %v; want unreachable with an error", h, err)
+	}
+	if h.ConnectLatency <= 0 {
+		t.Errorf("ConnectLatency = %s, want the time spent trying", h.ConnectLatency)
+	}
+}
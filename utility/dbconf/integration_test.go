@@ -0,0 +1,115 @@
+package dbconf
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"cli-things/internal/testdb"
+)
+
+// The tests in this file run against a real server from internal/testdb
+// and skip when there is none.
+
+func TestMain(m *testing.M) { os.Exit(testdb.Run(m)) }
+
+func TestApplyMigrationsIntegration(t *testing.T) {
+	name, dsn := testdb.New(t)
+	testdb.Use(t, dsn, Reload)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	migs := []Migration{
+		{ID: "20260101_0002_fill", SQL: "INSERT INTO public.items (n) VALUES (1), (2);"},
+		{ID: "20260101_0001_items", SQL: "CREATE TABLE public.items (n int NOT NULL);"},
+	}
+	results, err := ApplyMigrationsReport(ctx, name, migs)
+	if err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "20260101_0001_items" || !results[0].Applied || !results[1].Applied {
+		t.Fatalf("first run results = %+v, want both applied in ID order", results)
+	}
+	results, err = ApplyMigrationsReport(ctx, name, migs)
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	for _, r := range results {
+		if r.Applied {
+			t.Errorf("second run applied %s again", r.ID)
+		}
+	}
+
+	bad := append(migs,
+		Migration{ID: "20260101_0003_bad", SQL: "INSERT INTO public.items (n) VALUES (3); SELEC 1;"},
+		Migration{ID: "20260101_0004_after", SQL: "INSERT INTO public.items (n) VALUES (4);"},
+	)
+	if err := ApplyMigrations(ctx, name, bad); err == nil {
+		t.Fatal("a migration with a syntax error was applied")
+	}
+
+	db, err := ConnectDBAsContext(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count, sum int
+	if err := db.QueryRowContext(ctx, "SELECT count(*), coalesce(sum(n), 0) FROM public.items").Scan(&count, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || sum != 3 {
+		t.Errorf("items: count %d, sum %d; want the failed migration rolled back and the next one not run", count, sum)
+	}
+	applied, err := AppliedMigrations(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 {
+		t.Errorf("recorded migrations = %v, want the first two only", applied)
+	}
+}
+
+func TestApplyMigrationsConcurrentIntegration(t *testing.T) {
+	name, dsn := testdb.New(t)
+	testdb.Use(t, dsn, Reload)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Without the advisory lock both runs would try the CREATE TABLE, and
+	// one would fail on the existing table or the ledger's primary key.
+	migs := []Migration{
+		{ID: "20260101_0001_slow", SQL: "SELECT pg_sleep(0.5); CREATE TABLE public.once (id int);"},
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = ApplyMigrations(ctx, name, migs)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("run %d: %v", i, err)
+		}
+	}
+}
+
+func TestRepositoryMigrationsIntegration(t *testing.T) {
+	name, dsn := testdb.New(t)
+	testdb.Use(t, dsn, Reload)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// The migrations the tools ship must apply cleanly to an empty database,
+	// and twice in a row.
+	for run := 1; run <= 2; run++ {
+		if err := ApplyMigrationsFromDir(ctx, name, "../../migrations"); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+}
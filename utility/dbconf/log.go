@@ -0,0 +1,50 @@
+package dbconf
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	loggerMu sync.RWMutex
+	logger   func(format string, args ...any)
+)
+
+// SetLogger sends dbconf's diagnostics (configuration resolution, pool
+// settings, migrations) to logf, one printf-style message at a time, each
+// ending in a newline. A tool installs one from its own verbose flag, such
+// as the Debugf of its clog.Logger, or to capture the messages in tests. nil restores the default, which writes to
+// stderr when DBTOOL_VERBOSE=1 and discards them otherwise.
+func SetLogger(logf func(format string, args ...any)) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = logf
+}
+
+func currentLogger() func(format string, args ...any) {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+// isVerbose reports whether diagnostics go anywhere, so callers can skip
+// work that only feeds them.
+func isVerbose() bool {
+	return currentLogger() != nil || strings.TrimSpace(os.Getenv("DBTOOL_VERBOSE")) == "1"
+}
+
+func vprintf(format string, a ...any) {
+	if logf := currentLogger(); logf != nil {
+		logf(format, a...)
+		return
+	}
+	if isVerbose() {
+		fmt.Fprintf(os.Stderr, format, a...)
+	}
+}
+
+func vprintln(a ...any) {
+	vprintf("%s", fmt.Sprintln(a...))
+}
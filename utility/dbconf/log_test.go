@@ -0,0 +1,45 @@
+package dbconf
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetLogger(t *testing.T) {
+	clearDBEnv(t)
+	t.Setenv("DBTOOL_VERBOSE", "")
+	ini := filepath.Join(t.TempDir(), "config.ini")
+	writeFile(t, ini, "[default]\nDB_HOST=loghost\n")
+	t.Setenv("DBTOOL_CONFIG_FILE", ini)
+
+	if isVerbose() {
+		t.Fatal("verbose without a logger or DBTOOL_VERBOSE")
+	}
+	var got []string
+	SetLogger(func(format string, args ...any) { got = append(got, fmt.Sprintf(format, args...)) })
+	t.Cleanup(func() { SetLogger(nil) })
+
+	if _, err := load(); err != nil {
+		t.Fatal(err)
+	}
+	log := strings.Join(got, "")
+	if !strings.Contains(log, "dbconf: reading config.ini: "+ini+"\n") || !strings.Contains(log, `-> "loghost"`) {
+		t.Errorf("logger got:\n%s", log)
+	}
+	for _, msg := range got {
+		if !strings.HasSuffix(msg, "\n") {
+			t.Errorf("message %q lacks a trailing newline", msg)
+		}
+	}
+
+	SetLogger(nil)
+	if isVerbose() {
+		t.Error("still verbose after SetLogger(nil)")
+	}
+	t.Setenv("DBTOOL_VERBOSE", "1")
+	if !isVerbose() {
+		t.Error("DBTOOL_VERBOSE=1 no longer honored by the default logger")
+	}
+}
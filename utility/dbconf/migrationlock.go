@@ -0,0 +1,126 @@
+package dbconf
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// DefaultMigrationsLockTimeout is how long applying or rolling back
+// migrations waits for another process to finish when
+// DB_MIGRATIONS_LOCK_TIMEOUT is not set.
+var DefaultMigrationsLockTimeout = 60 * time.Second
+
+// migrationsLockPoll is how often a waiting process retries the lock.
+var migrationsLockPoll = 500 * time.Millisecond
+
+// ErrMigrationsLocked is returned when the migrations lock stays held by
+// another session for longer than the lock timeout.
+var ErrMigrationsLocked = errors.New("another process is applying migrations")
+
+// migrationsDB is what migrations run on: an *sql.DB, or the *sql.Conn
+// holding the migrations lock.
+type migrationsDB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// loadMigrationsLockTimeout reads DB_MIGRATIONS_LOCK_TIMEOUT. Zero means
+// give up at once when the lock is held.
+func loadMigrationsLockTimeout(config map[string]string) (time.Duration, error) {
+	v := poolSetting(config, "DB_MIGRATIONS_LOCK_TIMEOUT")
+	if v == "" {
+		return DefaultMigrationsLockTimeout, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid DB_MIGRATIONS_LOCK_TIMEOUT %q: want a duration such as 30s or 5m", v)
+	}
+	return d, nil
+}
+
+// migrationsLockKey is the pg_advisory_lock key for the migrations of
+// database name.
+func migrationsLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("cli-things/migrations/" + name))
+	return int64(h.Sum64())
+}
+
+// withMigrationsLock runs fn on a single connection from db while holding a
+// session-level advisory lock keyed on the database name, so two processes
+// never apply or roll back migrations at the same time. It waits up to the
+// configured lock timeout for the lock before failing with
+// ErrMigrationsLocked.
+func withMigrationsLock(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	cfg, err := load()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var name string
+	if err := conn.QueryRowContext(ctx, `SELECT current_database()`).Scan(&name); err != nil {
+		return err
+	}
+	key := migrationsLockKey(name)
+	if err := acquireMigrationsLock(ctx, conn, key, name, cfg.MigrationsLockTimeout); err != nil {
+		return err
+	}
+	defer releaseMigrationsLock(conn, key, name)
+	return fn(conn)
+}
+
+func acquireMigrationsLock(ctx context.Context, conn *sql.Conn, key int64, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		var ok bool
+		if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&ok); err != nil {
+			return fmt.Errorf("migrations lock: %w", err)
+		}
+		if ok {
+			vprintf("dbconf: acquired migrations lock on %s\n", name)
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("%w on %s (gave up waiting for the lock after %s)", ErrMigrationsLocked, name, timeout)
+		}
+		if !waiting {
+			vprintf("dbconf: waiting up to %s for the migrations lock on %s\n", timeout, name)
+			waiting = true
+		}
+		wait := migrationsLockPoll
+		if left := time.Until(deadline); left < wait {
+			wait = left
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w on %s: %w", ErrMigrationsLocked, name, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+// releaseMigrationsLock unlocks even when the caller's context is done. If
+// that fails the connection is discarded rather than returned to the pool,
+// since closing the session is what frees a lock it still holds.
+func releaseMigrationsLock(conn *sql.Conn, key int64, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultConnectTimeout)
+	defer cancel()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, key); err != nil {
+		vprintf("dbconf: releasing migrations lock on %s: %v; closing the connection\n", name, err)
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		return
+	}
+	vprintf("dbconf: released migrations lock on %s\n", name)
+}
@@ -0,0 +1,215 @@
+package dbconf
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// fakePG is just enough of one Postgres database for migrations: advisory
+// locks held per session, public._migrations with its primary key, and a
+// count of how often each migration's SQL ran.
+type fakePG struct {
+	mu      sync.Mutex
+	nextID  int
+	locks   map[int64]int // key -> holding session
+	applied map[string]bool
+	runs    map[string]int
+}
+
+func newFakePG() *fakePG {
+	return &fakePG{locks: map[int64]int{}, applied: map[string]bool{}, runs: map[string]int{}}
+}
+
+func (s *fakePG) Connect(context.Context) (driver.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	return &fakeConn{srv: s, id: s.nextID}, nil
+}
+
+func (s *fakePG) Driver() driver.Driver { return nil }
+
+type fakeConn struct {
+	srv *fakePG
+	id  int
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+// Close ends the session, which frees its advisory locks.
+func (c *fakeConn) Close() error {
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+	for k, id := range c.srv.locks {
+		if id == c.id {
+			delete(c.srv.locks, k)
+		}
+	}
+	return nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s := c.srv
+	switch {
+	case strings.HasPrefix(query, `CREATE TABLE IF NOT EXISTS "public"."_migrations"`):
+	case strings.HasPrefix(query, "SELECT pg_advisory_unlock"):
+		s.mu.Lock()
+		if s.locks[args[0].Value.(int64)] == c.id {
+			delete(s.locks, args[0].Value.(int64))
+		}
+		s.mu.Unlock()
+	case strings.HasPrefix(query, `INSERT INTO "public"."_migrations"`):
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		id := args[0].Value.(string)
+		if s.applied[id] {
+			return nil, fmt.Errorf("duplicate key value violates unique constraint \"_migrations_pkey\": %s", id)
+		}
+		s.applied[id] = true
+	case strings.Contains(query, "SELEC "):
+		// A typo, reported with its position as the server would.
+		pos := len([]rune(query[:strings.Index(query, "SELEC ")])) + 1
+		return nil, &pq.Error{Severity: "ERROR", Code: "42601", Message: `syntax error at or near "SELEC"`, Position: strconv.Itoa(pos)}
+	default:
+		// Migration SQL; take a while, as DDL does, to widen any race.
+		time.Sleep(20 * time.Millisecond)
+		s.mu.Lock()
+		s.runs[query]++
+		s.mu.Unlock()
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s := c.srv
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case query == "SELECT current_database()":
+		return &fakeRows{cols: []string{"current_database"}, vals: [][]driver.Value{{"app"}}}, nil
+	case strings.HasPrefix(query, "SELECT pg_try_advisory_lock"):
+		key := args[0].Value.(int64)
+		holder, held := s.locks[key]
+		ok := !held || holder == c.id
+		if ok {
+			s.locks[key] = c.id
+		}
+		return &fakeRows{cols: []string{"pg_try_advisory_lock"}, vals: [][]driver.Value{{ok}}}, nil
+	case query == `SELECT id FROM "public"."_migrations"`:
+		rows := &fakeRows{cols: []string{"id"}}
+		for id := range s.applied {
+			rows.vals = append(rows.vals, []driver.Value{id})
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("fakePG: unexpected query %q", query)
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	cols []string
+	vals [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.vals) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.vals[0])
+	r.vals = r.vals[1:]
+	return nil
+}
+
+func useFakeMigrationsLock(t *testing.T) {
+	t.Helper()
+	useDatabaseURL(t, "postgres://u:p@127.0.0.1:1/app?sslmode=disable")
+	old := migrationsLockPoll
+	migrationsLockPoll = 5 * time.Millisecond
+	t.Cleanup(func() { migrationsLockPoll = old })
+}
+
+func TestApplyMigrationsConcurrent(t *testing.T) {
+	useFakeMigrationsLock(t)
+	srv := newFakePG()
+	migs := []Migration{
+		{ID: "001_users.sql", SQL: "CREATE TABLE users ()"},
+		{ID: "002_posts.sql", SQL: "CREATE TABLE posts ()"},
+		{ID: "003_tags.sql", SQL: "CREATE TABLE tags ()"},
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			db := sql.OpenDB(srv)
+			defer db.Close()
+			own := append([]Migration(nil), migs...)
+			errs[i] = ApplyMigrationsDB(context.Background(), db, own)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("applier %d: %v", i, err)
+		}
+	}
+	for _, m := range migs {
+		if n := srv.runs[m.SQL]; n != 1 {
+			t.Errorf("%s ran %d times, want once", m.ID, n)
+		}
+		if !srv.applied[m.ID] {
+			t.Errorf("%s not recorded", m.ID)
+		}
+	}
+	if len(srv.locks) != 0 {
+		t.Errorf("locks still held: %v", srv.locks)
+	}
+}
+
+func TestApplyMigrationsLocked(t *testing.T) {
+	useFakeMigrationsLock(t)
+	t.Setenv("DB_MIGRATIONS_LOCK_TIMEOUT", "50ms")
+	srv := newFakePG()
+	srv.locks[migrationsLockKey("app")] = -1 // another process
+	db := sql.OpenDB(srv)
+	defer db.Close()
+
+	start := time.Now()
+	err := ApplyMigrationsDB(context.Background(), db, []Migration{{ID: "001_users.sql", SQL: "CREATE TABLE users ()"}})
+	if !errors.Is(err, ErrMigrationsLocked) {
+		t.Fatalf("err = %v, want ErrMigrationsLocked", err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond || d > 2*time.Second {
+		t.Errorf("gave up after %s, want about 50ms", d)
+	}
+	if len(srv.runs) != 0 || len(srv.applied) != 0 {
+		t.Errorf("migrations ran without the lock: runs=%v applied=%v", srv.runs, srv.applied)
+	}
+
+	t.Setenv("DB_MIGRATIONS_LOCK_TIMEOUT", "soon")
+	Reload()
+	if err := ApplyMigrationsDB(context.Background(), db, nil); err == nil || !strings.Contains(err.Error(), "DB_MIGRATIONS_LOCK_TIMEOUT") {
+		t.Errorf("invalid timeout: err = %v", err)
+	}
+}
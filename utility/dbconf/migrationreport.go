@@ -0,0 +1,94 @@
+package dbconf
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MigrationResult is what happened to one migration in a run. A migration
+// that was already applied has Applied false and no Err.
+type MigrationResult struct {
+	ID       string
+	Applied  bool
+	Duration time.Duration
+	Err      error
+}
+
+// ApplyMigrationsReport is ApplyMigrations that also returns a result per
+// migration, in ID order, up to and including the one that failed.
+func ApplyMigrationsReport(ctx context.Context, dbname string, migrations []Migration) ([]MigrationResult, error) {
+	db, err := ConnectDBAsContext(ctx, dbname)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return ApplyMigrationsDBReport(ctx, db, migrations)
+}
+
+// ApplyMigrationsDBReport is ApplyMigrationsDB that also returns a result
+// per migration, as ApplyMigrationsReport does.
+func ApplyMigrationsDBReport(ctx context.Context, db *sql.DB, migrations []Migration) ([]MigrationResult, error) {
+	l, err := migrationsLedger()
+	if err != nil {
+		return nil, err
+	}
+	var results []MigrationResult
+	err = withMigrationsLock(ctx, db, func(conn *sql.Conn) error {
+		var err error
+		results, err = applyMigrations(ctx, conn, l, migrations)
+		return err
+	})
+	return results, err
+}
+
+// ApplyConfiguredMigrationsReport is ApplyConfiguredMigrations that also
+// returns a result per migration; both are nil when the migrations
+// directory does not exist.
+func ApplyConfiguredMigrationsReport(ctx context.Context, dbname string) ([]MigrationResult, error) {
+	dir, err := ConfiguredMigrationsDir()
+	if err != nil {
+		return nil, err
+	}
+	vprintf("dbconf: ApplyConfiguredMigrations db=%q dir=%q\n", dbname, dir)
+	migs, err := ReadMigrationsDir(dir)
+	if err != nil || migs == nil {
+		return nil, err
+	}
+	return ApplyMigrationsReport(ctx, dbname, migs)
+}
+
+// statementExcerpt picks the line of script an error refers to: the line of
+// the position the server reported, else the first line that is not blank
+// or a comment. It is trimmed and cut to 80 characters.
+func statementExcerpt(script string, err error) string {
+	lines := strings.Split(script, "\n")
+	line := ""
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if pos, perr := strconv.Atoi(pqErr.Position); perr == nil && pos >= 1 {
+			runes := []rune(script)
+			if pos <= len(runes) {
+				line = lines[strings.Count(string(runes[:pos-1]), "\n")]
+			}
+		}
+	}
+	if strings.TrimSpace(line) == "" {
+		for _, l := range lines {
+			if t := strings.TrimSpace(l); t != "" && !strings.HasPrefix(t, "--") {
+				line = l
+				break
+			}
+		}
+	}
+	line = strings.TrimSpace(line)
+	if r := []rune(line); len(r) > 80 {
+		line = string(r[:77]) + "..."
+	}
+	return line
+}
@@ -0,0 +1,76 @@
+package dbconf
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestApplyMigrationsReport(t *testing.T) {
+	useFakeMigrationsLock(t)
+	srv := newFakePG()
+	srv.applied["001_users.sql"] = true
+	db := sql.OpenDB(srv)
+	defer db.Close()
+
+	migs := []Migration{
+		{ID: "003_never.sql", SQL: "CREATE TABLE never ()"},
+		{ID: "002_typo.sql", SQL: "-- add posts\nCREATE TABLE posts ();\nSELEC 1;\n"},
+		{ID: "001_users.sql", SQL: "CREATE TABLE users ()"},
+		{ID: "001_zones.sql", SQL: "CREATE TABLE zones ()"},
+	}
+	results, err := ApplyMigrationsDBReport(context.Background(), db, migs)
+	if err == nil {
+		t.Fatal("ApplyMigrationsDBReport succeeded despite the typo")
+	}
+	if msg := err.Error(); !strings.Contains(msg, "002_typo.sql") || !strings.Contains(msg, `near "SELEC 1;"`) {
+		t.Errorf("error %q should name the migration and the failing line", msg)
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "42601" {
+		t.Errorf("error %v does not unwrap to the server error", err)
+	}
+
+	want := []struct {
+		id      string
+		applied bool
+		failed  bool
+	}{
+		{"001_users.sql", false, false},
+		{"001_zones.sql", true, false},
+		{"002_typo.sql", false, true},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results %+v, want %d", len(results), results, len(want))
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.ID != w.id || r.Applied != w.applied || (r.Err != nil) != w.failed {
+			t.Errorf("result %d = %+v, want ID %s applied %t failed %t", i, r, w.id, w.applied, w.failed)
+		}
+		if w.applied && r.Duration <= 0 {
+			t.Errorf("%s: no duration recorded", r.ID)
+		}
+	}
+}
+
+func TestStatementExcerpt(t *testing.T) {
+	script := "-- comment\n\n  CREATE TABLE a ();\nSELECT nope;\n"
+	if got := statementExcerpt(script, errors.New("boom")); got != "CREATE TABLE a ();" {
+		t.Errorf("without a position: %q", got)
+	}
+	pos := strings.Index(script, "nope") + 1
+	err := &pq.Error{Position: strconv.Itoa(pos)}
+	if got := statementExcerpt(script, err); got != "SELECT nope;" {
+		t.Errorf("with position %d: %q", pos, got)
+	}
+	long := strings.Repeat("x", 100)
+	if got := statementExcerpt(long, nil); len(got) != 80 || !strings.HasSuffix(got, "...") {
+		t.Errorf("long line excerpt = %q", got)
+	}
+}
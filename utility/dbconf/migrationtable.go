@@ -0,0 +1,85 @@
+package dbconf
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// DefaultMigrationsTable is the ledger of applied migrations when
+// DB_MIGRATIONS_TABLE is not set.
+const DefaultMigrationsTable = "public._migrations"
+
+// ledger is the schema-qualified table recording applied migrations.
+type ledger struct {
+	schema, table string
+}
+
+var defaultLedger = ledger{"public", "_migrations"}
+
+// parseMigrationsTable reads DB_MIGRATIONS_TABLE, "table" or
+// "schema.table"; a bare table lives in public. Names are used as written,
+// case included, and quoted in SQL.
+func parseMigrationsTable(v string) (ledger, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return defaultLedger, nil
+	}
+	parts := strings.Split(v, ".")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return ledger{"public", parts[0]}, nil
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return ledger{parts[0], parts[1]}, nil
+	}
+	return ledger{}, fmt.Errorf("invalid DB_MIGRATIONS_TABLE %q: want table or schema.table", v)
+}
+
+func (l ledger) String() string { return l.schema + "." + l.table }
+
+// ident is the quoted, schema-qualified name for SQL.
+func (l ledger) ident() string {
+	return pq.QuoteIdentifier(l.schema) + "." + pq.QuoteIdentifier(l.table)
+}
+
+// migrationsLedger is the configured ledger.
+func migrationsLedger() (ledger, error) {
+	cfg, err := load()
+	if err != nil {
+		return ledger{}, err
+	}
+	return parseMigrationsTable(cfg.MigrationsTable)
+}
+
+// ensureMigrationsTable creates the ledger, and its schema unless that is
+// public or already there (CREATE SCHEMA IF NOT EXISTS still needs the
+// CREATE privilege on the database).
+func ensureMigrationsTable(ctx context.Context, db migrationsDB, l ledger) error {
+	if l.schema != "public" {
+		rows, err := db.QueryContext(ctx, `SELECT 1 FROM pg_namespace WHERE nspname = $1`, l.schema)
+		if err != nil {
+			return err
+		}
+		exists := rows.Next()
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if !exists {
+			vprintf("dbconf: creating schema %s for the migrations table\n", l.schema)
+			if _, err := db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+pq.QuoteIdentifier(l.schema)); err != nil {
+				return fmt.Errorf("create schema for migrations table %s: %w", l, err)
+			}
+		}
+	}
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+l.ident()+` (
+		id text PRIMARY KEY,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`)
+	return err
+}
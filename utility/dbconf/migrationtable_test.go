@@ -0,0 +1,86 @@
+package dbconf
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestParseMigrationsTable(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                   `"public"."_migrations"`,
+		"schema_migrations":  `"public"."schema_migrations"`,
+		" ops . _migrations": `"ops"."_migrations"`,
+		`Ops."my table"`:     `"Ops"."""my table"""`,
+	} {
+		l, err := parseMigrationsTable(in)
+		if err != nil || l.ident() != want {
+			t.Errorf("parseMigrationsTable(%q) = %s, %v; want %s", in, l.ident(), err, want)
+		}
+	}
+	for _, bad := range []string{".", "ops.", ".t", "a.b.c"} {
+		if _, err := parseMigrationsTable(bad); err == nil {
+			t.Errorf("parseMigrationsTable(%q) accepted", bad)
+		}
+	}
+}
+
+func TestMigrationsTableSetting(t *testing.T) {
+	useDatabaseURL(t, "postgres://u@db.example/app")
+	t.Setenv("DB_MIGRATIONS_TABLE", "ops._migrations")
+	cfg, err := load()
+	if err != nil || cfg.MigrationsTable != "ops._migrations" {
+		t.Fatalf("MigrationsTable = %q, %v", cfg.MigrationsTable, err)
+	}
+	t.Setenv("DB_MIGRATIONS_TABLE", "a.b.c")
+	Reload()
+	if _, err := load(); err == nil {
+		t.Error("an invalid DB_MIGRATIONS_TABLE loaded without error")
+	}
+}
+
+func TestMigrationsInOpsSchema(t *testing.T) {
+	ops := ledger{"ops", "_migrations"}
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Apply: the schema is missing, so it is created before the table.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT 1 FROM pg_namespace WHERE nspname = $1`)).WithArgs("ops").
+		WillReturnRows(sqlmock.NewRows([]string{"?column?"}))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE SCHEMA IF NOT EXISTS "ops"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "ops"."_migrations"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM "ops"."_migrations"`)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE a").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "ops"."_migrations"`)).WithArgs("001_a.sql").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	migs := []Migration{{ID: "001_a.sql", SQL: "CREATE TABLE a ()", Down: "DROP TABLE a", HasDown: true}}
+	if _, err := applyMigrations(ctx, db, ops, migs); err != nil {
+		t.Fatal(err)
+	}
+
+	// Roll back: the schema exists now, so it is left alone.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT 1 FROM pg_namespace WHERE nspname = $1`)).WithArgs("ops").
+		WillReturnRows(sqlmock.NewRows([]string{"?column?"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "ops"."_migrations"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM "ops"."_migrations" ORDER BY applied_at DESC`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("001_a.sql"))
+	mock.ExpectBegin()
+	mock.ExpectExec("DROP TABLE a").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "ops"."_migrations"`)).WithArgs("001_a.sql").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	done, err := rollbackDB(ctx, db, ops, migs, func(applied []string) ([]string, error) { return applied, nil })
+	if err != nil || !reflect.DeepEqual(done, []string{"001_a.sql"}) {
+		t.Errorf("rolled back %q, err %v", done, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,271 @@
+package dbconf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+	"golang.org/x/term"
+)
+
+// Password sources, as reported by verbose output.
+const (
+	PasswordFromEnv    = "env"
+	PasswordFromConfig = "config"
+	PasswordFromFile   = "file"
+	PasswordFromURL    = "url"
+	PasswordFromPgpass = "pgpass"
+	PasswordFromPrompt = "prompt"
+)
+
+var (
+	promptMu  sync.Mutex
+	prompted  = map[string]string{}
+	stdinTerm = func() bool { return term.IsTerminal(int(os.Stdin.Fd())) }
+)
+
+// endpoint is what a password is looked up for: the pgpass fields and the
+// key for passwords typed at the prompt.
+type endpoint struct {
+	host, port, dbname, user string
+}
+
+func (e endpoint) promptKey() string { return e.user + "@" + e.host + ":" + e.port }
+
+// endpointFor describes a connection to dbname ("" for the configured
+// database) with libpq's defaults for an unset host (localhost), port (5432)
+// and user (PGUSER, else the OS user).
+func (c *DBConfig) endpointFor(dbname string) endpoint {
+	e := endpoint{host: c.Host, port: c.Port, dbname: dbname, user: c.User}
+	if e.dbname == "" {
+		e.dbname = c.Name
+	}
+	if u := strings.TrimSpace(c.URL); u != "" {
+		e = endpoint{dbname: dbname}
+		if f, ok := dsnFields(u); ok {
+			e.host, e.port, e.user = f["host"], f["port"], f["user"]
+			if e.dbname == "" {
+				e.dbname = f["dbname"]
+			}
+		}
+	}
+	return e.withDefaults()
+}
+
+func (e endpoint) withDefaults() endpoint {
+	if e.host == "" || strings.HasPrefix(e.host, "/") {
+		e.host = "localhost"
+	}
+	if e.port == "" {
+		e.port = "5432"
+	}
+	if e.user == "" {
+		e.user = os.Getenv("PGUSER")
+	}
+	if e.user == "" {
+		if u, err := user.Current(); err == nil {
+			e.user = u.Username
+		}
+	}
+	return e
+}
+
+// hasPassword reports whether the configuration carries a password.
+func (c *DBConfig) hasPassword() bool {
+	if u := strings.TrimSpace(c.URL); u != "" {
+		if isKeywordDSN(u) {
+			pairs, _ := parseKeywordDSN(u)
+			for _, p := range pairs {
+				if p.key == "password" {
+					return true
+				}
+			}
+			return false
+		}
+		pu, err := url.Parse(u)
+		if err != nil || pu.User == nil {
+			return false
+		}
+		_, ok := pu.User.Password()
+		return ok
+	}
+	return c.Password != ""
+}
+
+// setPassword stores pw for the connection, inside the URL when one is
+// configured.
+func (c *DBConfig) setPassword(e endpoint, pw string) {
+	if u := strings.TrimSpace(c.URL); u != "" {
+		if isKeywordDSN(u) {
+			c.URL = setKeywordParam(u, "password", pw)
+		} else if pu, err := url.Parse(u); err == nil {
+			pu.User = url.UserPassword(e.user, pw)
+			c.URL = pu.String()
+		}
+		return
+	}
+	c.Password = pw
+}
+
+// fillPassword supplies a password the configuration lacks, from an earlier
+// prompt for the same user and server or from the pgpass file, and reports
+// the source in verbose mode (never the value).
+func (c *DBConfig) fillPassword(dbname string) {
+	if c.hasPassword() {
+		vprintf("dbconf: password from %s\n", c.passwordSource)
+		return
+	}
+	e := c.endpointFor(dbname)
+	promptMu.Lock()
+	pw, ok := prompted[e.promptKey()]
+	promptMu.Unlock()
+	if ok {
+		c.setPassword(e, pw)
+		c.passwordSource = PasswordFromPrompt
+		vprintf("dbconf: password from %s\n", c.passwordSource)
+		return
+	}
+	if pw, path, ok := pgpassLookup(e); ok {
+		c.setPassword(e, pw)
+		c.passwordSource = PasswordFromPgpass
+		vprintf("dbconf: password from %s (%s)\n", c.passwordSource, path)
+		return
+	}
+	vprintln("dbconf: no password configured")
+}
+
+// shouldPrompt reports whether a failed connection should be retried after
+// asking for a password: the server rejected the login, none was supplied
+// from any source, and stdin is a terminal.
+func (c *DBConfig) shouldPrompt(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "28P01" {
+		return false
+	}
+	return c.passwordSource == "" && stdinTerm()
+}
+
+// promptPassword asks for the password without echo, like psql. Concurrent
+// connections to the same server share one prompt.
+func (c *DBConfig) promptPassword(dbname string) error {
+	e := c.endpointFor(dbname)
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	pw, ok := prompted[e.promptKey()]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Password for user %s: ", e.user)
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return fmt.Errorf("read password: %w", err)
+		}
+		pw = string(b)
+		prompted[e.promptKey()] = pw
+	}
+	c.setPassword(e, pw)
+	c.passwordSource = PasswordFromPrompt
+	vprintf("dbconf: password from %s\n", c.passwordSource)
+	return nil
+}
+
+// PromptedPassword returns the password typed at a dbconf prompt for user on
+// host:port during this run, so external tools started later (psql,
+// pg_dump) need not ask again.
+func PromptedPassword(host, port, user string) (string, bool) {
+	e := endpoint{host: host, port: port, user: user}.withDefaults()
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	pw, ok := prompted[e.promptKey()]
+	return pw, ok
+}
+
+// pgpassPath is PGPASSFILE, else ~/.pgpass.
+func pgpassPath() string {
+	if p := os.Getenv("PGPASSFILE"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".pgpass")
+}
+
+// pgpassLookup returns the password of the first pgpass line matching e.
+// As with libpq, a file readable by group or others is ignored.
+func pgpassLookup(e endpoint) (pw, path string, ok bool) {
+	path = pgpassPath()
+	if path == "" {
+		return "", "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", path, false
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		fmt.Fprintf(os.Stderr, "dbconf: ignoring %s: permissions should be u=rw (0600) or less\n", path)
+		return "", path, false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", path, false
+	}
+	defer f.Close()
+	pw, ok = matchPgpass(bufio.NewScanner(f), e)
+	return pw, path, ok
+}
+
+// matchPgpass scans hostname:port:database:username:password lines, where
+// each of the first four fields may be * and \ escapes : and \.
+func matchPgpass(sc *bufio.Scanner, e endpoint) (string, bool) {
+	want := []string{e.host, e.port, e.dbname, e.user}
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitPgpassLine(line)
+		if len(fields) != 5 {
+			continue
+		}
+		match := true
+		for i, w := range want {
+			if fields[i] != "*" && fields[i] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return fields[4], true
+		}
+	}
+	return "", false
+}
+
+func splitPgpassLine(line string) []string {
+	var fields []string
+	var cur strings.Builder
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ':' && len(fields) < 4:
+			fields = append(fields, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	return append(fields, cur.String())
+}
@@ -0,0 +1,117 @@
+package dbconf
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PoolConfig tunes the connection pool of every *sql.DB dbconf opens, from
+// DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME and
+// DB_CONN_MAX_IDLE_TIME. Zero fields keep database/sql's defaults:
+// unlimited open connections, 2 idle ones and no lifetime limits.
+type PoolConfig struct {
+	MaxOpenConns int
+	// MaxIdleConns < 0 keeps no idle connections (DB_MAX_IDLE_CONNS=0).
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// poolSetting looks key up in the environment, then in config.
+func poolSetting(config map[string]string, key string) string {
+	return strings.TrimSpace(firstNonEmpty(getenv(key), config[key]))
+}
+
+// loadPoolConfig reads the pool settings. A value that is not a
+// non-negative integer (or duration, like 30m) is an error rather than
+// being ignored.
+func loadPoolConfig(config map[string]string) (PoolConfig, error) {
+	var p PoolConfig
+	count := func(key string) (int, bool, error) {
+		v := poolSetting(config, key)
+		if v == "" {
+			return 0, false, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, false, fmt.Errorf("invalid %s %q: want a whole number >= 0", key, v)
+		}
+		return n, true, nil
+	}
+	duration := func(key string) (time.Duration, error) {
+		v := poolSetting(config, key)
+		if v == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("invalid %s %q: want a duration such as 30m or 90s", key, v)
+		}
+		return d, nil
+	}
+	var err error
+	if p.MaxOpenConns, _, err = count("DB_MAX_OPEN_CONNS"); err != nil {
+		return p, err
+	}
+	n, set, err := count("DB_MAX_IDLE_CONNS")
+	if err != nil {
+		return p, err
+	}
+	p.MaxIdleConns = n
+	if set && n == 0 {
+		p.MaxIdleConns = -1
+	}
+	if p.ConnMaxLifetime, err = duration("DB_CONN_MAX_LIFETIME"); err != nil {
+		return p, err
+	}
+	if p.ConnMaxIdleTime, err = duration("DB_CONN_MAX_IDLE_TIME"); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// apply sets p on db and reports the effective values in verbose mode.
+func (p PoolConfig) apply(db *sql.DB) {
+	if p.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+	if p.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+	}
+	vprintf("dbconf: pool %s\n", p)
+}
+
+// String describes the pool as database/sql will run it: idle connections
+// are capped by the open limit, and 2 idle are kept by default.
+func (p PoolConfig) String() string {
+	open, idle := "unlimited", 2
+	if p.MaxOpenConns > 0 {
+		open = strconv.Itoa(p.MaxOpenConns)
+	}
+	switch {
+	case p.MaxIdleConns < 0:
+		idle = 0
+	case p.MaxIdleConns > 0:
+		idle = p.MaxIdleConns
+	}
+	if p.MaxOpenConns > 0 && idle > p.MaxOpenConns {
+		idle = p.MaxOpenConns
+	}
+	limit := func(d time.Duration) string {
+		if d == 0 {
+			return "none"
+		}
+		return d.String()
+	}
+	return fmt.Sprintf("max_open_conns=%s max_idle_conns=%d conn_max_lifetime=%s conn_max_idle_time=%s",
+		open, idle, limit(p.ConnMaxLifetime), limit(p.ConnMaxIdleTime))
+}
@@ -0,0 +1,59 @@
+package dbconf
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPoolConfig(t *testing.T) {
+	clearDBEnv(t)
+	t.Setenv("DB_MAX_OPEN_CONNS", "8")
+	t.Setenv("DB_CONN_MAX_IDLE_TIME", "90s")
+	config := map[string]string{"DB_MAX_OPEN_CONNS": "99", "DB_MAX_IDLE_CONNS": "0", "DB_CONN_MAX_LIFETIME": "30m"}
+	p, err := loadPoolConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PoolConfig{MaxOpenConns: 8, MaxIdleConns: -1, ConnMaxLifetime: 30 * time.Minute, ConnMaxIdleTime: 90 * time.Second}
+	if p != want {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+
+	for key, bad := range map[string]string{
+		"DB_MAX_OPEN_CONNS":     "ten",
+		"DB_MAX_IDLE_CONNS":     "-1",
+		"DB_CONN_MAX_LIFETIME":  "30",
+		"DB_CONN_MAX_IDLE_TIME": "-5s",
+	} {
+		clearDBEnv(t)
+		t.Setenv(key, bad)
+		if _, err := loadPoolConfig(nil); err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("%s=%q: err = %v, want an error naming the key", key, bad, err)
+		}
+	}
+	t.Setenv("DBTOOL_CONFIG_FILE", "")
+	if _, err := GetDBConfig(); err == nil {
+		t.Error("GetDBConfig accepted an invalid pool setting")
+	}
+}
+
+func TestPoolConfigApply(t *testing.T) {
+	db, err := sql.Open("postgres", "host=localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	p := PoolConfig{MaxOpenConns: 4, MaxIdleConns: 10}
+	p.apply(db)
+	if got := db.Stats().MaxOpenConnections; got != 4 {
+		t.Errorf("MaxOpenConnections = %d, want 4", got)
+	}
+	if want := "max_open_conns=4 max_idle_conns=4 conn_max_lifetime=none conn_max_idle_time=none"; p.String() != want {
+		t.Errorf("String() = %q, want %q", p.String(), want)
+	}
+	if want := "max_open_conns=unlimited max_idle_conns=2 conn_max_lifetime=none conn_max_idle_time=none"; (PoolConfig{}).String() != want {
+		t.Errorf("zero String() = %q, want %q", PoolConfig{}.String(), want)
+	}
+}
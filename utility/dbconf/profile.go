@@ -0,0 +1,62 @@
+package dbconf
+
+import (
+	"strings"
+	"sync"
+)
+
+// LoadOptions changes how dbconf finds its configuration. The zero value
+// is the default behavior.
+type LoadOptions struct {
+	// Profile selects a config.ini section, such as "staging" for
+	// [staging]; keys it does not set come from [default]. Empty means
+	// DBTOOL_PROFILE, else [default] alone.
+	Profile string
+	// DisableDotEnv skips reading .env files, as DBCONF_NO_DOTENV=1 does,
+	// for tools that must only see the environment and config.ini.
+	DisableDotEnv bool
+}
+
+var (
+	loadOptsMu sync.Mutex
+	loadOpts   LoadOptions
+)
+
+// SetLoadOptions replaces the options every later configuration load uses,
+// e.g. from a tool's --profile flag, and drops the cached configuration.
+func SetLoadOptions(opts LoadOptions) {
+	opts.Profile = strings.TrimSpace(opts.Profile)
+	loadOptsMu.Lock()
+	loadOpts = opts
+	loadOptsMu.Unlock()
+	Reload()
+}
+
+func currentLoadOptions() LoadOptions {
+	loadOptsMu.Lock()
+	defer loadOptsMu.Unlock()
+	return loadOpts
+}
+
+// activeProfile returns the selected profile ("" for [default] alone) as a
+// Setting saying where the choice came from.
+func activeProfile() Setting {
+	st := Setting{Name: "profile", Value: "default", Source: "default"}
+	if p := currentLoadOptions().Profile; p != "" {
+		st.Value, st.Source, st.Key = p, "flag", "--profile"
+	} else if v, f := envSource("DBTOOL_PROFILE"); strings.TrimSpace(v) != "" {
+		st.Value, st.Source, st.Key = strings.TrimSpace(v), "env", "DBTOOL_PROFILE"
+		if f != "" {
+			st.Source, st.File = ".env", f
+		}
+	}
+	return st
+}
+
+// profileName is the config.ini section to overlay on [default], or "".
+func profileName() string {
+	if p := activeProfile().Value; p != "default" {
+		return p
+	}
+	return ""
+}
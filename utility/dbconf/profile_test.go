@@ -0,0 +1,81 @@
+package dbconf
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	clearDBEnv(t)
+	t.Setenv("DBTOOL_PROFILE", "")
+	t.Cleanup(func() { SetLoadOptions(LoadOptions{}) })
+	dir := t.TempDir()
+	ini := writeFile(t, filepath.Join(dir, "config.ini"), `HOST=tophost
+[default]
+DB_USER=app
+DB_PASSWORD=default-secret
+CLOUDFLARE_API_KEY=cf-default
+[staging]
+DB_HOST=staging.internal
+DB_PASSWORD_FILE=`+writeFile(t, filepath.Join(dir, "staging-pw"), "staging-secret\n")+`
+[prod]
+DB_HOST=prod.internal
+CLOUDFLARE_API_KEY=cf-prod
+`)
+	t.Setenv("DBTOOL_CONFIG_FILE", ini)
+
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "tophost" || cfg.Password != "default-secret" {
+		t.Errorf("no profile: host %q password %q, want [default] only", cfg.Host, cfg.Password)
+	}
+
+	t.Setenv("DBTOOL_PROFILE", "staging")
+	Reload()
+	if cfg, err = load(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "staging.internal" || cfg.User != "app" || cfg.Password != "staging-secret" {
+		t.Errorf("staging: host %q user %q password %q, want the profile over [default]", cfg.Host, cfg.User, cfg.Password)
+	}
+	settings, err := ResolveSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]Setting{}
+	for _, s := range settings {
+		byName[s.Name] = s
+	}
+	if p := byName["profile"]; p.Value != "staging" || p.Source != "env" || p.Key != "DBTOOL_PROFILE" {
+		t.Errorf("profile setting = %+v", p)
+	}
+	if h := byName["host"]; h.Section != "staging" || h.Key != "DB_HOST" {
+		t.Errorf("host setting = %+v, want DB_HOST from [staging]", h)
+	}
+	if u := byName["user"]; u.Section != "" {
+		t.Errorf("user setting = %+v, want it from [default]", u)
+	}
+
+	SetLoadOptions(LoadOptions{Profile: "prod"})
+	if cfg, _ = load(); cfg.Host != "prod.internal" {
+		t.Errorf("LoadOptions.Profile should beat DBTOOL_PROFILE: host %q", cfg.Host)
+	}
+	raw, err := GetRawConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw["CLOUDFLARE_API_KEY"] != "cf-prod" || raw["DB_USER"] != "app" {
+		t.Errorf("GetRawConfig with prod = %v", raw)
+	}
+
+	SetLoadOptions(LoadOptions{Profile: "prdo"})
+	if _, err := load(); err == nil || !strings.Contains(err.Error(), `profile "prdo": no [prdo] section`) {
+		t.Errorf("unknown profile: err = %v", err)
+	}
+	if _, err := GetRawConfig(); err == nil {
+		t.Error("GetRawConfig ignored the unknown profile")
+	}
+}
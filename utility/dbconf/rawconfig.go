@@ -0,0 +1,100 @@
+package dbconf
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RawValue is one key of GetRawConfigWithSources and where its value came
+// from. Its String and GoString hide secret-looking values, so it can be
+// logged; Value itself is never redacted.
+type RawValue struct {
+	Key     string
+	Value   string
+	Source  string // env, .env, config.ini or file (a <KEY>_FILE secret)
+	File    string // .env, config.ini or secret file path, when applicable
+	Section string // config.ini section, when a profile's
+}
+
+func (v RawValue) String() string {
+	s := v.Key + "=" + v.displayValue() + " (" + v.Source
+	if v.File != "" {
+		s += " " + v.File
+	}
+	if v.Section != "" {
+		s += " [" + v.Section + "]"
+	}
+	return s + ")"
+}
+
+// GoString keeps %#v from printing the value in the clear.
+func (v RawValue) GoString() string {
+	return fmt.Sprintf("dbconf.RawValue{Key:%q, Value:%q, Source:%q, File:%q, Section:%q}",
+		v.Key, v.displayValue(), v.Source, v.File, v.Section)
+}
+
+func (v RawValue) displayValue() string {
+	switch {
+	case v.Value == "":
+		return ""
+	case isSecretKey(v.Key):
+		return "********"
+	case strings.Contains(v.Value, "://") || isKeywordDSN(v.Value):
+		return RedactDSN(v.Value)
+	}
+	return v.Value
+}
+
+// isSecretKey reports whether key looks like it holds a credential, such as
+// DB_PASSWORD, CLOUDFLARE_API_KEY or GITHUB_TOKEN.
+func isSecretKey(key string) bool {
+	k := strings.ToUpper(key)
+	for _, w := range []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "CREDENTIAL", "PRIVATE"} {
+		if strings.Contains(k, w) {
+			return true
+		}
+	}
+	return strings.HasSuffix(k, "KEY") || strings.HasSuffix(k, "_PASS") || strings.HasSuffix(k, "_PW")
+}
+
+// GetRawConfigWithSources is GetRawConfig with the origin of each value:
+// config.ini's keys (with <KEY>_FILE secrets resolved), overridden by the
+// non-blank variables of the process environment and of the .env files,
+// the same precedence as the database settings.
+func GetRawConfigWithSources() (map[string]RawValue, error) {
+	s := currentState()
+	config, configPath, secretFiles, err := s.ini()
+	if err != nil {
+		return nil, err
+	}
+	section := profileName()
+	out := make(map[string]RawValue, len(config))
+	for k, v := range config {
+		rv := RawValue{Key: k, Value: v, Source: "config.ini", File: configPath}
+		if f := secretFiles[k]; f != "" {
+			rv.Source, rv.File = "file", f
+		}
+		if s.fromProfile[k] {
+			rv.Section = section
+		}
+		out[k] = rv
+	}
+	for k, d := range s.dotEnv {
+		if _, set := os.LookupEnv(k); !set && strings.TrimSpace(d.value) != "" {
+			out[k] = RawValue{Key: k, Value: d.value, Source: ".env", File: d.file}
+		}
+	}
+	for _, kv := range os.Environ() {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" || strings.TrimSpace(v) == "" {
+			continue
+		}
+		rv := RawValue{Key: k, Value: v, Source: "env"}
+		if f := envOrigin(k); f != "" {
+			rv.Source, rv.File = ".env", f
+		}
+		out[k] = rv
+	}
+	return out, nil
+}
@@ -0,0 +1,62 @@
+package dbconf
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetRawConfigMergesEnvironment(t *testing.T) {
+	clearDBEnv(t)
+	dir := t.TempDir()
+	ini := writeFile(t, filepath.Join(dir, "config.ini"), "[default]\nCLOUDFLARE_API_KEY=cf-ini\nZONE=example.com\nDB_USER=app\n")
+	t.Setenv("DBTOOL_CONFIG_FILE", ini)
+	t.Setenv("CLOUDFLARE_API_KEY", "cf-env")
+	t.Setenv("RAWCFG_ENV_ONLY", "yes")
+	t.Setenv("DB_USER", "")
+
+	raw, err := GetRawConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw["CLOUDFLARE_API_KEY"] != "cf-env" || raw["ZONE"] != "example.com" || raw["RAWCFG_ENV_ONLY"] != "yes" {
+		t.Errorf("GetRawConfig = CLOUDFLARE_API_KEY %q ZONE %q RAWCFG_ENV_ONLY %q, want the environment over config.ini",
+			raw["CLOUDFLARE_API_KEY"], raw["ZONE"], raw["RAWCFG_ENV_ONLY"])
+	}
+	if raw["DB_USER"] != "app" {
+		t.Errorf("DB_USER = %q, want config.ini's: an empty variable does not override", raw["DB_USER"])
+	}
+
+	srcs, err := GetRawConfigWithSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := srcs["CLOUDFLARE_API_KEY"]; v.Source != "env" || v.File != "" {
+		t.Errorf("CLOUDFLARE_API_KEY = %#v, want from env", v)
+	}
+	if v := srcs["ZONE"]; v.Source != "config.ini" || v.File != ini {
+		t.Errorf("ZONE = %#v, want from %s", v, ini)
+	}
+}
+
+func TestRawValueRedacted(t *testing.T) {
+	for _, c := range []struct {
+		v    RawValue
+		want string
+	}{
+		{RawValue{Key: "CLOUDFLARE_API_KEY", Value: "s3cret", Source: "env"}, "CLOUDFLARE_API_KEY=******** (env)"},
+		{RawValue{Key: "GITHUB_TOKEN", Value: "s3cret", Source: ".env", File: "/app/.env"}, "GITHUB_TOKEN=******** (.env /app/.env)"},
+		{RawValue{Key: "DATABASE_URL", Value: "postgres://u:s3cret@h/db", Source: "config.ini", File: "c.ini", Section: "prod"}, "DATABASE_URL=postgres://u:xxxxx@h/db (config.ini c.ini [prod])"},
+		{RawValue{Key: "ZONE", Value: "example.com", Source: "env"}, "ZONE=example.com (env)"},
+	} {
+		for _, out := range []string{c.v.String(), fmt.Sprint(c.v), fmt.Sprintf("%+v", c.v), fmt.Sprintf("%#v", c.v)} {
+			if strings.Contains(out, "s3cret") {
+				t.Errorf("%s leaks the secret: %s", c.v.Key, out)
+			}
+		}
+		if got := c.v.String(); got != c.want {
+			t.Errorf("String() = %q, want %q", got, c.want)
+		}
+	}
+}
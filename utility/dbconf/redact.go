@@ -0,0 +1,219 @@
+package dbconf
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// redactedPassword replaces passwords in RedactDSN's output.
+const redactedPassword = "xxxxx"
+
+// RedactDSN hides the password in a connection string so it can be logged
+// or shown: the password of a postgres:// URL (in its user info or a
+// password query parameter) or the password= of a key=value DSN. A URL too
+// malformed to parse keeps only the part before the password; anything else
+// that cannot be parsed is hidden entirely.
+func RedactDSN(dsn string) string {
+	dsn = strings.TrimSpace(dsn)
+	if dsn == "" {
+		return ""
+	}
+	if i := strings.Index(dsn, "://"); i > 0 && !strings.ContainsAny(dsn[:i], " =") {
+		return redactURL(dsn, i)
+	}
+	pairs, ok := parseKeywordDSN(dsn)
+	if !ok {
+		return "<redacted>"
+	}
+	var b strings.Builder
+	last := 0
+	for _, p := range pairs {
+		if p.key == "password" {
+			b.WriteString(dsn[last:p.valueStart])
+			b.WriteString(redactedPassword)
+			last = p.valueEnd
+		}
+	}
+	b.WriteString(dsn[last:])
+	return b.String()
+}
+
+// parseDSNURL is url.Parse, failing also when an '@' is left in the path:
+// postgres://u:p@ss/word@host/db parses, but as host "ss".
+func parseDSNURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err == nil && strings.Contains(u.Path, "@") {
+		err = errors.New("'@' after the host")
+	}
+	return u, err
+}
+
+// redactURL is RedactDSN for a URL whose scheme ends at i.
+func redactURL(raw string, i int) string {
+	u, err := parseDSNURL(raw)
+	if err != nil {
+		// Unencoded special characters in the password, e.g.
+		// postgres://u:p@ss/word@host/db, defeat url.Parse. Everything
+		// between the first ':' of the user info and the last '@' may be
+		// password, so all of it goes.
+		rest := raw[i+3:]
+		at := strings.LastIndex(rest, "@")
+		if at < 0 || strings.Contains(strings.ToLower(rest[at+1:]), "password=") {
+			return "<redacted>"
+		}
+		user := rest[:at]
+		if colon := strings.Index(user, ":"); colon >= 0 {
+			user = user[:colon+1] + redactedPassword
+		}
+		return raw[:i+3] + user + "@" + rest[at+1:]
+	}
+	if u.User != nil {
+		if _, has := u.User.Password(); has {
+			u.User = url.UserPassword(u.User.Username(), redactedPassword)
+		}
+	}
+	if q := u.Query(); q.Has("password") {
+		q.Set("password", redactedPassword)
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// Describe summarizes where c connects, as host, port, database and user,
+// taken from its DSN when it has one. It never includes the password, so it
+// is safe for logs.
+func Describe(c *DBConfig) string {
+	host, port, name, user := c.Host, c.Port, c.Name, c.User
+	if dsn := strings.TrimSpace(c.URL); dsn != "" {
+		f, ok := dsnFields(dsn)
+		if !ok {
+			return "DSN " + RedactDSN(dsn)
+		}
+		host, port, name, user = f["host"], f["port"], f["dbname"], f["user"]
+	}
+	if isSocketHost(host) && (port == "" || port == "5432") {
+		// The port only names the socket file; show it when it is not the
+		// default.
+		port = ""
+	}
+	var parts []string
+	for _, kv := range [][2]string{{"host", host}, {"port", port}, {"db", name}, {"user", user}} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+"="+kv[1])
+		}
+	}
+	if len(parts) == 0 {
+		return "libpq defaults"
+	}
+	return strings.Join(parts, " ")
+}
+
+// dsnFields extracts host, port, dbname and user from a URL or key=value
+// DSN. A URL's query parameters win over its other parts, as in libpq, so
+// postgres:///app?host=/var/run/postgresql yields the socket directory.
+func dsnFields(dsn string) (map[string]string, bool) {
+	if isURLDSN(dsn) {
+		u, err := parseDSNURL(dsn)
+		if err != nil {
+			return nil, false
+		}
+		f := map[string]string{
+			"host":   u.Hostname(),
+			"port":   u.Port(),
+			"dbname": strings.TrimPrefix(u.Path, "/"),
+		}
+		if u.User != nil {
+			f["user"] = u.User.Username()
+		}
+		q := u.Query()
+		for _, k := range []string{"host", "port", "dbname", "user"} {
+			if q.Has(k) {
+				f[k] = q.Get(k)
+			}
+		}
+		return f, true
+	}
+	pairs, ok := parseKeywordDSN(dsn)
+	if !ok {
+		return nil, false
+	}
+	f := map[string]string{}
+	for _, p := range pairs {
+		f[p.key] = p.value
+	}
+	return f, true
+}
+
+// dsnPair is one key=value of a keyword/value DSN; valueStart and valueEnd
+// locate the value as written, quotes included.
+type dsnPair struct {
+	key, value           string
+	valueStart, valueEnd int
+}
+
+// parseKeywordDSN splits a libpq keyword/value connection string such as
+// host=db user=app password='it\'s secret', honoring single quotes and
+// backslash escapes.
+func parseKeywordDSN(s string) ([]dsnPair, bool) {
+	var pairs []dsnPair
+	i := 0
+	for {
+		for i < len(s) && isDSNSpace(s[i]) {
+			i++
+		}
+		if i == len(s) {
+			return pairs, len(pairs) > 0
+		}
+		start := i
+		for i < len(s) && s[i] != '=' && !isDSNSpace(s[i]) {
+			i++
+		}
+		key := s[start:i]
+		for i < len(s) && isDSNSpace(s[i]) {
+			i++
+		}
+		if key == "" || i == len(s) || s[i] != '=' {
+			return nil, false
+		}
+		i++
+		for i < len(s) && isDSNSpace(s[i]) {
+			i++
+		}
+		p := dsnPair{key: key, valueStart: i}
+		var v strings.Builder
+		if i < len(s) && s[i] == '\'' {
+			i++
+			closed := false
+			for i < len(s) {
+				c := s[i]
+				if c == '\\' && i+1 < len(s) {
+					v.WriteByte(s[i+1])
+					i += 2
+					continue
+				}
+				i++
+				if c == '\'' {
+					closed = true
+					break
+				}
+				v.WriteByte(c)
+			}
+			if !closed {
+				return nil, false
+			}
+		} else {
+			for i < len(s) && !isDSNSpace(s[i]) {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				v.WriteByte(s[i])
+				i++
+			}
+		}
+		p.value, p.valueEnd = v.String(), i
+		pairs = append(pairs, p)
+	}
+}
+
+func isDSNSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
@@ -0,0 +1,82 @@
+package dbconf
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/url"
+)
+
+// readConfig is the configuration of the read replica: DATABASE_READ_URL
+// as the whole connection string, else the primary's with DB_READ_HOST as
+// its host. from names the setting used; c itself and "" are returned when
+// no replica is configured.
+func (c *DBConfig) readConfig() (r *DBConfig, from string) {
+	switch {
+	case c.ReadURL != "":
+		rc := *c
+		rc.Host, rc.Port, rc.Name, rc.User, rc.Password, rc.SSLMode = "", "", "", "", "", ""
+		rc.URL = rc.mergeSSLParams(c.ReadURL)
+		rc.passwordSource = ""
+		if rc.hasPassword() {
+			rc.passwordSource = PasswordFromURL
+		}
+		return &rc, "DATABASE_READ_URL"
+	case c.ReadHost != "":
+		rc := *c
+		switch {
+		case c.URL == "":
+			rc.Host = c.ReadHost
+		case isKeywordDSN(c.URL):
+			rc.URL = setKeywordParam(c.URL, "host", c.ReadHost)
+		default:
+			u, err := url.Parse(c.URL)
+			if err != nil {
+				return c, ""
+			}
+			if port := u.Port(); port != "" {
+				u.Host = net.JoinHostPort(c.ReadHost, port)
+			} else {
+				u.Host = c.ReadHost
+			}
+			rc.URL = u.String()
+		}
+		return &rc, "DB_READ_HOST"
+	}
+	return c, ""
+}
+
+// ConnectReadDB connects to the configured database on the read replica
+// (DATABASE_READ_URL or DB_READ_HOST), or on the primary when no replica is
+// configured. Use it for queries that can tolerate replication lag, such as
+// listings and reports; writes must go through ConnectDB.
+func ConnectReadDB() (*sql.DB, error) {
+	return ConnectReadDBAsContext(context.Background(), "")
+}
+
+// ConnectReadDBAs is ConnectReadDB for dbname.
+func ConnectReadDBAs(dbname string) (*sql.DB, error) {
+	return ConnectReadDBAsContext(context.Background(), dbname)
+}
+
+// ConnectReadDBContext is ConnectReadDB with the connection attempt bounded
+// by ctx as well as DefaultConnectTimeout.
+func ConnectReadDBContext(ctx context.Context) (*sql.DB, error) {
+	return ConnectReadDBAsContext(ctx, "")
+}
+
+// ConnectReadDBAsContext is ConnectReadDBAs with the connection attempt
+// bounded by ctx as well as DefaultConnectTimeout.
+func ConnectReadDBAsContext(ctx context.Context, dbname string) (*sql.DB, error) {
+	config, err := loadForConnect()
+	if err != nil {
+		return nil, err
+	}
+	r, from := config.readConfig()
+	if from == "" {
+		vprintf("dbconf: read connection: no replica configured (DATABASE_READ_URL, DB_READ_HOST); using the primary, %s\n", Describe(config))
+	} else {
+		vprintf("dbconf: read connection: replica from %s, %s\n", from, Describe(r))
+	}
+	return openConfigDB(ctx, r, dbname, openPostgres)
+}
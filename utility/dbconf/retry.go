@@ -0,0 +1,108 @@
+package dbconf
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultConnectBackoff is the wait before the first connection retry when
+// DB_CONNECT_BACKOFF is not set; it doubles on each further retry, up to
+// maxConnectBackoff.
+var DefaultConnectBackoff = time.Second
+
+const maxConnectBackoff = 30 * time.Second
+
+// ConnectRetry is how often the Connect functions retry a connection that
+// failed for a transient reason, such as a server that is restarting.
+type ConnectRetry struct {
+	// Retries is the number of retries after the first attempt
+	// (DB_CONNECT_RETRIES); 0, the default, does not retry.
+	Retries int
+	// Backoff is the wait before the first retry (DB_CONNECT_BACKOFF).
+	Backoff time.Duration
+}
+
+// loadConnectRetry reads DB_CONNECT_RETRIES and DB_CONNECT_BACKOFF. An
+// invalid value is an error rather than being ignored.
+func loadConnectRetry(config map[string]string) (ConnectRetry, error) {
+	r := ConnectRetry{Backoff: DefaultConnectBackoff}
+	if v := poolSetting(config, "DB_CONNECT_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return r, fmt.Errorf("invalid DB_CONNECT_RETRIES %q: want a whole number >= 0", v)
+		}
+		r.Retries = n
+	}
+	if v := poolSetting(config, "DB_CONNECT_BACKOFF"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return r, fmt.Errorf("invalid DB_CONNECT_BACKOFF %q: want a positive duration such as 500ms or 2s", v)
+		}
+		r.Backoff = d
+	}
+	return r, nil
+}
+
+// wait returns the pause before retry number n (1-based): Backoff doubled
+// n-1 times and capped, plus up to half of it again as jitter so that
+// several tools started by the same cron entry do not retry in lockstep.
+func (r ConnectRetry) wait(n int) time.Duration {
+	d := r.Backoff
+	for i := 1; i < n && d < maxConnectBackoff; i++ {
+		d *= 2
+	}
+	if d > maxConnectBackoff {
+		d = maxConnectBackoff
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// connectSleep waits d or until ctx is done; tests replace it.
+var connectSleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isTransientConnError reports whether a failed connection attempt may
+// succeed if repeated: the server refused or dropped the connection, did
+// not answer in time, is starting up or shutting down, or has no free
+// connection slots. Authentication failures, unknown databases and other
+// server errors are permanent.
+func isTransientConnError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "53300", // too_many_connections
+			"57P01", "57P02", "57P03": // shutdowns, cannot_connect_now
+			return true
+		}
+		return pqErr.Code.Class() == "08" && pqErr.Code != "08P01"
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,159 @@
+package dbconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestIsTransientConnError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{fmt.Errorf("connection timed out: %w", context.DeadlineExceeded), true},
+		{io.EOF, true},
+		{&pq.Error{Code: "53300"}, true},
+		{&pq.Error{Code: "57P03"}, true},
+		{&pq.Error{Code: "08006"}, true},
+		{&pq.Error{Code: "28P01"}, false},
+		{&pq.Error{Code: "3D000"}, false},
+		{&pq.Error{Code: "08P01"}, false},
+		{context.Canceled, false},
+		{errors.New("pq: unknown sslmode"), false},
+	}
+	for _, c := range cases {
+		if got := isTransientConnError(c.err); got != c.want {
+			t.Errorf("isTransientConnError(%v) = %t, want %t", c.err, got, c.want)
+		}
+	}
+}
+
+func TestConnectRetryWait(t *testing.T) {
+	r := ConnectRetry{Backoff: 100 * time.Millisecond}
+	for n, base := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 20: maxConnectBackoff} {
+		if got := r.wait(n); got < base || got > base+base/2 {
+			t.Errorf("wait(%d) = %s, want %s plus up to half again", n, got, base)
+		}
+	}
+}
+
+func stubConnectSleep(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var waits []time.Duration
+	old := connectSleep
+	connectSleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	t.Cleanup(func() { connectSleep = old })
+	return &waits
+}
+
+func TestConnectRetriesRefused(t *testing.T) {
+	useDatabaseURL(t, "postgres://u:p@127.0.0.1:1/app?sslmode=disable")
+	t.Setenv("DB_CONNECT_RETRIES", "2")
+	t.Setenv("DB_CONNECT_BACKOFF", "10ms")
+	waits := stubConnectSleep(t)
+	var logged strings.Builder
+	SetLogger(func(format string, args ...any) { fmt.Fprintf(&logged, format, args...) })
+	t.Cleanup(func() { SetLogger(nil) })
+
+	_, err := ConnectDBAs("app")
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Fatalf("err = %v, want a failure after 3 attempts", err)
+	}
+	if len(*waits) != 2 {
+		t.Errorf("slept %d times, want 2", len(*waits))
+	}
+	if !strings.Contains(logged.String(), "connection attempt 1 of 3 failed") {
+		t.Errorf("retries not logged:\n%s", logged.String())
+	}
+}
+
+// authFailServer answers every startup message with a FATAL 28P01
+// "password authentication failed" and counts the connections.
+func authFailServer(t *testing.T) (dsn string, conns *int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	conns = new(int32)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(conns, 1)
+			go func(c net.Conn) {
+				defer c.Close()
+				var n int32
+				if binary.Read(c, binary.BigEndian, &n) != nil || n < 4 {
+					return
+				}
+				if _, err := io.CopyN(io.Discard, c, int64(n-4)); err != nil {
+					return
+				}
+				var body bytes.Buffer
+				for _, f := range []string{"SFATAL", "C28P01", "Mpassword authentication failed for user \"u\""} {
+					body.WriteString(f)
+					body.WriteByte(0)
+				}
+				body.WriteByte(0)
+				msg := []byte{'E', 0, 0, 0, 0}
+				binary.BigEndian.PutUint32(msg[1:], uint32(body.Len()+4))
+				c.Write(append(msg, body.Bytes()...))
+			}(c)
+		}
+	}()
+	return "postgres://u:p@" + ln.Addr().String() + "/app?sslmode=disable", conns
+}
+
+func TestConnectDoesNotRetryAuthFailure(t *testing.T) {
+	dsn, conns := authFailServer(t)
+	useDatabaseURL(t, dsn)
+	t.Setenv("DB_CONNECT_RETRIES", "3")
+	waits := stubConnectSleep(t)
+
+	_, err := ConnectDBAs("app")
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "28P01" {
+		t.Fatalf("err = %v, want the authentication failure", err)
+	}
+	if n := atomic.LoadInt32(conns); n != 1 || len(*waits) != 0 {
+		t.Errorf("%d connection(s) and %d retry wait(s), want 1 and none", n, len(*waits))
+	}
+}
+
+func TestConnectRetrySettings(t *testing.T) {
+	useDatabaseURL(t, "postgres://u@db.example/app")
+	cfg, err := load()
+	if err != nil || cfg.Retry != (ConnectRetry{Backoff: DefaultConnectBackoff}) {
+		t.Fatalf("default Retry = %+v, %v", cfg.Retry, err)
+	}
+	for _, kv := range [][2]string{{"DB_CONNECT_RETRIES", "-1"}, {"DB_CONNECT_RETRIES", "x"}, {"DB_CONNECT_BACKOFF", "0s"}} {
+		t.Run(kv[0]+"="+kv[1], func(t *testing.T) {
+			t.Setenv(kv[0], kv[1])
+			Reload()
+			if _, err := load(); err == nil || !strings.Contains(err.Error(), kv[0]) {
+				t.Errorf("err = %v, want one naming %s", err, kv[0])
+			}
+		})
+	}
+}
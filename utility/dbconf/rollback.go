@@ -0,0 +1,134 @@
+package dbconf
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// RollbackMigrations undoes the last steps migrations applied to dbname,
+// newest first, with the down files from the configured migrations
+// directory. It returns the IDs rolled back.
+func RollbackMigrations(ctx context.Context, dbname string, steps int) ([]string, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("invalid number of steps %d (want at least 1)", steps)
+	}
+	return rollbackConfigured(ctx, dbname, func(applied []string) ([]string, error) {
+		if steps > len(applied) {
+			return nil, fmt.Errorf("cannot roll back %d migration(s): only %d applied", steps, len(applied))
+		}
+		return applied[:steps], nil
+	})
+}
+
+// RollbackTo undoes, newest first, every migration applied to dbname after
+// id, which stays applied. It returns the IDs rolled back.
+func RollbackTo(ctx context.Context, dbname, id string) ([]string, error) {
+	return rollbackConfigured(ctx, dbname, func(applied []string) ([]string, error) {
+		for i, a := range applied {
+			if a == id {
+				return applied[:i], nil
+			}
+		}
+		return nil, fmt.Errorf("migration %s is not applied", id)
+	})
+}
+
+func rollbackConfigured(ctx context.Context, dbname string, plan func(applied []string) ([]string, error)) ([]string, error) {
+	dir, err := ConfiguredMigrationsDir()
+	if err != nil {
+		return nil, err
+	}
+	migs, err := ReadMigrationsDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	l, err := migrationsLedger()
+	if err != nil {
+		return nil, err
+	}
+	db, err := ConnectDBAsContext(ctx, dbname)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	var done []string
+	err = withMigrationsLock(ctx, db, func(conn *sql.Conn) error {
+		done, err = rollbackDB(ctx, conn, l, migs, plan)
+		return err
+	})
+	return done, err
+}
+
+// rollbackDB runs the down files of the migrations plan picks from the
+// applied ones (newest first), each in its own transaction together with
+// removing its row from ledger l. Every picked migration must have a
+// down file; otherwise nothing is run.
+func rollbackDB(ctx context.Context, db migrationsDB, l ledger, migs []Migration, plan func(applied []string) ([]string, error)) ([]string, error) {
+	if err := ensureMigrationsTable(ctx, db, l); err != nil {
+		return nil, err
+	}
+	applied, err := appliedNewestFirst(ctx, db, l)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := plan(applied)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]Migration, len(migs))
+	for _, m := range migs {
+		byID[m.ID] = m
+	}
+	var missing []string
+	for _, id := range targets {
+		if !byID[id].HasDown {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no down file for %s; nothing rolled back", strings.Join(missing, ", "))
+	}
+
+	var done []string
+	for _, id := range targets {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return done, err
+		}
+		if _, err := tx.ExecContext(ctx, byID[id].Down); err != nil {
+			_ = tx.Rollback()
+			return done, fmt.Errorf("roll back %s: %w", id, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+l.ident()+` WHERE id = $1`, id); err != nil {
+			_ = tx.Rollback()
+			return done, err
+		}
+		if err := tx.Commit(); err != nil {
+			return done, err
+		}
+		vprintf("dbconf: rolled back %s\n", id)
+		done = append(done, id)
+	}
+	return done, nil
+}
+
+// appliedNewestFirst lists the applied migration IDs in the reverse of the
+// order they were applied.
+func appliedNewestFirst(ctx context.Context, db migrationsDB, l ledger) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id FROM `+l.ident()+` ORDER BY applied_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
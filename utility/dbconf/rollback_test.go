@@ -0,0 +1,106 @@
+package dbconf
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestReadMigrationsDirUpDown(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"001_users.sql":        "CREATE TABLE users ()",
+		"002_posts.up.sql":     "CREATE TABLE posts ()",
+		"002_posts.down.sql":   "DROP TABLE posts",
+		"003_tags.up.sql":      "CREATE TABLE tags ()",
+		"001_users.down.sql":   "DROP TABLE users",
+		"README.md":            "not a migration",
+		"004_empty.sql":        "",
+		"004_empty.down.sql":   "",
+		"notes/005_x.down.sql": "",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	migs, err := ReadMigrationsDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Migration{
+		{ID: "001_users.sql", SQL: "CREATE TABLE users ()", Down: "DROP TABLE users", HasDown: true},
+		{ID: "002_posts.sql", SQL: "CREATE TABLE posts ()", Down: "DROP TABLE posts", HasDown: true},
+		{ID: "003_tags.sql", SQL: "CREATE TABLE tags ()"},
+		{ID: "004_empty.sql", HasDown: true},
+	}
+	if !reflect.DeepEqual(migs, want) {
+		t.Errorf("got %+v\nwant %+v", migs, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "009_orphan.down.sql"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadMigrationsDir(dir); err == nil || !strings.Contains(err.Error(), "009_orphan.down.sql") {
+		t.Errorf("orphan down file: err = %v", err)
+	}
+}
+
+func TestRollbackDB(t *testing.T) {
+	migs := []Migration{
+		{ID: "001_a.sql", Down: "DROP TABLE a", HasDown: true},
+		{ID: "002_b.sql"},
+		{ID: "003_c.sql", Down: "DROP TABLE c", HasDown: true},
+		{ID: "004_d.sql", Down: "DROP TABLE d", HasDown: true},
+	}
+	lastN := func(n int) func([]string) ([]string, error) {
+		return func(applied []string) ([]string, error) { return applied[:n], nil }
+	}
+	setup := func(t *testing.T) (sqlmock.Sqlmock, func([]Migration, func([]string) ([]string, error)) ([]string, error)) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "public"."_migrations"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM "public"."_migrations" ORDER BY applied_at DESC, id DESC`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("004_d.sql").AddRow("003_c.sql").AddRow("002_b.sql").AddRow("001_a.sql"))
+		return mock, func(m []Migration, plan func([]string) ([]string, error)) ([]string, error) {
+			return rollbackDB(context.Background(), db, defaultLedger, m, plan)
+		}
+	}
+
+	mock, rollback := setup(t)
+	for _, id := range []string{"004_d.sql", "003_c.sql"} {
+		mock.ExpectBegin()
+		mock.ExpectExec("DROP TABLE " + id[4:5]).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "public"."_migrations"`)).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	done, err := rollback(migs, lastN(2))
+	if err != nil || !reflect.DeepEqual(done, []string{"004_d.sql", "003_c.sql"}) {
+		t.Errorf("rolled back %q, err %v", done, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// 002_b.sql has no down file: nothing may run, not even 004 and 003.
+	mock, rollback = setup(t)
+	done, err = rollback(migs, lastN(3))
+	if err == nil || !strings.Contains(err.Error(), "002_b.sql") || len(done) != 0 {
+		t.Errorf("rolled back %q, err %v; want an error naming 002_b.sql", done, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,98 @@
+package dbconf
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// rawConfigSecrets are keys utilities read through GetRawConfig rather
+// than load(), which may also come from <KEY>_FILE in the environment.
+var rawConfigSecrets = []string{"CLOUDFLARE_API_KEY"}
+
+// applySecretFiles resolves <KEY>_FILE settings, as used for Kubernetes and
+// systemd credentials, into config[KEY]: the file is read, trimmed and used
+// as if KEY were set. In config.ini, KEY_FILE fills an empty KEY. In the
+// environment, KEY_FILE stands for the environment variable KEY, so it beats
+// config.ini but not KEY set explicitly in the environment; that applies to
+// the keys load() resolves, the keys present in config.ini and
+// rawConfigSecrets. It returns the file each resolved key came from.
+func applySecretFiles(config map[string]string) (map[string]string, error) {
+	origins := map[string]string{}
+	read := func(key, path string) (string, error) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("%s_FILE: cannot read secret file: %w", key, err)
+		}
+		origins[key] = path
+		vprintf("dbconf: %s from %s_FILE (%s)\n", key, key, path)
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	var iniKeys []string
+	for k := range config {
+		iniKeys = append(iniKeys, k)
+	}
+	sort.Strings(iniKeys)
+	for _, fk := range iniKeys {
+		key, ok := strings.CutSuffix(fk, "_FILE")
+		path := strings.TrimSpace(config[fk])
+		if !ok || key == "" || path == "" {
+			continue
+		}
+		if config[key] != "" {
+			vprintf("dbconf: %s ignored: %s is set in config.ini\n", fk, key)
+			continue
+		}
+		v, err := read(key, path)
+		if err != nil {
+			return nil, err
+		}
+		config[key] = v
+	}
+
+	for _, key := range secretEnvKeys(config) {
+		path := strings.TrimSpace(getenv(key + "_FILE"))
+		if path == "" {
+			continue
+		}
+		if getenv(key) != "" {
+			vprintf("dbconf: %s_FILE ignored: %s is set in the environment\n", key, key)
+			continue
+		}
+		v, err := read(key, path)
+		if err != nil {
+			return nil, err
+		}
+		config[key] = v
+	}
+	return origins, nil
+}
+
+// secretEnvKeys lists, sorted, the keys whose <KEY>_FILE environment
+// variable is honored. DBTOOL_CONFIG_FILE names the config file itself and
+// is not a secret.
+func secretEnvKeys(config map[string]string) []string {
+	seen := map[string]bool{"DBTOOL_CONFIG": true}
+	var keys []string
+	add := func(k string) {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	for _, spec := range settingSpecs {
+		for _, k := range spec.env {
+			add(k)
+		}
+	}
+	for k := range config {
+		add(k)
+	}
+	for _, k := range rawConfigSecrets {
+		add(k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,68 @@
+package dbconf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) string {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSecretFiles(t *testing.T) {
+	clearDBEnv(t)
+	dir := t.TempDir()
+	pw := writeFile(t, filepath.Join(dir, "pw"), "from-file\n")
+	ini := writeFile(t, filepath.Join(dir, "config.ini"), "[default]\nDB_USER_FILE="+writeFile(t, filepath.Join(dir, "user"), " alice \n")+"\nPASSWORD=from-ini\n")
+	t.Setenv("DBTOOL_CONFIG_FILE", ini)
+	t.Setenv("DB_PASSWORD_FILE", pw)
+
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.User != "alice" {
+		t.Errorf("user = %q, want alice from DB_USER_FILE in config.ini", cfg.User)
+	}
+	if cfg.Password != "from-file" || cfg.passwordSource != PasswordFromFile {
+		t.Errorf("password %q from %q, want from-file from file (env _FILE beats config.ini)", cfg.Password, cfg.passwordSource)
+	}
+	settings, err := ResolveSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range settings {
+		if s.Name == "password" && (s.Source != "file" || s.Key != "DB_PASSWORD_FILE" || s.File != pw) {
+			t.Errorf("password setting = %+v, want source file %s", s, pw)
+		}
+	}
+
+	t.Setenv("DB_PASSWORD", "explicit")
+	Reload()
+	if cfg, _ = load(); cfg.Password != "explicit" {
+		t.Errorf("password = %q, want the explicitly set DB_PASSWORD", cfg.Password)
+	}
+
+	t.Setenv("CLOUDFLARE_API_KEY_FILE", writeFile(t, filepath.Join(dir, "token"), "cf-token\n"))
+	Reload()
+	raw, err := GetRawConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw["CLOUDFLARE_API_KEY"] != "cf-token" {
+		t.Errorf("CLOUDFLARE_API_KEY = %q, want cf-token", raw["CLOUDFLARE_API_KEY"])
+	}
+
+	missing := filepath.Join(dir, "nope")
+	t.Setenv("DB_HOST_FILE", missing)
+	Reload()
+	if _, err := load(); err == nil || !strings.Contains(err.Error(), "DB_HOST_FILE") || !strings.Contains(err.Error(), missing) {
+		t.Errorf("err = %v, want one naming DB_HOST_FILE and %s", err, missing)
+	}
+}
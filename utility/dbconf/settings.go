@@ -0,0 +1,171 @@
+package dbconf
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	envOriginsMu sync.Mutex
+	envOrigins   = map[string]string{}
+)
+
+// NoteEnvFile records that key was set from the .env file at path, so
+// ResolveSettings can tell .env values apart from the real environment.
+// Loaders that apply .env files themselves (like dbtool's) should call it.
+func NoteEnvFile(key, path string) {
+	envOriginsMu.Lock()
+	defer envOriginsMu.Unlock()
+	if _, ok := envOrigins[key]; !ok {
+		envOrigins[key] = path
+	}
+}
+
+func envOrigin(key string) string {
+	envOriginsMu.Lock()
+	defer envOriginsMu.Unlock()
+	return envOrigins[key]
+}
+
+// Setting is one resolved configuration value and where it came from.
+type Setting struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`             // redacted for secrets
+	Source  string `json:"source"`            // flag, env, .env, config.ini, file, default or unset
+	Key     string `json:"key,omitempty"`     // variable or config.ini key that won
+	File    string `json:"file,omitempty"`    // .env or config.ini path, when applicable
+	Section string `json:"section,omitempty"` // config.ini section, when a profile's
+	Note    string `json:"note,omitempty"`
+}
+
+// settingSpec lists, in priority order, the environment variables and
+// config.ini keys load() consults for one DBConfig field.
+type settingSpec struct {
+	name     string
+	env      []string
+	ini      []string
+	def      string
+	discrete bool // ignored when DATABASE_URL is set
+}
+
+var settingSpecs = []settingSpec{
+	{name: "host", env: []string{"DB_HOST"}, ini: []string{"DB_HOST", "HOST"}, discrete: true},
+	{name: "port", env: []string{"DB_PORT"}, ini: []string{"DB_PORT", "PORT"}, def: "5432", discrete: true},
+	{name: "database", env: []string{"DB_NAME", "DB_DATABASE"}, ini: []string{"DB_NAME", "DB_DATABASE", "NAME"}, discrete: true},
+	{name: "user", env: []string{"DB_USER", "DB_USERNAME"}, ini: []string{"DB_USER", "DB_USERNAME", "USER"}, discrete: true},
+	{name: "password", env: []string{"DB_PASSWORD"}, ini: []string{"DB_PASSWORD", "PASSWORD"}, discrete: true},
+	{name: "sslmode", env: []string{"DB_SSLMODE", "DB_SSL_MODE"}, ini: []string{"DB_SSLMODE", "DB_SSL_MODE", "SSL_MODE"}, def: "disable", discrete: true},
+	{name: "sslrootcert", env: []string{"DB_SSLROOTCERT"}, ini: []string{"DB_SSLROOTCERT"}},
+	{name: "sslcert", env: []string{"DB_SSLCERT"}, ini: []string{"DB_SSLCERT"}},
+	{name: "sslkey", env: []string{"DB_SSLKEY"}, ini: []string{"DB_SSLKEY"}},
+	{name: "migrations_dir", env: []string{"DB_MIGRATIONS_DIR"}, ini: []string{"DB_MIGRATIONS_DIR", "MIGRATIONS_DIR"}, def: "./migrations"},
+	{name: "database_url", env: []string{"DATABASE_URL"}, ini: []string{"DATABASE_URL"}},
+	{name: "read_database_url", env: []string{"DATABASE_READ_URL"}, ini: []string{"DATABASE_READ_URL"}},
+	{name: "read_host", env: []string{"DB_READ_HOST"}, ini: []string{"DB_READ_HOST"}},
+	{name: "max_open_conns", env: []string{"DB_MAX_OPEN_CONNS"}, ini: []string{"DB_MAX_OPEN_CONNS"}},
+	{name: "max_idle_conns", env: []string{"DB_MAX_IDLE_CONNS"}, ini: []string{"DB_MAX_IDLE_CONNS"}},
+	{name: "conn_max_lifetime", env: []string{"DB_CONN_MAX_LIFETIME"}, ini: []string{"DB_CONN_MAX_LIFETIME"}},
+	{name: "conn_max_idle_time", env: []string{"DB_CONN_MAX_IDLE_TIME"}, ini: []string{"DB_CONN_MAX_IDLE_TIME"}},
+	{name: "migrations_table", env: []string{"DB_MIGRATIONS_TABLE"}, ini: []string{"DB_MIGRATIONS_TABLE"}, def: DefaultMigrationsTable},
+	{name: "connect_retries", env: []string{"DB_CONNECT_RETRIES"}, ini: []string{"DB_CONNECT_RETRIES"}, def: "0"},
+	{name: "connect_backoff", env: []string{"DB_CONNECT_BACKOFF"}, ini: []string{"DB_CONNECT_BACKOFF"}, def: "1s"},
+	{name: "migrations_lock_timeout", env: []string{"DB_MIGRATIONS_LOCK_TIMEOUT"}, ini: []string{"DB_MIGRATIONS_LOCK_TIMEOUT"}, def: "60s"},
+}
+
+// ResolveSettings reports every database setting with the source that won,
+// following the same precedence as GetDBConfig. Passwords are redacted. The
+// first two entries describe the config.ini file itself and the selected
+// profile.
+func ResolveSettings() ([]Setting, error) {
+	s := currentState()
+	config, configPath, secretFiles, err := s.ini()
+	if err != nil {
+		return nil, err
+	}
+
+	profile := activeProfile()
+	out := []Setting{configFileSetting(configPath), profile}
+	urlSet := false
+	for _, spec := range settingSpecs {
+		st := Setting{Name: spec.name, Source: "unset"}
+		resolved := false
+		for _, k := range spec.env {
+			if v, f := envSource(k); v != "" {
+				st.Value, st.Key, st.Source = v, k, "env"
+				if f != "" {
+					st.Source, st.File = ".env", f
+				}
+				resolved = true
+				break
+			}
+		}
+		if !resolved {
+			for _, k := range spec.ini {
+				if v := config[k]; v != "" {
+					st.Value, st.Key, st.Source, st.File = v, k, "config.ini", configPath
+					if f := secretFiles[k]; f != "" {
+						st.Key, st.Source, st.File = k+"_FILE", "file", f
+					}
+					if s.fromProfile[st.Key] {
+						st.Section = profile.Value
+					}
+					resolved = true
+					break
+				}
+			}
+		}
+		if !resolved && spec.def != "" {
+			st.Value, st.Source = spec.def, "default"
+		}
+		switch spec.name {
+		case "password":
+			if st.Value != "" {
+				st.Value = "********"
+			}
+		case "database_url":
+			if override := getDSNOverride(); override != "" {
+				st = Setting{Name: spec.name, Value: override, Source: "flag", Key: "--dsn"}
+			}
+			urlSet = st.Value != ""
+			st.Value = RedactDSN(st.Value)
+		case "read_database_url", "read_host":
+			if spec.name == "read_database_url" {
+				st.Value = RedactDSN(st.Value)
+			}
+			if st.Value != "" && getDSNOverride() != "" {
+				st.Note = "ignored: --dsn in use"
+			}
+		}
+		out = append(out, st)
+	}
+	if urlSet {
+		for i := range out {
+			if isDiscrete(out[i].Name) && out[i].Source != "unset" {
+				out[i].Note = "ignored: DATABASE_URL takes precedence"
+			}
+		}
+	}
+	return out, nil
+}
+
+func configFileSetting(path string) Setting {
+	st := Setting{Name: "config_file", Value: path, Source: "default"}
+	if explicit, f := envSource("DBTOOL_CONFIG_FILE"); strings.TrimSpace(explicit) != "" {
+		st.Key, st.Source = "DBTOOL_CONFIG_FILE", "env"
+		if f != "" {
+			st.Source, st.File = ".env", f
+		}
+	} else if path == "" {
+		st.Source, st.Note = "unset", "no config.ini found; using environment only"
+	}
+	return st
+}
+
+func isDiscrete(name string) bool {
+	for _, spec := range settingSpecs {
+		if spec.name == name {
+			return spec.discrete
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package dbconf
+
+import "strings"
+
+// isSocketHost reports whether host names a directory holding a Unix-domain
+// socket, e.g. /var/run/postgresql, as libpq treats a host starting with
+// "/".
+func isSocketHost(host string) bool { return strings.HasPrefix(host, "/") }
+
+// isURLDSN reports whether dsn is written as a URL rather than as libpq
+// keyword/value pairs.
+func isURLDSN(dsn string) bool {
+	i := strings.Index(dsn, "://")
+	return i > 0 && !strings.ContainsAny(dsn[:i], " =")
+}
+
+// isKeywordDSN reports whether dsn is a keyword/value connection string such
+// as host=/var/run/postgresql dbname=app, the usual way to write a socket
+// connection in DATABASE_URL.
+func isKeywordDSN(dsn string) bool {
+	dsn = strings.TrimSpace(dsn)
+	if dsn == "" || isURLDSN(dsn) {
+		return false
+	}
+	_, ok := parseKeywordDSN(dsn)
+	return ok
+}
+
+// setKeywordParam sets key to value in a keyword/value connection string,
+// replacing every occurrence already there or appending it.
+func setKeywordParam(dsn, key, value string) string {
+	pairs, _ := parseKeywordDSN(dsn)
+	var b strings.Builder
+	last, found := 0, false
+	for _, p := range pairs {
+		if p.key == key {
+			b.WriteString(dsn[last:p.valueStart])
+			b.WriteString(quoteConnValue(value))
+			last, found = p.valueEnd, true
+		}
+	}
+	b.WriteString(dsn[last:])
+	if !found {
+		b.WriteString(" " + key + "=" + quoteConnValue(value))
+	}
+	return b.String()
+}
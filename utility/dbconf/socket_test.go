@@ -0,0 +1,123 @@
+package dbconf
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestSocketHost(t *testing.T) {
+	clearDBEnv(t)
+	t.Setenv("DBTOOL_CONFIG_FILE", writeFile(t, filepath.Join(t.TempDir(), "config.ini"), "[default]\n"))
+	t.Setenv("DB_HOST", "/var/run/my postgresql")
+	t.Setenv("DB_NAME", "app")
+	t.Setenv("DB_USER", "bob")
+
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for dbname, want := range map[string]string{
+		"":      "host='/var/run/my postgresql' port='5432' user='bob' dbname='app' sslmode='disable'",
+		"other": "host='/var/run/my postgresql' port='5432' user='bob' dbname='other' sslmode='disable'",
+	} {
+		conn := cfg.createConnectionStringFor(dbname)
+		if conn != want {
+			t.Errorf("createConnectionStringFor(%q) = %q, want %q", dbname, conn, want)
+		}
+		if _, err := pq.NewConnector(conn); err != nil {
+			t.Errorf("lib/pq rejects %q: %v", conn, err)
+		}
+	}
+	if got := Describe(cfg); got != "host=/var/run/my postgresql db=app user=bob" {
+		t.Errorf("Describe = %q", got)
+	}
+	if e := cfg.endpointFor("other"); e.host != "localhost" || e.dbname != "other" {
+		t.Errorf("pgpass endpoint = %+v, want localhost/other", e)
+	}
+}
+
+func TestSocketDSN(t *testing.T) {
+	cases := []struct {
+		dsn, other, describe string
+	}{
+		{
+			"host=/var/run/postgresql dbname=app user=bob",
+			"host=/var/run/postgresql dbname='other' user=bob",
+			"host=/var/run/postgresql db=app user=bob",
+		},
+		{
+			"host=/tmp port=5433 user=bob",
+			"host=/tmp port=5433 user=bob dbname='other'",
+			"host=/tmp port=5433 user=bob",
+		},
+		{
+			"postgres://bob@/app?host=/var/run/postgresql",
+			"postgres://bob@/other?host=/var/run/postgresql",
+			"host=/var/run/postgresql db=app user=bob",
+		},
+		{
+			"postgres://bob@?host=/var/run/postgresql",
+			"postgres://bob@/other?host=/var/run/postgresql",
+			"host=/var/run/postgresql user=bob",
+		},
+	}
+	for _, c := range cases {
+		cfg := &DBConfig{URL: c.dsn}
+		if got := cfg.createConnectionString(); got != c.dsn {
+			t.Errorf("createConnectionString(%q) = %q, want it unchanged", c.dsn, got)
+		}
+		if got := cfg.createConnectionStringFor("other"); got != c.other {
+			t.Errorf("createConnectionStringFor(%q, other) = %q, want %q", c.dsn, got, c.other)
+		}
+		if got := Describe(cfg); got != c.describe {
+			t.Errorf("Describe(%q) = %q, want %q", c.dsn, got, c.describe)
+		}
+	}
+}
+
+func TestSocketDSNPassword(t *testing.T) {
+	cfg := &DBConfig{URL: "host=/var/run/postgresql dbname=app user=bob"}
+	if cfg.hasPassword() {
+		t.Fatal("hasPassword without password=")
+	}
+	e := cfg.endpointFor("")
+	if e.host != "localhost" || e.user != "bob" || e.dbname != "app" {
+		t.Errorf("endpoint = %+v", e)
+	}
+	cfg.setPassword(e, "it's")
+	if want := `host=/var/run/postgresql dbname=app user=bob password='it\'s'`; cfg.URL != want {
+		t.Errorf("URL = %q, want %q", cfg.URL, want)
+	}
+	if !cfg.hasPassword() {
+		t.Error("hasPassword after setPassword")
+	}
+}
+
+func TestKeywordDatabaseURL(t *testing.T) {
+	useDatabaseURL(t, "host=db.example port=5432 user=y password='p w' dbname=z sslmode=require")
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "" || cfg.Name != "" {
+		t.Errorf("discrete fields %+v should be cleared by DATABASE_URL", cfg)
+	}
+	if name, err := DefaultDBName(); err != nil || name != "z" {
+		t.Errorf("DefaultDBName = %q, %v; want z", name, err)
+	}
+	want := "host=db.example port=5432 user=y password='p w' dbname='other' sslmode=require"
+	if got := cfg.createConnectionStringFor("other"); got != want {
+		t.Errorf("createConnectionStringFor(other) = %q, want %q", got, want)
+	}
+	if got := RedactDSN(cfg.URL); got != "host=db.example port=5432 user=y password=xxxxx dbname=z sslmode=require" {
+		t.Errorf("RedactDSN = %q", got)
+	}
+
+	useDatabaseURL(t, "db.example:5432/z")
+	if _, err := ConnectDBAs("z"); err == nil || !strings.Contains(err.Error(), "neither a postgres:// URL nor key=value") {
+		t.Errorf("ConnectDBAs with an unusable DATABASE_URL: %v", err)
+	}
+}
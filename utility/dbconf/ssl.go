@@ -0,0 +1,93 @@
+package dbconf
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// sslParam is one configured certificate setting: the libpq parameter, the
+// configuration key it comes from and the DBConfig field holding the path.
+type sslParam struct {
+	name, key string
+	path      *string
+}
+
+func (c *DBConfig) sslParams() []sslParam {
+	var out []sslParam
+	for _, p := range []sslParam{
+		{"sslrootcert", "DB_SSLROOTCERT", &c.SSLRootCert},
+		{"sslcert", "DB_SSLCERT", &c.SSLCert},
+		{"sslkey", "DB_SSLKEY", &c.SSLKey},
+	} {
+		if *p.path != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// sslConnParams is the certificate part of a key=value connection string.
+func (c *DBConfig) sslConnParams() string {
+	var b strings.Builder
+	for _, p := range c.sslParams() {
+		fmt.Fprintf(&b, " %s=%s", p.name, quoteConnValue(*p.path))
+	}
+	return b.String()
+}
+
+// mergeSSLParams adds the certificate paths to the query of a postgres://
+// URL, or to a keyword/value DSN. Parameters the URL already sets win, so a URL carrying its own
+// sslrootcert is not changed behind the user's back; the overridden setting
+// is cleared.
+func (c *DBConfig) mergeSSLParams(raw string) string {
+	params := c.sslParams()
+	if len(params) == 0 {
+		return raw
+	}
+	if isKeywordDSN(raw) {
+		pairs, _ := parseKeywordDSN(raw)
+		set := map[string]string{}
+		for _, p := range pairs {
+			set[p.key] = p.value
+		}
+		for _, p := range params {
+			if v, ok := set[p.name]; ok {
+				vprintf("dbconf: %s ignored: DATABASE_URL sets %s=%s\n", p.key, p.name, v)
+				*p.path = ""
+				continue
+			}
+			raw = setKeywordParam(raw, p.name, *p.path)
+		}
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return raw
+	}
+	q := u.Query()
+	for _, p := range params {
+		if q.Has(p.name) {
+			vprintf("dbconf: %s ignored: DATABASE_URL sets %s=%s\n", p.key, p.name, q.Get(p.name))
+			*p.path = ""
+			continue
+		}
+		q.Set(p.name, *p.path)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// CheckSSLFiles fails when a configured certificate or key file does not
+// exist, so the problem is reported by name instead of as a TLS error from
+// the driver. In verbose mode it lists the paths in use.
+func (c *DBConfig) CheckSSLFiles() error {
+	for _, p := range c.sslParams() {
+		if _, err := os.Stat(*p.path); err != nil {
+			return fmt.Errorf("%s: %w", p.key, err)
+		}
+		vprintf("dbconf: %s %s\n", p.name, *p.path)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package dbconf
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSLSettings(t *testing.T) {
+	clearDBEnv(t)
+	dir := t.TempDir()
+	ini := filepath.Join(dir, "config.ini")
+	ca := filepath.Join(dir, "ca.pem")
+	for _, f := range []string{ini, ca} {
+		if err := os.WriteFile(f, []byte("[default]\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("DBTOOL_CONFIG_FILE", ini)
+	t.Setenv("DB_SSLROOTCERT", ca)
+	t.Setenv("DB_SSLCERT", filepath.Join(dir, "client.crt"))
+
+	t.Setenv("DB_HOST", "db.example")
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := cfg.createConnectionStringFor("app")
+	if !strings.HasSuffix(conn, " sslrootcert='"+ca+"' sslcert='"+filepath.Join(dir, "client.crt")+"'") {
+		t.Errorf("connection string %q lacks the certificate paths", conn)
+	}
+	if err := cfg.CheckSSLFiles(); !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "DB_SSLCERT") {
+		t.Errorf("CheckSSLFiles() = %v, want DB_SSLCERT not found", err)
+	}
+
+	t.Setenv("DATABASE_URL", "postgres://u@db.example/app?sslmode=verify-full&sslcert=%2Fown%2Fclient.crt")
+	Reload()
+	cfg, err = load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "postgres://u@db.example/app?sslcert=%2Fown%2Fclient.crt&sslmode=verify-full&sslrootcert=" + strings.ReplaceAll(ca, "/", "%2F")
+	if cfg.URL != want {
+		t.Errorf("URL = %q, want %q", cfg.URL, want)
+	}
+	if err := cfg.CheckSSLFiles(); err != nil {
+		t.Errorf("CheckSSLFiles() = %v; the URL's own sslcert should win", err)
+	}
+}
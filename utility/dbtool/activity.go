@@ -0,0 +1,117 @@
+package dbtool
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// activityQueryWidth is how much of each query `activity list` shows unless
+// full output is requested.
+const activityQueryWidth = 60
+
+// ActivityInfo is one backend from pg_stat_activity.
+type ActivityInfo struct {
+	PID   int    `json:"pid"`
+	User  string `json:"user"`
+	State string `json:"state"`
+	// QueryStart is nil for backends that have not run a query yet.
+	QueryStart *time.Time `json:"queryStart"`
+	// DurationSeconds is how long the current (or last, when idle) query
+	// has been running.
+	DurationSeconds float64 `json:"durationSeconds"`
+	WaitEvent       string  `json:"waitEvent,omitempty"`
+	Query           string  `json:"query"`
+}
+
+// ListActivity prints the client backends connected to dbname, longest
+// running first, leaving out dbtool's own connection. Only queries running
+// for at least minDuration are shown. Query text is cut to one line unless
+// full is set; JSON output always has the full text.
+func ListActivity(dbname string, minDuration time.Duration, full, asJSON bool) error {
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	rows, err := db.Query(`
+SELECT pid, COALESCE(usename, ''), COALESCE(state, ''), query_start,
+       COALESCE(EXTRACT(EPOCH FROM now() - query_start), 0)::float8,
+       COALESCE(wait_event_type || ':' || wait_event, ''), COALESCE(query, '')
+FROM pg_stat_activity
+WHERE datname = $1 AND pid <> pg_backend_pid() AND backend_type = 'client backend'
+  AND ($2::float8 = 0 OR now() - query_start >= $2::float8 * interval '1 second')
+ORDER BY query_start NULLS LAST, pid`, dbname, minDuration.Seconds())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	out := []ActivityInfo{}
+	for rows.Next() {
+		var a ActivityInfo
+		var start sql.NullTime
+		if err := rows.Scan(&a.PID, &a.User, &a.State, &start, &a.DurationSeconds, &a.WaitEvent, &a.Query); err != nil {
+			return err
+		}
+		if start.Valid {
+			t := start.Time
+			a.QueryStart = &t
+		}
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+	fmt.Printf("%-8s %-16s %-20s %-20s %10s  %s\n", "pid", "user", "state", "query start", "duration", "query")
+	for _, a := range out {
+		started, took := "-", "-"
+		if a.QueryStart != nil {
+			started = a.QueryStart.Local().Format("2006-01-02 15:04:05")
+			took = (time.Duration(a.DurationSeconds * float64(time.Second))).Round(time.Second).String()
+		}
+		query := strings.Join(strings.Fields(a.Query), " ")
+		if !full {
+			query = truncateCell(query, activityQueryWidth)
+		}
+		fmt.Printf("%-8d %-16s %-20s %-20s %10s  %s\n", a.PID, a.User, a.State, started, took, query)
+	}
+	return nil
+}
+
+// KillBackend cancels the current query of the backend pid
+// (pg_cancel_backend) or, with terminate, closes its connection
+// (pg_terminate_backend). Any database on the server can do this, so it
+// connects to the maintenance database.
+func KillBackend(pid int, terminate bool) error {
+	db, err := connectMaintenanceDB("")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	fn := "pg_cancel_backend"
+	if terminate {
+		fn = "pg_terminate_backend"
+	}
+	var ok bool
+	if err := db.QueryRow("SELECT "+fn+"($1)", pid).Scan(&ok); err != nil {
+		return fmt.Errorf("%s(%d): %w", fn, pid, err)
+	}
+	if !ok {
+		return fmt.Errorf("%s(%d) returned false: no such backend", fn, pid)
+	}
+	if terminate {
+		fmt.Printf("terminated backend %d\n", pid)
+	} else {
+		fmt.Printf("canceled query on backend %d\n", pid)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package dbtool
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// IndexInfo is one row of `index list`.
+type IndexInfo struct {
+	Schema     string `json:"schema"`
+	Name       string `json:"name"`
+	Table      string `json:"table"`
+	Definition string `json:"definition"`
+	SizeBytes  int64  `json:"sizeBytes"`
+	// Scans is pg_stat_user_indexes.idx_scan since the last stats reset; 0
+	// on a long-running server usually means the index is unused.
+	Scans int64 `json:"scans"`
+}
+
+// ListIndexes prints the user indexes in dbname, optionally only those on
+// table ([schema.]table).
+func ListIndexes(dbname, table string, asJSON bool) error {
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	filter := ""
+	if table = strings.TrimSpace(table); table != "" {
+		missing, err := missingTables(db, []string{table})
+		if err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("table %q not found", table)
+		}
+		filter = quoteTableName(table)
+	}
+	rows, err := db.Query(`
+SELECT s.schemaname, s.indexrelname, s.schemaname || '.' || s.relname, pg_get_indexdef(s.indexrelid),
+       pg_relation_size(s.indexrelid), COALESCE(s.idx_scan, 0)
+FROM pg_stat_user_indexes s
+WHERE $1 = '' OR s.relid = to_regclass($1)
+ORDER BY s.schemaname, s.relname, s.indexrelname`, filter)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	out := []IndexInfo{}
+	for rows.Next() {
+		var ix IndexInfo
+		if err := rows.Scan(&ix.Schema, &ix.Name, &ix.Table, &ix.Definition, &ix.SizeBytes, &ix.Scans); err != nil {
+			return err
+		}
+		out = append(out, ix)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+	fmt.Printf("%-40s %-30s %10s %10s  %s\n", "index", "table", "size", "scans", "definition")
+	for _, ix := range out {
+		fmt.Printf("%-40s %-30s %10s %10d  %s\n", ix.Schema+"."+ix.Name, ix.Table, humanBytes(ix.SizeBytes), ix.Scans, ix.Definition)
+	}
+	return nil
+}
+
+// SequenceInfo is one row of `sequence list`.
+type SequenceInfo struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	// LastValue is nil when the sequence has never been used (or the role
+	// cannot read it).
+	LastValue *int64 `json:"lastValue"`
+	// OwnedBy is schema.table.column for serial and identity columns.
+	OwnedBy string `json:"ownedBy,omitempty"`
+}
+
+// ListSequences prints the sequences in dbname with their last value and
+// owning column.
+func ListSequences(dbname string, asJSON bool) error {
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	rows, err := db.Query(`
+SELECT s.schemaname, s.sequencename, s.last_value,
+       COALESCE(tn.nspname || '.' || t.relname || '.' || a.attname, '')
+FROM pg_sequences s
+JOIN pg_namespace n ON n.nspname = s.schemaname
+JOIN pg_class c ON c.relnamespace = n.oid AND c.relname = s.sequencename AND c.relkind = 'S'
+LEFT JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.objid = c.oid
+      AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a','i')
+LEFT JOIN pg_class t ON t.oid = d.refobjid
+LEFT JOIN pg_namespace tn ON tn.oid = t.relnamespace
+LEFT JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+ORDER BY s.schemaname, s.sequencename`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	out := []SequenceInfo{}
+	for rows.Next() {
+		var sq SequenceInfo
+		var last sql.NullInt64
+		if err := rows.Scan(&sq.Schema, &sq.Name, &last, &sq.OwnedBy); err != nil {
+			return err
+		}
+		if last.Valid {
+			v := last.Int64
+			sq.LastValue = &v
+		}
+		out = append(out, sq)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+	fmt.Printf("%-40s %20s  %s\n", "sequence", "last value", "owned by")
+	for _, sq := range out {
+		last := "-"
+		if sq.LastValue != nil {
+			last = fmt.Sprint(*sq.LastValue)
+		}
+		fmt.Printf("%-40s %20s  %s\n", sq.Schema+"."+sq.Name, last, sq.OwnedBy)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package dbtool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	dbconf "cli-things/utility/dbconf"
+)
+
+// NoteEnvFile records that key was set from the .env file at path; see
+// dbconf.NoteEnvFile.
+func NoteEnvFile(key, path string) { dbconf.NoteEnvFile(key, path) }
+
+// SetDSNOverride makes this invocation connect with dsn instead of the
+// configured settings; see dbconf.SetDSNOverride.
+func SetDSNOverride(dsn string) error { return dbconf.SetDSNOverride(dsn) }
+
+// SetProfile selects the config.ini section this invocation reads over
+// [default]; "" leaves the choice to DBTOOL_PROFILE. See dbconf.LoadOptions.
+func SetProfile(name string) { dbconf.SetLoadOptions(dbconf.LoadOptions{Profile: name}) }
+
+// PrintConfig prints every database setting, its (redacted) value and where
+// it was resolved from.
+func PrintConfig(asJSON bool) error {
+	settings, err := dbconf.ResolveSettings()
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(settings)
+	}
+	fmt.Printf("%-24s %-40s %s\n", "setting", "value", "source")
+	for _, s := range settings {
+		src := s.Source
+		switch {
+		case s.Section != "":
+			src = fmt.Sprintf("%s %s (%s in [%s])", s.Source, s.File, s.Key, s.Section)
+		case s.File != "" && s.Key != "":
+			src = fmt.Sprintf("%s %s (%s)", s.Source, s.File, s.Key)
+		case s.Key != "":
+			src = fmt.Sprintf("%s %s", s.Source, s.Key)
+		}
+		if s.Note != "" {
+			src += "  [" + s.Note + "]"
+		}
+		val := s.Value
+		if val == "" {
+			val = "-"
+		}
+		fmt.Printf("%-24s %-40s %s\n", s.Name, val, src)
+	}
+	return nil
+}
+
+// ConnectionCheck is the result of `config test`.
+type ConnectionCheck struct {
+	OK            bool   `json:"ok"`
+	Database      string `json:"database"`
+	ServerVersion string `json:"serverVersion,omitempty"`
+	CurrentUser   string `json:"currentUser,omitempty"`
+	ReadOnly      bool   `json:"readOnly"`
+	InRecovery    bool   `json:"inRecovery"`
+	// ConnectMillis covers opening and pinging the connection; QueryMillis a
+	// single round trip once connected.
+	ConnectMillis int64  `json:"connectMillis"`
+	QueryMillis   int64  `json:"queryMillis,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// TestConnection connects to dbname, reports the server version, role,
+// read-only state and latency, and returns an error if the connection or
+// query failed.
+func TestConnection(dbname string, asJSON bool) error {
+	h, err := dbconf.HealthCheckAs(context.Background(), dbname)
+	res := ConnectionCheck{
+		OK:            err == nil,
+		Database:      dbname,
+		ServerVersion: h.ServerVersion,
+		CurrentUser:   h.CurrentUser,
+		ReadOnly:      h.ReadOnly,
+		InRecovery:    h.InRecovery,
+		ConnectMillis: h.ConnectLatency.Milliseconds(),
+		QueryMillis:   h.Latency.Milliseconds(),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(res); encErr != nil {
+			return encErr
+		}
+	} else if res.OK {
+		fmt.Printf("OK: connected to %q as %s, PostgreSQL %s%s (connect %dms, query %dms)\n",
+			dbname, res.CurrentUser, strings.TrimSpace(res.ServerVersion), readOnlyNote(h), res.ConnectMillis, res.QueryMillis)
+	}
+	return err
+}
+
+// readOnlyNote is ", read-only" or ", standby" for a server that rejects
+// writes, and "" otherwise.
+func readOnlyNote(h *dbconf.Health) string {
+	switch {
+	case h.InRecovery:
+		return ", standby"
+	case h.ReadOnly:
+		return ", read-only"
+	}
+	return ""
+}
@@ -0,0 +1,247 @@
+package dbtool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"cli-things/utility/secrets"
+
+	"github.com/lib/pq"
+)
+
+// CopyOptions controls CopyDatabase.
+type CopyOptions struct {
+	// DropExisting drops the target first when it already exists.
+	DropExisting bool
+	// Jobs > 1 runs pg_dump/pg_restore in parallel. pg_restore cannot read a
+	// parallel stream from a pipe, so this goes through a temporary
+	// directory-format dump that is removed afterwards.
+	Jobs int
+}
+
+// CopyDatabase creates target as a copy of source on the configured server.
+// When nobody is connected to source it uses CREATE DATABASE ... TEMPLATE,
+// which is a fast file-level copy; otherwise it streams pg_dump into
+// pg_restore. If the copy fails after target was created, the returned error
+// says so and target is left in place for inspection.
+func CopyDatabase(source, target string, opts CopyOptions) error {
+	if source == target {
+		return errors.New("source and target must differ")
+	}
+	ctx := context.Background()
+	admin, err := connectMaintenanceDB(source)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	exists := func(name string) (bool, error) {
+		var ok bool
+		err := admin.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, name).Scan(&ok)
+		return ok, err
+	}
+	if ok, err := exists(source); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("source database %q does not exist", source)
+	}
+	if ok, err := exists(target); err != nil {
+		return err
+	} else if ok {
+		if !opts.DropExisting {
+			return fmt.Errorf("target database %q already exists (use --drop-existing to replace it)", target)
+		}
+		fmt.Fprintf(os.Stderr, "dbtool: dropping existing database %q\n", target)
+		if _, err := admin.ExecContext(ctx, "DROP DATABASE "+pq.QuoteIdentifier(target)); err != nil {
+			return fmt.Errorf("drop target: %w", err)
+		}
+	}
+
+	started := time.Now()
+	var others int
+	if err := admin.QueryRowContext(ctx, `SELECT count(*) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()`, source).Scan(&others); err != nil {
+		return err
+	}
+	usedTemplate := false
+	if others == 0 {
+		fmt.Fprintf(os.Stderr, "dbtool: copying %q to %q with CREATE DATABASE ... TEMPLATE\n", source, target)
+		_, err := admin.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", pq.QuoteIdentifier(target), pq.QuoteIdentifier(source)))
+		if err == nil {
+			usedTemplate = true
+		} else {
+			// A client may have connected in the meantime; fall back.
+			fmt.Fprintf(os.Stderr, "dbtool: template copy failed (%v); falling back to pg_dump | pg_restore\n", err)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "dbtool: %d session(s) connected to %q; using pg_dump | pg_restore\n", others, source)
+	}
+
+	if !usedTemplate {
+		if _, err := admin.ExecContext(ctx, "CREATE DATABASE "+pq.QuoteIdentifier(target)); err != nil {
+			return fmt.Errorf("create target: %w", err)
+		}
+		if err := dumpRestore(source, target, opts.Jobs); err != nil {
+			return fmt.Errorf("copy into %q failed; the target database was created and is incomplete (drop it or rerun with --drop-existing): %w", target, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "dbtool: copy finished in %s\n", time.Since(started).Round(time.Millisecond))
+	return printCopySummary(source, target)
+}
+
+// connectMaintenanceDB connects to the "postgres" database so that neither
+// source nor target is held open by dbtool itself. Servers without it fall
+// back to the configured default database.
+func connectMaintenanceDB(avoid string) (*sql.DB, error) {
+	if avoid != "postgres" {
+		if db, err := ConnectDBAs("postgres"); err == nil {
+			return db, nil
+		}
+		vprintln("dbtool: cannot connect to maintenance database \"postgres\"; using configured database")
+	}
+	return ConnectDB()
+}
+
+// dumpRestore copies source into the existing, empty target database.
+func dumpRestore(source, target string, jobs int) error {
+	cfg, err := GetDBConfig()
+	if err != nil {
+		return err
+	}
+	restoreArgs := []string{"--no-owner", "--exit-on-error"}
+	if isVerbose() {
+		restoreArgs = append(restoreArgs, "--verbose")
+	}
+
+	if jobs > 1 {
+		dir, err := os.MkdirTemp("", "dbtool-copy-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		out := dir + "/dump"
+		j := strconv.Itoa(jobs)
+		fmt.Fprintf(os.Stderr, "dbtool: dumping %q with %s jobs\n", source, j)
+		dump := pgCommand(cfg, "pg_dump", source, "-Fd", "-j", j, "-f", out)
+		if err := dump.Run(); err != nil {
+			return fmt.Errorf("pg_dump: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "dbtool: restoring into %q with %s jobs\n", target, j)
+		restore := pgCommand(cfg, "pg_restore", target, append(restoreArgs, "-j", j, out)...)
+		if err := restore.Run(); err != nil {
+			return fmt.Errorf("pg_restore: %w", err)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "dbtool: streaming pg_dump %q | pg_restore %q\n", source, target)
+	dump := pgCommand(cfg, "pg_dump", source, "-Fc")
+	restore := pgCommand(cfg, "pg_restore", target, restoreArgs...)
+	dump.Stdout = nil
+	pipe, err := dump.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	restore.Stdin = pipe
+	if err := dump.Start(); err != nil {
+		return fmt.Errorf("pg_dump: %w", err)
+	}
+	if err := restore.Start(); err != nil {
+		_ = dump.Process.Kill()
+		_ = dump.Wait()
+		return fmt.Errorf("pg_restore: %w", err)
+	}
+	restoreErr := restore.Wait()
+	dumpErr := dump.Wait()
+	if dumpErr != nil {
+		return fmt.Errorf("pg_dump: %w", dumpErr)
+	}
+	if restoreErr != nil {
+		return fmt.Errorf("pg_restore: %w", restoreErr)
+	}
+	return nil
+}
+
+// pgCommand builds an invocation of a PostgreSQL client tool (pg_dump,
+// pg_restore, psql) against dbname, using the same DSN-or-discrete-fields
+// rules as RunPgDump. A password in the DSN is passed in the environment,
+// not on the command line where ps would show it.
+func pgCommand(cfg *DBConfig, tool, dbname string, extra ...string) *exec.Cmd {
+	cmd := exec.Command(tool, append(connArgs(cfg, dbname), extra...)...)
+	env := os.Environ()
+	if cfg.URL == "" {
+		env = append(env, fmt.Sprintf("PGPASSWORD=%s", cfg.Password))
+		if cfg.SSLMode != "" {
+			env = append(env, fmt.Sprintf("PGSSLMODE=%s", cfg.SSLMode))
+		}
+		env = append(env, sslEnv(cfg)...)
+	}
+	env = append(env, promptedPasswordEnv(cfg)...)
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return secrets.WrapCommand(cmd)
+}
+
+type objectSummary struct {
+	Tables, Views, Sequences, Functions, Indexes int
+	// Rows is the planner estimate (pg_class.reltuples); it is 0 for tables
+	// that have not been analyzed yet.
+	Rows int64
+}
+
+func summarizeObjects(dbname string) (objectSummary, error) {
+	var s objectSummary
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return s, err
+	}
+	defer db.Close()
+	err = db.QueryRow(`
+SELECT
+  count(*) FILTER (WHERE c.relkind IN ('r','p')),
+  count(*) FILTER (WHERE c.relkind IN ('v','m')),
+  count(*) FILTER (WHERE c.relkind = 'S'),
+  (SELECT count(*) FROM pg_proc p JOIN pg_namespace pn ON pn.oid = p.pronamespace
+     WHERE pn.nspname NOT IN ('pg_catalog','information_schema')),
+  count(*) FILTER (WHERE c.relkind = 'i'),
+  COALESCE(sum(GREATEST(c.reltuples, 0)) FILTER (WHERE c.relkind IN ('r','p')), 0)::bigint
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname NOT IN ('pg_catalog','information_schema') AND n.nspname NOT LIKE 'pg_toast%'`).
+		Scan(&s.Tables, &s.Views, &s.Sequences, &s.Functions, &s.Indexes, &s.Rows)
+	return s, err
+}
+
+func printCopySummary(source, target string) error {
+	src, err := summarizeObjects(source)
+	if err != nil {
+		return fmt.Errorf("summarize source: %w", err)
+	}
+	dst, err := summarizeObjects(target)
+	if err != nil {
+		return fmt.Errorf("summarize target: %w", err)
+	}
+	fmt.Printf("%-10s %10s %10s\n", "object", source, target)
+	row := func(name string, a, b int64) {
+		mark := ""
+		if a != b {
+			mark = "  *"
+		}
+		fmt.Printf("%-10s %10d %10d%s\n", name, a, b, mark)
+	}
+	row("tables", int64(src.Tables), int64(dst.Tables))
+	row("views", int64(src.Views), int64(dst.Views))
+	row("sequences", int64(src.Sequences), int64(dst.Sequences))
+	row("functions", int64(src.Functions), int64(dst.Functions))
+	row("indexes", int64(src.Indexes), int64(dst.Indexes))
+	row("rows~", src.Rows, dst.Rows)
+	fmt.Println("rows~ are planner estimates; run ANALYZE on the target for current numbers")
+	return nil
+}
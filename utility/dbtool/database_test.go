@@ -0,0 +1,62 @@
+package dbtool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestQueryError(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	canceled, cancel2 := context.WithCancel(context.Background())
+	cancel2()
+	bg := context.Background()
+	other := errors.New("syntax error")
+
+	cases := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want error
+	}{
+		{"nil", bg, nil, nil},
+		{"deadline", expired, context.DeadlineExceeded, ErrQueryTimeout},
+		{"statement_timeout", bg, &pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"}, ErrQueryTimeout},
+		{"ctrl-c", canceled, &pq.Error{Code: "57014", Message: "canceling statement due to user request"}, ErrQueryCanceled},
+		{"other", bg, other, other},
+	}
+	for _, c := range cases {
+		got := queryError(c.ctx, c.err, 5*time.Second)
+		if c.want == nil {
+			if got != nil {
+				t.Errorf("%s: got %v, want nil", c.name, got)
+			}
+			continue
+		}
+		if !errors.Is(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestConnArgsSocket(t *testing.T) {
+	cases := []struct {
+		cfg  DBConfig
+		want []string
+	}{
+		{DBConfig{Host: "/var/run/postgresql", Port: "5432", User: "bob"}, []string{"-h", "/var/run/postgresql", "-p", "5432", "-U", "bob", "-d", "other"}},
+		{DBConfig{URL: "host=/var/run/postgresql dbname=app"}, []string{"-d", "host=/var/run/postgresql dbname=app dbname='other'"}},
+		{DBConfig{URL: "postgres://bob@?host=/var/run/postgresql"}, []string{"-d", "postgres://bob@/other?host=/var/run/postgresql"}},
+		{DBConfig{URL: "postgres://bob@db.example/app"}, []string{"-d", "postgres://bob@db.example/other"}},
+	}
+	for _, c := range cases {
+		if got := connArgs(&c.cfg, "other"); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("connArgs(%+v) = %q, want %q", c.cfg, got, c.want)
+		}
+	}
+}
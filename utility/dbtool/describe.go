@@ -0,0 +1,145 @@
+package dbtool
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ColumnInfo is one column in a TableDescription.
+type ColumnInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	Default  string `json:"default,omitempty"`
+}
+
+// TableDescription is the result of `table describe` and the shell's \d.
+type TableDescription struct {
+	Table   string       `json:"table"`
+	Columns []ColumnInfo `json:"columns"`
+	Indexes []string     `json:"indexes"`
+}
+
+// DescribeTable prints the columns and indexes of a [schema.]table.
+func DescribeTable(dbname, table string, format OutputFormat) error {
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return describeTableTo(os.Stdout, db, table, format)
+}
+
+func describeTableTo(w io.Writer, db *sql.DB, name string, format OutputFormat) error {
+	d, err := describeTable(db, name)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case FormatJSONL:
+		return json.NewEncoder(w).Encode(d)
+	}
+	cols := []string{"column", "type", "nullable", "default"}
+	data := make([][]string, len(d.Columns))
+	for i, c := range d.Columns {
+		nullable := "yes"
+		if !c.Nullable {
+			nullable = "no"
+		}
+		data[i] = []string{c.Name, c.Type, nullable, c.Default}
+	}
+	switch format {
+	case FormatCSV, FormatTSV:
+		// Columns only, so the output stays one table.
+		return writeGrid(w, cols, data, format)
+	case FormatTable, FormatMarkdown:
+		fmt.Fprintf(w, "Table %s\n\n", d.Table)
+		if err := writeGrid(w, cols, data, format); err != nil {
+			return err
+		}
+		if len(d.Indexes) > 0 {
+			fmt.Fprintln(w, "\nIndexes:")
+			for _, ix := range d.Indexes {
+				if format == FormatMarkdown {
+					fmt.Fprintf(w, "- `%s`\n", ix)
+				} else {
+					fmt.Fprintln(w, "  "+ix)
+				}
+			}
+		}
+		return nil
+	}
+	fmt.Fprintf(w, "Table %s\n", d.Table)
+	fmt.Fprintf(w, "%-30s %-30s %-9s %s\n", "column", "type", "nullable", "default")
+	for _, row := range data {
+		fmt.Fprintf(w, "%-30s %-30s %-9s %s\n", row[0], row[1], row[2], row[3])
+	}
+	if len(d.Indexes) > 0 {
+		fmt.Fprintln(w, "Indexes:")
+		for _, ix := range d.Indexes {
+			fmt.Fprintln(w, "  "+ix)
+		}
+	}
+	return nil
+}
+
+func describeTable(db *sql.DB, name string) (TableDescription, error) {
+	d := TableDescription{Columns: []ColumnInfo{}, Indexes: []string{}}
+	qualified := quoteTableName(name)
+	var found sql.NullString
+	if err := db.QueryRow(`SELECT to_regclass($1)::text`, qualified).Scan(&found); err != nil {
+		return d, err
+	}
+	if !found.Valid {
+		return d, fmt.Errorf("table %q not found", name)
+	}
+	d.Table = found.String
+	rows, err := db.Query(`
+SELECT a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull,
+       COALESCE(pg_get_expr(ad.adbin, ad.adrelid), '')
+FROM pg_attribute a
+LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+WHERE a.attrelid = to_regclass($1) AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`, qualified)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c ColumnInfo
+		var notNull bool
+		if err := rows.Scan(&c.Name, &c.Type, &notNull, &c.Default); err != nil {
+			return d, err
+		}
+		c.Nullable = !notNull
+		d.Columns = append(d.Columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	idx, err := db.Query(`
+SELECT pg_get_indexdef(indexrelid)
+FROM pg_index
+WHERE indrelid = to_regclass($1)
+ORDER BY indisprimary DESC, indexrelid::regclass::text`, qualified)
+	if err != nil {
+		return d, err
+	}
+	defer idx.Close()
+	for idx.Next() {
+		var def string
+		if err := idx.Scan(&def); err != nil {
+			return d, err
+		}
+		d.Indexes = append(d.Indexes, def)
+	}
+	return d, idx.Err()
+}
@@ -0,0 +1,321 @@
+package dbtool
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// DumpOptions controls RunPgDumpWith.
+type DumpOptions struct {
+	StructureOnly bool
+	// Format is plain (default), custom or directory, mapped to pg_dump -F.
+	Format string
+	// Compress is pg_dump -Z (0-9); 0 leaves pg_dump's default.
+	Compress int
+	// Schemas limits the dump to these schemas (pg_dump -n) and
+	// ExcludeSchemas leaves these out (pg_dump -N). Both are exact names,
+	// not patterns.
+	Schemas        []string
+	ExcludeSchemas []string
+}
+
+// ImportOptions controls ImportDatabaseWith.
+type ImportOptions struct {
+	// Overwrite resets the public schema before importing.
+	Overwrite bool
+	// Jobs > 1 runs pg_restore in parallel (custom and directory archives).
+	Jobs int
+	// SingleTransaction restores everything in one transaction that is
+	// rolled back on the first error (psql -1 with ON_ERROR_STOP, or
+	// pg_restore --single-transaction). It cannot be combined with Jobs.
+	SingleTransaction bool
+	// Schemas and ExcludeSchemas select what Overwrite drops and, for
+	// archives, what pg_restore restores (-n/-N). See resetSchemas.
+	Schemas        []string
+	ExcludeSchemas []string
+}
+
+var dumpFormatFlag = map[string]string{"plain": "p", "custom": "c", "directory": "d"}
+
+// RunPgDumpWith executes pg_dump writing to path in the requested format.
+func RunPgDumpWith(dbname, path string, opts DumpOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if err := checkSchemasExist(dbname, append(append([]string{}, opts.Schemas...), opts.ExcludeSchemas...)); err != nil {
+		return err
+	}
+	cfg, err := GetDBConfig()
+	if err != nil {
+		return err
+	}
+	return pgDumpCommand(cfg, dbname, path, opts).Run()
+}
+
+// checkSchemasExist fails with "schema X does not exist" for the first name
+// not found in dbname, so a typo is not silently turned into an empty dump.
+func checkSchemasExist(dbname string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	existing, err := userSchemas(db)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool, len(existing))
+	for _, s := range existing {
+		have[s] = true
+	}
+	for _, n := range names {
+		if !have[n] {
+			return fmt.Errorf("schema %q does not exist in database %q", n, dbname)
+		}
+	}
+	return nil
+}
+
+// userSchemas lists the schemas in the connected database, leaving out the
+// system ones (pg_catalog, information_schema, pg_toast and temp schemas).
+func userSchemas(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`
+SELECT nspname FROM pg_namespace
+WHERE nspname NOT IN ('pg_catalog','information_schema')
+  AND nspname NOT LIKE 'pg\_%'
+ORDER BY nspname`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+// schemaArgs turns schema names into pg_dump/pg_restore -n/-N arguments.
+// The names are double-quoted so they match exactly instead of being read
+// as patterns.
+func schemaArgs(include, exclude []string) []string {
+	var args []string
+	quote := func(s string) string { return `"` + strings.ReplaceAll(s, `"`, `""`) + `"` }
+	for _, s := range include {
+		args = append(args, "-n", quote(s))
+	}
+	for _, s := range exclude {
+		args = append(args, "-N", quote(s))
+	}
+	return args
+}
+
+func (opts DumpOptions) validate() error {
+	if _, ok := dumpFormatFlag[opts.format()]; !ok {
+		return fmt.Errorf("invalid --format %q (want plain, custom or directory)", opts.Format)
+	}
+	if opts.Compress < 0 || opts.Compress > 9 {
+		return fmt.Errorf("invalid --compress %d (want 0-9)", opts.Compress)
+	}
+	return nil
+}
+
+func (opts DumpOptions) format() string {
+	if opts.Format == "" {
+		return "plain"
+	}
+	return opts.Format
+}
+
+// dumpStampLayout is the timestamp in <dbname>_<timestamp> dump names.
+const dumpStampLayout = "20060102_150405"
+
+// fileExt is the extension of a dump in opts' format: .sql (.sql.gz when
+// compressed), .dump for custom format and none for a directory.
+func (opts DumpOptions) fileExt() string {
+	switch opts.format() {
+	case "custom":
+		return ".dump"
+	case "directory":
+		return ""
+	}
+	if opts.Compress > 0 {
+		return ".sql.gz"
+	}
+	return ".sql"
+}
+
+// pgDumpCommand builds the pg_dump invocation for validated opts.
+func pgDumpCommand(cfg *DBConfig, dbname, path string, opts DumpOptions) *exec.Cmd {
+	format := opts.format()
+	f := dumpFormatFlag[format]
+	args := []string{"-f", path}
+	if format != "plain" {
+		args = append(args, "-F", f)
+	}
+	if opts.Compress > 0 {
+		args = append(args, "-Z", strconv.Itoa(opts.Compress))
+	}
+	if opts.StructureOnly {
+		args = append(args, "--schema-only")
+	}
+	args = append(args, schemaArgs(opts.Schemas, opts.ExcludeSchemas)...)
+	return pgCommand(cfg, "pg_dump", dbname, args...)
+}
+
+// Dump file kinds recognized by DetectDumpFormat.
+const (
+	DumpPlain     = "plain"
+	DumpPlainGzip = "plain+gzip"
+	DumpCustom    = "custom"
+	DumpTar       = "tar"
+	DumpDirectory = "directory"
+)
+
+// DetectDumpFormat inspects path: a directory containing toc.dat is a
+// directory archive, files starting with "PGDMP" are custom archives, tar
+// archives carry "ustar" at offset 257, gzip data is a compressed plain dump
+// (pg_dump -Fp -Z), and anything else is treated as plain SQL.
+func DetectDumpFormat(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		if _, err := os.Stat(filepath.Join(path, "toc.dat")); err != nil {
+			return "", fmt.Errorf("%s is a directory but not a pg_dump directory archive (no toc.dat)", path)
+		}
+		return DumpDirectory, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 262)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PGDMP")):
+		return DumpCustom, nil
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return DumpTar, nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return DumpPlainGzip, nil
+	default:
+		return DumpPlain, nil
+	}
+}
+
+// ImportDatabaseWith restores path into dbname, choosing psql for plain SQL
+// (gzip-compressed or not) and pg_restore for custom, tar and directory
+// archives.
+func ImportDatabaseWith(dbname, path string, opts ImportOptions) error {
+	kind, err := DetectDumpFormat(path)
+	if err != nil {
+		return err
+	}
+	vprintf("dbtool: %s looks like a %s dump\n", path, kind)
+	if opts.SingleTransaction && opts.Jobs > 1 && (kind == DumpCustom || kind == DumpDirectory) {
+		return fmt.Errorf("--single-transaction cannot be combined with --jobs")
+	}
+	filtered := len(opts.Schemas) > 0 || len(opts.ExcludeSchemas) > 0
+	if opts.Overwrite {
+		if err := resetSchemas(dbname, opts.Schemas, opts.ExcludeSchemas); err != nil {
+			return fmt.Errorf("overwrite reset failed: %w", err)
+		}
+	}
+	if filtered && (kind == DumpPlain || kind == DumpPlainGzip) {
+		fmt.Fprintln(os.Stderr, "dbtool: plain SQL dumps are restored in full; --schema/--exclude-schema only limit the --overwrite reset")
+	}
+	switch kind {
+	case DumpPlain:
+		if opts.Jobs > 1 {
+			fmt.Fprintln(os.Stderr, "dbtool: --jobs ignored for plain SQL dumps")
+		}
+		return runPSQLStream(dbname, path, false, opts)
+	case DumpPlainGzip:
+		if opts.Jobs > 1 {
+			fmt.Fprintln(os.Stderr, "dbtool: --jobs ignored for plain SQL dumps")
+		}
+		return runPSQLStream(dbname, path, true, opts)
+	default:
+		cfg, err := GetDBConfig()
+		if err != nil {
+			return err
+		}
+		args := []string{"--no-owner"}
+		if opts.Jobs > 1 {
+			if kind == DumpTar {
+				fmt.Fprintln(os.Stderr, "dbtool: --jobs ignored for tar archives")
+			} else {
+				args = append(args, "-j", strconv.Itoa(opts.Jobs))
+			}
+		}
+		if opts.SingleTransaction {
+			args = append(args, "--single-transaction")
+		}
+		if isVerbose() {
+			args = append(args, "--verbose")
+		}
+		args = append(args, schemaArgs(opts.Schemas, opts.ExcludeSchemas)...)
+		return pgCommand(cfg, "pg_restore", dbname, append(args, path)...).Run()
+	}
+}
+
+// resetSchemas is the --overwrite step of an import. Without schema options
+// it is ResetDatabase (public only). With include, exactly those schemas are
+// dropped; with only exclude, every user schema except those is dropped.
+// public is recreated afterwards because dumps do not create it; other
+// schemas are left for the dump to create.
+func resetSchemas(dbname string, include, exclude []string) error {
+	if len(include) == 0 && len(exclude) == 0 {
+		return ResetDatabase(dbname)
+	}
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	targets := include
+	if len(targets) == 0 {
+		if targets, err = userSchemas(db); err != nil {
+			return err
+		}
+	}
+	skip := make(map[string]bool, len(exclude))
+	for _, s := range exclude {
+		skip[s] = true
+	}
+	for _, s := range targets {
+		if skip[s] {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "dbtool: dropping schema %s\n", s)
+		if _, err := db.Exec("DROP SCHEMA IF EXISTS " + pq.QuoteIdentifier(s) + " CASCADE"); err != nil {
+			return err
+		}
+		if s == "public" {
+			if _, err := db.Exec("CREATE SCHEMA public"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package dbtool
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPgDumpCommandSchemas(t *testing.T) {
+	cfg := &DBConfig{URL: "postgres://u@h/db"}
+	opts := DumpOptions{StructureOnly: true, Schemas: []string{"app"}, ExcludeSchemas: []string{`we"ird`}}
+	cmd := pgDumpCommand(cfg, "other", "out.sql", opts)
+	want := []string{"pg_dump", "-d", "postgres://u@h/other", "-f", "out.sql", "--schema-only", "-n", `"app"`, "-N", `"we""ird"`}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("args = %q, want %q", cmd.Args, want)
+	}
+}
+
+func TestPgCommandPasswordNotInArgs(t *testing.T) {
+	for _, cfg := range []*DBConfig{
+		{URL: "postgres://u:hunter2@h/db?sslmode=require"},
+		{URL: "host=h user=u password='hunter2' dbname=db"},
+	} {
+		cmd := pgDumpCommand(cfg, "other", "out.sql", DumpOptions{})
+		if args := strings.Join(cmd.Args, " "); strings.Contains(args, "hunter2") {
+			t.Errorf("%s: args %q contain the password", cfg.URL, args)
+		}
+		if env := cmd.Env; len(env) == 0 || env[len(env)-1] != "PGPASSWORD=hunter2" {
+			t.Errorf("%s: PGPASSWORD not set for pg_dump", cfg.URL)
+		}
+	}
+}
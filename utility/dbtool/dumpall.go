@@ -0,0 +1,178 @@
+package dbtool
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DumpAllOptions controls DumpAllDatabases.
+type DumpAllOptions struct {
+	DumpOptions
+	// Exclude skips databases whose name matches.
+	Exclude *regexp.Regexp
+	// Jobs is how many databases are dumped at once (default 1).
+	Jobs int
+	// OnResult, if set, is called with each database's result as soon as
+	// it is known, from that dump's goroutine: with Jobs > 1 calls may run
+	// at the same time.
+	OnResult func(DumpResult)
+}
+
+// DumpResult is the outcome for one database in DumpAllDatabases.
+type DumpResult struct {
+	Database string
+	Path     string
+	Bytes    int64
+	Duration time.Duration
+	Err      error
+}
+
+// DumpAllDatabases dumps every non-template database the server allows
+// connections to into dir as <dbname>_<timestamp>.sql (.sql.gz when
+// compressed, .dump for custom format, a directory for directory format).
+// A failing database does not stop the others; the summary lists every
+// result and the returned error names the failures.
+func DumpAllDatabases(dir string, opts DumpAllOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	cfg, err := GetDBConfig()
+	if err != nil {
+		return err
+	}
+	names, err := dumpableDatabases()
+	if err != nil {
+		return err
+	}
+	var selected []string
+	for _, n := range names {
+		if opts.Exclude != nil && opts.Exclude.MatchString(n) {
+			vprintln("dbtool: excluding", n)
+			continue
+		}
+		selected = append(selected, n)
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no databases to dump")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	stamp := time.Now().Format(dumpStampLayout)
+	ext := opts.fileExt()
+	jobs := max(opts.Jobs, 1)
+	fmt.Fprintf(os.Stderr, "dbtool: dumping %d database(s) to %s with %d job(s)\n", len(selected), dir, jobs)
+
+	results := make([]DumpResult, len(selected))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, name := range selected {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res := DumpResult{Database: name, Path: filepath.Join(dir, name+"_"+stamp+ext)}
+			fmt.Fprintf(os.Stderr, "dbtool: dumping %s -> %s\n", name, res.Path)
+			start := time.Now()
+			cmd := pgDumpCommand(cfg, name, res.Path, opts.DumpOptions)
+			var stderr bytes.Buffer
+			cmd.Stdout = nil
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				if msg := lastLine(stderr.String()); msg != "" {
+					err = fmt.Errorf("%w: %s", err, msg)
+				}
+				res.Err = err
+			}
+			res.Duration = time.Since(start)
+			if res.Err == nil {
+				res.Bytes, res.Err = pathSize(res.Path)
+			}
+			results[i] = res
+			if opts.OnResult != nil {
+				opts.OnResult(res)
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	var failed []string
+	var total int64
+	fmt.Printf("%-30s %-6s %10s %10s  %s\n", "database", "status", "size", "duration", "file")
+	for _, r := range results {
+		status, size := "ok", humanBytes(r.Bytes)
+		if r.Err != nil {
+			status, size = "FAILED", "-"
+			failed = append(failed, r.Database)
+		}
+		total += r.Bytes
+		fmt.Printf("%-30s %-6s %10s %10s  %s\n", r.Database, status, size, r.Duration.Round(time.Millisecond), r.Path)
+	}
+	fmt.Printf("%d of %d database(s) dumped, %s total\n", len(results)-len(failed), len(results), humanBytes(total))
+	if len(failed) > 0 {
+		for _, r := range results {
+			if r.Err != nil {
+				fmt.Fprintf(os.Stderr, "dbtool: %s: %v\n", r.Database, r.Err)
+			}
+		}
+		return fmt.Errorf("%d database(s) failed: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// dumpableDatabases lists non-template databases that accept connections.
+func dumpableDatabases() ([]string, error) {
+	db, err := connectMaintenanceDB("")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT datname FROM pg_database WHERE NOT datistemplate AND datallowconn ORDER BY datname`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		names = append(names, n)
+	}
+	return names, rows.Err()
+}
+
+// pathSize is the size of a file, or the total of the files under a
+// directory.
+func pathSize(path string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,210 @@
+package dbtool
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	dbconf "cli-things/utility/dbconf"
+)
+
+// HistoryEntry is one line of the query history. Parameter values are never
+// stored, since they often carry secrets; only how many there were.
+type HistoryEntry struct {
+	// ID is the 1-based line number in the history file; it is not stored.
+	ID         int       `json:"-"`
+	Time       time.Time `json:"time"`
+	Database   string    `json:"db"`
+	Server     string    `json:"server,omitempty"`
+	Query      string    `json:"query"`
+	Params     int       `json:"params,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	// RowsReturned or RowsAffected is set when the count is known.
+	RowsReturned *int64 `json:"rowsReturned,omitempty"`
+	RowsAffected *int64 `json:"rowsAffected,omitempty"`
+	ExitCode     int    `json:"exitCode"`
+	Error        string `json:"error,omitempty"`
+}
+
+// HistoryEnabled reports whether queries should be recorded: DBTOOL_HISTORY
+// in the environment (or .env) wins, then DBTOOL_HISTORY in config.ini.
+func HistoryEnabled() bool {
+	v, ok := os.LookupEnv("DBTOOL_HISTORY")
+	if !ok {
+		if cfg, err := dbconf.GetRawConfig(); err == nil {
+			v = cfg["DBTOOL_HISTORY"]
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// HistoryPath is $XDG_DATA_HOME/dbtool/history.jsonl, by default
+// ~/.local/share/dbtool/history.jsonl.
+func HistoryPath() (string, error) {
+	base := strings.TrimSpace(os.Getenv("XDG_DATA_HOME"))
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(base, "dbtool", "history.jsonl"), nil
+}
+
+// NewHistoryEntry fills in an entry for a finished query.
+func NewHistoryEntry(dbname, query string, params int, stats QueryStats, exitCode int, err error) HistoryEntry {
+	e := HistoryEntry{
+		Time:       time.Now().Add(-stats.Duration).UTC().Truncate(time.Millisecond),
+		Database:   dbname,
+		Server:     historyServer(),
+		Query:      query,
+		Params:     params,
+		DurationMs: stats.Duration.Milliseconds(),
+		ExitCode:   exitCode,
+	}
+	if stats.Rows >= 0 {
+		n := stats.Rows
+		if stats.ReturnsRows {
+			e.RowsReturned = &n
+		} else {
+			e.RowsAffected = &n
+		}
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// historyServer is host[:port] of the configured server, without
+// credentials.
+func historyServer() string {
+	cfg, err := GetDBConfig()
+	if err != nil {
+		return ""
+	}
+	if u := strings.TrimSpace(cfg.URL); u != "" {
+		if pu, err := url.Parse(u); err == nil {
+			return pu.Host
+		}
+		return ""
+	}
+	if cfg.Host == "" {
+		return ""
+	}
+	return cfg.Host + ":" + cfg.Port
+}
+
+// AppendHistory adds e to the history file, creating it (readable only by
+// the user) if needed. Each entry is a single write to a file opened with
+// O_APPEND, so concurrent dbtool runs do not interleave lines.
+func AppendHistory(e HistoryEntry) error {
+	path, err := HistoryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadHistory returns every entry in the history file, oldest first. A
+// missing file is an empty history.
+func ReadHistory() ([]HistoryEntry, error) {
+	path, err := HistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []HistoryEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		var e HistoryEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		e.ID = line
+		out = append(out, e)
+	}
+	return out, sc.Err()
+}
+
+// HistoryByID returns the entry with the given id.
+func HistoryByID(id int) (HistoryEntry, error) {
+	entries, err := ReadHistory()
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	if id < 1 || id > len(entries) {
+		return HistoryEntry{}, fmt.Errorf("no history entry %d (history has %d)", id, len(entries))
+	}
+	return entries[id-1], nil
+}
+
+// ListHistory prints the history, optionally only entries for dbname and
+// whose query matches the regular expression grep.
+func ListHistory(dbname, grep string) error {
+	var re *regexp.Regexp
+	if grep != "" {
+		var err error
+		if re, err = regexp.Compile(grep); err != nil {
+			return fmt.Errorf("invalid --grep: %w", err)
+		}
+	}
+	entries, err := ReadHistory()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-6s %-19s %-20s %10s %8s %4s  %s\n", "id", "time", "db", "duration", "rows", "exit", "query")
+	for _, e := range entries {
+		if dbname != "" && e.Database != dbname {
+			continue
+		}
+		if re != nil && !re.MatchString(e.Query) {
+			continue
+		}
+		rows := "-"
+		switch {
+		case e.RowsReturned != nil:
+			rows = fmt.Sprint(*e.RowsReturned)
+		case e.RowsAffected != nil:
+			rows = fmt.Sprint(*e.RowsAffected)
+		}
+		took := (time.Duration(e.DurationMs) * time.Millisecond).String()
+		query := truncateCell(strings.Join(strings.Fields(e.Query), " "), 80)
+		fmt.Printf("%-6d %-19s %-20s %10s %8s %4d  %s\n", e.ID, e.Time.Local().Format("2006-01-02 15:04:05"), e.Database, took, rows, e.ExitCode, query)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package dbtool
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryAppendRead(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	if got, err := ReadHistory(); err != nil || len(got) != 0 {
+		t.Fatalf("empty history = %v, %v", got, err)
+	}
+	ok := NewHistoryEntry("app", "SELECT 1", 0, QueryStats{ReturnsRows: true, Rows: 1, Duration: 5 * time.Millisecond}, 0, nil)
+	failed := NewHistoryEntry("app", "UPDATE t SET x = $1", 2, QueryStats{Rows: -1}, 1, errors.New("boom"))
+	for _, e := range []HistoryEntry{ok, failed} {
+		if err := AppendHistory(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := ReadHistory()
+	if err != nil || len(got) != 2 {
+		t.Fatalf("ReadHistory = %d entries, %v", len(got), err)
+	}
+	if got[0].ID != 1 || got[0].RowsReturned == nil || *got[0].RowsReturned != 1 || got[0].DurationMs != 5 {
+		t.Errorf("entry 1 = %+v", got[0])
+	}
+	if got[1].ID != 2 || got[1].Params != 2 || got[1].RowsAffected != nil || got[1].ExitCode != 1 || got[1].Error != "boom" {
+		t.Errorf("entry 2 = %+v", got[1])
+	}
+	e, err := HistoryByID(2)
+	if err != nil || !strings.HasPrefix(e.Query, "UPDATE") {
+		t.Errorf("HistoryByID(2) = %+v, %v", e, err)
+	}
+	if _, err := HistoryByID(3); err == nil {
+		t.Error("HistoryByID(3) should fail")
+	}
+}
+
+func TestHistoryEnabled(t *testing.T) {
+	for v, want := range map[string]bool{"1": true, "true": true, "0": false, "": false} {
+		t.Setenv("DBTOOL_HISTORY", v)
+		if got := HistoryEnabled(); got != want {
+			t.Errorf("DBTOOL_HISTORY=%q: HistoryEnabled() = %v", v, got)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package dbtool
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// importProgressInterval is how often a plain-dump import reports progress.
+var importProgressInterval = 5 * time.Second
+
+// countingReader counts the bytes and newlines read through it. The counts
+// are read from another goroutine while psql consumes the stream.
+type countingReader struct {
+	r     io.Reader
+	bytes atomic.Int64
+	lines atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.bytes.Add(int64(n))
+	c.lines.Add(int64(bytes.Count(p[:n], []byte{'\n'})))
+	return n, err
+}
+
+// importProgressLine describes how far an import of total bytes is after
+// read bytes and elapsed time.
+func importProgressLine(read, total int64, elapsed time.Duration) string {
+	pct := 100.0
+	if total > 0 {
+		pct = float64(read) * 100 / float64(total)
+	}
+	line := fmt.Sprintf("dbtool: %5.1f%% (%s of %s)", pct, humanBytes(read), humanBytes(total))
+	if secs := elapsed.Seconds(); secs > 0 && read > 0 {
+		rate := float64(read) / secs
+		line += fmt.Sprintf(", %s/s", humanBytes(int64(rate)))
+		if read < total {
+			eta := time.Duration(float64(total-read) / rate * float64(time.Second))
+			line += ", about " + eta.Round(time.Second).String() + " left"
+		}
+	}
+	return line
+}
+
+// runPSQLStream feeds a plain dump (gzip-compressed if gz) to psql through
+// stdin, printing the share of the file read and the throughput every
+// importProgressInterval. The percentage is of the file on disk, so for
+// compressed dumps it tracks compressed bytes. If psql fails, the error says
+// how far into the dump it got; psql reads ahead, so that is an upper bound
+// and psql's own "psql:<stdin>:N:" message has the exact line.
+func runPSQLStream(dbname, path string, gz bool, opts ImportOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	file := &countingReader{r: f}
+	text := file
+	if gz {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		text = &countingReader{r: zr}
+	}
+	cfg, err := GetDBConfig()
+	if err != nil {
+		return err
+	}
+	args := []string{"-f", "-"}
+	if opts.SingleTransaction {
+		// Without ON_ERROR_STOP psql would carry on in an aborted
+		// transaction and report success.
+		args = append(args, "--single-transaction", "-v", "ON_ERROR_STOP=1")
+	}
+	cmd := pgCommand(cfg, "psql", dbname, args...)
+	cmd.Stdin = text
+
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("psql: %w", err)
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tick := time.NewTicker(importProgressInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				fmt.Fprintln(os.Stderr, importProgressLine(file.bytes.Load(), info.Size(), time.Since(started)))
+			}
+		}
+	}()
+	err = cmd.Wait()
+	close(done)
+	wg.Wait()
+
+	took := time.Since(started).Round(time.Millisecond)
+	if err != nil {
+		return fmt.Errorf("psql: %w (after %s, with %s of %s read; psql had read up to line %d, byte offset %d of the SQL)",
+			err, took, humanBytes(file.bytes.Load()), humanBytes(info.Size()), text.lines.Load()+1, text.bytes.Load())
+	}
+	fmt.Fprintf(os.Stderr, "dbtool: imported %s in %s\n", humanBytes(info.Size()), took)
+	return nil
+}
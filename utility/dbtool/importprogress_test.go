@@ -0,0 +1,38 @@
+package dbtool
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCountingReader(t *testing.T) {
+	c := &countingReader{r: strings.NewReader("SELECT 1;\nSELECT 2;\n\nSELECT 3;")}
+	if _, err := io.Copy(io.Discard, c); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.bytes.Load(); got != 30 {
+		t.Errorf("bytes = %d, want 30", got)
+	}
+	if got := c.lines.Load(); got != 3 {
+		t.Errorf("lines = %d, want 3", got)
+	}
+}
+
+func TestImportProgressLine(t *testing.T) {
+	cases := []struct {
+		read, total int64
+		elapsed     time.Duration
+		want        string
+	}{
+		{0, 4 << 20, 0, "dbtool:   0.0% (0 B of 4.0 MiB)"},
+		{1 << 20, 4 << 20, 2 * time.Second, "dbtool:  25.0% (1.0 MiB of 4.0 MiB), 512.0 KiB/s, about 6s left"},
+		{4 << 20, 4 << 20, 4 * time.Second, "dbtool: 100.0% (4.0 MiB of 4.0 MiB), 1.0 MiB/s"},
+	}
+	for _, c := range cases {
+		if got := importProgressLine(c.read, c.total, c.elapsed); got != c.want {
+			t.Errorf("importProgressLine(%d, %d, %s) = %q, want %q", c.read, c.total, c.elapsed, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package dbtool
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cli-things/internal/testdb"
+	"cli-things/utility/dbconf"
+)
+
+// The tests in this file run against a real server from internal/testdb
+// and skip when there is none.
+
+func TestMain(m *testing.M) { os.Exit(testdb.Run(m)) }
+
+// captureStdout returns what fn writes to os.Stdout.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	orig := os.Stdout
+	os.Stdout = f
+	runErr := fn()
+	os.Stdout = orig
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b), runErr
+}
+
+func params(t *testing.T, values ...string) []QueryParam {
+	t.Helper()
+	var out []QueryParam
+	for _, v := range values {
+		p, err := ParseParam(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func TestQueryDatabaseIntegration(t *testing.T) {
+	name, dsn := testdb.New(t)
+	testdb.Use(t, dsn, dbconf.Reload)
+
+	out, err := captureStdout(t, func() error {
+		return QueryDatabase(name, "CREATE TABLE public.people (id int PRIMARY KEY, name text NOT NULL, note text)", FormatText)
+	})
+	if err != nil || out != "OK\n" {
+		t.Fatalf("create table: %q, %v", out, err)
+	}
+	out, err = captureStdout(t, func() error {
+		return QueryDatabase(name, "INSERT INTO public.people VALUES ($1, $2, $3), ($4, $5, $6)", FormatText,
+			params(t, "int:1", "Ada", "null:", "int:2", "Grace", "text:it's quoted")...)
+	})
+	if err != nil || out != "OK (2 rows affected)\n" {
+		t.Fatalf("insert: %q, %v", out, err)
+	}
+
+	out, err = captureStdout(t, func() error {
+		return QueryDatabase(name, "SELECT id, name, note FROM public.people ORDER BY id", FormatJSON)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal([]byte(out), &rows); err != nil {
+		t.Fatalf("%v in %q", err, out)
+	}
+	want := []map[string]any{
+		{"id": float64(1), "name": "Ada", "note": nil},
+		{"id": float64(2), "name": "Grace", "note": "it's quoted"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+
+	defer func(limit int) { RowLimit = limit }(RowLimit)
+	RowLimit = 1
+	out, err = captureStdout(t, func() error {
+		return QueryDatabase(name, "SELECT name FROM public.people ORDER BY id", FormatJSONL)
+	})
+	if err != nil || out != `{"name":"Ada"}`+"\n" {
+		t.Errorf("limited JSONL = %q, %v; want the first row only", out, err)
+	}
+}
+
+func TestQueryDatabaseErrorIntegration(t *testing.T) {
+	name, dsn := testdb.New(t)
+	testdb.Use(t, dsn, dbconf.Reload)
+
+	_, err := captureStdout(t, func() error {
+		return QueryDatabase(name, "SELECT 1,\n  missing_column", FormatText)
+	})
+	var sqlErr *SQLError
+	if !errors.As(err, &sqlErr) {
+		t.Fatalf("err = %v, want a *SQLError", err)
+	}
+	if code := string(sqlErr.Err.Code); code != "42703" {
+		t.Errorf("SQLSTATE = %s, want 42703 (undefined column)", code)
+	}
+	if line, col, ok := sqlErr.Position(); !ok || line != 2 || col != 3 {
+		t.Errorf("position = %d:%d (%v), want 2:3", line, col, ok)
+	}
+	if !strings.Contains(err.Error(), "missing_column") {
+		t.Errorf("error %q does not name the column", err)
+	}
+}
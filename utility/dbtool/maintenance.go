@@ -0,0 +1,128 @@
+package dbtool
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	dbconf "cli-things/utility/dbconf"
+
+	"github.com/lib/pq"
+)
+
+// MaintenanceOptions controls RunMaintenance.
+type MaintenanceOptions struct {
+	// Full runs VACUUM FULL (vacuum only).
+	Full bool
+	// Verbose adds the VERBOSE option; the server's progress messages are
+	// printed to stderr as they arrive.
+	Verbose bool
+	// DryRun prints the statements instead of running them.
+	DryRun bool
+}
+
+// maintenanceStatement builds the statement for op on an already quoted
+// table name.
+func maintenanceStatement(op, quotedTable string, opts MaintenanceOptions) (string, error) {
+	var options []string
+	switch op {
+	case "vacuum":
+		if opts.Full {
+			options = append(options, "FULL")
+		}
+	case "analyze", "reindex":
+		if opts.Full {
+			return "", fmt.Errorf("--full only applies to vacuum")
+		}
+	default:
+		return "", fmt.Errorf("unknown maintenance operation %q (want vacuum, analyze or reindex)", op)
+	}
+	if opts.Verbose {
+		options = append(options, "VERBOSE")
+	}
+	stmt := strings.ToUpper(op)
+	if len(options) > 0 {
+		stmt += " (" + strings.Join(options, ", ") + ")"
+	}
+	if op == "reindex" {
+		stmt += " TABLE"
+	}
+	return stmt + " " + quotedTable, nil
+}
+
+// RunMaintenance runs VACUUM, ANALYZE or REINDEX on one table, or on every
+// user table in dbname one at a time when table is empty, so progress is
+// visible per table.
+func RunMaintenance(dbname, op, table string, opts MaintenanceOptions) error {
+	if _, err := maintenanceStatement(op, "t", opts); err != nil {
+		return err
+	}
+	db, err := dbconf.ConnectDBAsWithNotices(dbname, func(n *pq.Error) {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", n.Severity, n.Message)
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var tables []string
+	if table != "" {
+		missing, err := missingTables(db, []string{table})
+		if err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("table %q not found", table)
+		}
+		tables = []string{quoteTableName(table)}
+	} else if tables, err = userTables(db); err != nil {
+		return err
+	}
+
+	started := time.Now()
+	for i, t := range tables {
+		stmt, _ := maintenanceStatement(op, t, opts)
+		if opts.DryRun {
+			fmt.Println(stmt + ";")
+			continue
+		}
+		fmt.Printf("[%d/%d] %s\n", i+1, len(tables), stmt)
+		t0 := time.Now()
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+		vprintf("dbtool: %s took %s\n", stmt, time.Since(t0).Round(time.Millisecond))
+	}
+	if !opts.DryRun {
+		fmt.Printf("%s finished on %d table(s) in %s\n", op, len(tables), time.Since(started).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// userTables returns the quoted names of all ordinary and partitioned tables
+// outside the system schemas.
+func userTables(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`
+SELECT n.nspname, c.relname
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('r','p')
+  AND n.nspname NOT IN ('pg_catalog','information_schema')
+  AND n.nspname NOT LIKE 'pg_toast%'
+ORDER BY n.nspname, c.relname`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var s, t string
+		if err := rows.Scan(&s, &t); err != nil {
+			return nil, err
+		}
+		out = append(out, pq.QuoteIdentifier(s)+"."+pq.QuoteIdentifier(t))
+	}
+	return out, rows.Err()
+}
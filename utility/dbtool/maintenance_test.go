@@ -0,0 +1,33 @@
+package dbtool
+
+import "testing"
+
+func TestMaintenanceStatement(t *testing.T) {
+	cases := []struct {
+		op   string
+		opts MaintenanceOptions
+		want string
+	}{
+		{"vacuum", MaintenanceOptions{}, `VACUUM "public"."t"`},
+		{"vacuum", MaintenanceOptions{Full: true, Verbose: true}, `VACUUM (FULL, VERBOSE) "public"."t"`},
+		{"analyze", MaintenanceOptions{Verbose: true}, `ANALYZE (VERBOSE) "public"."t"`},
+		{"reindex", MaintenanceOptions{}, `REINDEX TABLE "public"."t"`},
+		{"reindex", MaintenanceOptions{Verbose: true}, `REINDEX (VERBOSE) TABLE "public"."t"`},
+	}
+	for _, c := range cases {
+		got, err := maintenanceStatement(c.op, quoteTableName("t"), c.opts)
+		if err != nil {
+			t.Errorf("%s %+v: %v", c.op, c.opts, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s %+v = %q, want %q", c.op, c.opts, got, c.want)
+		}
+	}
+	if _, err := maintenanceStatement("analyze", "t", MaintenanceOptions{Full: true}); err == nil {
+		t.Error("--full with analyze should fail")
+	}
+	if _, err := maintenanceStatement("cluster", "t", MaintenanceOptions{}); err == nil {
+		t.Error("unknown op should fail")
+	}
+}
@@ -0,0 +1,148 @@
+package dbtool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dbconf "cli-things/utility/dbconf"
+)
+
+// migrationFileRe matches the repo's migration naming scheme:
+// YYYYMMDD_NNNN_name.sql, where NNNN is a sequence shared across dates.
+var migrationFileRe = regexp.MustCompile(`^(\d{8})_(\d{4})_(.+)\.sql$`)
+
+var nonSlugRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// CreateMigration writes an empty migration named <today>_<next seq>_<name>.sql
+// into the configured migrations directory and returns its path.
+func CreateMigration(name string) (string, error) {
+	slug := strings.Trim(nonSlugRe.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if slug == "" {
+		return "", errors.New("migration name must contain letters or digits")
+	}
+	dir, err := dbconf.ConfiguredMigrationsDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	next := 1
+	for _, ent := range entries {
+		m := migrationFileRe.FindStringSubmatch(ent.Name())
+		if m == nil {
+			continue
+		}
+		if n, err := strconv.Atoi(m[2]); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s_%04d_%s.sql", time.Now().Format("20060102"), next, slug))
+	body := fmt.Sprintf("-- %s\n-- Dependencies: \n\n", strings.ReplaceAll(slug, "_", " "))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(body); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// MigrationState is one row of `migrate status`.
+type MigrationState struct {
+	ID        string     `json:"id"`
+	Status    string     `json:"status"` // applied, pending, or missing (applied but file gone)
+	Down      bool       `json:"down"`   // a down file exists, so it can be rolled back
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// MigrationStatus compares the configured migrations directory with
+// the migrations table (DB_MIGRATIONS_TABLE) in dbname.
+func MigrationStatus(dbname string) ([]MigrationState, error) {
+	dir, err := dbconf.ConfiguredMigrationsDir()
+	if err != nil {
+		return nil, err
+	}
+	vprintln("dbtool: migrations dir:", dir)
+	migs, err := dbconf.ReadMigrationsDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	applied, err := dbconf.AppliedMigrations(context.Background(), db)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []MigrationState
+	seen := make(map[string]bool, len(migs))
+	for _, m := range migs {
+		seen[m.ID] = true
+		st := MigrationState{ID: m.ID, Status: "pending", Down: m.HasDown}
+		if at, ok := applied[m.ID]; ok {
+			at := at
+			st.Status, st.AppliedAt = "applied", &at
+		}
+		out = append(out, st)
+	}
+	for id, at := range applied {
+		if !seen[id] {
+			at := at
+			out = append(out, MigrationState{ID: id, Status: "missing", AppliedAt: &at})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// PrintMigrationStatus prints MigrationStatus as text or JSON.
+func PrintMigrationStatus(dbname string, asJSON bool) error {
+	states, err := MigrationStatus(dbname)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		if states == nil {
+			states = []MigrationState{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(states)
+	}
+	pending := 0
+	for _, st := range states {
+		at := ""
+		if st.AppliedAt != nil {
+			at = st.AppliedAt.Local().Format(time.RFC3339)
+		}
+		if st.Status == "pending" {
+			pending++
+		}
+		down := ""
+		if st.Down {
+			down = "down"
+		}
+		fmt.Printf("%-8s %-25s %-4s %s\n", st.Status, at, down, st.ID)
+	}
+	fmt.Printf("%d migration(s), %d pending\n", len(states), pending)
+	return nil
+}
@@ -0,0 +1,306 @@
+package dbtool
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// MaxColWidth caps column width in FormatTable output; longer values are
+// cut with an ellipsis. 0 means no limit.
+var MaxColWidth = 40
+
+// RowLimit stops query output after this many rows, with a notice on
+// stderr. 0 means no limit; dbtool's query command sets it from --limit.
+var RowLimit = 0
+
+// printRows writes the rows of rows to w in the given format, stopping after
+// limit rows when limit is positive. n is the number of rows written and
+// truncated reports whether more rows were left. Text, CSV/TSV, JSON and
+// JSON lines rows are written as they are scanned (JSON as an array streamed
+// one element at a time, JSON lines as one object per line and write); table
+// and markdown are buffered, since they need every row to size the columns.
+func printRows(w io.Writer, rows *sql.Rows, format OutputFormat, limit int) (n int64, truncated bool, err error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return n, false, err
+	}
+	dbTypes := make([]string, len(cols))
+	if cts, err := rows.ColumnTypes(); err == nil {
+		for i, ct := range cts {
+			dbTypes[i] = strings.ToUpper(ct.DatabaseTypeName())
+		}
+	}
+	vals := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	var cw *csv.Writer
+	if format == FormatCSV || format == FormatTSV {
+		cw = csv.NewWriter(w)
+		if format == FormatTSV {
+			cw.Comma = '\t'
+		}
+		if err := cw.Write(cols); err != nil {
+			return n, false, err
+		}
+	}
+	var grid [][]string
+	for rows.Next() {
+		if limit > 0 && n == int64(limit) {
+			truncated = true
+			break
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, false, err
+		}
+		switch {
+		case cw != nil:
+			record := make([]string, len(cols))
+			for i, v := range vals {
+				if v != nil {
+					record[i] = fmt.Sprint(normalizeValue(v, dbTypes[i]))
+				}
+			}
+			if err := cw.Write(record); err != nil {
+				return n, false, err
+			}
+		case format == FormatJSONL:
+			rec := make(map[string]any, len(cols))
+			for i, c := range cols {
+				rec[c] = normalizeValue(vals[i], dbTypes[i])
+			}
+			b, err := json.Marshal(rec)
+			if err != nil {
+				return n, false, err
+			}
+			if _, err := w.Write(append(b, '\n')); err != nil {
+				return n, false, err
+			}
+		case format == FormatJSON:
+			rec := make(map[string]any, len(cols))
+			for i, c := range cols {
+				rec[c] = normalizeValue(vals[i], dbTypes[i])
+			}
+			b, err := json.MarshalIndent(rec, "  ", "  ")
+			if err != nil {
+				return n, false, err
+			}
+			sep := ",\n  "
+			if n == 0 {
+				sep = "[\n  "
+			}
+			if _, err := fmt.Fprintf(w, "%s%s", sep, b); err != nil {
+				return n, false, err
+			}
+		case format == FormatTable || format == FormatMarkdown:
+			record := make([]string, len(cols))
+			for i, v := range vals {
+				record[i] = textValue(v, dbTypes[i])
+			}
+			grid = append(grid, record)
+		default:
+			// simple table-ish print
+			parts := make([]string, len(cols))
+			for i, c := range cols {
+				parts[i] = fmt.Sprintf("%s=%s", c, textValue(vals[i], dbTypes[i]))
+			}
+			fmt.Fprintln(w, strings.Join(parts, " | "))
+		}
+		n++
+	}
+	if !truncated {
+		if err := rows.Err(); err != nil {
+			return n, false, err
+		}
+	}
+	if cw != nil {
+		cw.Flush()
+		return n, truncated, cw.Error()
+	}
+	if format == FormatJSON {
+		closing := "\n]\n"
+		if n == 0 {
+			closing = "[]\n"
+		}
+		_, err := io.WriteString(w, closing)
+		return n, truncated, err
+	}
+	if format == FormatTable || format == FormatMarkdown {
+		return n, truncated, writeGrid(w, cols, grid, format)
+	}
+	return n, truncated, nil
+}
+
+// writeGrid renders already-formatted cells. It supports every format so
+// commands with fixed columns (sizes, describe) can share it; JSON emits an
+// array of objects with string values and JSON lines one object per line.
+func writeGrid(w io.Writer, cols []string, data [][]string, format OutputFormat) error {
+	switch format {
+	case FormatCSV, FormatTSV:
+		cw := csv.NewWriter(w)
+		if format == FormatTSV {
+			cw.Comma = '\t'
+		}
+		cw.Write(cols)
+		cw.WriteAll(data)
+		return cw.Error()
+	case FormatJSON:
+		out := make([]map[string]string, 0, len(data))
+		for _, row := range data {
+			rec := make(map[string]string, len(cols))
+			for i, c := range cols {
+				rec[c] = row[i]
+			}
+			out = append(out, rec)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, row := range data {
+			rec := make(map[string]string, len(cols))
+			for i, c := range cols {
+				rec[c] = row[i]
+			}
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatMarkdown:
+		esc := func(s string) string {
+			return strings.ReplaceAll(flattenCell(s), "|", `\|`)
+		}
+		line := func(cells []string) {
+			parts := make([]string, len(cells))
+			for i, c := range cells {
+				parts[i] = esc(c)
+			}
+			fmt.Fprintf(w, "| %s |\n", strings.Join(parts, " | "))
+		}
+		line(cols)
+		seps := make([]string, len(cols))
+		for i := range seps {
+			seps[i] = "---"
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(seps, " | "))
+		for _, row := range data {
+			line(row)
+		}
+		return nil
+	case FormatTable:
+		cell := func(s string) string { return truncateCell(flattenCell(s), MaxColWidth) }
+		widths := make([]int, len(cols))
+		for i, c := range cols {
+			widths[i] = utf8.RuneCountInString(cell(c))
+		}
+		for _, row := range data {
+			for i, v := range row {
+				widths[i] = max(widths[i], utf8.RuneCountInString(cell(v)))
+			}
+		}
+		line := func(cells []string) {
+			parts := make([]string, len(cells))
+			for i, c := range cells {
+				c = cell(c)
+				parts[i] = c + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c))
+			}
+			fmt.Fprintln(w, strings.TrimRight(strings.Join(parts, " | "), " "))
+		}
+		line(cols)
+		seps := make([]string, len(cols))
+		for i := range seps {
+			seps[i] = strings.Repeat("-", widths[i])
+		}
+		fmt.Fprintln(w, strings.Join(seps, "-+-"))
+		for _, row := range data {
+			line(row)
+		}
+		if len(data) == 1 {
+			fmt.Fprintln(w, "(1 row)")
+		} else {
+			fmt.Fprintf(w, "(%d rows)\n", len(data))
+		}
+		return nil
+	default:
+		for _, row := range data {
+			parts := make([]string, len(cols))
+			for i, c := range cols {
+				parts[i] = c + "=" + row[i]
+			}
+			fmt.Fprintln(w, strings.Join(parts, " | "))
+		}
+		return nil
+	}
+}
+
+// writeJSONLError ends a JSON lines stream with an object describing err:
+// {"error": "..."} plus the SQLSTATE and position for server errors.
+func writeJSONLError(w io.Writer, err error) {
+	rec := map[string]any{"error": err.Error()}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		rec["error"] = pqErr.Message
+		rec["sqlstate"] = string(pqErr.Code)
+	}
+	var sqlErr *SQLError
+	if errors.As(err, &sqlErr) {
+		if line, col, ok := sqlErr.Position(); ok {
+			rec["line"], rec["column"] = line, col
+		}
+	}
+	json.NewEncoder(w).Encode(rec)
+}
+
+// flattenCell keeps multi-line values on one grid line.
+func flattenCell(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ").Replace(s)
+}
+
+// truncateCell shortens s to limit runes, ending in an ellipsis.
+func truncateCell(s string, limit int) string {
+	if limit <= 0 || utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	return string([]rune(s)[:limit-1]) + "…"
+}
+
+// normalizeValue turns a value scanned by lib/pq into something that prints
+// sensibly. lib/pq returns text, numeric and many other types as []byte,
+// which fmt renders as a byte list and encoding/json as base64; those become
+// strings. bytea stays binary, so it is rendered as hex like psql does.
+// Timestamps use RFC 3339. NULL stays nil.
+func normalizeValue(v any, dbType string) any {
+	switch x := v.(type) {
+	case []byte:
+		if dbType == "BYTEA" {
+			return `\x` + hex.EncodeToString(x)
+		}
+		return string(x)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	default:
+		return v
+	}
+}
+
+// textValue renders a value for the default text output, where NULL is
+// spelled out.
+func textValue(v any, dbType string) string {
+	if v == nil {
+		return "NULL"
+	}
+	return fmt.Sprint(normalizeValue(v, dbType))
+}
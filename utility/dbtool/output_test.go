@@ -0,0 +1,246 @@
+package dbtool
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+// mixedRows returns rows shaped like what lib/pq hands back: text and numeric
+// as []byte, bytea as raw bytes, timestamps as time.Time, NULL as nil.
+func mixedRows(t *testing.T) *sql.Rows {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	ts := time.Date(2026, 10, 16, 12, 30, 0, 0, time.UTC)
+	rows := mock.NewRowsWithColumnDefinition(
+		sqlmock.NewColumn("name").OfType("TEXT", ""),
+		sqlmock.NewColumn("blob").OfType("BYTEA", ""),
+		sqlmock.NewColumn("amount").OfType("NUMERIC", ""),
+		sqlmock.NewColumn("created").OfType("TIMESTAMPTZ", ""),
+		sqlmock.NewColumn("note").OfType("TEXT", ""),
+	).AddRow([]byte("hello"), []byte{0xde, 0xad}, []byte("12.50"), ts, nil)
+	mock.ExpectQuery("SELECT").WillReturnRows(rows)
+	r, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestPrintRowsText(t *testing.T) {
+	var buf bytes.Buffer
+	if _, _, err := printRows(&buf, mixedRows(t), FormatText, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := `name=hello | blob=\xdead | amount=12.50 | created=2026-10-16T12:30:00Z | note=NULL` + "\n"
+	if buf.String() != want {
+		t.Errorf("got  %q\nwant %q", buf.String(), want)
+	}
+}
+
+func TestPrintRowsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if _, _, err := printRows(&buf, mixedRows(t), FormatJSON, 0); err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"name":    "hello",
+		"blob":    `\xdead`,
+		"amount":  "12.50",
+		"created": "2026-10-16T12:30:00Z",
+		"note":    nil,
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d rows, want 1", len(got))
+	}
+	for k, v := range want {
+		if got[0][k] != v {
+			t.Errorf("%s = %#v, want %#v", k, got[0][k], v)
+		}
+	}
+}
+
+func TestPrintRowsCSVAndTSV(t *testing.T) {
+	var buf bytes.Buffer
+	if _, _, err := printRows(&buf, mixedRows(t), FormatCSV, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := "name,blob,amount,created,note\nhello,\\xdead,12.50,2026-10-16T12:30:00Z,\n"
+	if buf.String() != want {
+		t.Errorf("csv got %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if _, _, err := printRows(&buf, mixedRows(t), FormatTSV, 0); err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.ReplaceAll(want, ",", "\t"); buf.String() != want {
+		t.Errorf("tsv got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestPrintRowsCSVQuoting(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"v"}).AddRow([]byte("a,\"b\"\nc")))
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var buf bytes.Buffer
+	if _, _, err := printRows(&buf, rows, FormatCSV, 0); err != nil {
+		t.Fatal(err)
+	}
+	if want := "v\n\"a,\"\"b\"\"\nc\"\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestPrintRowsTable(t *testing.T) {
+	defer func(old int) { MaxColWidth = old }(MaxColWidth)
+	MaxColWidth = 8
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "description"}).
+		AddRow([]byte("1"), []byte("short")).
+		AddRow([]byte("22"), []byte("much too long\nvalue")).
+		AddRow([]byte("3"), nil))
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var buf bytes.Buffer
+	if _, _, err := printRows(&buf, rows, FormatTable, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := "id | descrip…\n" +
+		"---+---------\n" +
+		"1  | short\n" +
+		"22 | much to…\n" +
+		"3  | NULL\n" +
+		"(3 rows)\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteGridMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeGrid(&buf, []string{"a", "b"}, [][]string{{"x|y", "two\nlines"}}, FormatMarkdown); err != nil {
+		t.Fatal(err)
+	}
+	want := "| a | b |\n| --- | --- |\n| x\\|y | two lines |\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestPrintRowsLimitJSON(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id"}).
+		AddRow([]byte("1")).AddRow([]byte("2")).AddRow([]byte("3")))
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var buf bytes.Buffer
+	n, truncated, err := printRows(&buf, rows, FormatJSON, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !truncated || n != 2 {
+		t.Errorf("n=%d truncated=%v, want 2 rows and truncated", n, truncated)
+	}
+	if want := "[\n  {\n    \"id\": \"1\"\n  },\n  {\n    \"id\": \"2\"\n  }\n]\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow([]byte("1")))
+	rows, err = db.Query("SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	buf.Reset()
+	if _, truncated, err := printRows(&buf, rows, FormatJSON, 1); err != nil || truncated {
+		t.Errorf("exactly limit rows: truncated=%v err=%v", truncated, err)
+	}
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	rows, err = db.Query("SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	buf.Reset()
+	if _, _, err := printRows(&buf, rows, FormatJSON, 0); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("empty result = %q, want []", buf.String())
+	}
+}
+
+func TestPrintRowsJSONL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
+		AddRow([]byte("1"), []byte("a")).AddRow([]byte("2"), nil).AddRow([]byte("3"), []byte("c")))
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var buf bytes.Buffer
+	n, truncated, err := printRows(&buf, rows, FormatJSONL, 2)
+	if err != nil || n != 2 || !truncated {
+		t.Fatalf("n=%d truncated=%v err=%v", n, truncated, err)
+	}
+	if want := "{\"id\":\"1\",\"name\":\"a\"}\n{\"id\":\"2\",\"name\":null}\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteJSONLError(t *testing.T) {
+	var buf bytes.Buffer
+	writeJSONLError(&buf, withPosition(&pq.Error{Code: "42703", Message: `column "x" does not exist`, Position: "8"}, "SELECT x"))
+	if want := "{\"column\":8,\"error\":\"column \\\"x\\\" does not exist\",\"line\":1,\"sqlstate\":\"42703\"}\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	buf.Reset()
+	writeJSONLError(&buf, ErrQueryCanceled)
+	if want := "{\"error\":\"query canceled\"}\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,169 @@
+package dbtool
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// QueryParam is one --param value for QueryDatabase. Value is passed to the
+// driver as a bind parameter; a non-empty Cast is appended to every use of the
+// matching $n placeholder so the server does not have to infer the type.
+type QueryParam struct {
+	Value any
+	Cast  string
+}
+
+// paramCasts maps the type hints accepted by ParseParam to SQL types.
+var paramCasts = map[string]string{
+	"int":       "bigint",
+	"float":     "double precision",
+	"numeric":   "numeric",
+	"bool":      "boolean",
+	"text":      "text",
+	"json":      "jsonb",
+	"uuid":      "uuid",
+	"date":      "date",
+	"timestamp": "timestamptz",
+}
+
+// ParseParam parses a --param value. "type:value" with a known type (int,
+// float, numeric, bool, text, json, uuid, date, timestamp) validates and casts
+// the value; "null:" binds NULL. Anything else, including values that merely
+// contain a colon such as URLs, is bound as an untyped string.
+func ParseParam(s string) (QueryParam, error) {
+	hint, val, ok := strings.Cut(s, ":")
+	if !ok {
+		return QueryParam{Value: s}, nil
+	}
+	hint = strings.ToLower(hint)
+	if hint == "null" {
+		if val != "" {
+			return QueryParam{}, fmt.Errorf("param %q: null takes no value (use \"null:\")", s)
+		}
+		return QueryParam{Value: nil}, nil
+	}
+	cast, known := paramCasts[hint]
+	if !known {
+		return QueryParam{Value: s}, nil
+	}
+	p := QueryParam{Value: val, Cast: cast}
+	switch hint {
+	case "int":
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return QueryParam{}, fmt.Errorf("param %q: not an integer", s)
+		}
+		p.Value = n
+	case "float":
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return QueryParam{}, fmt.Errorf("param %q: not a number", s)
+		}
+		p.Value = f
+	case "bool":
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return QueryParam{}, fmt.Errorf("param %q: not a boolean", s)
+		}
+		p.Value = b
+	case "json":
+		if !json.Valid([]byte(val)) {
+			return QueryParam{}, fmt.Errorf("param %q: invalid JSON", s)
+		}
+	}
+	return p, nil
+}
+
+// bindParams returns the query with casts applied to typed placeholders and
+// the driver arguments. Placeholders inside string literals, quoted
+// identifiers, comments and dollar-quoted bodies are left alone.
+func bindParams(query string, params []QueryParam) (string, []any) {
+	args := make([]any, len(params))
+	anyCast := false
+	for i, p := range params {
+		args[i] = p.Value
+		anyCast = anyCast || p.Cast != ""
+	}
+	if !anyCast {
+		return query, args
+	}
+
+	var b strings.Builder
+	n := len(query)
+	for i := 0; i < n; {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			j := i + 1
+			for j < n {
+				if query[j] == c {
+					if j+1 < n && query[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			j = min(j+1, n)
+			b.WriteString(query[i:j])
+			i = j
+		case c == '-' && i+1 < n && query[i+1] == '-':
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = n - i
+			}
+			b.WriteString(query[i : i+j])
+			i += j
+		case c == '/' && i+1 < n && query[i+1] == '*':
+			j := strings.Index(query[i+2:], "*/")
+			end := n
+			if j >= 0 {
+				end = i + 2 + j + 2
+			}
+			b.WriteString(query[i:end])
+			i = end
+		case c == '$' && (i == 0 || !isIdentByte(query[i-1])):
+			j := i + 1
+			for j < n && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			if j > i+1 {
+				b.WriteString(query[i:j])
+				if idx, err := strconv.Atoi(query[i+1 : j]); err == nil && idx >= 1 && idx <= len(params) && params[idx-1].Cast != "" {
+					b.WriteString("::" + params[idx-1].Cast)
+				}
+				i = j
+				continue
+			}
+			// Dollar quote: $$...$$ or $tag$...$tag$.
+			for j < n && isIdentByte(query[j]) {
+				j++
+			}
+			if j < n && query[j] == '$' {
+				tag := query[i : j+1]
+				end := strings.Index(query[j+1:], tag)
+				if end < 0 {
+					end = n
+				} else {
+					end = j + 1 + end + len(tag)
+				}
+				b.WriteString(query[i:end])
+				i = end
+				continue
+			}
+			b.WriteByte(c)
+			i++
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), args
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
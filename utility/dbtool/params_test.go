@@ -0,0 +1,56 @@
+package dbtool
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseParam(t *testing.T) {
+	cases := []struct {
+		in   string
+		want QueryParam
+	}{
+		{"a@b.com", QueryParam{Value: "a@b.com"}},
+		{"https://example.com", QueryParam{Value: "https://example.com"}},
+		{"int:42", QueryParam{Value: int64(42), Cast: "bigint"}},
+		{"float:1.5", QueryParam{Value: 1.5, Cast: "double precision"}},
+		{"bool:true", QueryParam{Value: true, Cast: "boolean"}},
+		{"text:int:42", QueryParam{Value: "int:42", Cast: "text"}},
+		{`json:{"a":1}`, QueryParam{Value: `{"a":1}`, Cast: "jsonb"}},
+		{"null:", QueryParam{Value: nil}},
+	}
+	for _, c := range cases {
+		got, err := ParseParam(c.in)
+		if err != nil {
+			t.Errorf("ParseParam(%q): %v", c.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseParam(%q) = %#v, want %#v", c.in, got, c.want)
+		}
+	}
+	for _, bad := range []string{"int:x", "bool:maybe", "json:{", "null:x"} {
+		if _, err := ParseParam(bad); err == nil {
+			t.Errorf("ParseParam(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	params := []QueryParam{{Value: int64(1), Cast: "bigint"}, {Value: "x"}}
+	q, args := bindParams(`SELECT $1, $2, '$1', "$1", $f$ $1 $f$, a$1 -- $1
+/* $1 */ FROM t WHERE id = $1`, params)
+	want := `SELECT $1::bigint, $2, '$1', "$1", $f$ $1 $f$, a$1 -- $1
+/* $1 */ FROM t WHERE id = $1::bigint`
+	if q != want {
+		t.Errorf("query\n got %q\nwant %q", q, want)
+	}
+	if !reflect.DeepEqual(args, []any{int64(1), "x"}) {
+		t.Errorf("args = %#v", args)
+	}
+
+	q, _ = bindParams("SELECT $1", []QueryParam{{Value: "x"}})
+	if q != "SELECT $1" {
+		t.Errorf("untyped params should not rewrite the query, got %q", q)
+	}
+}
@@ -0,0 +1,324 @@
+package dbtool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CompareOptions controls CompareQuery.
+type CompareOptions struct {
+	Timeout time.Duration
+	Params  []QueryParam
+	// Key names the columns that identify a row. Rows with the same key but
+	// other values are reported as differing; without Key whole rows are
+	// matched, so a changed row shows up once only in A and once only in B.
+	Key []string
+}
+
+// CompareRow is one result row, column name to value; NULL is nil.
+type CompareRow map[string]any
+
+// RowDifference is a key present on both sides with different values.
+type RowDifference struct {
+	Key CompareRow `json:"key"`
+	A   CompareRow `json:"a"`
+	B   CompareRow `json:"b"`
+}
+
+// QueryComparison is the outcome of CompareQuery. Rows are compared on the
+// columns both results have, matched by name, so column order does not
+// matter.
+type QueryComparison struct {
+	DatabaseA      string          `json:"dbA"`
+	DatabaseB      string          `json:"dbB"`
+	Columns        []string        `json:"columns"`
+	ColumnsOnlyInA []string        `json:"columnsOnlyInA,omitempty"`
+	ColumnsOnlyInB []string        `json:"columnsOnlyInB,omitempty"`
+	RowsA          int             `json:"rowsA"`
+	RowsB          int             `json:"rowsB"`
+	OnlyInA        []CompareRow    `json:"onlyInA"`
+	OnlyInB        []CompareRow    `json:"onlyInB"`
+	Differing      []RowDifference `json:"differing"`
+}
+
+// Identical reports whether both results have the same columns and rows.
+func (c *QueryComparison) Identical() bool {
+	return len(c.ColumnsOnlyInA) == 0 && len(c.ColumnsOnlyInB) == 0 &&
+		len(c.OnlyInA) == 0 && len(c.OnlyInB) == 0 && len(c.Differing) == 0
+}
+
+// resultSet is a query result with every value rendered as a string (or nil
+// for NULL), so that values compare the same way whatever Go type lib/pq
+// scanned them into.
+type resultSet struct {
+	cols []string
+	rows [][]any
+}
+
+// CompareQuery runs query against dbA and dbB at the same time and compares
+// the results. Both results are held in memory.
+func CompareQuery(ctx context.Context, dbA, dbB, query string, opts CompareOptions) (*QueryComparison, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("empty query")
+	}
+	type fetched struct {
+		rs  resultSet
+		err error
+	}
+	results := make([]chan fetched, 2)
+	for i, dbname := range []string{dbA, dbB} {
+		results[i] = make(chan fetched, 1)
+		go func(dbname string, out chan<- fetched) {
+			rs, err := fetchResultSet(ctx, dbname, query, opts.Timeout, opts.Params)
+			out <- fetched{rs, err}
+		}(dbname, results[i])
+	}
+	a, b := <-results[0], <-results[1]
+	if a.err != nil {
+		return nil, fmt.Errorf("%s: %w", dbA, a.err)
+	}
+	if b.err != nil {
+		return nil, fmt.Errorf("%s: %w", dbB, b.err)
+	}
+	c, err := compareResultSets(a.rs, b.rs, opts.Key)
+	if err != nil {
+		return nil, err
+	}
+	c.DatabaseA, c.DatabaseB = dbA, dbB
+	return c, nil
+}
+
+func fetchResultSet(ctx context.Context, dbname, query string, timeout time.Duration, params []QueryParam) (resultSet, error) {
+	var rs resultSet
+	conn, ctx, done, err := timedConn(ctx, dbname, timeout)
+	if err != nil {
+		return rs, err
+	}
+	defer done()
+	q, args := bindParams(query, params)
+	rows, err := conn.QueryContext(ctx, q, args...)
+	if err != nil {
+		return rs, queryError(ctx, withPosition(err, q), timeout)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return rs, err
+	}
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.Name()
+	}
+	rs.cols = uniqueColumnNames(names)
+	for rows.Next() {
+		vals := make([]any, len(types))
+		ptrs := make([]any, len(types))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return rs, err
+		}
+		for i, v := range vals {
+			if v != nil {
+				vals[i] = fmt.Sprint(normalizeValue(v, types[i].DatabaseTypeName()))
+			}
+		}
+		rs.rows = append(rs.rows, vals)
+	}
+	return rs, queryError(ctx, rows.Err(), timeout)
+}
+
+// uniqueColumnNames numbers repeated names (count, count#2, ...) so every
+// column can be matched by name.
+func uniqueColumnNames(names []string) []string {
+	seen := make(map[string]int, len(names))
+	out := make([]string, len(names))
+	for i, n := range names {
+		seen[n]++
+		out[i] = n
+		if seen[n] > 1 {
+			out[i] = fmt.Sprintf("%s#%d", n, seen[n])
+		}
+	}
+	return out
+}
+
+// compareResultSets matches rows of a and b by key (whole rows when key is
+// empty). Exact duplicates are matched one for one; remaining rows with the
+// same key are paired up as differing.
+func compareResultSets(a, b resultSet, key []string) (*QueryComparison, error) {
+	c := &QueryComparison{Columns: []string{}, RowsA: len(a.rows), RowsB: len(b.rows), OnlyInA: []CompareRow{}, OnlyInB: []CompareRow{}, Differing: []RowDifference{}}
+	inB := make(map[string]bool, len(b.cols))
+	for _, col := range b.cols {
+		inB[col] = true
+	}
+	inA := make(map[string]bool, len(a.cols))
+	for _, col := range a.cols {
+		inA[col] = true
+		if inB[col] {
+			c.Columns = append(c.Columns, col)
+		} else {
+			c.ColumnsOnlyInA = append(c.ColumnsOnlyInA, col)
+		}
+	}
+	for _, col := range b.cols {
+		if !inA[col] {
+			c.ColumnsOnlyInB = append(c.ColumnsOnlyInB, col)
+		}
+	}
+	sort.Strings(c.Columns)
+	for _, k := range key {
+		if !inA[k] || !inB[k] {
+			return nil, fmt.Errorf("key column %q is not in both results", k)
+		}
+	}
+
+	project := func(rs resultSet) []CompareRow {
+		idx := make(map[string]int, len(rs.cols))
+		for i, col := range rs.cols {
+			idx[col] = i
+		}
+		out := make([]CompareRow, len(rs.rows))
+		for r, vals := range rs.rows {
+			row := make(CompareRow, len(c.Columns))
+			for _, col := range c.Columns {
+				row[col] = vals[idx[col]]
+			}
+			out[r] = row
+		}
+		return out
+	}
+	keyCols := key
+	if len(keyCols) == 0 {
+		keyCols = c.Columns
+	}
+	group := func(rows []CompareRow) map[string][]CompareRow {
+		g := map[string][]CompareRow{}
+		for _, row := range rows {
+			k := rowSignature(row, keyCols)
+			g[k] = append(g[k], row)
+		}
+		return g
+	}
+	ga, gb := group(project(a)), group(project(b))
+	keys := make([]string, 0, len(ga)+len(gb))
+	for k := range ga {
+		keys = append(keys, k)
+	}
+	for k := range gb {
+		if _, ok := ga[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ra, rb := unmatchedRows(ga[k], gb[k], c.Columns)
+		for len(ra) > 0 && len(rb) > 0 {
+			c.Differing = append(c.Differing, RowDifference{Key: subRow(ra[0], key), A: ra[0], B: rb[0]})
+			ra, rb = ra[1:], rb[1:]
+		}
+		c.OnlyInA = append(c.OnlyInA, ra...)
+		c.OnlyInB = append(c.OnlyInB, rb...)
+	}
+	return c, nil
+}
+
+// unmatchedRows removes rows present in both a and b (as a multiset) and
+// returns what is left of each.
+func unmatchedRows(a, b []CompareRow, cols []string) (restA, restB []CompareRow) {
+	count := map[string]int{}
+	for _, row := range b {
+		count[rowSignature(row, cols)]++
+	}
+	for _, row := range a {
+		sig := rowSignature(row, cols)
+		if count[sig] > 0 {
+			count[sig]--
+			continue
+		}
+		restA = append(restA, row)
+	}
+	for _, row := range b {
+		sig := rowSignature(row, cols)
+		if count[sig] > 0 {
+			count[sig]--
+			restB = append(restB, row)
+		}
+	}
+	return restA, restB
+}
+
+// rowSignature encodes the given columns of row unambiguously (NULL and the
+// string "NULL" differ).
+func rowSignature(row CompareRow, cols []string) string {
+	vals := make([]any, len(cols))
+	for i, col := range cols {
+		vals[i] = row[col]
+	}
+	b, _ := json.Marshal(vals)
+	return string(b)
+}
+
+func subRow(row CompareRow, cols []string) CompareRow {
+	out := make(CompareRow, len(cols))
+	for _, col := range cols {
+		out[col] = row[col]
+	}
+	return out
+}
+
+// WriteQueryComparison prints c as a unified-diff-like listing ("-" rows
+// from A, "+" rows from B, "~" keys whose values differ, with only the
+// differing columns) followed by a summary line.
+func WriteQueryComparison(w io.Writer, c *QueryComparison) {
+	if c.Identical() {
+		fmt.Fprintf(w, "identical: %d row(s), %d column(s)\n", c.RowsA, len(c.Columns))
+		return
+	}
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", c.DatabaseA, c.DatabaseB)
+	if len(c.ColumnsOnlyInA) > 0 {
+		fmt.Fprintf(w, "- columns: %s\n", strings.Join(c.ColumnsOnlyInA, ", "))
+	}
+	if len(c.ColumnsOnlyInB) > 0 {
+		fmt.Fprintf(w, "+ columns: %s\n", strings.Join(c.ColumnsOnlyInB, ", "))
+	}
+	for _, row := range c.OnlyInA {
+		fmt.Fprintf(w, "- %s\n", formatCompareRow(row, c.Columns))
+	}
+	for _, row := range c.OnlyInB {
+		fmt.Fprintf(w, "+ %s\n", formatCompareRow(row, c.Columns))
+	}
+	for _, d := range c.Differing {
+		var keyCols, changed []string
+		for _, col := range c.Columns {
+			if _, isKey := d.Key[col]; isKey {
+				keyCols = append(keyCols, col)
+			} else if rowSignature(d.A, []string{col}) != rowSignature(d.B, []string{col}) {
+				changed = append(changed, col)
+			}
+		}
+		fmt.Fprintf(w, "~ %s\n", formatCompareRow(d.Key, keyCols))
+		fmt.Fprintf(w, "-     %s\n", formatCompareRow(d.A, changed))
+		fmt.Fprintf(w, "+     %s\n", formatCompareRow(d.B, changed))
+	}
+	fmt.Fprintf(w, "rows: %s %d, %s %d; only in %s: %d, only in %s: %d, differing: %d\n",
+		c.DatabaseA, c.RowsA, c.DatabaseB, c.RowsB, c.DatabaseA, len(c.OnlyInA), c.DatabaseB, len(c.OnlyInB), len(c.Differing))
+}
+
+func formatCompareRow(row CompareRow, cols []string) string {
+	parts := make([]string, len(cols))
+	for i, col := range cols {
+		v := "NULL"
+		if s, ok := row[col].(string); ok {
+			v = s
+		}
+		parts[i] = col + "=" + v
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,82 @@
+package dbtool
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestCompareResultSets(t *testing.T) {
+	a := resultSet{
+		cols: []string{"status", "n", "note"},
+		rows: [][]any{{"open", "3", nil}, {"closed", "5", "x"}, {"stale", "1", nil}, {"dup", "1", nil}, {"dup", "1", nil}},
+	}
+	// Same data in another column order, one changed count, one NULL that
+	// is the string "NULL" instead, one extra row and one duplicate fewer.
+	b := resultSet{
+		cols: []string{"n", "note", "status"},
+		rows: [][]any{{"5", "x", "closed"}, {"4", nil, "open"}, {"1", "NULL", "stale"}, {"2", nil, "new"}, {"1", nil, "dup"}},
+	}
+
+	c, err := compareResultSets(a, b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.Columns, []string{"n", "note", "status"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Columns = %q, want %q", got, want)
+	}
+	if len(c.OnlyInA) != 3 || len(c.OnlyInB) != 3 || len(c.Differing) != 0 {
+		t.Errorf("without key: onlyA=%v onlyB=%v differing=%v", c.OnlyInA, c.OnlyInB, c.Differing)
+	}
+
+	c, err = compareResultSets(a, b, []string{"status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantA := []CompareRow{{"status": "dup", "n": "1", "note": nil}}
+	wantB := []CompareRow{{"status": "new", "n": "2", "note": nil}}
+	if !reflect.DeepEqual(c.OnlyInA, wantA) || !reflect.DeepEqual(c.OnlyInB, wantB) {
+		t.Errorf("with key: onlyA=%v onlyB=%v", c.OnlyInA, c.OnlyInB)
+	}
+	if len(c.Differing) != 2 || c.Differing[0].Key["status"] != "open" || c.Differing[1].Key["status"] != "stale" {
+		t.Errorf("with key: differing=%v", c.Differing)
+	}
+	if c.Identical() {
+		t.Error("Identical() = true")
+	}
+
+	if _, err := compareResultSets(a, b, []string{"missing"}); err == nil {
+		t.Error("unknown key column accepted")
+	}
+	if c, _ := compareResultSets(a, a, []string{"status"}); !c.Identical() {
+		t.Errorf("same result not identical: %+v", c)
+	}
+}
+
+func TestWriteQueryComparison(t *testing.T) {
+	c, err := compareResultSets(
+		resultSet{cols: []string{"k", "v"}, rows: [][]any{{"a", "1"}, {"b", "2"}}},
+		resultSet{cols: []string{"v", "k"}, rows: [][]any{{"9", "b"}, {"3", "c"}}},
+		[]string{"k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.DatabaseA, c.DatabaseB = "old", "new"
+	var buf bytes.Buffer
+	WriteQueryComparison(&buf, c)
+	want := "--- old\n+++ new\n" +
+		"- k=a, v=1\n" +
+		"+ k=c, v=3\n" +
+		"~ k=b\n-     v=2\n+     v=9\n" +
+		"rows: old 2, new 2; only in old: 1, only in new: 1, differing: 1\n"
+	if buf.String() != want {
+		t.Errorf("WriteQueryComparison:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestUniqueColumnNames(t *testing.T) {
+	got := uniqueColumnNames([]string{"count", "id", "count", "count"})
+	if want := []string{"count", "id", "count#2", "count#3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueColumnNames = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package dbtool
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ResetOptions selects the schemas ResetSchemas drops and recreates. With
+// neither Schemas nor AllUserSchemas only public is reset, as ResetDatabase
+// does.
+type ResetOptions struct {
+	// Schemas are exact names; each must exist.
+	Schemas []string
+	// AllUserSchemas selects every schema except the system ones.
+	AllUserSchemas bool
+	// Exclude, if set, leaves out schemas whose name matches.
+	Exclude *regexp.Regexp
+}
+
+// ResetTargets returns the schemas a reset of dbname with opts would drop,
+// in name order.
+func ResetTargets(dbname string, opts ResetOptions) ([]string, error) {
+	if len(opts.Schemas) > 0 && opts.AllUserSchemas {
+		return nil, fmt.Errorf("--schema and --all-user-schemas cannot be combined")
+	}
+	for _, s := range opts.Schemas {
+		if isSystemSchema(s) {
+			return nil, fmt.Errorf("refusing to reset system schema %q", s)
+		}
+	}
+	names := opts.Schemas
+	switch {
+	case opts.AllUserSchemas:
+		db, err := ConnectDBAs(dbname)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		if names, err = userSchemas(db); err != nil {
+			return nil, err
+		}
+	case len(names) > 0:
+		if err := checkSchemasExist(dbname, names); err != nil {
+			return nil, err
+		}
+	default:
+		names = []string{"public"}
+	}
+	return filterResetTargets(names, opts.Exclude), nil
+}
+
+// filterResetTargets drops duplicates and names matching exclude, and sorts.
+func filterResetTargets(names []string, exclude *regexp.Regexp) []string {
+	seen := make(map[string]bool, len(names))
+	var out []string
+	for _, n := range names {
+		if seen[n] || (exclude != nil && exclude.MatchString(n)) {
+			continue
+		}
+		seen[n] = true
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func isSystemSchema(name string) bool {
+	return name == "information_schema" || strings.HasPrefix(name, "pg_")
+}
+
+// ResetSchemas drops each schema with CASCADE and creates it again, empty,
+// in one transaction, then prints what was reset.
+func ResetSchemas(dbname string, schemas []string) error {
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, s := range schemas {
+		q := pq.QuoteIdentifier(s)
+		if _, err := tx.Exec("DROP SCHEMA IF EXISTS " + q + " CASCADE"); err != nil {
+			return fmt.Errorf("drop schema %s: %w", s, err)
+		}
+		if _, err := tx.Exec("CREATE SCHEMA " + q); err != nil {
+			return fmt.Errorf("create schema %s: %w", s, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, s := range schemas {
+		fmt.Fprintf(os.Stderr, "dbtool: dropped and recreated schema %s\n", s)
+	}
+	return nil
+}
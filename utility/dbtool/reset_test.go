@@ -0,0 +1,35 @@
+package dbtool
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestFilterResetTargets(t *testing.T) {
+	names := []string{"public", "audit", "app", "app_archive", "audit"}
+	if got, want := filterResetTargets(names, nil), []string{"app", "app_archive", "audit", "public"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("filterResetTargets(nil) = %q, want %q", got, want)
+	}
+	exclude := regexp.MustCompile(`_archive$|^audit$`)
+	if got, want := filterResetTargets(names, exclude), []string{"app", "public"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("filterResetTargets(%s) = %q, want %q", exclude, got, want)
+	}
+}
+
+func TestResetTargetsRejects(t *testing.T) {
+	cases := []ResetOptions{
+		{Schemas: []string{"app"}, AllUserSchemas: true},
+		{Schemas: []string{"pg_catalog"}},
+		{Schemas: []string{"information_schema"}},
+	}
+	for _, opts := range cases {
+		if _, err := ResetTargets("unused", opts); err == nil {
+			t.Errorf("ResetTargets(%+v) succeeded, want error", opts)
+		}
+	}
+	got, err := ResetTargets("unused", ResetOptions{})
+	if err != nil || !reflect.DeepEqual(got, []string{"public"}) {
+		t.Errorf("ResetTargets(default) = %q, %v; want [public]", got, err)
+	}
+}
@@ -0,0 +1,146 @@
+package dbtool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RotateOptions controls RotateDumps.
+type RotateOptions struct {
+	// Keep is how many dumps of the database are kept, the new one
+	// included.
+	Keep int
+	// MinRatio protects against rotating away good dumps after a broken
+	// one: when the new dump is smaller than MinRatio times the previous
+	// dump of the same format, nothing is deleted. 0 disables the check.
+	MinRatio float64
+}
+
+// ErrDumpTooSmall is returned by RotateDumps when the new dump fails the
+// MinRatio check.
+var ErrDumpTooSmall = errors.New("new dump is suspiciously small")
+
+// TimestampedDumpPath returns dir/<dbname>_<timestamp><ext> for a dump taken
+// at t, the naming dump-all uses and RotateDumps recognizes.
+func TimestampedDumpPath(dir, dbname string, t time.Time, opts DumpOptions) string {
+	return filepath.Join(dir, dbname+"_"+t.Format(dumpStampLayout)+opts.fileExt())
+}
+
+// timestampedDump is a <dbname>_<timestamp><ext> entry of a dump directory.
+type timestampedDump struct {
+	name, stamp, ext string
+}
+
+// parseDumpName reports whether name is a dump of dbname under the
+// <dbname>_<timestamp><ext> convention. A dump without extension is a
+// directory-format dump, so isDir must match.
+func parseDumpName(name, dbname string, isDir bool) (timestampedDump, bool) {
+	rest, ok := strings.CutPrefix(name, dbname+"_")
+	if !ok || len(rest) < len(dumpStampLayout) {
+		return timestampedDump{}, false
+	}
+	stamp, ext := rest[:len(dumpStampLayout)], rest[len(dumpStampLayout):]
+	if _, err := time.Parse(dumpStampLayout, stamp); err != nil {
+		return timestampedDump{}, false
+	}
+	switch ext {
+	case "":
+		ok = isDir
+	case ".sql", ".sql.gz", ".dump":
+		ok = !isDir
+	default:
+		ok = false
+	}
+	return timestampedDump{name: name, stamp: stamp, ext: ext}, ok
+}
+
+// RotateDumps deletes the dumps of dbname in the directory of current, the
+// dump just written, beyond the newest opts.Keep, and prints each one it
+// removes. current is always kept. When current fails the MinRatio check
+// against the previous dump, nothing is deleted and the error wraps
+// ErrDumpTooSmall.
+func RotateDumps(dbname, current string, opts RotateOptions) ([]string, error) {
+	if opts.Keep < 1 {
+		return nil, fmt.Errorf("invalid keep count %d (want at least 1)", opts.Keep)
+	}
+	dir, base := filepath.Split(current)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var dumps []timestampedDump
+	var cur *timestampedDump
+	for _, e := range entries {
+		d, ok := parseDumpName(e.Name(), dbname, e.IsDir())
+		if !ok {
+			continue
+		}
+		if d.name == base {
+			cur = &d
+			continue
+		}
+		dumps = append(dumps, d)
+	}
+	if cur == nil {
+		return nil, fmt.Errorf("%s is not a <dbname>_<timestamp> dump of %s", current, dbname)
+	}
+	// Newest first.
+	sort.Slice(dumps, func(i, j int) bool {
+		if dumps[i].stamp != dumps[j].stamp {
+			return dumps[i].stamp > dumps[j].stamp
+		}
+		return dumps[i].name > dumps[j].name
+	})
+
+	if opts.MinRatio > 0 {
+		if err := checkDumpSize(dir, *cur, dumps, opts.MinRatio); err != nil {
+			return nil, err
+		}
+	}
+	if len(dumps) < opts.Keep {
+		return nil, nil
+	}
+	var removed []string
+	for _, d := range dumps[opts.Keep-1:] {
+		path := filepath.Join(dir, d.name)
+		size, _ := pathSize(path)
+		if err := os.RemoveAll(path); err != nil {
+			return removed, err
+		}
+		fmt.Fprintf(os.Stderr, "dbtool: removed old dump %s (%s)\n", path, humanBytes(size))
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// checkDumpSize compares cur with the newest older dump of the same format
+// (other formats and compression levels are not comparable).
+func checkDumpSize(dir string, cur timestampedDump, older []timestampedDump, minRatio float64) error {
+	for _, d := range older {
+		if d.ext != cur.ext || d.stamp > cur.stamp {
+			continue
+		}
+		prev, err := pathSize(filepath.Join(dir, d.name))
+		if err != nil {
+			return err
+		}
+		size, err := pathSize(filepath.Join(dir, cur.name))
+		if err != nil {
+			return err
+		}
+		if float64(size) < minRatio*float64(prev) {
+			return fmt.Errorf("%w: %s is %s, less than %g%% of %s (%s); nothing deleted",
+				ErrDumpTooSmall, cur.name, humanBytes(size), minRatio*100, d.name, humanBytes(prev))
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package dbtool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDumpName(t *testing.T) {
+	cases := []struct {
+		name  string
+		isDir bool
+		ok    bool
+	}{
+		{"app_20261016_120000.sql", false, true},
+		{"app_20261016_120000.sql.gz", false, true},
+		{"app_20261016_120000.dump", false, true},
+		{"app_20261016_120000", true, true},
+		{"app_20261016_120000", false, false},
+		{"app_20261016_120000.sql", true, false},
+		{"app_test_20261016_120000.sql", false, false},
+		{"app_20261399_120000.sql", false, false},
+		{"app_20261016_120000.sql.bak", false, false},
+		{"app.sql", false, false},
+	}
+	for _, c := range cases {
+		if _, ok := parseDumpName(c.name, "app", c.isDir); ok != c.ok {
+			t.Errorf("parseDumpName(%q, dir=%v) = %v, want %v", c.name, c.isDir, ok, c.ok)
+		}
+	}
+}
+
+func TestTimestampedDumpPath(t *testing.T) {
+	at := time.Date(2026, 10, 16, 9, 5, 7, 0, time.UTC)
+	got := TimestampedDumpPath("/backups", "app", at, DumpOptions{Format: "plain", Compress: 6})
+	if want := filepath.Join("/backups", "app_20261016_090507.sql.gz"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func writeDumps(t *testing.T, dir string, sizes map[string]int) {
+	t.Helper()
+	for name, n := range sizes {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Repeat("x", n)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRotateDumps(t *testing.T) {
+	dir := t.TempDir()
+	writeDumps(t, dir, map[string]int{
+		"app_20261013_010000.sql":      100,
+		"app_20261014_010000.sql":      100,
+		"app_20261015_010000.sql":      100,
+		"app_20261016_010000.sql":      90,
+		"app_test_20261001_010000.sql": 100,
+		"notes.txt":                    1,
+	})
+	removed, err := RotateDumps("app", filepath.Join(dir, "app_20261016_010000.sql"), RotateOptions{Keep: 2, MinRatio: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "app_20261014_010000.sql"), filepath.Join(dir, "app_20261013_010000.sql")}
+	if !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed %q, want %q", removed, want)
+	}
+	left, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range left {
+		names = append(names, e.Name())
+	}
+	if want := []string{"app_20261015_010000.sql", "app_20261016_010000.sql", "app_test_20261001_010000.sql", "notes.txt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("left %q, want %q", names, want)
+	}
+}
+
+func TestRotateDumpsTooSmall(t *testing.T) {
+	dir := t.TempDir()
+	writeDumps(t, dir, map[string]int{
+		"app_20261014_010000.sql":    1000,
+		"app_20261015_010000.sql.gz": 10,
+		"app_20261016_010000.sql":    100,
+	})
+	removed, err := RotateDumps("app", filepath.Join(dir, "app_20261016_010000.sql"), RotateOptions{Keep: 1, MinRatio: 0.5})
+	if !errors.Is(err, ErrDumpTooSmall) || len(removed) != 0 {
+		t.Fatalf("removed %q, err %v; want nothing removed and ErrDumpTooSmall", removed, err)
+	}
+	if left, _ := os.ReadDir(dir); len(left) != 3 {
+		t.Errorf("%d file(s) left, want 3", len(left))
+	}
+
+	// The check compares against the previous dump of the same format only.
+	removed, err = RotateDumps("app", filepath.Join(dir, "app_20261015_010000.sql.gz"), RotateOptions{Keep: 3, MinRatio: 0.5})
+	if err != nil || len(removed) != 0 {
+		t.Errorf("removed %q, err %v; want no error and nothing removed", removed, err)
+	}
+}
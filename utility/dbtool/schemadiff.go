@@ -0,0 +1,169 @@
+package dbtool
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SchemaSnapshot maps an object key such as "column public.users.email" to
+// its normalized definition, as rendered by the server itself (format_type,
+// pg_get_constraintdef, pg_get_viewdef, ...), so two databases on the same
+// server compare equal exactly when their objects do.
+type SchemaSnapshot map[string]string
+
+// Schema change kinds.
+const (
+	SchemaOnlyInA   = "only-a"
+	SchemaOnlyInB   = "only-b"
+	SchemaDifferent = "changed"
+)
+
+// SchemaChange is one object that differs between two snapshots.
+type SchemaChange struct {
+	Object string
+	Kind   string
+	// A and B are the definitions on each side; the missing side is empty.
+	A, B string
+}
+
+// userNamespaces is the WHERE fragment that skips system schemas; n is
+// pg_namespace.
+const userNamespaces = `n.nspname NOT IN ('pg_catalog','information_schema') AND n.nspname NOT LIKE 'pg_toast%' AND n.nspname NOT LIKE 'pg_temp%'`
+
+// notFromExtension skips objects created by CREATE EXTENSION; both sides
+// already record the extension itself.
+const notFromExtension = `NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = %s AND d.deptype = 'e')`
+
+// schemaQueries each return (key, definition) rows.
+var schemaQueries = []string{
+	`SELECT 'schema ' || quote_ident(n.nspname), '' FROM pg_namespace n WHERE ` + userNamespaces + ` AND n.nspname NOT LIKE 'pg\_%'`,
+	`SELECT 'extension ' || quote_ident(e.extname), e.extversion FROM pg_extension e`,
+	`SELECT CASE c.relkind WHEN 'p' THEN 'partitioned table ' ELSE 'table ' END || quote_ident(n.nspname) || '.' || quote_ident(c.relname), ''
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('r','p') AND ` + userNamespaces + ` AND ` + fmt.Sprintf(notFromExtension, "c.oid"),
+	`SELECT 'column ' || quote_ident(n.nspname) || '.' || quote_ident(c.relname) || '.' || quote_ident(a.attname),
+       format_type(a.atttypid, a.atttypmod)
+       || CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END
+       || COALESCE(' DEFAULT ' || pg_get_expr(ad.adbin, ad.adrelid), '')
+FROM pg_attribute a
+JOIN pg_class c ON c.oid = a.attrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+WHERE c.relkind IN ('r','p') AND a.attnum > 0 AND NOT a.attisdropped AND ` + userNamespaces + ` AND ` + fmt.Sprintf(notFromExtension, "c.oid"),
+	`SELECT 'constraint ' || quote_ident(n.nspname) || '.' || quote_ident(c.relname) || '.' || quote_ident(co.conname), pg_get_constraintdef(co.oid)
+FROM pg_constraint co
+JOIN pg_class c ON c.oid = co.conrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE ` + userNamespaces,
+	`SELECT 'index ' || quote_ident(n.nspname) || '.' || quote_ident(c.relname), pg_get_indexdef(i.indexrelid)
+FROM pg_index i
+JOIN pg_class c ON c.oid = i.indexrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE ` + userNamespaces,
+	`SELECT CASE c.relkind WHEN 'm' THEN 'materialized view ' ELSE 'view ' END || quote_ident(n.nspname) || '.' || quote_ident(c.relname), pg_get_viewdef(c.oid, true)
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('v','m') AND ` + userNamespaces + ` AND ` + fmt.Sprintf(notFromExtension, "c.oid"),
+	`SELECT 'sequence ' || quote_ident(n.nspname) || '.' || quote_ident(c.relname),
+       format('%s start %s increment %s min %s max %s%s', s.seqtypid::regtype, s.seqstart, s.seqincrement, s.seqmin, s.seqmax, CASE WHEN s.seqcycle THEN ' cycle' ELSE '' END)
+FROM pg_sequence s
+JOIN pg_class c ON c.oid = s.seqrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE ` + userNamespaces + ` AND ` + fmt.Sprintf(notFromExtension, "c.oid"),
+	`SELECT 'function ' || quote_ident(n.nspname) || '.' || quote_ident(p.proname) || '(' || pg_get_function_identity_arguments(p.oid) || ')', pg_get_functiondef(p.oid)
+FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+WHERE p.prokind IN ('f','p') AND ` + userNamespaces + ` AND ` + fmt.Sprintf(notFromExtension, "p.oid"),
+	`SELECT 'type ' || quote_ident(n.nspname) || '.' || quote_ident(t.typname), 'ENUM (' || string_agg(quote_literal(e.enumlabel), ', ' ORDER BY e.enumsortorder) || ')'
+FROM pg_type t
+JOIN pg_namespace n ON n.oid = t.typnamespace
+JOIN pg_enum e ON e.enumtypid = t.oid
+WHERE ` + userNamespaces + ` AND ` + fmt.Sprintf(notFromExtension, "t.oid") + `
+GROUP BY n.nspname, t.typname`,
+	`SELECT 'trigger ' || quote_ident(n.nspname) || '.' || quote_ident(c.relname) || '.' || quote_ident(tg.tgname), pg_get_triggerdef(tg.oid)
+FROM pg_trigger tg
+JOIN pg_class c ON c.oid = tg.tgrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE NOT tg.tgisinternal AND ` + userNamespaces,
+}
+
+// SnapshotSchema introspects every user schema of db: schemas, extensions,
+// tables and their columns, constraints, indexes, views, sequences,
+// functions, enum types and triggers. Ownership, grants and comments are not
+// compared.
+func SnapshotSchema(db *sql.DB) (SchemaSnapshot, error) {
+	snap := SchemaSnapshot{}
+	for _, q := range schemaQueries {
+		rows, err := db.Query(q)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var key, def string
+			if err := rows.Scan(&key, &def); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			snap[key] = strings.TrimSpace(def)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return snap, nil
+}
+
+// DiffSchemas returns the objects that differ between a and b, sorted by
+// object key.
+func DiffSchemas(a, b SchemaSnapshot) []SchemaChange {
+	var out []SchemaChange
+	for key, defA := range a {
+		defB, ok := b[key]
+		switch {
+		case !ok:
+			out = append(out, SchemaChange{Object: key, Kind: SchemaOnlyInA, A: defA})
+		case defA != defB:
+			out = append(out, SchemaChange{Object: key, Kind: SchemaDifferent, A: defA, B: defB})
+		}
+	}
+	for key, defB := range b {
+		if _, ok := a[key]; !ok {
+			out = append(out, SchemaChange{Object: key, Kind: SchemaOnlyInB, B: defB})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Object < out[j].Object })
+	return out
+}
+
+// WriteSchemaDiff prints changes in a unified-diff-like layout: "-" lines
+// come from side a (named nameA), "+" lines from side b.
+func WriteSchemaDiff(w io.Writer, changes []SchemaChange, nameA, nameB string) {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", nameA, nameB)
+	for _, c := range changes {
+		switch c.Kind {
+		case SchemaOnlyInA:
+			fmt.Fprintf(w, "- %s\n", c.Object)
+			writeIndented(w, "-", c.A)
+		case SchemaOnlyInB:
+			fmt.Fprintf(w, "+ %s\n", c.Object)
+			writeIndented(w, "+", c.B)
+		default:
+			fmt.Fprintf(w, "~ %s\n", c.Object)
+			writeIndented(w, "-", c.A)
+			writeIndented(w, "+", c.B)
+		}
+	}
+	fmt.Fprintf(w, "%d difference(s)\n", len(changes))
+}
+
+func writeIndented(w io.Writer, mark, def string) {
+	if def == "" {
+		return
+	}
+	for _, line := range strings.Split(def, "\n") {
+		fmt.Fprintf(w, "%s     %s\n", mark, strings.TrimRight(line, " \t\r"))
+	}
+}
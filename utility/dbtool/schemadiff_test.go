@@ -0,0 +1,51 @@
+package dbtool
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	live := SchemaSnapshot{
+		"schema public":             "",
+		"table public.users":        "",
+		"column public.users.id":    "bigint NOT NULL",
+		"column public.users.name":  "text",
+		"column public.users.extra": "jsonb",
+	}
+	reference := SchemaSnapshot{
+		"schema public":               "",
+		"table public.users":          "",
+		"column public.users.id":      "bigint NOT NULL",
+		"column public.users.name":    "text NOT NULL",
+		"index public.users_name_idx": "CREATE INDEX users_name_idx ON public.users USING btree (name)",
+	}
+	got := DiffSchemas(live, reference)
+	want := []SchemaChange{
+		{Object: "column public.users.extra", Kind: SchemaOnlyInA, A: "jsonb"},
+		{Object: "column public.users.name", Kind: SchemaDifferent, A: "text", B: "text NOT NULL"},
+		{Object: "index public.users_name_idx", Kind: SchemaOnlyInB, B: "CREATE INDEX users_name_idx ON public.users USING btree (name)"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("DiffSchemas = %+v, want %+v", got, want)
+	}
+	if d := DiffSchemas(live, live); len(d) != 0 {
+		t.Fatalf("DiffSchemas(same) = %+v, want none", d)
+	}
+}
+
+func TestWriteSchemaDiff(t *testing.T) {
+	var buf bytes.Buffer
+	WriteSchemaDiff(&buf, []SchemaChange{
+		{Object: "column public.t.a", Kind: SchemaDifferent, A: "integer", B: "bigint"},
+		{Object: "function public.f()", Kind: SchemaOnlyInB, B: "CREATE FUNCTION f()\n BEGIN\n END"},
+	}, "app", "schema.sql")
+	want := "--- app\n+++ schema.sql\n" +
+		"~ column public.t.a\n-     integer\n+     bigint\n" +
+		"+ function public.f()\n+     CREATE FUNCTION f()\n+      BEGIN\n+      END\n" +
+		"2 difference(s)\n"
+	if buf.String() != want {
+		t.Fatalf("WriteSchemaDiff:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,94 @@
+package dbtool
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/lib/pq"
+)
+
+// ErrSchemaMismatch is returned by VerifySchema when the live database and
+// the reference schema differ; the differences have already been printed.
+var ErrSchemaMismatch = errors.New("schema differs from reference")
+
+// VerifySchema loads the reference schema file into a temporary database
+// (dbtool_verify_<random>), compares it with dbname and prints the
+// differences on stdout. The temporary database is dropped afterwards unless
+// keepTemp is set.
+func VerifySchema(dbname, file string, keepTemp bool) error {
+	if _, err := os.Stat(file); err != nil {
+		return err
+	}
+	cfg, err := GetDBConfig()
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	temp := "dbtool_verify_" + hex.EncodeToString(suffix)
+
+	if err := createDatabase(temp); err != nil {
+		return fmt.Errorf("create temporary database %q: %w", temp, err)
+	}
+	vprintf("dbtool: created temporary database %q\n", temp)
+	defer func() {
+		if keepTemp {
+			fmt.Fprintf(os.Stderr, "dbtool: kept temporary database %q\n", temp)
+			return
+		}
+		if err := dropDatabase(temp); err != nil {
+			fmt.Fprintf(os.Stderr, "dbtool: could not drop temporary database %q: %v\n", temp, err)
+		}
+	}()
+
+	load := pgCommand(cfg, "psql", temp, "-X", "-q", "-v", "ON_ERROR_STOP=1", "-f", file)
+	if !isVerbose() {
+		load.Stdout = io.Discard
+	}
+	if err := load.Run(); err != nil {
+		return fmt.Errorf("load %s: %w", file, err)
+	}
+
+	live, err := snapshotDatabase(dbname)
+	if err != nil {
+		return fmt.Errorf("introspect %q: %w", dbname, err)
+	}
+	reference, err := snapshotDatabase(temp)
+	if err != nil {
+		return fmt.Errorf("introspect reference: %w", err)
+	}
+	changes := DiffSchemas(live, reference)
+	if len(changes) == 0 {
+		fmt.Printf("dbtool: %q matches %s (%d objects)\n", dbname, file, len(live))
+		return nil
+	}
+	WriteSchemaDiff(os.Stdout, changes, dbname, filepath.Base(file))
+	return ErrSchemaMismatch
+}
+
+func snapshotDatabase(dbname string) (SchemaSnapshot, error) {
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return SnapshotSchema(db)
+}
+
+// dropDatabase runs DROP DATABASE from the maintenance database.
+func dropDatabase(dbname string) error {
+	admin, err := connectMaintenanceDB(dbname)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	_, err = admin.Exec("DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(dbname))
+	return err
+}
@@ -0,0 +1,190 @@
+package dbtool
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SeedOptions controls Seed.
+type SeedOptions struct {
+	// NoTransaction applies each file on its own instead of all files in one
+	// transaction.
+	NoTransaction bool
+	// Only limits the files to those whose name matches this glob.
+	Only string
+}
+
+// seedOrderPrefix is an optional ordering prefix such as "010_" or "2-".
+var seedOrderPrefix = regexp.MustCompile(`^\d+[_-]`)
+
+// seedTable derives the target table from a CSV file name:
+// "public.users.csv", "010_public.users.csv" and "users.csv" (public schema)
+// all load into public.users.
+func seedTable(file string) (string, error) {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	name = seedOrderPrefix.ReplaceAllString(name, "")
+	if name == "" || strings.Count(name, ".") > 1 {
+		return "", fmt.Errorf("%s: cannot derive table name (want [NNN_][schema.]table.csv)", file)
+	}
+	return name, nil
+}
+
+// seedFiles returns the .sql and .csv files in dir in lexical order,
+// filtered by the only glob.
+func seedFiles(dir, only string) ([]string, error) {
+	if only != "" {
+		if _, err := filepath.Match(only, ""); err != nil {
+			return nil, fmt.Errorf("invalid --only pattern: %w", err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if ext != ".sql" && ext != ".csv" {
+			continue
+		}
+		if only != "" {
+			if ok, _ := filepath.Match(only, e.Name()); !ok {
+				continue
+			}
+		}
+		files = append(files, e.Name())
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Seed applies the .sql and .csv fixtures in dir to dbname in lexical order.
+// SQL files are executed as-is; CSV files are loaded with COPY into the table
+// named by the file (see seedTable). By default everything runs in one
+// transaction, so a failing file leaves the database untouched.
+func Seed(dbname, dir string, opts SeedOptions) error {
+	files, err := seedFiles(dir, opts.Only)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no .sql or .csv files in %s", dir)
+	}
+	// Resolve table names up front so a bad file name fails before anything
+	// is applied.
+	tables := make(map[string]string)
+	for _, f := range files {
+		if strings.EqualFold(filepath.Ext(f), ".csv") {
+			t, err := seedTable(f)
+			if err != nil {
+				return err
+			}
+			tables[f] = t
+		}
+	}
+
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var shared *sql.Tx
+	if !opts.NoTransaction {
+		if shared, err = db.Begin(); err != nil {
+			return err
+		}
+		defer shared.Rollback()
+	}
+
+	type result struct {
+		file, kind, rows string
+		took             time.Duration
+	}
+	var results []result
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		start := time.Now()
+		tx := shared
+		if tx == nil {
+			if tx, err = db.Begin(); err != nil {
+				return err
+			}
+		}
+		res := result{file: f}
+		var applyErr error
+		if table, ok := tables[f]; ok {
+			res.kind = "csv -> " + table
+			var n int64
+			n, applyErr = seedCSV(tx, table, path)
+			res.rows = fmt.Sprint(n)
+		} else {
+			res.kind, res.rows = "sql", "-"
+			applyErr = seedSQL(tx, path)
+		}
+		if applyErr == nil && shared == nil {
+			applyErr = tx.Commit()
+		}
+		if applyErr != nil {
+			if shared != nil {
+				return fmt.Errorf("%s: %w (transaction rolled back, nothing was applied)", f, applyErr)
+			}
+			tx.Rollback()
+			return fmt.Errorf("%s: %w (earlier files were applied)", f, applyErr)
+		}
+		res.took = time.Since(start)
+		results = append(results, res)
+		fmt.Fprintf(os.Stderr, "dbtool: applied %s\n", f)
+	}
+	if shared != nil {
+		if err := shared.Commit(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%-40s %-35s %10s %10s\n", "file", "kind", "rows", "duration")
+	for _, r := range results {
+		fmt.Printf("%-40s %-35s %10s %10s\n", r.file, r.kind, r.rows, r.took.Round(time.Millisecond))
+	}
+	fmt.Printf("%d file(s) applied to %s\n", len(results), dbname)
+	return nil
+}
+
+func seedCSV(tx *sql.Tx, table, path string) (int64, error) {
+	var found sql.NullString
+	if err := tx.QueryRow(`SELECT to_regclass($1)::text`, quoteTableName(table)).Scan(&found); err != nil {
+		return 0, err
+	}
+	if !found.Valid {
+		return 0, fmt.Errorf("table %q not found", table)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return copyCSV(tx, table, f, path)
+}
+
+func seedSQL(tx *sql.Tx, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(b)) == "" {
+		return nil
+	}
+	// Without arguments lib/pq uses the simple query protocol, which accepts
+	// several statements in one string.
+	_, err = tx.Exec(string(b))
+	return withPosition(err, string(b))
+}
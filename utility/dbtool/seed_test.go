@@ -0,0 +1,52 @@
+package dbtool
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSeedTable(t *testing.T) {
+	cases := map[string]string{
+		"public.users.csv":     "public.users",
+		"010_public.users.csv": "public.users",
+		"2-orders.csv":         "orders",
+		"users.csv":            "users",
+	}
+	for file, want := range cases {
+		got, err := seedTable(file)
+		if err != nil || got != want {
+			t.Errorf("seedTable(%q) = %q, %v; want %q", file, got, err, want)
+		}
+	}
+	for _, bad := range []string{"a.b.c.csv", "010_.csv"} {
+		if _, err := seedTable(bad); err == nil {
+			t.Errorf("seedTable(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSeedFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"020_public.users.csv", "010_schema.sql", "notes.txt", "030_data.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "015_dir.sql"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	got, err := seedFiles(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"010_schema.sql", "020_public.users.csv", "030_data.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("seedFiles = %v, want %v", got, want)
+	}
+	got, _ = seedFiles(dir, "*.sql")
+	if want := []string{"010_schema.sql", "030_data.sql"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("seedFiles(*.sql) = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,143 @@
+package dbtool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+const shellHelp = `Statements run when a line ends with ';'. Meta-commands:
+  \dt          list tables
+  \d <table>   describe a table ([schema.]table)
+  \c <dbname>  connect to another database
+  \q           quit
+  \?           this help`
+
+// Shell runs an interactive prompt against dbname. Statements may span lines
+// and run once a line ends with ';'; history is kept in ~/.dbtool_history.
+func Shell(dbname string) error {
+	db, err := connectShellDB(dbname)
+	if err != nil {
+		return err
+	}
+	defer func() { db.Close() }()
+
+	cfg := &readline.Config{
+		Prompt:                 dbname + "=> ",
+		DisableAutoSaveHistory: true,
+		InterruptPrompt:        "^C",
+		EOFPrompt:              `\q`,
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		cfg.HistoryFile = filepath.Join(home, ".dbtool_history")
+	}
+	rl, err := readline.NewEx(cfg)
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+
+	fmt.Printf("dbtool shell on %q. Type \\? for help, \\q to quit.\n", dbname)
+	var buf []string
+	for {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			buf = nil
+			rl.SetPrompt(dbname + "=> ")
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		trimmed := strings.TrimSpace(line)
+		if len(buf) == 0 && strings.HasPrefix(trimmed, `\`) {
+			_ = rl.SaveHistory(trimmed)
+			cmd, arg, _ := strings.Cut(trimmed, " ")
+			arg = strings.TrimSpace(arg)
+			switch cmd {
+			case `\q`:
+				return nil
+			case `\?`:
+				fmt.Println(shellHelp)
+			case `\dt`:
+				if err := ListTables(dbname, arg); err != nil {
+					fmt.Fprintln(os.Stderr, "ERROR:", err)
+				}
+			case `\d`:
+				if arg == "" {
+					fmt.Fprintln(os.Stderr, `usage: \d <table>`)
+				} else if err := describeTableTo(os.Stdout, db, arg, FormatText); err != nil {
+					fmt.Fprintln(os.Stderr, "ERROR:", err)
+				}
+			case `\c`:
+				if arg == "" {
+					fmt.Printf("connected to %q\n", dbname)
+					break
+				}
+				next, err := connectShellDB(arg)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "ERROR: connect %q: %v (still on %q)\n", arg, err, dbname)
+					break
+				}
+				db.Close()
+				db, dbname = next, arg
+				rl.SetPrompt(dbname + "=> ")
+				fmt.Printf("connected to %q\n", dbname)
+			default:
+				fmt.Fprintf(os.Stderr, "unknown command %s; type \\? for help\n", cmd)
+			}
+			continue
+		}
+		if trimmed == "" && len(buf) == 0 {
+			continue
+		}
+		buf = append(buf, line)
+		if !strings.HasSuffix(trimmed, ";") {
+			rl.SetPrompt(dbname + "-> ")
+			continue
+		}
+		stmt := strings.TrimSpace(strings.Join(buf, "\n"))
+		buf = nil
+		rl.SetPrompt(dbname + "=> ")
+		_ = rl.SaveHistory(strings.Join(strings.Fields(stmt), " "))
+		stmt = strings.TrimSpace(strings.TrimRight(stmt, ";"))
+		if stmt == "" {
+			continue
+		}
+		// Ctrl-C while a statement runs cancels it instead of exiting.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		_, err = runQuery(ctx, db, dbname, stmt, FormatText)
+		err = queryError(ctx, err, 0)
+		stop()
+		var sqlErr *SQLError
+		if errors.As(err, &sqlErr) {
+			// Already starts with the severity.
+			fmt.Fprintln(os.Stderr, err)
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", err)
+		}
+	}
+}
+
+// connectShellDB opens a single-connection pool so session state (SET,
+// temporary tables, open transactions) carries over between statements.
+func connectShellDB(dbname string) (*sql.DB, error) {
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	return db, nil
+}
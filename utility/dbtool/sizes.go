@@ -0,0 +1,182 @@
+package dbtool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// TableSize is one row of `table sizes`.
+type TableSize struct {
+	Schema     string `json:"schema"`
+	Name       string `json:"name"`
+	TotalBytes int64  `json:"totalBytes"`
+	TableBytes int64  `json:"tableBytes"`
+	IndexBytes int64  `json:"indexBytes"`
+	// ApproxRows comes from pg_class.reltuples (0 if never analyzed).
+	ApproxRows int64 `json:"approxRows"`
+	// ExactRows is only set with --exact.
+	ExactRows *int64 `json:"exactRows,omitempty"`
+}
+
+// SizeReport is the full `table sizes` result.
+type SizeReport struct {
+	Database      string      `json:"database"`
+	DatabaseBytes int64       `json:"databaseBytes"`
+	TotalBytes    int64       `json:"totalBytes"`
+	ApproxRows    int64       `json:"approxRows"`
+	Tables        []TableSize `json:"tables"`
+}
+
+// TableSizes reports per-table sizes for dbname, optionally limited to one
+// schema. sortBy is "size" (default, largest first), "rows" (most rows
+// first) or "name". exact adds a count(*) per table, which reads every table.
+// FormatText prints the fixed-width report with a summary line; the other
+// formats print one row per table (sizes in bytes for csv/tsv).
+func TableSizes(dbname, schema, sortBy string, exact bool, format OutputFormat) error {
+	switch sortBy {
+	case "", "size", "rows", "name":
+	default:
+		return fmt.Errorf("invalid --sort %q (want size, rows or name)", sortBy)
+	}
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rep := SizeReport{Database: dbname, Tables: []TableSize{}}
+	if err := db.QueryRow(`SELECT pg_database_size(current_database())`).Scan(&rep.DatabaseBytes); err != nil {
+		return err
+	}
+	rows, err := db.Query(`
+SELECT n.nspname, c.relname,
+       pg_total_relation_size(c.oid), pg_table_size(c.oid), pg_indexes_size(c.oid),
+       GREATEST(c.reltuples, 0)::bigint
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('r','p')
+  AND n.nspname NOT IN ('pg_catalog','information_schema')
+  AND n.nspname NOT LIKE 'pg_toast%'
+  AND ($1 = '' OR n.nspname = $1)`, strings.TrimSpace(schema))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t TableSize
+		if err := rows.Scan(&t.Schema, &t.Name, &t.TotalBytes, &t.TableBytes, &t.IndexBytes, &t.ApproxRows); err != nil {
+			return err
+		}
+		rep.Tables = append(rep.Tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if exact {
+		for i := range rep.Tables {
+			t := &rep.Tables[i]
+			var n int64
+			q := fmt.Sprintf("SELECT count(*) FROM %s.%s", pq.QuoteIdentifier(t.Schema), pq.QuoteIdentifier(t.Name))
+			if err := db.QueryRow(q).Scan(&n); err != nil {
+				return fmt.Errorf("count %s.%s: %w", t.Schema, t.Name, err)
+			}
+			t.ExactRows = &n
+		}
+	}
+
+	rowsOf := func(t TableSize) int64 {
+		if t.ExactRows != nil {
+			return *t.ExactRows
+		}
+		return t.ApproxRows
+	}
+	sort.SliceStable(rep.Tables, func(i, j int) bool {
+		a, b := rep.Tables[i], rep.Tables[j]
+		switch sortBy {
+		case "name":
+			return a.Schema+"."+a.Name < b.Schema+"."+b.Name
+		case "rows":
+			return rowsOf(a) > rowsOf(b)
+		default:
+			return a.TotalBytes > b.TotalBytes
+		}
+	})
+	for _, t := range rep.Tables {
+		rep.TotalBytes += t.TotalBytes
+		rep.ApproxRows += t.ApproxRows
+	}
+
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	case FormatJSONL:
+		// One line per table; the totals are sums a consumer can redo.
+		enc := json.NewEncoder(os.Stdout)
+		for _, t := range rep.Tables {
+			if err := enc.Encode(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatTable, FormatMarkdown, FormatCSV, FormatTSV:
+		raw := format == FormatCSV || format == FormatTSV
+		size := func(n int64) string {
+			if raw {
+				return strconv.FormatInt(n, 10)
+			}
+			return humanBytes(n)
+		}
+		cols := []string{"table", "total", "table_size", "indexes", "rows_estimate"}
+		if exact {
+			cols = append(cols, "rows")
+		}
+		data := make([][]string, 0, len(rep.Tables))
+		for _, t := range rep.Tables {
+			row := []string{t.Schema + "." + t.Name, size(t.TotalBytes), size(t.TableBytes), size(t.IndexBytes), strconv.FormatInt(t.ApproxRows, 10)}
+			if t.ExactRows != nil {
+				row = append(row, strconv.FormatInt(*t.ExactRows, 10))
+			}
+			data = append(data, row)
+		}
+		return writeGrid(os.Stdout, cols, data, format)
+	}
+
+	fmt.Printf("%-40s %10s %10s %10s %12s", "table", "total", "table", "indexes", "rows~")
+	if exact {
+		fmt.Printf(" %12s", "rows")
+	}
+	fmt.Println()
+	for _, t := range rep.Tables {
+		fmt.Printf("%-40s %10s %10s %10s %12d", t.Schema+"."+t.Name, humanBytes(t.TotalBytes), humanBytes(t.TableBytes), humanBytes(t.IndexBytes), t.ApproxRows)
+		if t.ExactRows != nil {
+			fmt.Printf(" %12d", *t.ExactRows)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("database %s: %s on disk, %d table(s) totalling %s, ~%d rows\n",
+		rep.Database, humanBytes(rep.DatabaseBytes), len(rep.Tables), humanBytes(rep.TotalBytes), rep.ApproxRows)
+	return nil
+}
+
+// humanBytes formats n using binary units, like pg_size_pretty.
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
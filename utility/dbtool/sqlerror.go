@@ -0,0 +1,118 @@
+package dbtool
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// SQLError is a server error together with the SQL text it refers to, so
+// the error position Postgres reports (a character offset) can be shown as a
+// line and column. It unwraps to the *pq.Error.
+type SQLError struct {
+	Err   *pq.Error
+	Query string
+}
+
+// withPosition attaches query to err when err is a server error; other
+// errors are returned unchanged.
+func withPosition(err error, query string) error {
+	if pqErr, ok := err.(*pq.Error); ok {
+		return &SQLError{Err: pqErr, Query: query}
+	}
+	return err
+}
+
+func (e *SQLError) Unwrap() error { return e.Err }
+
+// Position returns the 1-based line and column of the error in Query, if the
+// server reported one.
+func (e *SQLError) Position() (line, col int, ok bool) {
+	pos, err := strconv.Atoi(e.Err.Position)
+	if err != nil || pos < 1 {
+		return 0, 0, false
+	}
+	runes := []rune(e.Query)
+	if pos > len(runes)+1 {
+		return 0, 0, false
+	}
+	line, col = 1, 1
+	for _, r := range runes[:pos-1] {
+		if r == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col, true
+}
+
+// Error formats the error like psql: severity, message and SQLSTATE, then
+// the offending line with a caret under the position, then detail and hint.
+func (e *SQLError) Error() string {
+	var b strings.Builder
+	severity := e.Err.Severity
+	if severity == "" {
+		severity = "ERROR"
+	}
+	fmt.Fprintf(&b, "%s: %s (SQLSTATE %s)", severity, e.Err.Message, e.Err.Code)
+	if line, col, ok := e.Position(); ok {
+		text := strings.TrimRight(strings.Split(e.Query, "\n")[line-1], "\r")
+		prefix := fmt.Sprintf("LINE %d: ", line)
+		fmt.Fprintf(&b, "\n  at line %d, column %d", line, col)
+		fmt.Fprintf(&b, "\n  %s%s", prefix, strings.ReplaceAll(text, "\t", " "))
+		fmt.Fprintf(&b, "\n  %s^", strings.Repeat(" ", len(prefix)+col-1))
+	}
+	if e.Err.Detail != "" {
+		fmt.Fprintf(&b, "\n  DETAIL: %s", e.Err.Detail)
+	}
+	if e.Err.Hint != "" {
+		fmt.Fprintf(&b, "\n  HINT: %s", e.Err.Hint)
+	}
+	return b.String()
+}
+
+func errClass(err error) pq.ErrorClass {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code.Class()
+	}
+	return ""
+}
+
+// IsSyntaxError reports a SQLSTATE class 42 error ("syntax error or access
+// rule violation": bad syntax, unknown table or column, ...).
+func IsSyntaxError(err error) bool { return errClass(err) == "42" }
+
+// IsConstraintViolation reports a SQLSTATE class 23 error (unique, foreign
+// key, not-null and check violations).
+func IsConstraintViolation(err error) bool { return errClass(err) == "23" }
+
+// IsConnectionError reports errors reaching or staying connected to the
+// server: network errors, SQLSTATE class 08 (connection exception) and 28
+// (authorization), too many connections and server shutdowns.
+func IsConnectionError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	switch pqErr.Code.Class() {
+	case "08", "28":
+		return true
+	}
+	switch pqErr.Code {
+	case "53300", "57P01", "57P02", "57P03":
+		return true
+	}
+	return false
+}
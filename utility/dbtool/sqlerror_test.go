@@ -0,0 +1,57 @@
+package dbtool
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestSQLErrorPosition(t *testing.T) {
+	query := "SELECT 1;\nSELECT * FORM t;\n"
+	err := withPosition(&pq.Error{Severity: "ERROR", Code: "42601", Message: `syntax error at or near "FORM"`, Position: "20", Hint: "check the spelling"}, query)
+	se, ok := err.(*SQLError)
+	if !ok {
+		t.Fatalf("withPosition returned %T", err)
+	}
+	if line, col, ok := se.Position(); !ok || line != 2 || col != 10 {
+		t.Errorf("Position = %d, %d, %v; want 2, 10", line, col, ok)
+	}
+	want := `ERROR: syntax error at or near "FORM" (SQLSTATE 42601)` + "\n" +
+		"  at line 2, column 10\n" +
+		"  LINE 2: SELECT * FORM t;\n" +
+		"                   ^\n" +
+		"  HINT: check the spelling"
+	if err.Error() != want {
+		t.Errorf("got\n%s\nwant\n%s", err.Error(), want)
+	}
+	if !IsSyntaxError(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("IsSyntaxError should see through SQLError and wrapping")
+	}
+}
+
+func TestSQLErrorClasses(t *testing.T) {
+	cases := []struct {
+		err                          error
+		syntax, constraint, connects bool
+	}{
+		{&pq.Error{Code: "42P01"}, true, false, false},
+		{&pq.Error{Code: "23505"}, false, true, false},
+		{&pq.Error{Code: "28P01"}, false, false, true},
+		{&pq.Error{Code: "57P01"}, false, false, true},
+		{&pq.Error{Code: "22012"}, false, false, false},
+		{fmt.Errorf("ping: %w", driver.ErrBadConn), false, false, true},
+	}
+	for _, c := range cases {
+		if got := IsSyntaxError(c.err); got != c.syntax {
+			t.Errorf("IsSyntaxError(%v) = %v", c.err, got)
+		}
+		if got := IsConstraintViolation(c.err); got != c.constraint {
+			t.Errorf("IsConstraintViolation(%v) = %v", c.err, got)
+		}
+		if got := IsConnectionError(c.err); got != c.connects {
+			t.Errorf("IsConnectionError(%v) = %v", c.err, got)
+		}
+	}
+}
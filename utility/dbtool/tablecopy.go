@@ -0,0 +1,252 @@
+package dbtool
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	dbconf "cli-things/utility/dbconf"
+
+	"github.com/lib/pq"
+)
+
+// TableCopyOptions controls CopyTable.
+type TableCopyOptions struct {
+	// Create creates the destination table from the source columns (and
+	// primary key) when it does not exist.
+	Create bool
+	// Truncate empties the destination table before copying.
+	Truncate bool
+	// SourceDSN connects to the source through this postgres:// URL, with
+	// the source database name swapped into its path, instead of the
+	// configured server.
+	SourceDSN string
+}
+
+// ParseDBTable splits "<db>.<schema.table>" or "<db>.<table>" (schema
+// public). With optionalTable, a bare "<db>" is accepted and table is "".
+func ParseDBTable(s string, optionalTable bool) (dbname, table string, err error) {
+	dbname, table, found := strings.Cut(s, ".")
+	if dbname == "" || (found && table == "") || (!found && !optionalTable) {
+		return "", "", fmt.Errorf("invalid %q: want <dbname>.<schema.table>", s)
+	}
+	if strings.Count(table, ".") > 1 {
+		return "", "", fmt.Errorf("invalid table in %q: want <schema.table> or <table>", s)
+	}
+	return dbname, table, nil
+}
+
+// CopyTable streams srcTable in srcDB into dstTable in dstDB with COPY FROM
+// STDIN. The source is read in one REPEATABLE READ snapshot and the
+// destination is written in one transaction, which is only committed when
+// the number of rows added matches the source row count. Every source column
+// must exist in the destination with the same type; extra destination
+// columns get their defaults.
+func CopyTable(srcDB, srcTable, dstDB, dstTable string, opts TableCopyOptions) error {
+	if dstTable == "" {
+		dstTable = srcTable
+	}
+	if opts.SourceDSN == "" && srcDB == dstDB && quoteTableName(srcTable) == quoteTableName(dstTable) {
+		return fmt.Errorf("source and destination are the same table")
+	}
+	var src *sql.DB
+	var err error
+	if opts.SourceDSN != "" {
+		dsn := opts.SourceDSN
+		if u, ok := overrideDBNameInPostgresURL(dsn, srcDB); ok {
+			dsn = u
+		}
+		src, err = dbconf.ConnectDSN(dsn)
+	} else {
+		src, err = ConnectDBAs(srcDB)
+	}
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	defer src.Close()
+	dst, err := ConnectDBAs(dstDB)
+	if err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+	defer dst.Close()
+
+	srcDesc, err := describeTable(src, srcTable)
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	missing, err := missingTables(dst, []string{dstTable})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		if !opts.Create {
+			return fmt.Errorf("destination table %q does not exist in %s (use --create)", dstTable, dstDB)
+		}
+		stmt, err := createTableStatement(src, srcDesc, dstTable)
+		if err != nil {
+			return err
+		}
+		vprintln("dbtool:", stmt)
+		if _, err := dst.Exec(stmt); err != nil {
+			return fmt.Errorf("create %s: %w", dstTable, err)
+		}
+		fmt.Fprintf(os.Stderr, "dbtool: created %s in %s (columns and primary key only; add other indexes and constraints yourself)\n", dstTable, dstDB)
+	}
+	dstDesc, err := describeTable(dst, dstTable)
+	if err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+	if err := checkColumnTypes(srcDesc, dstDesc); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	stx, err := src.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer stx.Rollback()
+	var srcCount int64
+	if err := stx.QueryRow("SELECT count(*) FROM " + quoteTableName(srcTable)).Scan(&srcCount); err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+
+	dtx, err := dst.Begin()
+	if err != nil {
+		return err
+	}
+	defer dtx.Rollback()
+	if opts.Truncate {
+		if _, err := dtx.Exec("TRUNCATE TABLE " + quoteTableName(dstTable)); err != nil {
+			return fmt.Errorf("truncate: %w", err)
+		}
+	}
+	var before int64
+	if err := dtx.QueryRow("SELECT count(*) FROM " + quoteTableName(dstTable)).Scan(&before); err != nil {
+		return err
+	}
+
+	// Every column goes through its text form: the types match, so text
+	// output parses back exactly, and lib/pq's COPY encoder would otherwise
+	// treat the []byte it scans for most types as bytea.
+	cols := make([]string, len(srcDesc.Columns))
+	selects := make([]string, len(srcDesc.Columns))
+	for i, c := range srcDesc.Columns {
+		cols[i] = c.Name
+		selects[i] = pq.QuoteIdentifier(c.Name) + "::text"
+	}
+	rows, err := stx.Query("SELECT " + strings.Join(selects, ", ") + " FROM " + quoteTableName(srcTable))
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	defer rows.Close()
+	schema, name := splitTableName(dstTable)
+	stmt, err := dtx.Prepare(pq.CopyInSchema(schema, name, cols...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	started := time.Now()
+	vals := make([]sql.NullString, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	args := make([]any, len(cols))
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		for i, v := range vals {
+			if v.Valid {
+				args[i] = v.String
+			} else {
+				args[i] = nil
+			}
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return fmt.Errorf("copy: %w", err)
+		}
+		n++
+		if n%100000 == 0 {
+			fmt.Fprintf(os.Stderr, "dbtool: %d of %d rows copied\n", n, srcCount)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	if _, err := stmt.Exec(); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+
+	var after int64
+	if err := dtx.QueryRow("SELECT count(*) FROM " + quoteTableName(dstTable)).Scan(&after); err != nil {
+		return err
+	}
+	if n != srcCount || after-before != srcCount {
+		return fmt.Errorf("row count mismatch: source has %d, read %d, destination gained %d; nothing was committed", srcCount, n, after-before)
+	}
+	if err := dtx.Commit(); err != nil {
+		return err
+	}
+	fmt.Printf("Copied %d row(s) from %s.%s to %s.%s in %s; row counts verified (destination now has %d)\n",
+		n, srcDB, srcTable, dstDB, dstTable, time.Since(started).Round(time.Millisecond), after)
+	return nil
+}
+
+// createTableStatement builds CREATE TABLE for table from the source
+// columns and primary key. Defaults that use nextval() are left out because
+// the sequence does not exist in the destination.
+func createTableStatement(src *sql.DB, d TableDescription, table string) (string, error) {
+	var defs []string
+	for _, c := range d.Columns {
+		def := pq.QuoteIdentifier(c.Name) + " " + c.Type
+		if c.Default != "" && !strings.Contains(c.Default, "nextval(") {
+			def += " DEFAULT " + c.Default
+		}
+		if !c.Nullable {
+			def += " NOT NULL"
+		}
+		defs = append(defs, def)
+	}
+	var pk sql.NullString
+	err := src.QueryRow(`SELECT pg_get_constraintdef(oid) FROM pg_constraint WHERE conrelid = $1::regclass AND contype = 'p'`, d.Table).Scan(&pk)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if pk.Valid {
+		defs = append(defs, pk.String)
+	}
+	return "CREATE TABLE " + quoteTableName(table) + " (\n  " + strings.Join(defs, ",\n  ") + "\n)", nil
+}
+
+// checkColumnTypes requires every source column to exist in the destination
+// with the same type.
+func checkColumnTypes(src, dst TableDescription) error {
+	types := make(map[string]string, len(dst.Columns))
+	for _, c := range dst.Columns {
+		types[c.Name] = c.Type
+	}
+	var problems []string
+	for _, c := range src.Columns {
+		t, ok := types[c.Name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("column %q is missing in the destination", c.Name))
+		case t != c.Type:
+			problems = append(problems, fmt.Sprintf("column %q is %s in the source but %s in the destination", c.Name, c.Type, t))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s does not match %s:\n  %s", dst.Table, src.Table, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package dbtool
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDBTable(t *testing.T) {
+	cases := []struct {
+		in        string
+		optional  bool
+		db, table string
+		wantErr   bool
+	}{
+		{"app.public.users", false, "app", "public.users", false},
+		{"app.users", false, "app", "users", false},
+		{"app", true, "app", "", false},
+		{"app", false, "", "", true},
+		{"app.", true, "", "", true},
+		{".users", false, "", "", true},
+		{"app.a.b.c", false, "", "", true},
+	}
+	for _, c := range cases {
+		db, table, err := ParseDBTable(c.in, c.optional)
+		if (err != nil) != c.wantErr || db != c.db || table != c.table {
+			t.Errorf("ParseDBTable(%q, %v) = %q, %q, %v", c.in, c.optional, db, table, err)
+		}
+	}
+}
+
+func TestCheckColumnTypes(t *testing.T) {
+	src := TableDescription{Table: "users", Columns: []ColumnInfo{{Name: "id", Type: "bigint"}, {Name: "email", Type: "text"}, {Name: "age", Type: "integer"}}}
+	dst := TableDescription{Table: "users", Columns: []ColumnInfo{{Name: "id", Type: "bigint"}, {Name: "email", Type: "character varying(100)"}, {Name: "extra", Type: "text"}}}
+	err := checkColumnTypes(src, dst)
+	if err == nil {
+		t.Fatal("expected a mismatch")
+	}
+	for _, want := range []string{`column "email" is text in the source but character varying(100) in the destination`, `column "age" is missing`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if err := checkColumnTypes(src, src); err != nil {
+		t.Errorf("identical tables: %v", err)
+	}
+}
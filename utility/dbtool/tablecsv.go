@@ -0,0 +1,322 @@
+package dbtool
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// lib/pq implements COPY FROM STDIN (pq.CopyIn) but not COPY TO STDOUT, so
+// export streams a SELECT through a CSV writer that follows COPY's CSV rules:
+// NULL is an unquoted empty field and the empty string is written as "".
+// Import reads the same format and feeds pq.CopyIn row by row, so neither
+// direction needs psql or holds the file in memory.
+
+// ExportTableCSV writes table (optionally filtered by the SQL condition
+// where) to path as CSV with a header row and returns the number of rows.
+func ExportTableCSV(dbname, table, path, where string) (int64, error) {
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	if missing, err := missingTables(db, []string{table}); err != nil {
+		return 0, err
+	} else if len(missing) > 0 {
+		return 0, fmt.Errorf("table %q not found", table)
+	}
+
+	q := "SELECT * FROM " + quoteTableName(table)
+	if w := strings.TrimSpace(where); w != "" {
+		q += " WHERE " + w
+	}
+	vprintln("dbtool:", q)
+	rows, err := db.Query(q)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	header := make([]*string, len(cols))
+	for i := range cols {
+		header[i] = &cols[i]
+	}
+	if err := writeCSVRecord(w, header); err != nil {
+		return 0, err
+	}
+	vals := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	rec := make([]*string, len(cols))
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		for i, v := range vals {
+			if v == nil {
+				rec[i] = nil
+				continue
+			}
+			s := fmt.Sprint(normalizeValue(v, types[i].DatabaseTypeName()))
+			rec[i] = &s
+		}
+		if err := writeCSVRecord(w, rec); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if err := w.Flush(); err != nil {
+		return n, err
+	}
+	return n, f.Close()
+}
+
+// writeCSVRecord writes one CSV line; a nil field is NULL (unquoted empty).
+func writeCSVRecord(w *bufio.Writer, fields []*string) error {
+	for i, f := range fields {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		if f == nil {
+			continue
+		}
+		s := *f
+		if s == "" || strings.ContainsAny(s, ",\"\r\n") || s == `\.` {
+			w.WriteByte('"')
+			w.WriteString(strings.ReplaceAll(s, `"`, `""`))
+			w.WriteByte('"')
+			continue
+		}
+		w.WriteString(s)
+	}
+	_, err := w.WriteString("\n")
+	return err
+}
+
+// csvField is one parsed field; Quoted distinguishes "" (empty string) from
+// an empty unquoted field (NULL).
+type csvField struct {
+	Value  string
+	Quoted bool
+}
+
+// csvReader reads COPY-style CSV one record at a time.
+type csvReader struct {
+	r    *bufio.Reader
+	line int // physical line the next record starts on
+}
+
+func newCSVReader(r io.Reader) *csvReader { return &csvReader{r: bufio.NewReader(r), line: 1} }
+
+// Read returns the next record and the line it started on, or io.EOF.
+func (c *csvReader) Read() ([]csvField, int, error) {
+	start := c.line
+	var fields []csvField
+	var cur strings.Builder
+	quoted, inQuotes, sawByte := false, false, false
+	for {
+		b, err := c.r.ReadByte()
+		if err == io.EOF {
+			if inQuotes {
+				return nil, start, fmt.Errorf("line %d: unterminated quoted field", start)
+			}
+			if !sawByte && len(fields) == 0 {
+				return nil, start, io.EOF
+			}
+			return append(fields, csvField{cur.String(), quoted}), start, nil
+		}
+		if err != nil {
+			return nil, start, err
+		}
+		sawByte = true
+		if inQuotes {
+			if b == '"' {
+				if next, err := c.r.Peek(1); err == nil && next[0] == '"' {
+					c.r.ReadByte()
+					cur.WriteByte('"')
+					continue
+				}
+				inQuotes = false
+				continue
+			}
+			if b == '\n' {
+				c.line++
+			}
+			cur.WriteByte(b)
+			continue
+		}
+		switch b {
+		case '"':
+			inQuotes, quoted = true, true
+		case ',':
+			fields = append(fields, csvField{cur.String(), quoted})
+			cur.Reset()
+			quoted = false
+		case '\r':
+			// Dropped; \r\n ends the record at the \n.
+		case '\n':
+			c.line++
+			return append(fields, csvField{cur.String(), quoted}), start, nil
+		default:
+			cur.WriteByte(b)
+		}
+	}
+}
+
+var copyLineRe = regexp.MustCompile(`line (\d+)`)
+
+// ImportTableCSV loads a CSV file with a header row into table using COPY
+// FROM STDIN in one transaction, optionally truncating the table first. The
+// header names the target columns. Errors name the offending file line when
+// it is known.
+func ImportTableCSV(dbname, table, path string, truncateFirst bool) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	if missing, err := missingTables(db, []string{table}); err != nil {
+		return 0, err
+	} else if len(missing) > 0 {
+		return 0, fmt.Errorf("table %q not found", table)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if truncateFirst {
+		if _, err := tx.Exec("TRUNCATE TABLE " + quoteTableName(table)); err != nil {
+			return 0, fmt.Errorf("truncate: %w", err)
+		}
+	}
+	n, err := copyCSV(tx, table, f, path)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// copyCSV streams CSV with a header row from r into table inside tx. path is
+// only used in error messages.
+func copyCSV(tx *sql.Tx, table string, r io.Reader, path string) (int64, error) {
+	cr := newCSVReader(r)
+	header, _, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("%s is empty; expected a header row", path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	cols := make([]string, len(header))
+	for i, h := range header {
+		cols[i] = strings.TrimSpace(h.Value)
+	}
+
+	schema, name := splitTableName(table)
+	stmt, err := tx.Prepare(pq.CopyInSchema(schema, name, cols...))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	// COPY reports errors by data row; remember where rows started on a
+	// different file line than row+1 (multi-line quoted fields) so the row
+	// can be mapped back without keeping every row's position.
+	type shift struct{ row, line int }
+	var shifts []shift
+	fileLine := func(row int) int {
+		line := row + 1
+		for _, s := range shifts {
+			if s.row <= row {
+				line = s.line + (row - s.row)
+			}
+		}
+		return line
+	}
+	copyErr := func(err error) error {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			if m := copyLineRe.FindStringSubmatch(pqErr.Where); m != nil {
+				if row, convErr := strconv.Atoi(m[1]); convErr == nil {
+					return fmt.Errorf("%s line %d: %w", path, fileLine(row), err)
+				}
+			}
+		}
+		return err
+	}
+
+	var n int64
+	offset := 1 // file line minus row number
+	args := make([]any, len(cols))
+	for {
+		rec, line, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		n++
+		if line-int(n) != offset {
+			offset = line - int(n)
+			shifts = append(shifts, shift{int(n), line})
+		}
+		if len(rec) != len(cols) {
+			return 0, fmt.Errorf("%s line %d: %d fields, header has %d", path, line, len(rec), len(cols))
+		}
+		for i, fld := range rec {
+			if fld.Value == "" && !fld.Quoted {
+				args[i] = nil
+			} else {
+				args[i] = fld.Value
+			}
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return 0, copyErr(err)
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		return 0, copyErr(err)
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, copyErr(err)
+	}
+	return n, nil
+}
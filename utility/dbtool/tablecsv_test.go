@@ -0,0 +1,58 @@
+package dbtool
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func strp(s string) *string { return &s }
+
+func TestWriteCSVRecord(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := writeCSVRecord(w, []*string{strp("plain"), nil, strp(""), strp("a,\"b\"\nc")}); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	if want := "plain,,\"\",\"a,\"\"b\"\"\nc\"\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	in := "id,name,note\r\n1,,\"\"\n2,\"multi\nline, \"\"quoted\"\"\",x\n3,last,y"
+	cr := newCSVReader(strings.NewReader(in))
+	type rec struct {
+		fields []csvField
+		line   int
+	}
+	var got []rec
+	for {
+		f, line, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rec{f, line})
+	}
+	want := []rec{
+		{[]csvField{{"id", false}, {"name", false}, {"note", false}}, 1},
+		{[]csvField{{"1", false}, {"", false}, {"", true}}, 2},
+		{[]csvField{{"2", false}, {"multi\nline, \"quoted\"", true}, {"x", false}}, 3},
+		{[]csvField{{"3", false}, {"last", false}, {"y", false}}, 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %#v\nwant %#v", got, want)
+	}
+
+	if _, _, err := newCSVReader(strings.NewReader("\"open")).Read(); err == nil {
+		t.Error("unterminated quote should fail")
+	}
+}
@@ -0,0 +1,86 @@
+package dbtool
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// TruncateOptions controls TruncateTables.
+type TruncateOptions struct {
+	Cascade         bool
+	RestartIdentity bool
+}
+
+// splitTableName splits "schema.table" (schema defaults to public).
+func splitTableName(name string) (schema, table string) {
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "public", name
+}
+
+func quoteTableName(name string) string {
+	schema, table := splitTableName(name)
+	return pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(table)
+}
+
+// MissingTables returns the names from tables that do not exist in dbname.
+func MissingTables(dbname string, tables []string) ([]string, error) {
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return missingTables(db, tables)
+}
+
+func missingTables(db *sql.DB, tables []string) ([]string, error) {
+	var missing []string
+	for _, t := range tables {
+		var oid sql.NullString
+		if err := db.QueryRow(`SELECT to_regclass($1)::text`, quoteTableName(t)).Scan(&oid); err != nil {
+			return nil, err
+		}
+		if !oid.Valid {
+			missing = append(missing, t)
+		}
+	}
+	return missing, nil
+}
+
+// TruncateTables truncates all tables in one TRUNCATE statement. Nothing is
+// truncated if any table does not exist.
+func TruncateTables(dbname string, tables []string, opts TruncateOptions) error {
+	if len(tables) == 0 {
+		return fmt.Errorf("no tables given")
+	}
+	db, err := ConnectDBAs(dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	missing, err := missingTables(db, tables)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("table(s) not found: %s", strings.Join(missing, ", "))
+	}
+	quoted := make([]string, len(tables))
+	for i, t := range tables {
+		quoted[i] = quoteTableName(t)
+	}
+	stmt := "TRUNCATE TABLE " + strings.Join(quoted, ", ")
+	if opts.RestartIdentity {
+		stmt += " RESTART IDENTITY"
+	}
+	if opts.Cascade {
+		stmt += " CASCADE"
+	}
+	vprintln("dbtool:", stmt)
+	_, err = db.Exec(stmt)
+	return err
+}
@@ -0,0 +1,166 @@
+package dbtool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	dbconf "cli-things/utility/dbconf"
+	"cli-things/utility/exitcode"
+
+	"github.com/lib/pq"
+)
+
+// WaitOptions controls WaitForDatabase.
+type WaitOptions struct {
+	// Timeout is how long to keep trying in total.
+	Timeout time.Duration
+	// Interval is the pause between attempts.
+	Interval time.Duration
+	// CreateMissing creates the database once the server is reachable and
+	// reports that it does not exist.
+	CreateMissing bool
+	// JSON prints one JSON object per attempt on stdout instead of dots on
+	// stderr.
+	JSON bool
+}
+
+// Wait statuses, as printed in JSON progress.
+const (
+	WaitReady       = "ready"
+	WaitUnreachable = "unreachable"
+	WaitMissing     = "missing"
+	WaitAuth        = "auth-failed"
+	WaitCreated     = "created"
+)
+
+// waitStatus classifies a ConnectDBAs error: the server answered that the
+// database does not exist (SQLSTATE 3D000), rejected the credentials (class
+// 28), or could not be reached or used at all.
+func waitStatus(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "3D000":
+			return WaitMissing
+		case pqErr.Code.Class() == "28":
+			return WaitAuth
+		}
+	}
+	return WaitUnreachable
+}
+
+// WaitForDatabase tries to connect to dbname every opts.Interval until it
+// succeeds or opts.Timeout has passed; on timeout the error includes the
+// last connection error and is marked exitcode.Timeout. A single attempt that hangs (e.g. a firewalled
+// port) is abandoned at the deadline.
+func WaitForDatabase(dbname string, opts WaitOptions) error {
+	started := time.Now()
+	deadline := started.Add(opts.Timeout)
+	enc := json.NewEncoder(os.Stdout)
+	report := func(attempt int, status string, err error) {
+		if !opts.JSON {
+			return
+		}
+		ev := struct {
+			Attempt        int     `json:"attempt"`
+			ElapsedSeconds float64 `json:"elapsedSeconds"`
+			Database       string  `json:"db"`
+			Status         string  `json:"status"`
+			Error          string  `json:"error,omitempty"`
+		}{attempt, time.Since(started).Seconds(), dbname, status, ""}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		enc.Encode(ev)
+	}
+
+	var lastErr error
+	var lastStatus string
+	dots := false
+	for attempt := 1; ; attempt++ {
+		h, err := waitAttempt(dbname, time.Until(deadline))
+		if err == nil {
+			if dots {
+				fmt.Fprintln(os.Stderr)
+			}
+			report(attempt, WaitReady, nil)
+			fmt.Fprintf(os.Stderr, "dbtool: database %q is ready after %s (%d attempt(s)), PostgreSQL %s%s\n",
+				dbname, time.Since(started).Round(time.Millisecond), attempt, h.ServerVersion, readOnlyNote(h))
+			return nil
+		}
+		status := waitStatus(err)
+		lastErr = err
+		report(attempt, status, err)
+		if status != lastStatus {
+			// Say when the situation changes, e.g. the server came up but
+			// the database is not there yet.
+			if dots {
+				fmt.Fprintln(os.Stderr)
+				dots = false
+			}
+			if !opts.JSON {
+				fmt.Fprintf(os.Stderr, "dbtool: %s: %v\n", waitDescription(status, dbname), err)
+			}
+			lastStatus = status
+		}
+		if status == WaitMissing && opts.CreateMissing {
+			if err := createDatabase(dbname); err != nil {
+				return fmt.Errorf("create database %q: %w", dbname, err)
+			}
+			report(attempt, WaitCreated, nil)
+			if !opts.JSON {
+				fmt.Fprintf(os.Stderr, "dbtool: created database %q\n", dbname)
+			}
+			continue
+		}
+		if time.Now().Add(opts.Interval).After(deadline) {
+			break
+		}
+		if !opts.JSON {
+			fmt.Fprint(os.Stderr, ".")
+			dots = true
+		}
+		time.Sleep(opts.Interval)
+	}
+	if dots {
+		fmt.Fprintln(os.Stderr)
+	}
+	hint := ""
+	if lastStatus == WaitMissing {
+		hint = " (use --create-missing to create it)"
+	}
+	return exitcode.Wrap(exitcode.Timeout, fmt.Errorf("timed out after %s: %s%s: %w", opts.Timeout, waitDescription(lastStatus, dbname), hint, lastErr))
+}
+
+func waitDescription(status, dbname string) string {
+	switch status {
+	case WaitMissing:
+		return fmt.Sprintf("server is up but database %q does not exist", dbname)
+	case WaitAuth:
+		return "server is up but rejected the credentials"
+	default:
+		return "server unreachable"
+	}
+}
+
+// waitAttempt is one health check of dbname that gives up after limit.
+func waitAttempt(dbname string, limit time.Duration) (*dbconf.Health, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), limit)
+	defer cancel()
+	return dbconf.HealthCheckAs(ctx, dbname)
+}
+
+// createDatabase runs CREATE DATABASE from the maintenance database.
+func createDatabase(dbname string) error {
+	admin, err := connectMaintenanceDB(dbname)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	_, err = admin.Exec("CREATE DATABASE " + pq.QuoteIdentifier(dbname))
+	return err
+}
@@ -0,0 +1,26 @@
+package dbtool
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestWaitStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("failed to ping database: %w", &pq.Error{Code: "3D000"}), WaitMissing},
+		{fmt.Errorf("failed to ping database: %w", &pq.Error{Code: "28P01"}), WaitAuth},
+		{&pq.Error{Code: "57P03"}, WaitUnreachable},
+		{errors.New("dial tcp: connection refused"), WaitUnreachable},
+	}
+	for _, c := range cases {
+		if got := waitStatus(c.err); got != c.want {
+			t.Errorf("waitStatus(%v) = %q, want %q", c.err, got, c.want)
+		}
+	}
+}
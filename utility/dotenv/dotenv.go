@@ -0,0 +1,243 @@
+// Package dotenv reads .env files: KEY=value lines, optionally quoted or
+// behind "export ", as written for docker compose and shells. LoadNearest
+// applies every .env from a directory up to the repository root, the way
+// the tools pick up a project's settings from wherever they are started.
+package dotenv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Var is one assignment read from a .env file.
+type Var struct {
+	Key, Value string
+	// File is the .env file the assignment is in ("" from Parse), Line its
+	// line number.
+	File string
+	Line int
+}
+
+// Parse reads the assignments in r, in order. Blank lines and lines
+// starting with # are skipped, as are lines without a key and '='. An
+// "export " in front of the key is dropped. A value may be double-quoted,
+// with \n, \r, \t, \" and \\ escapes, or single-quoted, taken literally;
+// anything after the closing quote is ignored. An unquoted value ends at a
+// # that follows a space or tab, which starts a comment.
+func Parse(r io.Reader) ([]Var, error) {
+	var vars []Var
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest, ok := cutExport(line); ok {
+			line = rest
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		vars = append(vars, Var{Key: key, Value: parseValue(raw), Line: n})
+	}
+	return vars, sc.Err()
+}
+
+func cutExport(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(line, "export")
+	if !ok || rest == "" || (rest[0] != ' ' && rest[0] != '\t') {
+		return line, false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// parseValue unquotes raw, everything after the '='.
+func parseValue(raw string) string {
+	v := strings.TrimLeft(raw, " \t")
+	switch {
+	case strings.HasPrefix(v, `"`):
+		var b strings.Builder
+		for i := 1; i < len(v); i++ {
+			c := v[i]
+			if c == '"' {
+				return b.String()
+			}
+			if c == '\\' && i+1 < len(v) {
+				i++
+				switch v[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				case '"', '\\':
+					b.WriteByte(v[i])
+				default:
+					b.WriteByte('\\')
+					b.WriteByte(v[i])
+				}
+				continue
+			}
+			b.WriteByte(c)
+		}
+		// No closing quote: the value is taken as written.
+		return strings.TrimSpace(v)
+	case strings.HasPrefix(v, "'"):
+		if end := strings.IndexByte(v[1:], '\''); end >= 0 {
+			return v[1 : end+1]
+		}
+		return strings.TrimSpace(v)
+	}
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && (i == 0 || raw[i-1] == ' ' || raw[i-1] == '\t') {
+			raw = raw[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(raw)
+}
+
+// ReadFile parses the .env file at path.
+func ReadFile(path string) ([]Var, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	vars, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	for i := range vars {
+		vars[i].File = path
+	}
+	return vars, nil
+}
+
+// Options tune Find and LoadNearest.
+type Options struct {
+	// Dir is where the search starts; "" is the working directory.
+	Dir string
+	// MaxDepth is how many parent directories the search may climb: 0
+	// looks in Dir only, a negative value has no limit besides the
+	// repository root.
+	MaxDepth int
+	// Override lets .env values replace variables already set in the
+	// environment; by default the environment wins.
+	Override bool
+	// ResolvePaths names keys holding a path, such as DBTOOL_CONFIG_FILE;
+	// a relative value is resolved against the directory of its .env file.
+	ResolvePaths []string
+	// Set applies one winning assignment; nil calls os.Setenv.
+	Set func(v Var)
+	// Logf receives progress messages, each ending in a newline, such as
+	// dbconf's vprintf or a clog.Logger's Debugf; nil discards them.
+	Logf func(format string, args ...any)
+}
+
+func (o Options) logf(format string, args ...any) {
+	if o.Logf != nil {
+		o.Logf(format, args...)
+	}
+}
+
+// Find returns the .env files from opts.Dir upward, nearest first. The
+// search stops at the first directory holding a .git directory (the
+// repository root, whose .env is included), at the filesystem root, or
+// after opts.MaxDepth parents.
+func Find(opts Options) ([]string, error) {
+	dir := opts.Dir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		dir = wd
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	opts.logf("dotenv: searching for .env files from %s\n", dir)
+	for depth := 0; ; depth++ {
+		path := filepath.Join(dir, ".env")
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, path)
+			opts.logf("dotenv: found %s\n", path)
+		}
+		if info, err := os.Stat(filepath.Join(dir, ".git")); err == nil && info.IsDir() {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		if opts.MaxDepth >= 0 && depth >= opts.MaxDepth {
+			opts.logf("dotenv: stopping .env search at %s (max depth %d)\n", dir, opts.MaxDepth)
+			break
+		}
+		dir = parent
+	}
+	return files, nil
+}
+
+// LoadNearest applies the .env files Find returns. A nearer file wins over
+// one further up and, within a file, the last assignment of a key wins.
+// Keys already set in the environment are left alone unless
+// opts.Override is set.
+func LoadNearest(opts Options) error {
+	files, err := Find(opts)
+	if err != nil {
+		return err
+	}
+	set := opts.Set
+	if set == nil {
+		set = func(v Var) { os.Setenv(v.Key, v.Value) }
+	}
+	resolve := map[string]bool{}
+	for _, k := range opts.ResolvePaths {
+		resolve[k] = true
+	}
+	won := map[string]string{}
+	for _, file := range files {
+		opts.logf("dotenv: applying %s\n", file)
+		vars, err := ReadFile(file)
+		if err != nil {
+			return err
+		}
+		for i := len(vars) - 1; i >= 0; i-- {
+			v := vars[i]
+			if by, ok := won[v.Key]; ok {
+				if by != file {
+					opts.logf("dotenv: %s from %s overridden by %s\n", v.Key, file, by)
+				}
+				continue
+			}
+			won[v.Key] = file
+			if _, ok := os.LookupEnv(v.Key); ok && !opts.Override {
+				opts.logf("dotenv: skipping %s from %s (already set in environment)\n", v.Key, file)
+				continue
+			}
+			if resolve[v.Key] && v.Value != "" && !filepath.IsAbs(v.Value) {
+				resolved := filepath.Join(filepath.Dir(file), v.Value)
+				opts.logf("dotenv: resolving %s relative to %s -> %s\n", v.Key, file, resolved)
+				v.Value = resolved
+			}
+			set(v)
+		}
+	}
+	return nil
+}
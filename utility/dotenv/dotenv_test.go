@@ -0,0 +1,160 @@
+package dotenv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := "\ufeff# leading comment\n" +
+		"PLAIN=value\n" +
+		"  SPACED = padded value  \n" +
+		"export EXPORTED=yes\n" +
+		"export\tTABBED=yes\n" +
+		"exporter=not a prefix\n" +
+		"DOUBLE=\"a \\\"quoted\\\" line\\nnext\\tcol \\\\ \\$HOME\" # comment\n" +
+		"SINGLE='no \\n escapes # here' trailing\n" +
+		"INLINE=value # comment\n" +
+		"HASH=a#b\n" +
+		"EMPTY=\n" +
+		"EMPTY_COMMENT= # nothing\n" +
+		"UNCLOSED=\"open\n" +
+		"URL=postgres://u:p@h/db?sslmode=disable\n" +
+		"no equals sign\n" +
+		"=novalue\n" +
+		"CRLF=windows\r\n" +
+		"QUOTED_CRLF=\"windows\"\r\n"
+	vars, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Var{
+		{Key: "PLAIN", Value: "value", Line: 2},
+		{Key: "SPACED", Value: "padded value", Line: 3},
+		{Key: "EXPORTED", Value: "yes", Line: 4},
+		{Key: "TABBED", Value: "yes", Line: 5},
+		{Key: "exporter", Value: "not a prefix", Line: 6},
+		{Key: "DOUBLE", Value: "a \"quoted\" line\nnext\tcol \\ \\$HOME", Line: 7},
+		{Key: "SINGLE", Value: "no \\n escapes # here", Line: 8},
+		{Key: "INLINE", Value: "value", Line: 9},
+		{Key: "HASH", Value: "a#b", Line: 10},
+		{Key: "EMPTY", Value: "", Line: 11},
+		{Key: "EMPTY_COMMENT", Value: "", Line: 12},
+		{Key: "UNCLOSED", Value: "\"open", Line: 13},
+		{Key: "URL", Value: "postgres://u:p@h/db?sslmode=disable", Line: 14},
+		{Key: "CRLF", Value: "windows", Line: 17},
+		{Key: "QUOTED_CRLF", Value: "windows", Line: 18},
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("Parse =\n%+v\nwant\n%+v", vars, want)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tree makes outer/.git with a .env, an inner repository outer/inner/.git,
+// and .env files at inner, inner/a and inner/a/b; it returns outer and
+// inner/a/b/c, where the searches start.
+func tree(t *testing.T) (outer, deep string) {
+	t.Helper()
+	outer = t.TempDir()
+	inner := filepath.Join(outer, "inner")
+	deep = filepath.Join(inner, "a", "b", "c")
+	for _, d := range []string{filepath.Join(outer, ".git"), filepath.Join(inner, ".git"), deep} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(outer, ".env"), "DOTENV_TEST_OUTER=1\n")
+	writeFile(t, filepath.Join(inner, ".env"), "DOTENV_TEST_A=root\nDOTENV_TEST_ROOT=root\nDOTENV_TEST_CONFIG=conf/config.ini\n")
+	writeFile(t, filepath.Join(inner, "a", ".env"), "DOTENV_TEST_A=a\n")
+	writeFile(t, filepath.Join(inner, "a", "b", ".env"), "DOTENV_TEST_B=first\nDOTENV_TEST_B=last\n")
+	return outer, deep
+}
+
+func TestFind(t *testing.T) {
+	outer, deep := tree(t)
+	inner := filepath.Join(outer, "inner")
+	for _, c := range []struct {
+		maxDepth int
+		want     []string
+	}{
+		{-1, []string{filepath.Join(inner, "a", "b", ".env"), filepath.Join(inner, "a", ".env"), filepath.Join(inner, ".env")}},
+		{1, []string{filepath.Join(inner, "a", "b", ".env")}},
+		{0, nil},
+	} {
+		got, err := Find(Options{Dir: deep, MaxDepth: c.maxDepth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("MaxDepth %d: Find = %q, want %q (the inner repository's root ends the search)", c.maxDepth, got, c.want)
+		}
+	}
+}
+
+func TestLoadNearest(t *testing.T) {
+	outer, deep := tree(t)
+	inner := filepath.Join(outer, "inner")
+	t.Setenv("DOTENV_TEST_ROOT", "from env")
+
+	got := map[string]Var{}
+	var logged strings.Builder
+	err := LoadNearest(Options{
+		Dir:          deep,
+		MaxDepth:     -1,
+		ResolvePaths: []string{"DOTENV_TEST_CONFIG"},
+		Set:          func(v Var) { got[v.Key] = v },
+		Logf:         func(format string, args ...any) { fmt.Fprintf(&logged, format, args...) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Var{
+		"DOTENV_TEST_A":      {Key: "DOTENV_TEST_A", Value: "a", File: filepath.Join(inner, "a", ".env"), Line: 1},
+		"DOTENV_TEST_B":      {Key: "DOTENV_TEST_B", Value: "last", File: filepath.Join(inner, "a", "b", ".env"), Line: 2},
+		"DOTENV_TEST_CONFIG": {Key: "DOTENV_TEST_CONFIG", Value: filepath.Join(inner, "conf", "config.ini"), File: filepath.Join(inner, ".env"), Line: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("set\n%+v\nwant\n%+v", got, want)
+	}
+	for _, msg := range []string{"skipping DOTENV_TEST_ROOT", "DOTENV_TEST_A from " + filepath.Join(inner, ".env") + " overridden"} {
+		if !strings.Contains(logged.String(), msg) {
+			t.Errorf("log lacks %q:\n%s", msg, logged.String())
+		}
+	}
+
+	got = map[string]Var{}
+	if err := LoadNearest(Options{Dir: deep, MaxDepth: -1, Override: true, Set: func(v Var) { got[v.Key] = v }}); err != nil {
+		t.Fatal(err)
+	}
+	if v := got["DOTENV_TEST_ROOT"].Value; v != "root" {
+		t.Errorf("with Override, DOTENV_TEST_ROOT = %q, want the .env value", v)
+	}
+}
+
+func TestLoadNearestSetenv(t *testing.T) {
+	_, deep := tree(t)
+	for _, k := range []string{"DOTENV_TEST_A", "DOTENV_TEST_B", "DOTENV_TEST_ROOT", "DOTENV_TEST_CONFIG"} {
+		t.Setenv(k, "")
+		os.Unsetenv(k)
+	}
+	if err := LoadNearest(Options{Dir: deep, MaxDepth: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := os.Getenv("DOTENV_TEST_A"), os.Getenv("DOTENV_TEST_B"); a != "a" || b != "last" {
+		t.Errorf("DOTENV_TEST_A, DOTENV_TEST_B = %q, %q; want a, last", a, b)
+	}
+}
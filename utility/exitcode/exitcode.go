@@ -0,0 +1,133 @@
+// Package exitcode is the exit status convention the tools share:
+//
+//	0  OK            success
+//	1  RuntimeError  the work failed: database, network, API or file errors
+//	2  ConfigError   bad flags or arguments, or missing or invalid configuration
+//	3  NoChange      nothing to do, or a check found differences (Drift)
+//	4  Timeout       a deadline passed before the work was done
+//
+// Code that knows what kind of failure it has wraps the error with Wrap or
+// Configf; callers keep wrapping with %w, and Of finds the class at the top.
+// Errors that wrap context.DeadlineExceeded, or report Timeout() true as
+// net.Error does, are timeouts without further marking. Anything else is a
+// RuntimeError.
+//
+// A tool may give codes above 4 a meaning of its own, as dbtool's query
+// and seed do for SQL errors (see its help).
+package exitcode
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	OK           = 0
+	RuntimeError = 1
+	ConfigError  = 2
+	NoChange     = 3
+	Timeout      = 4
+
+	// Drift is NoChange as a check's result: what was compared differs.
+	Drift = NoChange
+)
+
+// Error is an error with the exit status it should end the program with.
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Wrap marks err with code; its message is unchanged. A nil err stays nil.
+func Wrap(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Configf is fmt.Errorf marked as a ConfigError.
+func Configf(format string, args ...any) error {
+	return Wrap(ConfigError, fmt.Errorf(format, args...))
+}
+
+// Of is the exit status for err: OK for nil, the Code of the first *Error
+// in its chain, Timeout for deadline errors, otherwise RuntimeError.
+func Of(err error) int {
+	if err == nil {
+		return OK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if IsTimeout(err) {
+		return Timeout
+	}
+	return RuntimeError
+}
+
+// IsTimeout reports whether err is a deadline passing: context's, or an
+// I/O timeout from the net and os packages.
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var t interface{ Timeout() bool }
+	return errors.As(err, &t) && t.Timeout()
+}
+
+// Doc is one line of the exit code section of a tool's help.
+type Doc struct {
+	Code    int
+	Meaning string
+}
+
+// Standard is what the shared codes mean in every tool's help. NoChange is
+// not among them: only some tools return it, and they say when.
+var Standard = []Doc{
+	{OK, "success"},
+	{RuntimeError, "the work failed (database, network, API or file error)"},
+	{ConfigError, "bad flags or arguments, or missing or invalid configuration"},
+	{Timeout, "timed out"},
+}
+
+// Write prints the "Exit codes:" section of a tool's help: Standard, with
+// docs added or, for the same code, replacing the standard line.
+func Write(w io.Writer, docs ...Doc) {
+	byCode := map[int]string{}
+	for _, d := range Standard {
+		byCode[d.Code] = d.Meaning
+	}
+	for _, d := range docs {
+		byCode[d.Code] = d.Meaning
+	}
+	codes := make([]int, 0, len(byCode))
+	for c := range byCode {
+		codes = append(codes, c)
+	}
+	sort.Ints(codes)
+	fmt.Fprintln(w, "\nExit codes:")
+	for _, c := range codes {
+		fmt.Fprintf(w, "  %3d  %s\n", c, byCode[c])
+	}
+}
+
+// SetUsage makes fs's usage (-h) the flag defaults followed by Write's
+// exit code section.
+func SetUsage(fs *flag.FlagSet, docs ...Doc) {
+	fs.Usage = func() {
+		w := fs.Output()
+		fmt.Fprintf(w, "Usage of %s:\n", fs.Name())
+		fs.PrintDefaults()
+		Write(w, docs...)
+	}
+}
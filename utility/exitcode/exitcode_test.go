@@ -0,0 +1,75 @@
+package exitcode
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestOf(t *testing.T) {
+	boom := errors.New("boom")
+	netTimeout := &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}
+	for _, c := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, OK},
+		{"plain", boom, RuntimeError},
+		{"configf", Configf("no [%s] section", "staging"), ConfigError},
+		{"wrapped config", fmt.Errorf("db: %w", Configf("bad DSN")), ConfigError},
+		{"drift", Wrap(Drift, boom), NoChange},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), Timeout},
+		{"net timeout", fmt.Errorf("fetch: %w", netTimeout), Timeout},
+		{"canceled", context.Canceled, RuntimeError},
+		// The outermost mark wins over what it wraps.
+		{"marked timeout", Wrap(RuntimeError, context.DeadlineExceeded), RuntimeError},
+		{"timeout of config", Wrap(Timeout, Configf("bad DSN")), Timeout},
+	} {
+		if got := Of(c.err); got != c.want {
+			t.Errorf("%s: Of = %d, want %d", c.name, got, c.want)
+		}
+	}
+	if Wrap(ConfigError, nil) != nil {
+		t.Error("Wrap(code, nil) must be nil")
+	}
+	if err := Configf("bad %w", boom); !errors.Is(err, boom) || err.Error() != "bad boom" {
+		t.Errorf("Configf = %q, want it to wrap boom unchanged", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var b strings.Builder
+	Write(&b, Doc{Drift, "the files differ"}, Doc{Timeout, "wait timed out"})
+	want := `
+Exit codes:
+    0  success
+    1  the work failed (database, network, API or file error)
+    2  bad flags or arguments, or missing or invalid configuration
+    3  the files differ
+    4  wait timed out
+`
+	if b.String() != want {
+		t.Errorf("Write:\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestSetUsage(t *testing.T) {
+	var b strings.Builder
+	fs := flag.NewFlagSet("tool", flag.ContinueOnError)
+	fs.SetOutput(&b)
+	fs.Bool("check", false, "compare only")
+	SetUsage(fs)
+	if err := fs.Parse([]string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("Parse(-h) = %v", err)
+	}
+	for _, s := range []string{"Usage of tool:", "-check", "Exit codes:", "  2  bad flags"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("usage lacks %q:\n%s", s, b.String())
+		}
+	}
+}
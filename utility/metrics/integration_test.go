@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"cli-things/internal/testdb"
+	"cli-things/utility/dbconf"
+)
+
+// The tests in this file run against a real server from internal/testdb
+// and skip when there is none.
+
+func TestMain(m *testing.M) { os.Exit(testdb.Run(m)) }
+
+func TestStoreIntegration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	name, dsn := testdb.New(t)
+	testdb.Use(t, dsn, dbconf.Reload)
+	if err := dbconf.ApplyMigrationsFromDir(ctx, name, "../../migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, advance := fakeClock("xata2pg")
+	r.Time("schema", func() error { advance(2 * time.Second); return nil })
+	r.Add("tables", 7)
+	// Twice: rows of each run are added to the table.
+	for i := 0; i < 2; i++ {
+		if err := Store(ctx, dsn, r.Snapshot()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := dbconf.ConnectDSNContext(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var timers, counters int
+	var seconds, tables float64
+	err = db.QueryRowContext(ctx, `SELECT
+		count(*) FILTER (WHERE kind = 'timer'), count(*) FILTER (WHERE kind = 'counter'),
+		max(value) FILTER (WHERE name = 'schema'), max(value) FILTER (WHERE name = 'tables')
+		FROM public.tool_metrics WHERE tool = 'xata2pg'`).Scan(&timers, &counters, &seconds, &tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timers != 2 || counters != 2 || seconds != 2 || tables != 7 {
+		t.Errorf("rows: %d timer(s), %d counter(s), schema=%v tables=%v; want 2, 2, 2, 7", timers, counters, seconds, tables)
+	}
+}
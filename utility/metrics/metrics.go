@@ -0,0 +1,288 @@
+// Package metrics records how long the steps of a long-running tool take
+// and how much they did, and reports it when the tool is done: a summary
+// line on stderr, and with the flags Output.AddFlags registers, a file
+// (-metrics-file, JSON unless -metrics-format says otherwise) and rows in a
+// Postgres table (-metrics-db).
+//
+// Timers and counters are named by the tool, e.g. "schema" or "tables".
+// Names with a '/' ("zone/example.com") are details: they go to the file and
+// the table but are left out of the summary line.
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cli-things/utility/atomicfile"
+	"cli-things/utility/dbconf"
+)
+
+// Recorder collects the timers and counters of one run. It is safe for
+// concurrent use.
+type Recorder struct {
+	mu       sync.Mutex
+	tool     string
+	started  time.Time
+	now      func() time.Time
+	timers   []TimerValue
+	counters []CounterValue
+	index    map[string]int // "t:" or "c:" + name -> position
+}
+
+// New starts recording a run of tool.
+func New(tool string) *Recorder {
+	r := &Recorder{tool: tool, now: time.Now, index: map[string]int{}}
+	r.started = r.now()
+	return r
+}
+
+// Start starts timing a step and returns the function that ends it. Calling
+// that function again does nothing, so it can be both called and deferred.
+func (r *Recorder) Start(name string) (stop func()) {
+	start := r.now()
+	var once sync.Once
+	return func() {
+		once.Do(func() { r.AddTime(name, r.now().Sub(start)) })
+	}
+}
+
+// Time runs fn as the step name and returns its error.
+func (r *Recorder) Time(name string, fn func() error) error {
+	defer r.Start(name)()
+	return fn()
+}
+
+// AddTime adds d as one run of the step name, for steps timed by someone
+// else, such as dbtool's per-database dump results.
+func (r *Recorder) AddTime(name string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, ok := r.index["t:"+name]
+	if !ok {
+		i = len(r.timers)
+		r.index["t:"+name] = i
+		r.timers = append(r.timers, TimerValue{Name: name})
+	}
+	r.timers[i].Count++
+	r.timers[i].Seconds += d.Seconds()
+}
+
+// Add adds n to the counter name.
+func (r *Recorder) Add(name string, n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, ok := r.index["c:"+name]
+	if !ok {
+		i = len(r.counters)
+		r.index["c:"+name] = i
+		r.counters = append(r.counters, CounterValue{Name: name})
+	}
+	r.counters[i].Value += n
+}
+
+// TimerValue is a step's total time over Count runs of it.
+type TimerValue struct {
+	Name    string  `json:"name"`
+	Count   int     `json:"count"`
+	Seconds float64 `json:"seconds"`
+}
+
+// CounterValue is a counter's total.
+type CounterValue struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+// Snapshot is what a Recorder holds at one moment; it is also the JSON
+// that -metrics-file gets.
+type Snapshot struct {
+	Tool     string         `json:"tool"`
+	Host     string         `json:"host"`
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Seconds  float64        `json:"seconds"`
+	Timers   []TimerValue   `json:"timers"`
+	Counters []CounterValue `json:"counters"`
+}
+
+// Snapshot returns the run so far, timers and counters in the order they
+// were first recorded.
+func (r *Recorder) Snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	host, _ := os.Hostname()
+	finished := r.now()
+	return Snapshot{
+		Tool:     r.tool,
+		Host:     host,
+		Started:  r.started,
+		Finished: finished,
+		Seconds:  finished.Sub(r.started).Seconds(),
+		Timers:   append([]TimerValue{}, r.timers...),
+		Counters: append([]CounterValue{}, r.counters...),
+	}
+}
+
+// Empty reports whether nothing has been recorded.
+func (r *Recorder) Empty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.timers) == 0 && len(r.counters) == 0
+}
+
+// JSON is the -metrics-format Flush writes itself.
+const JSON = "json"
+
+// Output is where Flush reports a run.
+type Output struct {
+	// File receives the Snapshot as JSON, replaced atomically, when Format
+	// is JSON or empty. A tool that offers another format writes File
+	// itself when that format is chosen.
+	File   string
+	Format string
+	// DB is a database name resolved through dbconf, or a DSN, whose
+	// public.tool_metrics table gets one row per timer and counter.
+	DB string
+	// Log prints the summary line; nil prints it on stderr after the tool
+	// name. Tools that log through utility/clog pass their Infof.
+	Log func(format string, args ...any)
+}
+
+// AddFlags registers -metrics-file, -metrics-format and -metrics-db on fs,
+// the same three flags in every tool. -metrics-format accepts JSON and the
+// formats given, which the tool writes itself; its default is o.Format when
+// set, otherwise JSON.
+func (o *Output) AddFlags(fs *flag.FlagSet, formats ...string) {
+	if o.Format == "" {
+		o.Format = JSON
+	}
+	formats = append([]string{JSON}, formats...)
+	fs.StringVar(&o.File, "metrics-file", o.File, "write step timings and counters to this file when done (see -metrics-format)")
+	fs.Func("metrics-format", fmt.Sprintf("format of -metrics-file: %s (default %s)", strings.Join(formats, " or "), o.Format), func(v string) error {
+		for _, f := range formats {
+			if v == f {
+				o.Format = v
+				return nil
+			}
+		}
+		return fmt.Errorf("must be %s", strings.Join(formats, " or "))
+	})
+	fs.StringVar(&o.DB, "metrics-db", o.DB, "also store them in public.tool_metrics of this database (name via dbconf, or a DSN)")
+}
+
+// Flush reports r to o: the summary line always, the JSON file and the table
+// when o names them. A run that recorded nothing is not reported.
+func (r *Recorder) Flush(ctx context.Context, o Output) error {
+	if r.Empty() {
+		return nil
+	}
+	s := r.Snapshot()
+	if o.Log != nil {
+		o.Log("%s", Summary(s))
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", s.Tool, Summary(s))
+	}
+	var errs []error
+	if o.File != "" && (o.Format == "" || o.Format == JSON) {
+		if err := WriteFile(o.File, s); err != nil {
+			errs = append(errs, fmt.Errorf("metrics file: %w", err))
+		}
+	}
+	if o.DB != "" {
+		if err := Store(ctx, o.DB, s); err != nil {
+			errs = append(errs, fmt.Errorf("metrics db: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Summary is the one-line report of s, e.g.
+//
+//	metrics: 2m3.4s total; schema 1.2s, copy 1m58s (12x); tables=12
+func Summary(s Snapshot) string {
+	var timers, counters []string
+	for _, t := range s.Timers {
+		if strings.Contains(t.Name, "/") {
+			continue
+		}
+		v := t.Name + " " + seconds(t.Seconds).String()
+		if t.Count > 1 {
+			v += fmt.Sprintf(" (%dx)", t.Count)
+		}
+		timers = append(timers, v)
+	}
+	for _, c := range s.Counters {
+		if !strings.Contains(c.Name, "/") {
+			counters = append(counters, fmt.Sprintf("%s=%d", c.Name, c.Value))
+		}
+	}
+	out := "metrics: " + seconds(s.Seconds).String() + " total"
+	for _, part := range []string{strings.Join(timers, ", "), strings.Join(counters, ", ")} {
+		if part != "" {
+			out += "; " + part
+		}
+	}
+	return out
+}
+
+// seconds is s as a Duration rounded for people: milliseconds under a
+// minute, tenths of a second above.
+func seconds(s float64) time.Duration {
+	d := time.Duration(s * float64(time.Second))
+	if d < time.Minute {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(100 * time.Millisecond)
+}
+
+// WriteFile writes s to path as indented JSON, atomically (see atomicfile),
+// so a reader never sees half of it.
+func WriteFile(path string, s Snapshot) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Store inserts s into public.tool_metrics of target, a database name
+// resolved through dbconf or a DSN, in one transaction: a timer's value is
+// its seconds and count its number of runs, a counter's value its total.
+// The configured migrations are applied first, as the tools that store
+// their results do; migration 20261016_0009_tool_metrics.sql creates the
+// table.
+func Store(ctx context.Context, target string, s Snapshot) error {
+	db, err := dbconf.ConnectTargetContext(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := dbconf.ApplyConfiguredMigrationsDB(ctx, db); err != nil {
+		return fmt.Errorf("apply migrations: %w", err)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	const insert = `INSERT INTO public.tool_metrics (tool, host, run_started_at, run_seconds, kind, name, value, count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	for _, t := range s.Timers {
+		if _, err := tx.ExecContext(ctx, insert, s.Tool, s.Host, s.Started, s.Seconds, "timer", t.Name, t.Seconds, t.Count); err != nil {
+			return err
+		}
+	}
+	for _, c := range s.Counters {
+		if _, err := tx.ExecContext(ctx, insert, s.Tool, s.Host, s.Started, s.Seconds, "counter", c.Name, float64(c.Value), nil); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
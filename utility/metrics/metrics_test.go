@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClock returns a Recorder whose clock moves only when advance is called.
+func fakeClock(tool string) (*Recorder, func(time.Duration)) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	r := New(tool)
+	r.now = func() time.Time { return now }
+	r.started = now
+	return r, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestRecorder(t *testing.T) {
+	r, advance := fakeClock("xata2pg")
+	if !r.Empty() {
+		t.Error("new Recorder is not empty")
+	}
+	stop := r.Start("schema")
+	advance(1200 * time.Millisecond)
+	stop()
+	stop() // a second call does nothing
+	for i := 0; i < 2; i++ {
+		r.Time("copy", func() error { advance(30 * time.Second); return nil })
+	}
+	boom := errors.New("boom")
+	if err := r.Time("copy/public.users", func() error { advance(time.Second); return boom }); err != boom {
+		t.Errorf("Time returned %v, want fn's error", err)
+	}
+	r.Add("tables", 2)
+	r.Add("tables", 1)
+
+	s := r.Snapshot()
+	wantTimers := []TimerValue{{"schema", 1, 1.2}, {"copy", 2, 60}, {"copy/public.users", 1, 1}}
+	if !reflect.DeepEqual(s.Timers, wantTimers) {
+		t.Errorf("timers = %+v, want %+v", s.Timers, wantTimers)
+	}
+	if want := []CounterValue{{"tables", 3}}; !reflect.DeepEqual(s.Counters, want) {
+		t.Errorf("counters = %+v, want %+v", s.Counters, want)
+	}
+	if s.Seconds != 62.2 {
+		t.Errorf("run seconds = %v, want 62.2", s.Seconds)
+	}
+	if got, want := Summary(s), "metrics: 1m2.2s total; schema 1.2s, copy 1m0s (2x); tables=3"; got != want {
+		t.Errorf("Summary = %q, want %q", got, want)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	r, advance := fakeClock("dbtool")
+	var logged []string
+	out := Output{File: filepath.Join(t.TempDir(), "metrics.json"), Log: func(format string, args ...any) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}}
+	if err := r.Flush(context.Background(), out); err != nil || logged != nil {
+		t.Fatalf("empty run: err %v, logged %q", err, logged)
+	}
+	if _, err := os.Stat(out.File); !os.IsNotExist(err) {
+		t.Error("empty run wrote the metrics file")
+	}
+
+	r.Time("dump", func() error { advance(3 * time.Second); return nil })
+	r.Add("dump.bytes", 1024)
+	if err := r.Flush(context.Background(), out); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"metrics: 3s total; dump 3s; dump.bytes=1024"}; !reflect.DeepEqual(logged, want) {
+		t.Errorf("logged %q, want %q", logged, want)
+	}
+	b, err := os.ReadFile(out.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s Snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Tool != "dbtool" || s.Seconds != 3 || len(s.Timers) != 1 || s.Counters[0] != (CounterValue{"dump.bytes", 1024}) {
+		t.Errorf("metrics file = %s", b)
+	}
+}
+
+func TestAddFlags(t *testing.T) {
+	var o Output
+	fs := flag.NewFlagSet("tool", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	o.AddFlags(fs)
+	if err := fs.Parse([]string{"-metrics-file", "m.json", "-metrics-db", "ops"}); err != nil {
+		t.Fatal(err)
+	}
+	if o.File != "m.json" || o.Format != JSON || o.DB != "ops" {
+		t.Errorf("Output = %+v", o)
+	}
+	if err := fs.Parse([]string{"-metrics-format", "prometheus"}); err == nil {
+		t.Error("-metrics-format accepted a format the tool does not offer")
+	}
+
+	// cloudflare-backup keeps its Prometheus textfile as the default.
+	o = Output{Format: "prometheus"}
+	fs = flag.NewFlagSet("cloudflare-backup", flag.ContinueOnError)
+	o.AddFlags(fs, "prometheus")
+	if err := fs.Parse([]string{"-metrics-file", "cf.prom"}); err != nil {
+		t.Fatal(err)
+	}
+	if o.File != "cf.prom" || o.Format != "prometheus" {
+		t.Errorf("Output = %+v", o)
+	}
+	if err := fs.Parse([]string{"-metrics-format=json"}); err != nil || o.Format != JSON {
+		t.Errorf("-metrics-format=json: %v, Output = %+v", err, o)
+	}
+}
+
+func TestFlushOtherFormat(t *testing.T) {
+	r, _ := fakeClock("cloudflare-backup")
+	r.Add("zones", 1)
+	out := Output{File: filepath.Join(t.TempDir(), "cf.prom"), Format: "prometheus", Log: func(string, ...any) {}}
+	if err := r.Flush(context.Background(), out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(out.File); !os.IsNotExist(err) {
+		t.Error("Flush wrote JSON over a file in the tool's own format")
+	}
+}
@@ -0,0 +1,167 @@
+// Package retry runs an operation again after transient failures, waiting
+// an exponentially growing, jittered backoff between attempts. It is shared
+// by the tools' HTTP clients and database code so they back off alike.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy says how often and how patiently Do retries.
+type Policy struct {
+	// MaxAttempts counts the first attempt; 1 or less does not retry.
+	MaxAttempts int
+	// Backoff is the wait before the first retry; it doubles on each
+	// further retry, up to MaxBackoff when that is set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter is the largest fraction of the wait added at random, so that
+	// several processes do not retry in lockstep.
+	Jitter float64
+	// MaxRetryAfter caps the wait a Retry-After hint may ask for (no cap
+	// when 0), so a misbehaving server cannot park the caller for hours.
+	MaxRetryAfter time.Duration
+	// IsRetryable says whether a failure is worth another attempt
+	// (DefaultRetryable when nil).
+	IsRetryable func(err error) bool
+	// OnRetry, when set, is called before each wait, with the number of
+	// the attempt that failed.
+	OnRetry func(attempt int, err error, wait time.Duration)
+	// Clock waits between attempts (the real clock when nil); tests pass
+	// a fake one so no time passes.
+	Clock Clock
+}
+
+// Clock is the time source of Do.
+type Clock interface {
+	Now() time.Time
+	// Sleep waits d, or returns ctx.Err() once ctx is done.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// RealClock is the wall clock.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Do calls fn until it succeeds, fails with an error p does not retry, or
+// has been called p.MaxAttempts times, and returns fn's last error. Between
+// attempts it waits p's backoff, or the Retry-After hint the error carries
+// (see WithRetryAfter). Cancelling ctx stops the wait and returns ctx.Err().
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error) error {
+	isRetryable := p.IsRetryable
+	if isRetryable == nil {
+		isRetryable = DefaultRetryable
+	}
+	clock := p.Clock
+	if clock == nil {
+		clock = RealClock
+	}
+	for n := 1; ; n++ {
+		err := fn(ctx)
+		if err == nil || n >= p.MaxAttempts || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+		wait := p.Wait(n)
+		if d, ok := RetryAfter(err); ok {
+			wait = d
+			if p.MaxRetryAfter > 0 && wait > p.MaxRetryAfter {
+				wait = p.MaxRetryAfter
+			}
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(n, err, wait)
+		}
+		if err := clock.Sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// Wait returns the backoff before retry number n (1-based), jitter
+// included.
+func (p Policy) Wait(n int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < n && d > 0 && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 && d > 0 {
+		d += time.Duration(rand.Int63n(int64(float64(d)*p.Jitter) + 1))
+	}
+	return d
+}
+
+// DefaultRetryable retries every error but a cancelled or expired context.
+func DefaultRetryable(err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryAfterError is an error with the wait its source asked for.
+type retryAfterError struct {
+	err  error
+	wait time.Duration
+}
+
+func (e *retryAfterError) Error() string             { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error             { return e.err }
+func (e *retryAfterError) RetryAfter() time.Duration { return e.wait }
+
+// WithRetryAfter returns err carrying a hint, such as a Retry-After header,
+// that the next attempt should wait d rather than the backoff. The message
+// and errors.Is/As see err unchanged.
+func WithRetryAfter(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err: err, wait: d}
+}
+
+// RetryAfter returns the hint of an error made by WithRetryAfter, or of
+// any error in the chain with a RetryAfter() time.Duration method.
+func RetryAfter(err error) (time.Duration, bool) {
+	var h interface{ RetryAfter() time.Duration }
+	if errors.As(err, &h) {
+		return h.RetryAfter(), true
+	}
+	return 0, false
+}
+
+// ParseRetryAfter parses a Retry-After header, in seconds or as an HTTP
+// date relative to now. A date in the past is no wait.
+func ParseRetryAfter(h string, now time.Time) (time.Duration, bool) {
+	h = strings.TrimSpace(h)
+	if h == "" {
+		return 0, false
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(h); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(h); err == nil {
+		d = t.Sub(now)
+	} else {
+		return 0, false
+	}
+	return max(d, 0), true
+}
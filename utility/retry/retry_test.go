@@ -0,0 +1,210 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeClock records the waits asked of it and moves its time on by them
+// without sleeping.
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+	// cancel, when set, is called on the given wait (1-based).
+	cancelOn int
+	cancel   func()
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.waits = append(c.waits, d)
+	if len(c.waits) == c.cancelOn {
+		c.cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.now = c.now.Add(d)
+	return nil
+}
+
+// failing returns an fn that fails with errs in turn, then succeeds, and
+// a pointer to its call count.
+func failing(errs ...error) (func(context.Context) error, *int) {
+	calls := 0
+	return func(context.Context) error {
+		calls++
+		if calls <= len(errs) {
+			return errs[calls-1]
+		}
+		return nil
+	}, &calls
+}
+
+var errTransient = errors.New("connection reset")
+
+func TestDoBacksOffExponentially(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	fn, calls := failing(errTransient, errTransient, errTransient)
+	p := Policy{MaxAttempts: 5, Backoff: 100 * time.Millisecond, Clock: clock}
+	if err := Do(context.Background(), p, fn); err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}
+	if *calls != 4 || fmt.Sprint(clock.waits) != fmt.Sprint(want) {
+		t.Errorf("%d calls, waits %v, want 4 calls and waits %v", *calls, clock.waits, want)
+	}
+	if elapsed := clock.Now().Sub(start); elapsed != 700*time.Millisecond {
+		t.Errorf("elapsed %v, want 700ms", elapsed)
+	}
+}
+
+func TestDoGivesUp(t *testing.T) {
+	clock := newFakeClock()
+	last := errors.New("still down")
+	fn, calls := failing(errTransient, errTransient, last, errTransient)
+	err := Do(context.Background(), Policy{MaxAttempts: 3, Backoff: time.Second, Clock: clock}, fn)
+	if err != last || *calls != 3 || len(clock.waits) != 2 {
+		t.Errorf("err %v after %d calls and waits %v, want the third error, no wait after it", err, *calls, clock.waits)
+	}
+}
+
+func TestDoSingleAttempt(t *testing.T) {
+	for _, attempts := range []int{0, 1} {
+		clock := newFakeClock()
+		fn, calls := failing(errTransient)
+		if err := Do(context.Background(), Policy{MaxAttempts: attempts, Clock: clock}, fn); err != errTransient || *calls != 1 || len(clock.waits) != 0 {
+			t.Errorf("MaxAttempts %d: err %v, %d calls, waits %v", attempts, err, *calls, clock.waits)
+		}
+	}
+}
+
+func TestDoMaxBackoff(t *testing.T) {
+	clock := newFakeClock()
+	fn, _ := failing(errTransient, errTransient, errTransient, errTransient, errTransient)
+	p := Policy{MaxAttempts: 6, Backoff: time.Second, MaxBackoff: 5 * time.Second, Clock: clock}
+	if err := Do(context.Background(), p, fn); err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	if fmt.Sprint(clock.waits) != fmt.Sprint(want) {
+		t.Errorf("waits %v, want %v", clock.waits, want)
+	}
+}
+
+func TestDoIsRetryable(t *testing.T) {
+	permanent := errors.New("401 unauthorized")
+	clock := newFakeClock()
+	fn, calls := failing(errTransient, permanent)
+	p := Policy{MaxAttempts: 5, Backoff: time.Second, Clock: clock,
+		IsRetryable: func(err error) bool { return err != permanent }}
+	if err := Do(context.Background(), p, fn); err != permanent || *calls != 2 {
+		t.Errorf("err %v after %d calls, want the permanent error on the second", err, *calls)
+	}
+
+	// By default, a context error is final.
+	fn, calls = failing(fmt.Errorf("dial: %w", context.DeadlineExceeded))
+	if err := Do(context.Background(), Policy{MaxAttempts: 3, Clock: newFakeClock()}, fn); *calls != 1 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err %v after %d calls", err, *calls)
+	}
+}
+
+func TestDoRetryAfterHint(t *testing.T) {
+	clock := newFakeClock()
+	fn, _ := failing(WithRetryAfter(errTransient, 7*time.Second), errTransient, WithRetryAfter(errTransient, time.Hour))
+	var retries []string
+	p := Policy{MaxAttempts: 4, Backoff: time.Second, MaxRetryAfter: time.Minute, Clock: clock,
+		OnRetry: func(n int, err error, wait time.Duration) {
+			retries = append(retries, fmt.Sprintf("%d:%v:%v", n, err, wait))
+		}}
+	if err := Do(context.Background(), p, fn); err != nil {
+		t.Fatal(err)
+	}
+	// The hint replaces the backoff for its wait only, within MaxRetryAfter.
+	want := []time.Duration{7 * time.Second, 2 * time.Second, time.Minute}
+	if fmt.Sprint(clock.waits) != fmt.Sprint(want) {
+		t.Errorf("waits %v, want %v", clock.waits, want)
+	}
+	if fmt.Sprint(retries) != "[1:connection reset:7s 2:connection reset:2s 3:connection reset:1m0s]" {
+		t.Errorf("OnRetry calls = %v", retries)
+	}
+}
+
+func TestDoCancelledDuringWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := newFakeClock()
+	clock.cancelOn, clock.cancel = 2, cancel
+	fn, calls := failing(errTransient, errTransient, errTransient)
+	err := Do(ctx, Policy{MaxAttempts: 5, Backoff: time.Second, Clock: clock}, fn)
+	if !errors.Is(err, context.Canceled) || *calls != 2 {
+		t.Errorf("err %v after %d calls, want context.Canceled after 2", err, *calls)
+	}
+}
+
+func TestWaitJitter(t *testing.T) {
+	p := Policy{Backoff: time.Second, MaxBackoff: 30 * time.Second, Jitter: 0.5}
+	for n, base := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 30 * time.Second} {
+		seen := map[time.Duration]bool{}
+		for i := 0; i < 50; i++ {
+			d := p.Wait(n)
+			if d < base || d > base+base/2 {
+				t.Fatalf("Wait(%d) = %v, want within [%v, %v]", n, d, base, base+base/2)
+			}
+			seen[d] = true
+		}
+		if len(seen) < 2 {
+			t.Errorf("Wait(%d) always %v: no jitter", n, base)
+		}
+	}
+	if d := (Policy{}).Wait(3); d != 0 {
+		t.Errorf("zero policy waits %v", d)
+	}
+}
+
+func TestRetryAfterHint(t *testing.T) {
+	err := fmt.Errorf("fetching zones: %w", WithRetryAfter(errTransient, 3*time.Second))
+	if d, ok := RetryAfter(err); !ok || d != 3*time.Second {
+		t.Errorf("RetryAfter = %v, %v", d, ok)
+	}
+	if !errors.Is(err, errTransient) || err.Error() != "fetching zones: connection reset" {
+		t.Errorf("wrapped error = %v", err)
+	}
+	if _, ok := RetryAfter(errTransient); ok {
+		t.Error("plain error has a hint")
+	}
+	if WithRetryAfter(nil, time.Second) != nil {
+		t.Error("WithRetryAfter(nil) is not nil")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for h, want := range map[string]time.Duration{
+		"3":                             3 * time.Second,
+		" 120 ":                         2 * time.Minute,
+		"0":                             0,
+		"-1":                            0,
+		"Mon, 01 Jan 2024 12:00:10 GMT": 10 * time.Second,
+		"Mon, 01 Jan 2024 11:00:00 GMT": 0,
+	} {
+		got, ok := ParseRetryAfter(h, now)
+		if !ok || got != want {
+			t.Errorf("ParseRetryAfter(%q) = %v, %v, want %v", h, got, ok, want)
+		}
+	}
+	for _, h := range []string{"", "soon", "1.5"} {
+		if _, ok := ParseRetryAfter(h, now); ok {
+			t.Errorf("ParseRetryAfter(%q) accepted", h)
+		}
+	}
+}